@@ -55,13 +55,15 @@ func (obj *CheckArgs) Run(ctx context.Context, data *cliUtil.Data) (bool, error)
 		// Run the 'run lang' command, but stop after all of the checks.
 		la := &cliUtil.LangArgs{
 			Input:              cmd.Input,
-			Download:           cmd.Download,
+			Download:           cmd.Download || cmd.UpdateLock,
 			Update:             cmd.Update,
+			UpdateLock:         cmd.UpdateLock,
 			UnifySolver:        cmd.UnifySolver,
 			UnifyOptimizations: cmd.UnifyOptimizations,
 			CheckOnly:          true,
 			CheckFmt:           !cmd.SkipFmt,
 			CheckUnify:         !cmd.SkipUnify,
+			CheckLint:          cmd.Lint,
 			Depth:              cmd.Depth,
 			Retry:              cmd.Retry,
 			ModulePath:         cmd.ModulePath,
@@ -85,6 +87,10 @@ type CheckLangArgs struct {
 	Download bool `arg:"--download" help:"download any missing imports"`
 	Update   bool `arg:"--update" help:"update all dependencies to the latest versions"`
 
+	// UpdateLock resolves every import again, including the ones that are
+	// already pinned, and rewrites the lockfile with the results.
+	UpdateLock bool `arg:"--update-lock" help:"resolve all imports again and rewrite the lockfile"`
+
 	// SkipUnify specifies that the mcl unification check should be skipped.
 	// It is used by the check command, which enables that check by default.
 	SkipUnify bool `arg:"--skip-unify" help:"skip the mcl type unification"`
@@ -96,6 +102,10 @@ type CheckLangArgs struct {
 	// used by the check command, which enables that check by default.
 	SkipFmt bool `arg:"--skip-fmt" help:"skip the mcl format check"`
 
+	// Lint specifies that the mcl code should also be checked for common
+	// mistakes. Each rule can be suppressed with a `# lint:ignore` comment.
+	Lint bool `arg:"--lint" help:"check the mcl code for common mistakes"`
+
 	Depth int `arg:"--depth" default:"-1" help:"max recursion depth limit (-1 is unlimited)"`
 
 	// The default of 0 means any error is a failure by default.
@@ -128,6 +128,12 @@ type Args struct {
 
 	CheckCmd *CheckArgs `arg:"subcommand:check" help:"check code on this machine"`
 
+	TestCmd *TestArgs `arg:"subcommand:test" help:"run mcl unit tests"`
+
+	LspCmd *LspArgs `arg:"subcommand:lsp" help:"run the mcl language server"`
+
+	ReplCmd *ReplArgs `arg:"subcommand:repl" help:"run the interactive mcl interpreter"`
+
 	RunCmd *RunArgs `arg:"subcommand:run" help:"run code on this machine"`
 
 	DeployCmd *DeployArgs `arg:"subcommand:deploy" help:"deploy code into a cluster"`
@@ -184,6 +190,18 @@ func (obj *Args) Run(ctx context.Context, data *cliUtil.Data) (bool, error) {
 		return cmd.Run(ctx, data)
 	}
 
+	if cmd := obj.TestCmd; cmd != nil {
+		return cmd.Run(ctx, data)
+	}
+
+	if cmd := obj.LspCmd; cmd != nil {
+		return cmd.Run(ctx, data)
+	}
+
+	if cmd := obj.ReplCmd; cmd != nil {
+		return cmd.Run(ctx, data)
+	}
+
 	if cmd := obj.RunCmd; cmd != nil {
 		return cmd.Run(ctx, data)
 	}
@@ -59,6 +59,29 @@ func TestFmtArgs(t *testing.T) {
 	}
 }
 
+func TestTestArgs(t *testing.T) {
+	args := &Args{}
+	parser, err := arg.NewParser(arg.Config{}, args)
+	if err != nil {
+		t.Fatalf("func NewParser failed: %v", err)
+	}
+	if err := parser.Parse([]string{"test", "--run", "^test_foo", "-v", "modules/"}); err != nil {
+		t.Fatalf("func Parse failed: %v", err)
+	}
+	if args.TestCmd == nil {
+		t.Fatalf("func TestCmd is nil")
+	}
+	if args.TestCmd.Pattern != "^test_foo" {
+		t.Fatalf("unexpected pattern: %s", args.TestCmd.Pattern)
+	}
+	if !args.TestCmd.Verbose || args.TestCmd.UpdateGolden {
+		t.Fatalf("unexpected flags: %+v", args.TestCmd)
+	}
+	if args.TestCmd.Input != "modules/" {
+		t.Fatalf("unexpected input: %s", args.TestCmd.Input)
+	}
+}
+
 func TestCheckLangArgs(t *testing.T) {
 	args := &Args{}
 	parser, err := arg.NewParser(arg.Config{}, args)
@@ -34,6 +34,7 @@ import (
 
 	cliUtil "github.com/purpleidea/mgmt/cli/util"
 	"github.com/purpleidea/mgmt/docs"
+	"github.com/purpleidea/mgmt/gapi"
 	. "github.com/purpleidea/mgmt/util/gettext"
 	"github.com/purpleidea/mgmt/util/signals"
 )
@@ -75,6 +76,13 @@ func (obj *DocsGenerateArgs) Run(ctx context.Context, data *cliUtil.Data) (bool,
 	var api docs.API
 
 	if cmd := obj.DocsGenerate; cmd != nil {
+		// We can't import the lang packages from here without causing
+		// an import cycle, so the lang frontend documents the modules.
+		var provider cliUtil.DocsProvider
+		if fn, exists := gapi.RegisteredGAPIs["lang"]; exists {
+			provider, _ = fn().(cliUtil.DocsProvider) // nil if not
+		}
+
 		api = &docs.Generate{
 			DocsGenerateArgs: args.(*cliUtil.DocsGenerateArgs),
 			Config:           obj.Config,
@@ -82,6 +90,7 @@ func (obj *DocsGenerateArgs) Run(ctx context.Context, data *cliUtil.Data) (bool,
 			Version:          data.Version,
 			Debug:            data.Flags.Debug,
 			Logf:             Logf,
+			Provider:         provider,
 		}
 	}
 
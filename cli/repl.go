@@ -0,0 +1,84 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	cliUtil "github.com/purpleidea/mgmt/cli/util"
+	"github.com/purpleidea/mgmt/gapi"
+)
+
+// ReplArgs is the CLI parsing structure and type of the parsed result. This
+// particular one contains the flags for the `repl` subcommand. This command
+// runs an interactive mcl interpreter. Each expression that you enter is
+// evaluated by the function engine and printed, and streaming values keep
+// updating in place until you press enter. Each statement that you enter is
+// added to the program, and the changes to the resource graph are printed.
+// Nothing is ever applied.
+type ReplArgs struct {
+	ModulePath string `arg:"--module-path,env:MGMT_MODULE_PATH" help:"choose the modules path (absolute)"`
+}
+
+// Run runs the interpreter until the input ends or the user quits. Return true
+// to not have a parser error.
+func (obj *ReplArgs) Run(ctx context.Context, data *cliUtil.Data) (bool, error) {
+
+	Logf := func(format string, v ...interface{}) {
+		data.Flags.Logf("repl: "+format, v...)
+	}
+
+	// We can't import the lang packages from here without causing an
+	// import cycle, so the lang frontend runs the interpreter for us.
+	fn, exists := gapi.RegisteredGAPIs["lang"]
+	if !exists {
+		return true, fmt.Errorf("the lang frontend is not available")
+	}
+	provider, ok := fn().(cliUtil.ReplProvider)
+	if !ok {
+		// programming error
+		return true, fmt.Errorf("the lang frontend can not run an interpreter")
+	}
+	args := &cliUtil.ReplArgs{
+		ModulePath: obj.ModulePath,
+	}
+	if err := provider.Repl(ctx, args, os.Stdin, os.Stdout, data.Flags.Debug, Logf); err != nil {
+		return true, err
+	}
+	return true, nil
+}
+
+// Description returns a description string. Implementing this signature is part
+// of the API for the cli library.
+func (obj *ReplArgs) Description() string {
+	return "run the interactive mcl interpreter"
+}
@@ -0,0 +1,111 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	cliUtil "github.com/purpleidea/mgmt/cli/util"
+	"github.com/purpleidea/mgmt/gapi"
+)
+
+// TestArgs is the CLI parsing structure and type of the parsed result. This
+// particular one contains the flags for the `test` subcommand. This command
+// recursively finds the mcl test files, which end in `_test.mcl`, and runs the
+// classes and functions in them whose names start with `test_`. A function
+// test passes if it returns true. A class test passes if it runs, and if its
+// resource graph matches the golden file in the `testdata/` directory beside
+// it, when one exists. Nothing is ever applied. Without an input param it
+// starts in the current working directory. It returns 0 if all tests passed.
+type TestArgs struct {
+	Pattern      string `arg:"--run" help:"only run the tests whose names match this regexp"`
+	UpdateGolden bool   `arg:"--update-golden" help:"write the resource graphs to the golden files"`
+	Timeout      int    `arg:"--timeout" help:"seconds to wait for the values of each test"`
+	Verbose      bool   `arg:"-v,--verbose" help:"print every test and not only failures"`
+
+	ModulePath string `arg:"--module-path,env:MGMT_MODULE_PATH" help:"choose the modules path (absolute)"`
+
+	// Input is the test file, or the directory to search for test files.
+	Input string `arg:"positional"`
+}
+
+// Run runs the selected mcl tests. Return true to not have a parser error.
+func (obj *TestArgs) Run(ctx context.Context, data *cliUtil.Data) (bool, error) {
+
+	Logf := func(format string, v ...interface{}) {
+		data.Flags.Logf("test: "+format, v...)
+	}
+
+	input := obj.Input
+	if input == "" {
+		d, err := os.Getwd()
+		if err != nil {
+			return false, err
+		}
+		input = d
+	}
+
+	// We can't import the lang packages from here without causing an
+	// import cycle, so the lang frontend runs the tests for us instead.
+	fn, exists := gapi.RegisteredGAPIs["lang"]
+	if !exists {
+		return true, fmt.Errorf("the lang frontend is not available")
+	}
+	provider, ok := fn().(cliUtil.TesterProvider)
+	if !ok {
+		// programming error
+		return true, fmt.Errorf("the lang frontend can not run tests")
+	}
+	args := &cliUtil.TestArgs{
+		Input:        input,
+		Run:          obj.Pattern,
+		UpdateGolden: obj.UpdateGolden,
+		Timeout:      obj.Timeout,
+		Verbose:      obj.Verbose,
+		ModulePath:   obj.ModulePath,
+	}
+	passed, err := provider.Test(ctx, args, data.Flags.Debug, Logf)
+	if err != nil {
+		return true, err
+	}
+	if !passed {
+		// return non-zero to the caller, some tests failed
+		return true, fmt.Errorf("tests failed")
+	}
+	return true, nil
+}
+
+// Description returns a description string. Implementing this signature is part
+// of the API for the cli library.
+func (obj *TestArgs) Description() string {
+	return "run mcl unit tests"
+}
@@ -30,8 +30,12 @@
 package util
 
 import (
+	"context"
+	"io"
 	"reflect"
 	"strings"
+
+	docsUtil "github.com/purpleidea/mgmt/docs/util"
 )
 
 // LookupSubcommand returns the name of the subcommand in the obj, of a struct.
@@ -85,6 +89,12 @@ type LangArgs struct {
 	Download     bool `arg:"--download" help:"download any missing imports"`
 	OnlyDownload bool `arg:"--only-download" help:"stop after downloading any missing imports"`
 	Update       bool `arg:"--update" help:"update all dependencies to the latest versions"`
+	Vendor       bool `arg:"--vendor" help:"download all imports and copy them into the deploy"`
+
+	// UpdateLock specifies that the downloader should resolve every import
+	// again and rewrite the lockfile. This is not a flag, it is set by the
+	// check command.
+	UpdateLock bool `arg:"-"`
 
 	UnifySolver        *string  `arg:"--unify-name" help:"pick a specific unification solver"`
 	UnifyOptimizations []string `arg:"--unify-optimizations,separate" help:"list of unification optimizations to request (experts only)"`
@@ -103,6 +113,10 @@ type LangArgs struct {
 	// used.
 	CheckUnify bool `arg:"-"`
 
+	// CheckLint specifies that we should run the mcl linter. This is not a
+	// flag, it is set by the check command when --lint is used.
+	CheckLint bool `arg:"-"`
+
 	Depth int `arg:"--depth" default:"-1" help:"max recursion depth limit (-1 is unlimited)"`
 
 	// The default of 0 means any error is a failure by default.
@@ -168,6 +182,8 @@ type DocsGenerateArgs struct {
 	RootDir     string `arg:"--root-dir" help:"path to mgmt source dir"`
 	NoResources bool   `arg:"--no-resources" help:"skip resource doc generation"`
 	NoFunctions bool   `arg:"--no-functions" help:"skip function doc generation"`
+	NoModules   bool   `arg:"--no-modules" help:"skip mcl module doc generation"`
+	ModulePath  string `arg:"--module-path,env:MGMT_MODULE_PATH" help:"choose the modules path (absolute)"`
 }
 
 // ToolsGrowArgs is the util tool CLI parsing structure and type of the parsed
@@ -177,3 +193,87 @@ type ToolsGrowArgs struct {
 	Exec  bool   `arg:"--exec" help:"actually run these commands"`
 	Done  string `arg:"--done" help:"create this file when done, skip if it exists"`
 }
+
+// TestArgs is the set of options for running mcl unit tests. The cli fills it
+// in from the `test` subcommand flags, and passes it to a TesterProvider.
+type TestArgs struct {
+	// Input is the test file or the directory to search for test files.
+	Input string
+
+	// Run is an optional regular expression of the test names to run.
+	Run string
+
+	// UpdateGolden writes the golden files instead of comparing them.
+	UpdateGolden bool
+
+	// Timeout is the number of seconds to wait for each test's values.
+	Timeout int
+
+	// Verbose prints every test that runs, and not only the failures.
+	Verbose bool
+
+	// ModulePath is the absolute path of the modules directory.
+	ModulePath string
+}
+
+// TesterProvider is implemented by frontends which can run mcl unit tests. The
+// cli looks this up through the gapi registry, since it can't import the lang
+// packages directly without an import cycle.
+type TesterProvider interface {
+	// Test runs the tests that are selected by the args. It returns true if
+	// they all passed. An error means they couldn't be run at all.
+	Test(ctx context.Context, args *TestArgs, debug bool, logf func(format string, v ...interface{})) (bool, error)
+}
+
+// LspArgs is the set of options for running the mcl language server. The cli
+// fills it in from the `lsp` subcommand flags, and passes it to a LspProvider.
+type LspArgs struct {
+	// ModulePath is the absolute path of the modules directory.
+	ModulePath string
+}
+
+// LspProvider is implemented by frontends which can run a language server. The
+// cli looks this up through the gapi registry, like the TesterProvider.
+type LspProvider interface {
+	// Lsp runs the language server over the reader and the writer until
+	// the client exits.
+	Lsp(ctx context.Context, args *LspArgs, r io.Reader, w io.Writer, debug bool, logf func(format string, v ...interface{})) error
+}
+
+// DocsArgs is the set of options for documenting the mcl modules. The docs
+// generator fills it in, and passes it to a DocsProvider.
+type DocsArgs struct {
+	// ModulesDir is the absolute path of a directory which contains mcl
+	// modules to document, each in a directory with a metadata file. It
+	// can be empty, in which case only the embedded modules are included.
+	ModulesDir string
+
+	// ModulePath is the absolute path of the modules directory which is
+	// used to resolve the imports of the modules that we document.
+	ModulePath string
+}
+
+// DocsProvider is implemented by frontends which can document the mcl modules.
+// The cli looks this up through the gapi registry, like the TesterProvider.
+type DocsProvider interface {
+	// Docs returns the documentation of each embedded mcl module, and of
+	// each module in the modules dir, keyed by the module name.
+	Docs(ctx context.Context, args *DocsArgs, debug bool, logf func(format string, v ...interface{})) (map[string]*docsUtil.ModuleInfo, error)
+}
+
+// ReplArgs is the set of options for running the interactive mcl interpreter.
+// The cli fills it in from the `repl` subcommand flags, and passes it to a
+// ReplProvider.
+type ReplArgs struct {
+	// ModulePath is the absolute path of the modules directory.
+	ModulePath string
+}
+
+// ReplProvider is implemented by frontends which can run an interactive
+// interpreter. The cli looks this up through the gapi registry, like the
+// TesterProvider.
+type ReplProvider interface {
+	// Repl runs the interpreter over the reader and the writer until the
+	// input ends, or the user quits.
+	Repl(ctx context.Context, args *ReplArgs, r io.Reader, w io.Writer, debug bool, logf func(format string, v ...interface{})) error
+}
@@ -53,6 +53,10 @@ import (
 const (
 	// JSONSuffix is the output extension for the generated documentation.
 	JSONSuffix = ".json"
+
+	// ModulesRelDir is the path where the mcl modules are located, relative
+	// to the mgmt source dir.
+	ModulesRelDir = "modules/"
 )
 
 // Generate is the main entrypoint for this command. It generates everything.
@@ -71,6 +75,10 @@ type Generate struct {
 
 	// Logf is a logger which should be used.
 	Logf func(format string, v ...interface{})
+
+	// Provider documents the mcl modules, since we can't import the mcl
+	// compiler here. If it is nil, then the modules are skipped.
+	Provider cliUtil.DocsProvider
 }
 
 // Main runs everything for this setup item.
@@ -137,10 +145,16 @@ func (obj *Generate) Run(ctx context.Context) error {
 		return err
 	}
 
+	modules, err := obj.genModules(ctx)
+	if err != nil {
+		return err
+	}
+
 	data := &Output{
 		Version:   safeVersion(obj.Version),
 		Resources: resources,
 		Functions: functions,
+		Modules:   modules,
 	}
 
 	b, err := json.Marshal(data)
@@ -574,6 +588,53 @@ func (obj *Generate) genFunctions() (map[string]*FunctionInfo, error) {
 	return functions, nil
 }
 
+func (obj *Generate) genModules(ctx context.Context) (map[string]*docsUtil.ModuleInfo, error) {
+	modules := make(map[string]*docsUtil.ModuleInfo)
+	if obj.DocsGenerateArgs.NoModules {
+		return modules, nil
+	}
+	if obj.Provider == nil {
+		obj.Logf("no mcl module doc generation available")
+		return modules, nil
+	}
+
+	rootDir := obj.DocsGenerateArgs.RootDir
+	if rootDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, err
+		}
+		rootDir = wd + "/" // add a trailing slash
+	}
+	if !strings.HasPrefix(rootDir, "/") || !strings.HasSuffix(rootDir, "/") {
+		return nil, fmt.Errorf("bad root dir: %s", rootDir)
+	}
+
+	args := &cliUtil.DocsArgs{
+		ModulesDir: rootDir + ModulesRelDir,
+		ModulePath: obj.DocsGenerateArgs.ModulePath,
+	}
+	modules, err := obj.Provider.Docs(ctx, args, obj.Debug, obj.Logf)
+	if err != nil {
+		return nil, err
+	}
+
+	// The files in the source dir are relative, like the other files.
+	for name, mi := range modules {
+		mi.File = strings.TrimPrefix(mi.File, rootDir)
+		for _, entries := range [][]*docsUtil.ModuleEntryInfo{mi.Functions, mi.Classes, mi.Variables} {
+			for _, entry := range entries {
+				entry.File = strings.TrimPrefix(entry.File, rootDir)
+				if entry.Desc == "" {
+					obj.Logf("empty module (%s) desc: %s", name, entry.Name)
+				}
+			}
+		}
+	}
+
+	return modules, nil
+}
+
 // Output is the type of the final data that will be for the json output.
 type Output struct {
 	// Version is the sha1 or ref name of this specific version. This is
@@ -588,6 +649,9 @@ type Output struct {
 	// Functions contains the collection of every available function!
 	// FIXME: should this be a list instead?
 	Functions map[string]*FunctionInfo `json:"functions"`
+
+	// Modules contains the collection of every available mcl module!
+	Modules map[string]*docsUtil.ModuleInfo `json:"modules"`
 }
 
 // ResourceInfo stores some information about each resource.
@@ -669,7 +733,7 @@ func commentCleaner(g *ast.CommentGroup) string {
 				// empty line
 				break
 			}
-			if isDevComment(c[1:]) { // get rid of one space
+			if docsUtil.IsDevComment(c[1:]) { // get rid of one space
 				continue
 			}
 			if c[0] == ' ' {
@@ -751,20 +815,6 @@ func isPrivate(fieldName string) bool {
 	return false
 }
 
-// isDevComment tells us that the comment is for developers only!
-func isDevComment(comment string) bool {
-	if strings.HasPrefix(comment, "TODO:") {
-		return true
-	}
-	if strings.HasPrefix(comment, "FIXME:") {
-		return true
-	}
-	if strings.HasPrefix(comment, "XXX:") {
-		return true
-	}
-	return false
-}
-
 // safeVersion parses the main version string and returns a short hash for us.
 // For example, we might get a string of 0.0.26-176-gabcdef012-dirty as input,
 // and we'd want to return abcdef012.
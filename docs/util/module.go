@@ -0,0 +1,77 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package util
+
+// ModuleInfo stores the documentation of an mcl module. This is generated from
+// the mcl code instead of from the golang code, so it is built by the compiler.
+type ModuleInfo struct {
+	// Name is the name of this module, which is how it is usually imported.
+	Name string `json:"name"`
+
+	// File is the main file of this module.
+	File string `json:"file"`
+
+	// Desc explains what this module does. It comes from the comment which
+	// is directly above the first import.
+	Desc string `json:"description"`
+
+	// Functions are the functions that this module defines.
+	Functions []*ModuleEntryInfo `json:"functions"`
+
+	// Classes are the classes that this module defines.
+	Classes []*ModuleEntryInfo `json:"classes"`
+
+	// Variables are the variables that this module defines.
+	Variables []*ModuleEntryInfo `json:"variables"`
+}
+
+// ModuleEntryInfo stores the documentation of a function, class, or variable
+// which is defined at the top-level of an mcl module.
+type ModuleEntryInfo struct {
+	// Name is the name of this function, class, or variable.
+	Name string `json:"name"`
+
+	// Signature is the declaration as it was written, without the body.
+	Signature string `json:"signature"`
+
+	// Type is the inferred type of this function or variable. It is empty
+	// if it is not known statically, which is always the case for classes.
+	Type *string `json:"type,omitempty"`
+
+	// File is the file name where this is defined.
+	File string `json:"file"`
+
+	// Line is the one-based line number where this is defined.
+	Line int `json:"line"`
+
+	// Desc explains what this does. It comes from the comment which is
+	// directly above the definition.
+	Desc string `json:"description"`
+}
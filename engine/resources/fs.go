@@ -0,0 +1,403 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/grow"
+	"github.com/purpleidea/mgmt/util/recwatch"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	engine.RegisterResource("fs", func() engine.Res { return &FsRes{} })
+}
+
+// fsLabelMaxLen is the maximum length of the label for each filesystem type.
+var fsLabelMaxLen = map[string]int{
+	"ext2":  16,
+	"ext3":  16,
+	"ext4":  16,
+	"xfs":   12,
+	"btrfs": 255,
+	"vfat":  11,
+}
+
+// FsRes is a resource that makes a filesystem on a block device. The name is
+// the path to the device, eg: /dev/vdb1. It will never reformat a device that
+// already contains a different filesystem (or other signature) unless you set
+// the Force parameter. If the filesystem exists but has a different label, it
+// will be relabelled, since that doesn't touch any data. It does not mount
+// anything, use the mount resource for that, which will automatically add an
+// edge from this resource.
+type FsRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// Type is the filesystem type to make. Currently ext2, ext3, ext4, xfs,
+	// btrfs and vfat are supported.
+	Type string `lang:"type" yaml:"type"`
+
+	// Label is the optional filesystem label.
+	Label string `lang:"label" yaml:"label"`
+
+	// UUID is the optional filesystem uuid to use. If it's not specified,
+	// then a random one will be chosen by the mkfs tool. For vfat this is
+	// the volume id which looks like: ABCD-1234. If this is set and the
+	// existing filesystem has a different one, then this is treated the
+	// same as a filesystem type mismatch.
+	UUID string `lang:"uuid" yaml:"uuid"`
+
+	// Args are any additional arguments to pass to the mkfs tool. They are
+	// only used when the filesystem is made, and they are not checked.
+	Args []string `lang:"args" yaml:"args"`
+
+	// Force must be true to allow reformatting a device which already
+	// contains a different filesystem or signature. This destroys data!
+	Force bool `lang:"force" yaml:"force"`
+}
+
+// grower returns the storage utility struct that does the real work.
+func (obj *FsRes) grower() *grow.Grow {
+	return &grow.Grow{
+		Debug: obj.init.Debug,
+		Logf:  obj.init.Logf,
+	}
+}
+
+// sameUUID returns true if the uuid that blkid found is the one we want. The
+// vfat volume id may be specified with or without the dash, but blkid always
+// shows it with one, so we compare it without.
+func (obj *FsRes) sameUUID(found string) bool {
+	want := obj.UUID
+	if obj.Type == "vfat" {
+		want = strings.ReplaceAll(want, "-", "")
+		found = strings.ReplaceAll(found, "-", "")
+	}
+	return strings.EqualFold(found, want)
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *FsRes) Default() engine.Res {
+	return &FsRes{}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *FsRes) Validate() error {
+	if !strings.HasPrefix(obj.Name(), "/") {
+		return fmt.Errorf("the device must be an absolute path")
+	}
+	if strings.HasSuffix(obj.Name(), "/") {
+		return fmt.Errorf("the device must not be a directory")
+	}
+
+	if err := (&grow.Grow{}).IsValidMkfsType(obj.Type); err != nil {
+		return err
+	}
+
+	if n := fsLabelMaxLen[obj.Type]; len(obj.Label) > n {
+		return fmt.Errorf("the label is longer than %d characters", n)
+	}
+
+	if obj.UUID != "" && obj.Type == "vfat" {
+		if s := strings.ReplaceAll(obj.UUID, "-", ""); len(s) != 8 {
+			return fmt.Errorf("the vfat volume id must be eight hex chars")
+		}
+	} else if obj.UUID != "" {
+		if _, err := uuid.Parse(obj.UUID); err != nil {
+			return errwrap.Wrapf(err, "invalid uuid")
+		}
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *FsRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *FsRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events. We
+// watch the /dev/disk/ tree which udev updates whenever a filesystem signature
+// or label changes.
+func (obj *FsRes) Watch(ctx context.Context) error {
+	recurse := true // the by-uuid/ and by-label/ dirs are inside
+	recWatcher, err := recwatch.NewRecWatcher(devDisk, recurse)
+	if err != nil {
+		return err
+	}
+	defer recWatcher.Close()
+
+	if err := obj.init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-recWatcher.Events():
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if event == nil {
+				// programming error
+				return fmt.Errorf("unexpected nil recwatch event")
+			}
+			if err := event.Error; err != nil {
+				return errwrap.Wrapf(err, "unknown %s watcher error", obj)
+			}
+			if obj.init.Debug { // don't access event.Body if event.Error isn't nil
+				obj.init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *FsRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	g := obj.grower()
+
+	info, err := g.Blkid(ctx, obj.Name())
+	if err != nil {
+		return false, err
+	}
+
+	mkfs := false
+	if info.Empty() {
+		mkfs = true // empty device
+
+	} else if info.Type != obj.Type || info.PTType != "" || (obj.UUID != "" && !obj.sameUUID(info.UUID)) {
+		// A partition table, lvm pv, swap area or anything else
+		// that isn't our filesystem is existing data too.
+		if !obj.Force {
+			return false, fmt.Errorf("refusing to reformat %s which contains: %s", obj.Name(), info)
+		}
+		mkfs = true
+	}
+
+	if mkfs {
+		if !apply {
+			return false, nil
+		}
+		if !info.Empty() { // mkfs doesn't erase everything, eg: a gpt backup
+			if err := g.Wipefs(ctx, obj.Name()); err != nil {
+				return false, errwrap.Wrapf(err, "could not wipe the device")
+			}
+		}
+		if err := g.Mkfs(ctx, obj.Name(), obj.Type, obj.Label, obj.UUID, obj.Args, obj.Force); err != nil {
+			return false, errwrap.Wrapf(err, "could not make the filesystem")
+		}
+		return false, nil
+	}
+
+	if obj.Label == "" || info.Label == obj.Label {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+	if err := g.Relabel(ctx, obj.Name(), obj.Type, obj.Label); err != nil {
+		return false, errwrap.Wrapf(err, "could not relabel the filesystem")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *FsRes) Cmp(r engine.Res) error {
+	// we can only compare FsRes to others of the same resource kind
+	res, ok := r.(*FsRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.Type != res.Type {
+		return fmt.Errorf("the Type differs")
+	}
+	if obj.Label != res.Label {
+		return fmt.Errorf("the Label differs")
+	}
+	if obj.UUID != res.UUID {
+		return fmt.Errorf("the UUID differs")
+	}
+	if len(obj.Args) != len(res.Args) {
+		return fmt.Errorf("the number of Args differs")
+	}
+	for i, x := range obj.Args {
+		if x != res.Args[i] {
+			return fmt.Errorf("the Args differ at index: %d", i)
+		}
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force value differs")
+	}
+
+	return nil
+}
+
+// FsUID is the UID struct for FsRes.
+type FsUID struct {
+	engine.BaseUID
+
+	// device is the path to the device.
+	device string
+
+	// label is the filesystem label if one is used.
+	label string
+
+	// uuid is the filesystem uuid if one is used.
+	uuid string
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false. A
+// filesystem can be identified by any of its device, label or uuid.
+func (obj *FsUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*FsUID)
+	if !ok {
+		return false
+	}
+	if obj.device != "" && obj.device == res.device {
+		return true
+	}
+	if obj.label != "" && obj.label == res.label {
+		return true
+	}
+	if obj.uuid != "" && strings.EqualFold(obj.uuid, res.uuid) {
+		return true
+	}
+	return false
+}
+
+// FsResAutoEdges holds the state of the auto edge generator.
+type FsResAutoEdges struct {
+	uids    []engine.ResUID
+	pointer int
+}
+
+// Next returns the next automatic edge.
+func (obj *FsResAutoEdges) Next() []engine.ResUID {
+	if len(obj.uids) == 0 {
+		return nil
+	}
+	value := obj.uids[obj.pointer]
+	obj.pointer++
+	return []engine.ResUID{value}
+}
+
+// Test gets results of the earlier Next() call, & returns if we should
+// continue.
+func (obj *FsResAutoEdges) Test(input []bool) bool {
+	if len(obj.uids) <= obj.pointer {
+		return false
+	}
+	if len(input) != 1 { // in case we get given bad data
+		panic("expecting a single value")
+	}
+	return true // keep going
+}
+
+// AutoEdges returns an edge from the partition or logical volume resource that
+// provides the device that we're making a filesystem on.
+func (obj *FsRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := true // the partition comes first
+	base := engine.BaseUID{
+		Name:     obj.Name(),
+		Kind:     obj.Kind(),
+		Reversed: &reversed,
+	}
+	uids := []engine.ResUID{
+		&PartitionUID{
+			BaseUID: base,
+			device:  obj.Name(),
+		},
+	}
+	if uid, ok := lvmLVUID(base, obj.Name()); ok {
+		uids = append(uids, uid)
+	}
+	return &FsResAutoEdges{
+		uids: uids,
+	}, nil
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one although some resources can return multiple.
+func (obj *FsRes) UIDs() []engine.ResUID {
+	x := &FsUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		device:  obj.Name(),
+		label:   obj.Label,
+		uuid:    obj.UUID,
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *FsRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes FsRes // indirection to avoid infinite recursion
+
+	def := obj.Default()    // get the default
+	res, ok := def.(*FsRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to FsRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = FsRes(raw) // restore from indirection with type conversion!
+	return nil
+}
@@ -0,0 +1,225 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package resources
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func TestFsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *FsRes
+		fail bool
+	}{
+		{"/dev/vdb1", &FsRes{Type: "ext4", Label: "data"}, false},
+		{"/dev/vdb1", &FsRes{Type: "xfs", UUID: "0b1e6d7a-4ec1-4a0e-b1fb-2f3e1c8f3a11"}, false},
+		{"/dev/vdb1", &FsRes{Type: "vfat", UUID: "ABCD-1234"}, false},
+		{"vdb1", &FsRes{Type: "ext4"}, true},
+		{"/dev/vdb1", &FsRes{Type: "ntfs"}, true},
+		{"/dev/vdb1", &FsRes{Type: "xfs", Label: "thisistoolong"}, true},
+		{"/dev/vdb1", &FsRes{Type: "ext4", UUID: "nope"}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("fs")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+// fatImage returns a tiny fat12 filesystem image with the given volume id.
+func fatImage(id uint32) []byte {
+	b := make([]byte, 1024*1024)
+	copy(b[0:], []byte{0xeb, 0x3c, 0x90})
+	copy(b[3:], "mkfs.fat")
+	binary.LittleEndian.PutUint16(b[11:], 512)  // bytes per sector
+	b[13] = 4                                   // sectors per cluster
+	binary.LittleEndian.PutUint16(b[14:], 1)    // reserved sectors
+	b[16] = 2                                   // number of fats
+	binary.LittleEndian.PutUint16(b[17:], 512)  // root dir entries
+	binary.LittleEndian.PutUint16(b[19:], 2048) // total sectors
+	b[21] = 0xf8                                // media
+	binary.LittleEndian.PutUint16(b[22:], 2)    // sectors per fat
+	b[38] = 0x29                                // extended boot signature
+	binary.LittleEndian.PutUint32(b[39:], id)
+	copy(b[43:], "NO NAME    FAT12   ")
+	b[510], b[511] = 0x55, 0xaa
+	for _, fat := range []int{512, 512 * 3} {
+		copy(b[fat:], []byte{0xf8, 0xff, 0xff})
+	}
+	return b
+}
+
+func TestFsCheckApplyVfatUUID(t *testing.T) {
+	if _, err := exec.LookPath("blkid"); err != nil {
+		t.Skipf("blkid is missing")
+	}
+
+	img := filepath.Join(t.TempDir(), "fat.img")
+	if err := os.WriteFile(img, fatImage(0xabcd1234), 0600); err != nil {
+		t.Errorf("could not write image: %v", err)
+		return
+	}
+
+	tests := []struct {
+		uuid string
+		ok   bool
+	}{
+		{"ABCD-1234", true},
+		{"ABCD1234", true}, // blkid shows the dash
+		{"abcd1234", true},
+		{"ABCD1235", false},
+	}
+
+	for i, test := range tests {
+		fs := &FsRes{Type: "vfat", UUID: test.uuid}
+		fs.SetKind("fs")
+		fs.SetName(img)
+		fs.init = &engine.Init{Logf: t.Logf}
+		if err := fs.Validate(); err != nil {
+			t.Errorf("index: %d, unexpected validate error: %v", i, err)
+			continue
+		}
+		// never apply, so a mismatch can't reformat the image
+		checkOK, err := fs.CheckApply(context.Background(), false)
+		if test.ok && (err != nil || !checkOK) {
+			t.Errorf("index: %d, expected the uuid to match, got: %t, %v", i, checkOK, err)
+		}
+		if !test.ok && err == nil {
+			t.Errorf("index: %d, expected a refusal to reformat", i)
+		}
+	}
+}
+
+func TestPartitionValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *PartitionRes
+		fail bool
+	}{
+		{"/dev/vdb1", &PartitionRes{State: "exists", Table: "gpt", Label: "root"}, false},
+		{"/dev/nvme0n1p3", &PartitionRes{State: "absent", Table: "gpt"}, false},
+		{"/dev/vdb2", &PartitionRes{State: "exists", Table: "dos", Type: "swap"}, false},
+		{"/dev/vdb", &PartitionRes{State: "exists", Table: "gpt"}, true},
+		{"/dev/vdb1", &PartitionRes{State: "exists", Table: "mbr"}, true},
+		{"/dev/vdb1", &PartitionRes{State: "exists", Table: "dos", Label: "root"}, true},
+		{"/dev/vdb1", &PartitionRes{State: "exists", Table: "gpt", Size: -1}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("partition")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestSwapValidate(t *testing.T) {
+	priority := 5
+	badPriority := -5
+	tests := []struct {
+		name string
+		res  *SwapRes
+		fail bool
+	}{
+		{"/var/swapfile", &SwapRes{State: "exists", Size: 1024 * 1024 * 1024}, false},
+		{"/dev/vdb2", &SwapRes{State: "exists", Priority: &priority}, false},
+		{"/var/swapfile", &SwapRes{State: "exists"}, true},
+		{"/dev/vdb2", &SwapRes{State: "exists", Size: 1024}, true},
+		{"/dev/vdb2", &SwapRes{State: "exists", Priority: &badPriority}, true},
+		{"/dev/vdb2", &SwapRes{State: "maybe"}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("swap")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestFsAutoEdges(t *testing.T) {
+	fs := &FsRes{Type: "ext4", Label: "data"}
+	fs.SetKind("fs")
+	fs.SetName("/dev/vdb1")
+	uids := fs.UIDs()
+
+	tests := []struct {
+		device string
+		match  bool
+	}{
+		{"/dev/vdb1", true},
+		{"LABEL=data", true},
+		{"UUID=0b1e6d7a-4ec1-4a0e-b1fb-2f3e1c8f3a11", false},
+		{"/dev/vdc1", false},
+	}
+
+	for i, test := range tests {
+		mount := &MountRes{State: "exists", Device: test.device}
+		mount.SetKind("mount")
+		mount.SetName("/mnt/data")
+		ae, err := mount.AutoEdges(context.Background())
+		if err != nil {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+			continue
+		}
+		next := ae.Next()
+		if len(next) != 1 {
+			t.Errorf("index: %d, expected one uid", i)
+			continue
+		}
+		if !next[0].IsReversed() {
+			t.Errorf("index: %d, expected a reversed edge", i)
+		}
+		if match := next[0].IFF(uids[0]); match != test.match {
+			t.Errorf("index: %d, expected match: %t", i, test.match)
+		}
+	}
+}
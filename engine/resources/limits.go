@@ -0,0 +1,385 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+func init() {
+	engine.RegisterResource("limits", func() engine.Res { return &LimitsRes{} })
+
+	if !strings.HasPrefix(LimitsDir, "/") {
+		panic("the LimitsDir does not start with a slash")
+	}
+	if !strings.HasSuffix(LimitsDir, "/") {
+		panic("the LimitsDir does not end with a slash")
+	}
+}
+
+const (
+	// LimitsDir is the directory where we store our pam_limits files.
+	LimitsDir = "/etc/security/limits.d/"
+
+	// limitsMode is the mode that we use for our limits files.
+	limitsMode = 0644
+
+	// limitsHeader is the comment at the top of every generated file.
+	limitsHeader = "# This file is managed by mgmt. Do not edit.\n"
+)
+
+var (
+	// limitsItems is the list of valid pam_limits items. The value is true
+	// if the item takes a number, and false if it doesn't.
+	limitsItems = map[string]bool{
+		"core":         true,
+		"data":         true,
+		"fsize":        true,
+		"memlock":      true,
+		"nofile":       true,
+		"rss":          true,
+		"stack":        true,
+		"cpu":          true,
+		"nproc":        true,
+		"as":           true,
+		"maxlogins":    true,
+		"maxsyslogins": true,
+		"nonewprivs":   true,
+		"priority":     true,
+		"locks":        true,
+		"sigpending":   true,
+		"msgqueue":     true,
+		"nice":         true,
+		"rtprio":       true,
+		"chroot":       false, // a path
+	}
+
+	// limitsDomainRegexp matches a user or group name.
+	limitsDomainRegexp = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]*\$?$`)
+
+	// limitsRangeRegexp matches a uid or gid range, eg: 1000: or 10:20.
+	limitsRangeRegexp = regexp.MustCompile(`^([0-9]+:[0-9]*|:[0-9]+)$`)
+)
+
+// LimitsRes is a resource that manages a file in the /etc/security/limits.d/
+// directory which is read by pam_limits. The name of the resource is the name
+// of that file without the .conf suffix. Every entry is validated before the
+// file is atomically replaced. If this is reversed, the file is removed when
+// the resource goes away.
+type LimitsRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Reversible
+
+	init *engine.Init
+
+	// State must be exists or absent. If absent, the file is removed.
+	State string `lang:"state" yaml:"state"`
+
+	// Limits is the list of entries to put in the file.
+	Limits []*LimitsEntry `lang:"limits" yaml:"limits"`
+}
+
+// LimitsEntry is a single line in a pam_limits file.
+type LimitsEntry struct {
+	// Domain is who this applies to. It can be a user name, a group name
+	// with an @ prefix, the * wildcard, or a uid range like 1000: and a
+	// gid range with an @ prefix. A % prefix is used for maxlogins.
+	Domain string `lang:"domain" yaml:"domain"`
+
+	// Type must be soft, hard or - for both.
+	Type string `lang:"type" yaml:"type"`
+
+	// Item is the resource being limited, such as nofile or nproc.
+	Item string `lang:"item" yaml:"item"`
+
+	// Value is the limit. It is a number or one of unlimited, infinity or
+	// -1 for most items. The priority and nice items accept -20 to 19, and
+	// rtprio accepts 0 to 99.
+	Value string `lang:"value" yaml:"value"`
+}
+
+// Validate returns an error if the entry is not valid.
+func (obj *LimitsEntry) Validate() error {
+	domain := obj.Domain
+	switch {
+	case domain == "*":
+	case strings.HasPrefix(domain, "%"): // only for maxlogins
+		if obj.Item != "maxlogins" {
+			return fmt.Errorf("the %% domain prefix is only valid for maxlogins")
+		}
+		if d := strings.TrimPrefix(domain, "%"); d != "" && !limitsDomainRegexp.MatchString(d) {
+			return fmt.Errorf("invalid group: %s", d)
+		}
+	default:
+		d := strings.TrimPrefix(domain, "@")
+		if !limitsDomainRegexp.MatchString(d) && !limitsRangeRegexp.MatchString(d) {
+			return fmt.Errorf("invalid domain: %s", domain)
+		}
+	}
+
+	if obj.Type != "soft" && obj.Type != "hard" && obj.Type != "-" {
+		return fmt.Errorf("type must be 'soft', 'hard', or '-'")
+	}
+
+	numeric, exists := limitsItems[obj.Item]
+	if !exists {
+		return fmt.Errorf("unknown item: %s", obj.Item)
+	}
+
+	if obj.Value == "" || strings.ContainsAny(obj.Value, " \t\n") {
+		return fmt.Errorf("value must be non-empty and not contain whitespace")
+	}
+	if !numeric {
+		if !strings.HasPrefix(obj.Value, "/") {
+			return fmt.Errorf("the %s value must be an absolute path", obj.Item)
+		}
+		return nil
+	}
+
+	if obj.Item == "priority" || obj.Item == "nice" || obj.Item == "rtprio" {
+		n, err := strconv.Atoi(obj.Value)
+		if err != nil {
+			return fmt.Errorf("the %s value must be an integer", obj.Item)
+		}
+		lo, hi := -20, 19
+		if obj.Item == "rtprio" {
+			lo, hi = 0, 99
+		}
+		if n < lo || n > hi {
+			return fmt.Errorf("the %s value must be between %d and %d", obj.Item, lo, hi)
+		}
+		return nil
+	}
+
+	if obj.Value == "unlimited" || obj.Value == "infinity" || obj.Value == "-1" {
+		return nil
+	}
+	if _, err := strconv.ParseUint(obj.Value, 10, 64); err != nil {
+		return fmt.Errorf("the %s value must be a number, unlimited or infinity", obj.Item)
+	}
+	return nil
+}
+
+// String returns the entry in the pam_limits file format.
+func (obj *LimitsEntry) String() string {
+	return fmt.Sprintf("%s\t%s\t%s\t%s", obj.Domain, obj.Type, obj.Item, obj.Value)
+}
+
+// getPath returns the path to the managed file.
+func (obj *LimitsRes) getPath() string {
+	return LimitsDir + obj.Name() + ".conf"
+}
+
+// content returns the contents of the file that we manage.
+func (obj *LimitsRes) content() string {
+	s := limitsHeader
+	for _, x := range obj.Limits {
+		s += x.String() + "\n"
+	}
+	return s
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *LimitsRes) Default() engine.Res {
+	return &LimitsRes{
+		State: "exists",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *LimitsRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be 'exists', or 'absent'")
+	}
+
+	if obj.Name() == "" {
+		return fmt.Errorf("the name is empty")
+	}
+	if strings.Contains(obj.Name(), "/") {
+		return fmt.Errorf("the name must not contain a slash")
+	}
+	if strings.HasSuffix(obj.Name(), ".conf") {
+		return fmt.Errorf("the name must not end with .conf, it is added for you")
+	}
+
+	if obj.State == "absent" && len(obj.Limits) > 0 {
+		return fmt.Errorf("can't specify limits when absent")
+	}
+
+	for i, x := range obj.Limits {
+		if x == nil {
+			return fmt.Errorf("limit %d is nil", i)
+		}
+		if err := x.Validate(); err != nil {
+			return errwrap.Wrapf(err, "limit %d is invalid", i)
+		}
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *LimitsRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *LimitsRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *LimitsRes) Watch(ctx context.Context) error {
+	return dropinWatch(ctx, obj.init, obj.getPath())
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *LimitsRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	var content []byte
+	if obj.State == "exists" {
+		content = []byte(obj.content())
+	}
+	return dropinCheckApply(obj.init, obj.getPath(), content, limitsMode, apply)
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *LimitsRes) Cmp(r engine.Res) error {
+	// we can only compare LimitsRes to others of the same resource kind
+	res, ok := r.(*LimitsRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+
+	if len(obj.Limits) != len(res.Limits) {
+		return fmt.Errorf("the number of Limits differs")
+	}
+	for i, x := range obj.Limits {
+		if *x != *res.Limits[i] {
+			return fmt.Errorf("the Limits differ at index: %d", i)
+		}
+	}
+
+	return nil
+}
+
+// Copy copies the resource. Don't call it directly, use engine.ResCopy instead.
+// TODO: should this copy internal state?
+func (obj *LimitsRes) Copy() engine.CopyableRes {
+	limits := []*LimitsEntry{}
+	for _, x := range obj.Limits {
+		entry := *x // copy
+		limits = append(limits, &entry)
+	}
+	return &LimitsRes{
+		State:  obj.State,
+		Limits: limits,
+	}
+}
+
+// Reversed returns the "reverse" or "reciprocal" resource. This is used to
+// "clean" up after a previously defined resource has been removed. A file that
+// we added is removed, but we don't restore a file that we previously removed.
+func (obj *LimitsRes) Reversed() (engine.ReversibleRes, error) {
+	if obj.State == "absent" {
+		return nil, nil // nothing to do
+	}
+
+	cp, err := engine.ResCopy(obj)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not copy")
+	}
+	rev, ok := cp.(engine.ReversibleRes)
+	if !ok {
+		return nil, fmt.Errorf("not reversible")
+	}
+	rev.ReversibleMeta().Disabled = true // the reverse shouldn't run again
+
+	res, ok := cp.(*LimitsRes)
+	if !ok {
+		return nil, fmt.Errorf("copied res was not our kind")
+	}
+
+	res.State = "absent"
+	res.Limits = nil
+
+	return res, nil
+}
+
+// LimitsUID is the UID struct for LimitsRes.
+type LimitsUID struct {
+	engine.BaseUID
+
+	name string
+}
+
+// UIDs includes all params to make a unique identification of this object.
+// Most resources only return one although some resources can return multiple.
+func (obj *LimitsRes) UIDs() []engine.ResUID {
+	x := &LimitsUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *LimitsRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes LimitsRes // indirection to avoid infinite recursion
+
+	def := obj.Default()        // get the default
+	res, ok := def.(*LimitsRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to LimitsRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = LimitsRes(raw) // restore from indirection with type conversion!
+	return nil
+}
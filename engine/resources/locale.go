@@ -0,0 +1,487 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	engineUtil "github.com/purpleidea/mgmt/engine/util"
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+func init() {
+	engine.RegisterResource("locale", func() engine.Res { return &LocaleRes{} })
+	engine.RegisterResource("keymap", func() engine.Res { return &KeymapRes{} })
+}
+
+const (
+	locale1Path  = "/org/freedesktop/locale1"
+	locale1Iface = "org.freedesktop.locale1"
+
+	// localeConfPath is the file where localed stores the system locale.
+	localeConfPath = "/etc/locale.conf"
+
+	// vconsoleConfPath is the file where localed stores the console keymap.
+	vconsoleConfPath = "/etc/vconsole.conf"
+)
+
+var (
+	// localeVariables are the variables that localed accepts.
+	localeVariables = map[string]bool{
+		"LANG":              true,
+		"LANGUAGE":          true,
+		"LC_CTYPE":          true,
+		"LC_NUMERIC":        true,
+		"LC_TIME":           true,
+		"LC_COLLATE":        true,
+		"LC_MONETARY":       true,
+		"LC_MESSAGES":       true,
+		"LC_PAPER":          true,
+		"LC_NAME":           true,
+		"LC_ADDRESS":        true,
+		"LC_TELEPHONE":      true,
+		"LC_MEASUREMENT":    true,
+		"LC_IDENTIFICATION": true,
+	}
+
+	// localeValueRegexp matches a locale name such as en_US.UTF-8 or C.
+	localeValueRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.@:-]+$`)
+
+	// keymapValueRegexp matches a keymap or an X11 keyboard field.
+	keymapValueRegexp = regexp.MustCompile(`^[a-zA-Z0-9_.:,()+-]*$`)
+)
+
+// LocaleRes is a resource that sets and watches the system locale. It talks to
+// systemd-localed over dbus. If you don't specify the Lang, the Name is used.
+// Any locale variables which are not specified are removed.
+type LocaleRes struct {
+	traits.Base // add the base methods without re-implementation
+
+	init *engine.Init
+
+	// Lang is the value of the LANG variable, such as en_US.UTF-8.
+	Lang string `lang:"lang" yaml:"lang"`
+
+	// Variables are any other locale variables to set, such as LC_TIME. The
+	// key is the variable name and the value is the locale.
+	Variables map[string]string `lang:"variables" yaml:"variables"`
+}
+
+func (obj *LocaleRes) getLang() string {
+	if obj.Lang != "" {
+		return obj.Lang
+	}
+
+	return obj.Name()
+}
+
+// locale returns the sorted list of assignments that we want localed to have.
+func (obj *LocaleRes) locale() []string {
+	l := []string{"LANG=" + obj.getLang()}
+	for k, v := range obj.Variables {
+		l = append(l, k+"="+v)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *LocaleRes) Default() engine.Res {
+	return &LocaleRes{}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *LocaleRes) Validate() error {
+	if obj.getLang() == "" {
+		return ErrResourceInsufficientParameters
+	}
+	if !localeValueRegexp.MatchString(obj.getLang()) {
+		return fmt.Errorf("invalid lang: %s", obj.getLang())
+	}
+	for k, v := range obj.Variables {
+		if k == "LANG" {
+			return fmt.Errorf("use the lang field to set LANG")
+		}
+		if !localeVariables[k] {
+			return fmt.Errorf("unknown locale variable: %s", k)
+		}
+		if !localeValueRegexp.MatchString(v) {
+			return fmt.Errorf("invalid value for %s: %s", k, v)
+		}
+	}
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *LocaleRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *LocaleRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *LocaleRes) Watch(ctx context.Context) error {
+	return dbusPropertiesWatch(ctx, obj.init, locale1Path, localeConfPath)
+}
+
+// CheckApply method for Locale resource.
+func (obj *LocaleRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	conn, err := util.SystemBusPrivateUsable()
+	if err != nil {
+		return false, errwrap.Wrapf(err, "failed to connect to the private system bus")
+	}
+	defer conn.Close()
+
+	object := conn.Object(locale1Iface, locale1Path)
+
+	current, err := dbusStringsProperty(object, locale1Iface, "Locale")
+	if err != nil {
+		return false, err
+	}
+	sort.Strings(current)
+
+	expected := obj.locale()
+	if strings.Join(current, "\n") == strings.Join(expected, "\n") {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if err := object.CallWithContext(ctx, locale1Iface+".SetLocale", 0, expected, false).Err; err != nil {
+		return false, errwrap.Wrapf(err, "failed to call %s.SetLocale", locale1Iface)
+	}
+	obj.init.Logf("changed Locale: `%s` => `%s`", strings.Join(current, " "), strings.Join(expected, " "))
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *LocaleRes) Cmp(r engine.Res) error {
+	// we can only compare LocaleRes to others of the same resource kind
+	res, ok := r.(*LocaleRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.getLang() != res.getLang() {
+		return fmt.Errorf("the Lang differs")
+	}
+	if len(obj.Variables) != len(res.Variables) {
+		return fmt.Errorf("the number of Variables differs")
+	}
+	for k, v := range obj.Variables {
+		if x, exists := res.Variables[k]; !exists || x != v {
+			return fmt.Errorf("the Variables differ at: %s", k)
+		}
+	}
+
+	return nil
+}
+
+// LocaleUID is the UID struct for LocaleRes.
+type LocaleUID struct {
+	engine.BaseUID
+
+	name string
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *LocaleRes) UIDs() []engine.ResUID {
+	x := &LocaleUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *LocaleRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes LocaleRes // indirection to avoid infinite recursion
+
+	def := obj.Default()        // get the default
+	res, ok := def.(*LocaleRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to LocaleRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = LocaleRes(raw) // restore from indirection with type conversion!
+	return nil
+}
+
+// KeymapRes is a resource that sets and watches the keyboard mapping of the
+// virtual console and of X11. It talks to systemd-localed over dbus. If you
+// don't specify the Keymap, the Name is used. The X11 fields are only managed
+// if they are set. If they are not, then localed is not asked to convert the
+// console keymap into an X11 one, so the X11 settings are left alone.
+type KeymapRes struct {
+	traits.Base // add the base methods without re-implementation
+
+	init *engine.Init
+
+	// Keymap is the virtual console keymap, such as us or de-latin1.
+	Keymap string `lang:"keymap" yaml:"keymap"`
+
+	// KeymapToggle is the optional virtual console toggle keymap.
+	KeymapToggle *string `lang:"keymap_toggle" yaml:"keymap_toggle"`
+
+	// X11Layout is the X11 keyboard layout, such as us or de.
+	X11Layout *string `lang:"x11_layout" yaml:"x11_layout"`
+
+	// X11Model is the X11 keyboard model, such as pc105.
+	X11Model *string `lang:"x11_model" yaml:"x11_model"`
+
+	// X11Variant is the X11 keyboard variant, such as dvorak.
+	X11Variant *string `lang:"x11_variant" yaml:"x11_variant"`
+
+	// X11Options are the X11 keyboard options, such as ctrl:nocaps.
+	X11Options *string `lang:"x11_options" yaml:"x11_options"`
+}
+
+func (obj *KeymapRes) getKeymap() string {
+	if obj.Keymap != "" {
+		return obj.Keymap
+	}
+
+	return obj.Name()
+}
+
+// isX11 returns true if any of the X11 fields are managed.
+func (obj *KeymapRes) isX11() bool {
+	return obj.X11Layout != nil || obj.X11Model != nil || obj.X11Variant != nil || obj.X11Options != nil
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *KeymapRes) Default() engine.Res {
+	return &KeymapRes{}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *KeymapRes) Validate() error {
+	if obj.getKeymap() == "" {
+		return ErrResourceInsufficientParameters
+	}
+	keymap := obj.getKeymap()
+	fields := map[string]*string{
+		"keymap":        &keymap,
+		"keymap_toggle": obj.KeymapToggle,
+		"x11_layout":    obj.X11Layout,
+		"x11_model":     obj.X11Model,
+		"x11_variant":   obj.X11Variant,
+		"x11_options":   obj.X11Options,
+	}
+	for k, v := range fields {
+		if v != nil && !keymapValueRegexp.MatchString(*v) {
+			return fmt.Errorf("invalid value for %s: %s", k, *v)
+		}
+	}
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *KeymapRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *KeymapRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *KeymapRes) Watch(ctx context.Context) error {
+	return dbusPropertiesWatch(ctx, obj.init, locale1Path, vconsoleConfPath)
+}
+
+// CheckApply method for Keymap resource.
+func (obj *KeymapRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	conn, err := util.SystemBusPrivateUsable()
+	if err != nil {
+		return false, errwrap.Wrapf(err, "failed to connect to the private system bus")
+	}
+	defer conn.Close()
+
+	object := conn.Object(locale1Iface, locale1Path)
+
+	checkOK := true
+
+	// The console keymap and toggle are set together.
+	keymap, err := dbusStringProperty(object, locale1Iface, "VConsoleKeymap")
+	if err != nil {
+		return false, err
+	}
+	toggle, err := dbusStringProperty(object, locale1Iface, "VConsoleKeymapToggle")
+	if err != nil {
+		return false, err
+	}
+	expectedToggle := toggle // unmanaged if nil
+	if obj.KeymapToggle != nil {
+		expectedToggle = *obj.KeymapToggle
+	}
+	if keymap != obj.getKeymap() || toggle != expectedToggle {
+		checkOK = false
+		if apply {
+			// convert is false, since we manage X11 separately
+			if err := object.CallWithContext(ctx, locale1Iface+".SetVConsoleKeyboard", 0, obj.getKeymap(), expectedToggle, false, false).Err; err != nil {
+				return false, errwrap.Wrapf(err, "failed to call %s.SetVConsoleKeyboard", locale1Iface)
+			}
+			obj.init.Logf("changed VConsoleKeymap: `%s` => `%s`", keymap, obj.getKeymap())
+		}
+	}
+
+	if !obj.isX11() {
+		return checkOK, nil
+	}
+
+	// The four X11 fields are also set together.
+	current := []string{}
+	expected := []string{}
+	for _, x := range []struct {
+		property string
+		value    *string
+	}{
+		{"X11Layout", obj.X11Layout},
+		{"X11Model", obj.X11Model},
+		{"X11Variant", obj.X11Variant},
+		{"X11Options", obj.X11Options},
+	} {
+		s, err := dbusStringProperty(object, locale1Iface, x.property)
+		if err != nil {
+			return false, err
+		}
+		current = append(current, s)
+		if x.value == nil { // unmanaged
+			expected = append(expected, s)
+			continue
+		}
+		expected = append(expected, *x.value)
+	}
+	if strings.Join(current, "\n") == strings.Join(expected, "\n") {
+		return checkOK, nil
+	}
+	if !apply {
+		return false, nil
+	}
+	if err := object.CallWithContext(ctx, locale1Iface+".SetX11Keyboard", 0, expected[0], expected[1], expected[2], expected[3], false, false).Err; err != nil {
+		return false, errwrap.Wrapf(err, "failed to call %s.SetX11Keyboard", locale1Iface)
+	}
+	obj.init.Logf("changed X11 keyboard: `%s` => `%s`", strings.Join(current, " "), strings.Join(expected, " "))
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *KeymapRes) Cmp(r engine.Res) error {
+	// we can only compare KeymapRes to others of the same resource kind
+	res, ok := r.(*KeymapRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.getKeymap() != res.getKeymap() {
+		return fmt.Errorf("the Keymap differs")
+	}
+	if engineUtil.StrPtrCmp(obj.KeymapToggle, res.KeymapToggle) != nil {
+		return fmt.Errorf("the KeymapToggle differs")
+	}
+	if engineUtil.StrPtrCmp(obj.X11Layout, res.X11Layout) != nil {
+		return fmt.Errorf("the X11Layout differs")
+	}
+	if engineUtil.StrPtrCmp(obj.X11Model, res.X11Model) != nil {
+		return fmt.Errorf("the X11Model differs")
+	}
+	if engineUtil.StrPtrCmp(obj.X11Variant, res.X11Variant) != nil {
+		return fmt.Errorf("the X11Variant differs")
+	}
+	if engineUtil.StrPtrCmp(obj.X11Options, res.X11Options) != nil {
+		return fmt.Errorf("the X11Options differs")
+	}
+
+	return nil
+}
+
+// KeymapUID is the UID struct for KeymapRes.
+type KeymapUID struct {
+	engine.BaseUID
+
+	name string
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *KeymapRes) UIDs() []engine.ResUID {
+	x := &KeymapUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *KeymapRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes KeymapRes // indirection to avoid infinite recursion
+
+	def := obj.Default()        // get the default
+	res, ok := def.(*KeymapRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to KeymapRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = KeymapRes(raw) // restore from indirection with type conversion!
+	return nil
+}
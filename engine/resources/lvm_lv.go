@@ -0,0 +1,380 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/grow"
+)
+
+func init() {
+	engine.RegisterResource("lvm:lv", func() engine.Res { return &LVMLVRes{} })
+}
+
+// LVMLVRes is a resource that manages an lvm logical volume. The name is the
+// volume group and logical volume names separated by a slash, eg: vg0/data, so
+// that the device is found at /dev/vg0/data. The volume is only ever grown to
+// the requested size, unless Force is true, in which case it is also shrunk.
+type LVMLVRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State is either exists or absent.
+	State string `lang:"state" yaml:"state"`
+
+	// Size is the size of the volume in the lvm format, eg: 10G or 512M,
+	// where the suffixes are powers of 1024 and the default is megabytes.
+	// It can also be relative, such as 100%FREE or 50%VG, but then it's
+	// only used when the volume is created and never to resize it.
+	Size string `lang:"size" yaml:"size"`
+
+	// Snapshot is the name of the logical volume in the same volume group
+	// that this is a snapshot of. The Size is the space for the changes.
+	Snapshot string `lang:"snapshot" yaml:"snapshot"`
+
+	// ResizeFs specifies that the filesystem on the volume is resized when
+	// the volume is. You almost certainly want this if there is one.
+	ResizeFs bool `lang:"resizefs" yaml:"resizefs"`
+
+	// Force must be true to allow shrinking the volume when it is larger
+	// than the requested size. Unless ResizeFs is true and the filesystem
+	// supports shrinking, this destroys data!
+	Force bool `lang:"force" yaml:"force"`
+}
+
+// grower returns the storage utility struct that does the real work.
+func (obj *LVMLVRes) grower() *grow.Grow {
+	return &grow.Grow{
+		Debug: obj.init.Debug,
+		Logf:  obj.init.Logf,
+	}
+}
+
+// parse returns the volume group and logical volume names.
+func (obj *LVMLVRes) parse() (string, string, error) {
+	vg, lv, ok := strings.Cut(obj.Name(), "/")
+	if !ok {
+		return "", "", fmt.Errorf("the name must be in the vg/lv format")
+	}
+	if err := grow.IsValidLVMName(vg); err != nil {
+		return "", "", errwrap.Wrapf(err, "invalid volume group name")
+	}
+	if err := grow.IsValidLVMName(lv); err != nil {
+		return "", "", errwrap.Wrapf(err, "invalid logical volume name")
+	}
+	return vg, lv, nil
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *LVMLVRes) Default() engine.Res {
+	return &LVMLVRes{
+		State: "exists",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *LVMLVRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("the State must be exists or absent")
+	}
+	_, lv, err := obj.parse()
+	if err != nil {
+		return err
+	}
+
+	if obj.State == "exists" && obj.Size == "" {
+		return fmt.Errorf("the Size must be specified")
+	}
+	if obj.Size != "" && !grow.IsLVMPercent(obj.Size) {
+		if _, err := grow.ParseLVMSize(obj.Size); err != nil {
+			return err
+		}
+	}
+
+	if obj.Snapshot != "" {
+		if err := grow.IsValidLVMName(obj.Snapshot); err != nil {
+			return errwrap.Wrapf(err, "invalid snapshot origin name")
+		}
+		if obj.Snapshot == lv {
+			return fmt.Errorf("a volume can't be a snapshot of itself")
+		}
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *LVMLVRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *LVMLVRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *LVMLVRes) Watch(ctx context.Context) error {
+	vg, _, err := obj.parse()
+	if err != nil {
+		return err
+	}
+	return lvmWatch(ctx, obj.init, vg)
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *LVMLVRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	g := obj.grower()
+
+	vgName, lvName, err := obj.parse()
+	if err != nil {
+		return false, err
+	}
+	lv, err := g.LV(ctx, vgName, lvName)
+	if err != nil {
+		return false, err
+	}
+
+	if obj.State == "absent" {
+		if lv == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		if err := g.LVRemove(ctx, vgName, lvName); err != nil {
+			return false, errwrap.Wrapf(err, "could not remove the logical volume")
+		}
+		return false, nil
+	}
+
+	percent := grow.IsLVMPercent(obj.Size)
+	var size int64
+	if !percent {
+		if size, err = grow.ParseLVMSize(obj.Size); err != nil {
+			return false, err
+		}
+	}
+
+	if lv == nil {
+		if !apply {
+			return false, nil
+		}
+		s := obj.Size
+		if !percent {
+			s = fmt.Sprintf("%db", size)
+		}
+		if err := g.LVCreate(ctx, vgName, lvName, s, obj.Snapshot); err != nil {
+			return false, errwrap.Wrapf(err, "could not create the logical volume")
+		}
+		return false, nil
+	}
+
+	if lv.Origin != obj.Snapshot {
+		if lv.Origin == "" {
+			return false, fmt.Errorf("the logical volume is not a snapshot")
+		}
+		return false, fmt.Errorf("the logical volume is a snapshot of: %s", lv.Origin)
+	}
+
+	if percent { // only used on creation
+		return true, nil
+	}
+
+	vg, err := g.VG(ctx, vgName)
+	if err != nil {
+		return false, err
+	}
+	if vg == nil { // programming error?
+		return false, fmt.Errorf("the volume group disappeared")
+	}
+	size = grow.RoundExtents(size, vg.ExtentSize)
+
+	if lv.Size == size {
+		return true, nil
+	}
+	if lv.Size > size && !obj.Force { // we only grow
+		if obj.init.Debug {
+			obj.init.Logf("not shrinking from %d to %d bytes", lv.Size, size)
+		}
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+	if err := g.LVResize(ctx, vgName, lvName, size, obj.ResizeFs); err != nil {
+		return false, errwrap.Wrapf(err, "could not resize the logical volume")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *LVMLVRes) Cmp(r engine.Res) error {
+	// we can only compare LVMLVRes to others of the same resource kind
+	res, ok := r.(*LVMLVRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Size != res.Size {
+		return fmt.Errorf("the Size differs")
+	}
+	if obj.Snapshot != res.Snapshot {
+		return fmt.Errorf("the Snapshot differs")
+	}
+	if obj.ResizeFs != res.ResizeFs {
+		return fmt.Errorf("the ResizeFs value differs")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force value differs")
+	}
+
+	return nil
+}
+
+// LVMLVUID is the UID struct for LVMLVRes.
+type LVMLVUID struct {
+	engine.BaseUID
+
+	// vg is the name of the volume group.
+	vg string
+
+	// lv is the name of the logical volume.
+	lv string
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *LVMLVUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*LVMLVUID)
+	if !ok {
+		return false
+	}
+	return obj.vg == res.vg && obj.lv == res.lv
+}
+
+// UIDHash returns the matching identity of this UID as a string. This is part
+// of the engine.ResUIDHashable interface.
+func (obj *LVMLVUID) UIDHash() string {
+	return obj.vg + "/" + obj.lv
+}
+
+// AutoEdges returns an edge from the volume group, and from the origin volume
+// if this is a snapshot. If the volume is absent, then they're reversed, so
+// that we remove it first.
+func (obj *LVMLVRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	vg, _, err := obj.parse()
+	if err != nil {
+		return nil, err
+	}
+	reversed := obj.State == "exists"
+	base := engine.BaseUID{
+		Name:     obj.Name(),
+		Kind:     obj.Kind(),
+		Reversed: &reversed,
+	}
+	uids := []engine.ResUID{
+		&LVMVGUID{
+			BaseUID: base,
+			vg:      vg,
+		},
+	}
+	if obj.Snapshot != "" {
+		uids = append(uids, &LVMLVUID{
+			BaseUID: base,
+			vg:      vg,
+			lv:      obj.Snapshot,
+		})
+	}
+	return &LVMResAutoEdges{
+		uids: uids,
+	}, nil
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one although some resources can return multiple.
+func (obj *LVMLVRes) UIDs() []engine.ResUID {
+	vg, lv, _ := obj.parse()
+	x := &LVMLVUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		vg:      vg,
+		lv:      lv,
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *LVMLVRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes LVMLVRes // indirection to avoid infinite recursion
+
+	def := obj.Default()       // get the default
+	res, ok := def.(*LVMLVRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to LVMLVRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = LVMLVRes(raw) // restore from indirection with type conversion!
+	return nil
+}
+
+// lvmLVUID returns a UID which matches the logical volume at the device path
+// if it is one. It's used by the resources that use the device, eg: mount.
+func lvmLVUID(base engine.BaseUID, dev string) (*LVMLVUID, bool) {
+	vg, lv, ok := grow.ParseLVPath(dev)
+	if !ok {
+		return nil, false
+	}
+	return &LVMLVUID{
+		BaseUID: base,
+		vg:      vg,
+		lv:      lv,
+	}, true
+}
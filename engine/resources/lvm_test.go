@@ -0,0 +1,165 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package resources
+
+import (
+	"context"
+	"testing"
+
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func TestLVMVGValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *LVMVGRes
+		fail bool
+	}{
+		{"vg0", &LVMVGRes{State: "exists", Devices: []string{"/dev/vdb1", "/dev/vdc1"}}, false},
+		{"vg0", &LVMVGRes{State: "absent"}, false},
+		{"vg0", &LVMVGRes{State: "exists"}, true},
+		{"vg0", &LVMVGRes{State: "exists", Devices: []string{"vdb1"}}, true},
+		{"vg0", &LVMVGRes{State: "exists", Devices: []string{"/dev/vdb1", "/dev/vdb1"}}, true},
+		{"vg/0", &LVMVGRes{State: "exists", Devices: []string{"/dev/vdb1"}}, true},
+		{"-vg0", &LVMVGRes{State: "exists", Devices: []string{"/dev/vdb1"}}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("lvm:vg")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestLVMLVValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *LVMLVRes
+		fail bool
+	}{
+		{"vg0/data", &LVMLVRes{State: "exists", Size: "10G"}, false},
+		{"vg0/data", &LVMLVRes{State: "exists", Size: "100%FREE"}, false},
+		{"vg0/data-snap", &LVMLVRes{State: "exists", Size: "1G", Snapshot: "data"}, false},
+		{"vg0/data", &LVMLVRes{State: "absent"}, false},
+		{"data", &LVMLVRes{State: "exists", Size: "10G"}, true},
+		{"vg0/data", &LVMLVRes{State: "exists"}, true},
+		{"vg0/data", &LVMLVRes{State: "exists", Size: "ten"}, true},
+		{"vg0/data", &LVMLVRes{State: "exists", Size: "1G", Snapshot: "data"}, true},
+		{"vg0/snapshot0", &LVMLVRes{State: "exists", Size: "1G"}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("lvm:lv")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestLVMAutoEdges(t *testing.T) {
+	lv := &LVMLVRes{State: "exists", Size: "10G"}
+	lv.SetKind("lvm:lv")
+	lv.SetName("my-vg/data")
+	uids := lv.UIDs()
+
+	tests := []struct {
+		device string
+		match  bool
+	}{
+		{"/dev/my-vg/data", true},
+		{"/dev/mapper/my--vg-data", true},
+		{"/dev/my-vg/other", false},
+		{"/dev/vdb1", false},
+	}
+
+	for i, test := range tests {
+		mount := &MountRes{State: "exists", Device: test.device}
+		mount.SetKind("mount")
+		mount.SetName("/mnt/data")
+		fs := &FsRes{Type: "ext4"}
+		fs.SetKind("fs")
+		fs.SetName(test.device)
+
+		for _, res := range []engine.EdgeableRes{mount, fs} {
+			ae, err := res.AutoEdges(context.Background())
+			if err != nil {
+				t.Errorf("index: %d, unexpected error: %v", i, err)
+				continue
+			}
+			match := false
+			for next := ae.Next(); next != nil; next = ae.Next() {
+				if !next[0].IsReversed() {
+					t.Errorf("index: %d, expected a reversed edge", i)
+				}
+				if next[0].IFF(uids[0]) {
+					match = true
+				}
+				if !ae.Test([]bool{false}) {
+					break
+				}
+			}
+			if match != test.match {
+				t.Errorf("index: %d, %s: expected match: %t", i, res.Kind(), test.match)
+			}
+		}
+	}
+
+	// the volume comes after the volume group, and the snapshot after it
+	snap := &LVMLVRes{State: "exists", Size: "1G", Snapshot: "data"}
+	snap.SetKind("lvm:lv")
+	snap.SetName("my-vg/snap")
+	vg := &LVMVGRes{State: "exists", Devices: []string{"/dev/vdb1"}}
+	vg.SetKind("lvm:vg")
+	vg.SetName("my-vg")
+	ae, err := snap.AutoEdges(context.Background())
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if next := ae.Next(); !next[0].IFF(vg.UIDs()[0]) {
+		t.Errorf("expected an edge from the volume group")
+	}
+	ae.Test([]bool{true})
+	if next := ae.Next(); !next[0].IFF(uids[0]) {
+		t.Errorf("expected an edge from the origin")
+	}
+	if ae.Test([]bool{true}) {
+		t.Errorf("expected no more edges")
+	}
+}
@@ -0,0 +1,421 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/grow"
+	"github.com/purpleidea/mgmt/util/recwatch"
+)
+
+func init() {
+	engine.RegisterResource("lvm:vg", func() engine.Res { return &LVMVGRes{} })
+}
+
+const (
+	// lvmBackupDir is where lvm writes a backup of the metadata of each
+	// volume group whenever it changes. We watch this to notice changes.
+	lvmBackupDir = "/etc/lvm/backup/"
+)
+
+// LVMVGRes is a resource that manages an lvm volume group. The name is the name
+// of the volume group. Any devices which are not physical volumes yet will be
+// initialized as such, but only if they're empty, unless Force is true. Devices
+// that are added to the list will extend the volume group.
+type LVMVGRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State is either exists or absent.
+	State string `lang:"state" yaml:"state"`
+
+	// Devices is the list of devices (physical volumes) in the volume
+	// group, eg: ["/dev/vdb1", "/dev/vdc1"].
+	Devices []string `lang:"devices" yaml:"devices"`
+
+	// Force must be true to allow initializing a device which contains a
+	// different signature, to remove any physical volumes which are in the
+	// volume group but not in our list of devices, and to remove a volume
+	// group which still contains logical volumes. This destroys data!
+	Force bool `lang:"force" yaml:"force"`
+}
+
+// grower returns the storage utility struct that does the real work.
+func (obj *LVMVGRes) grower() *grow.Grow {
+	return &grow.Grow{
+		Debug: obj.init.Debug,
+		Logf:  obj.init.Logf,
+	}
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *LVMVGRes) Default() engine.Res {
+	return &LVMVGRes{
+		State: "exists",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *LVMVGRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("the State must be exists or absent")
+	}
+	if err := grow.IsValidLVMName(obj.Name()); err != nil {
+		return errwrap.Wrapf(err, "invalid volume group name")
+	}
+
+	if obj.State == "exists" && len(obj.Devices) == 0 {
+		return fmt.Errorf("at least one device must be specified")
+	}
+	seen := make(map[string]struct{})
+	for _, x := range obj.Devices {
+		if !strings.HasPrefix(x, "/") || strings.HasSuffix(x, "/") {
+			return fmt.Errorf("invalid device: %s", x)
+		}
+		if _, exists := seen[x]; exists {
+			return fmt.Errorf("duplicate device: %s", x)
+		}
+		seen[x] = struct{}{}
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *LVMVGRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *LVMVGRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *LVMVGRes) Watch(ctx context.Context) error {
+	return lvmWatch(ctx, obj.init, obj.Name())
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *LVMVGRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	g := obj.grower()
+
+	vg, err := g.VG(ctx, obj.Name())
+	if err != nil {
+		return false, err
+	}
+
+	if obj.State == "absent" {
+		if vg == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		if err := g.VGRemove(ctx, obj.Name(), obj.Force); err != nil {
+			return false, errwrap.Wrapf(err, "could not remove the volume group")
+		}
+		return false, nil
+	}
+
+	pvs, err := g.PVs(ctx)
+	if err != nil {
+		return false, err
+	}
+	pvMap := make(map[string]string) // device -> volume group
+	for _, pv := range pvs {
+		pvMap[lvmDevice(pv.Name)] = pv.VG
+	}
+
+	devices := make(map[string]struct{})
+	pvcreate := []string{}
+	missing := []string{}
+	for _, x := range obj.Devices {
+		dev := lvmDevice(x)
+		devices[dev] = struct{}{}
+
+		name, exists := pvMap[dev]
+		if exists && name == obj.Name() {
+			continue // already in our volume group
+		}
+		if exists && name != "" {
+			return false, fmt.Errorf("device %s is in volume group %s", x, name)
+		}
+		missing = append(missing, dev)
+		if exists { // an unused physical volume
+			continue
+		}
+
+		info, err := g.Blkid(ctx, dev)
+		if err != nil {
+			return false, err
+		}
+		if info.Type != "" && info.Type != grow.LVMMember && !obj.Force {
+			return false, fmt.Errorf("refusing to initialize %s which contains: %s (%s)", x, info.Type, info.UUID)
+		}
+		pvcreate = append(pvcreate, dev)
+	}
+
+	extra := []string{}
+	for _, pv := range pvs {
+		if _, exists := devices[lvmDevice(pv.Name)]; pv.VG == obj.Name() && !exists {
+			extra = append(extra, pv.Name)
+		}
+	}
+	if len(extra) > 0 && !obj.Force && obj.init.Debug {
+		obj.init.Logf("ignoring extra devices: %s", strings.Join(extra, ", "))
+	}
+
+	if vg != nil && len(missing) == 0 && (len(extra) == 0 || !obj.Force) {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	for _, dev := range pvcreate {
+		if err := g.PVCreate(ctx, dev); err != nil {
+			return false, errwrap.Wrapf(err, "could not initialize %s", dev)
+		}
+	}
+
+	if vg == nil {
+		if err := g.VGCreate(ctx, obj.Name(), missing); err != nil {
+			return false, errwrap.Wrapf(err, "could not create the volume group")
+		}
+		return false, nil
+	}
+
+	if len(missing) > 0 {
+		if err := g.VGExtend(ctx, obj.Name(), missing); err != nil {
+			return false, errwrap.Wrapf(err, "could not extend the volume group")
+		}
+	}
+	if len(extra) > 0 && obj.Force {
+		if err := g.VGReduce(ctx, obj.Name(), extra); err != nil {
+			return false, errwrap.Wrapf(err, "could not reduce the volume group")
+		}
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *LVMVGRes) Cmp(r engine.Res) error {
+	// we can only compare LVMVGRes to others of the same resource kind
+	res, ok := r.(*LVMVGRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if len(obj.Devices) != len(res.Devices) {
+		return fmt.Errorf("the number of Devices differs")
+	}
+	for i, x := range obj.Devices {
+		if x != res.Devices[i] {
+			return fmt.Errorf("the Devices differ at index: %d", i)
+		}
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force value differs")
+	}
+
+	return nil
+}
+
+// LVMVGUID is the UID struct for LVMVGRes.
+type LVMVGUID struct {
+	engine.BaseUID
+
+	// vg is the name of the volume group.
+	vg string
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *LVMVGUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*LVMVGUID)
+	if !ok {
+		return false
+	}
+	return obj.vg == res.vg
+}
+
+// UIDHash returns the matching identity of this UID as a string. This is part
+// of the engine.ResUIDHashable interface.
+func (obj *LVMVGUID) UIDHash() string {
+	return obj.vg
+}
+
+// LVMResAutoEdges holds the state of the auto edge generator.
+type LVMResAutoEdges struct {
+	uids    []engine.ResUID
+	pointer int
+}
+
+// Next returns the next automatic edge.
+func (obj *LVMResAutoEdges) Next() []engine.ResUID {
+	if len(obj.uids) == 0 {
+		return nil
+	}
+	value := obj.uids[obj.pointer]
+	obj.pointer++
+	return []engine.ResUID{value}
+}
+
+// Test gets results of the earlier Next() call, & returns if we should
+// continue.
+func (obj *LVMResAutoEdges) Test(input []bool) bool {
+	if len(obj.uids) <= obj.pointer {
+		return false
+	}
+	if len(input) != 1 { // in case we get given bad data
+		panic("expecting a single value")
+	}
+	return true // keep going
+}
+
+// AutoEdges returns edges from the partition resources that provide the
+// devices. If the volume group is absent, then they're reversed, so that we
+// remove it before the partitions.
+func (obj *LVMVGRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := obj.State == "exists"
+	uids := []engine.ResUID{}
+	for _, x := range obj.Devices {
+		uids = append(uids, &PartitionUID{
+			BaseUID: engine.BaseUID{
+				Name:     obj.Name(),
+				Kind:     obj.Kind(),
+				Reversed: &reversed,
+			},
+			device: x,
+		})
+	}
+	return &LVMResAutoEdges{
+		uids: uids,
+	}, nil
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one although some resources can return multiple.
+func (obj *LVMVGRes) UIDs() []engine.ResUID {
+	x := &LVMVGUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		vg:      obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *LVMVGRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes LVMVGRes // indirection to avoid infinite recursion
+
+	def := obj.Default()       // get the default
+	res, ok := def.(*LVMVGRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to LVMVGRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = LVMVGRes(raw) // restore from indirection with type conversion!
+	return nil
+}
+
+// lvmDevice resolves any symlinks in the device path, so that we can compare
+// the paths that we're given with the ones that lvm reports.
+func lvmDevice(dev string) string {
+	p, err := filepath.EvalSymlinks(dev)
+	if err != nil {
+		return dev // doesn't exist (yet) so use it as is
+	}
+	return p
+}
+
+// lvmWatch watches the metadata backup file that lvm writes whenever the volume
+// group changes. Nothing is written if backups are disabled in lvm.conf, but
+// we still get the initial event.
+func lvmWatch(ctx context.Context, init *engine.Init, vg string) error {
+	recurse := false
+	recWatcher, err := recwatch.NewRecWatcher(lvmBackupDir+vg, recurse)
+	if err != nil {
+		return err
+	}
+	defer recWatcher.Close()
+
+	if err := init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-recWatcher.Events():
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if event == nil {
+				// programming error
+				return fmt.Errorf("unexpected nil recwatch event")
+			}
+			if err := event.Error; err != nil {
+				return errwrap.Wrapf(err, "unknown lvm watcher error")
+			}
+			if init.Debug { // don't access event.Body if event.Error isn't nil
+				init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if err := init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
@@ -118,6 +118,7 @@ const (
 // accordingly. The mount point is set according to the resource's name.
 type MountRes struct {
 	traits.Base
+	traits.Edgeable
 
 	init *engine.Init
 
@@ -337,14 +338,7 @@ func (obj *MountRes) fstabEntryRemove(file string, mount *fstab.Mount) error {
 // fstabWrite generates an fstab file with the given mounts, and writes them to
 // the provided fstab file.
 func (obj *MountRes) fstabWrite(file string, mounts fstab.Mounts) error {
-	// build the file contents
-	contents := fmt.Sprintf("# Generated by %s at %d", obj.init.Program, time.Now().UnixNano()) + "\n"
-	contents = contents + mounts.String() + "\n"
-	// write the file
-	if err := os.WriteFile(file, []byte(contents), fstabUmask); err != nil {
-		return errwrap.Wrapf(err, "error writing fstab file: %s", file)
-	}
-	return nil
+	return fstabWrite(obj.init.Program, file, mounts)
 }
 
 // fstabCheckApply checks /etc/fstab for entries corresponding to the resource
@@ -460,6 +454,70 @@ func (obj *MountRes) Cmp(r engine.Res) error {
 	return nil
 }
 
+// MountResAutoEdges holds the state of the auto edge generator.
+type MountResAutoEdges struct {
+	uids    []engine.ResUID
+	pointer int
+}
+
+// Next returns the next automatic edge.
+func (obj *MountResAutoEdges) Next() []engine.ResUID {
+	if len(obj.uids) == 0 {
+		return nil
+	}
+	value := obj.uids[obj.pointer]
+	obj.pointer++
+	return []engine.ResUID{value}
+}
+
+// Test gets results of the earlier Next() call, & returns if we should
+// continue.
+func (obj *MountResAutoEdges) Test(input []bool) bool {
+	if len(obj.uids) <= obj.pointer {
+		return false
+	}
+	if len(input) != 1 { // in case we get given bad data
+		panic("expecting a single value")
+	}
+	return true // keep going
+}
+
+// AutoEdges returns an edge from the fs resource which makes the filesystem
+// that we mount, and from the lvm:lv resource if the device is a logical
+// volume. The device can be specified by path, label or uuid. If the mount is
+// absent, then the edges are reversed so we unmount first.
+func (obj *MountRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := obj.State == "exists"
+	base := engine.BaseUID{
+		Name:     obj.Name(),
+		Kind:     obj.Kind(),
+		Reversed: &reversed,
+	}
+	uid := &FsUID{
+		BaseUID: base,
+	}
+	uids := []engine.ResUID{uid}
+
+	m := &fstab.Mount{Spec: obj.Device}
+	switch m.SpecType() {
+	case fstab.UUID:
+		uid.uuid = m.SpecValue()
+	case fstab.Label:
+		uid.label = m.SpecValue()
+	case fstab.Path:
+		uid.device = m.SpecValue()
+		if lv, ok := lvmLVUID(base, uid.device); ok {
+			uids = append(uids, lv)
+		}
+	default:
+		return nil, nil // nothing we can match
+	}
+
+	return &MountResAutoEdges{
+		uids: uids,
+	}, nil
+}
+
 // MountUID is a unique resource identifier.
 type MountUID struct {
 	engine.BaseUID
@@ -539,6 +597,19 @@ func fstabEntryExists(file string, mount *fstab.Mount) (bool, error) {
 	return false, nil
 }
 
+// fstabWrite generates an fstab file with the given mounts, and writes them to
+// the provided fstab file. The program name is used in the header comment.
+func fstabWrite(program, file string, mounts fstab.Mounts) error {
+	// build the file contents
+	contents := fmt.Sprintf("# Generated by %s at %d", program, time.Now().UnixNano()) + "\n"
+	contents = contents + mounts.String() + "\n"
+	// write the file
+	if err := os.WriteFile(file, []byte(contents), fstabUmask); err != nil {
+		return errwrap.Wrapf(err, "error writing fstab file: %s", file)
+	}
+	return nil
+}
+
 // mountExists returns true, if a given mount exists in the given file
 // (typically /proc/mounts.)
 func mountExists(file string, mount *fstab.Mount) (bool, error) {
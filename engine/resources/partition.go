@@ -0,0 +1,427 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/grow"
+	"github.com/purpleidea/mgmt/util/recwatch"
+)
+
+func init() {
+	engine.RegisterResource("partition", func() engine.Res { return &PartitionRes{} })
+}
+
+// PartitionRes is a resource that manages a single partition on a disk. The
+// name is the path to the partition device, eg: /dev/vdb1 or /dev/nvme0n1p3
+// from which we determine the disk and the partition number. If the disk does
+// not have a partition table, then one is created, unless the disk contains
+// some other signature and Force is not set. Existing partitions are never
+// moved, shrunk or recreated, but their type and name are changed if they
+// differ, and they can be grown to fill any free space which follows them.
+type PartitionRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State must be exists or absent. If absent, the partition is removed
+	// from the partition table and the remaining fields are ignored.
+	State string `lang:"state" yaml:"state"`
+
+	// Table is the type of partition table to create if the disk doesn't
+	// have one. This is either gpt or dos. It defaults to gpt. If the disk
+	// already has a partition table of a different type, we error.
+	Table string `lang:"table" yaml:"table"`
+
+	// Size is the size of the partition in bytes. It is only used when the
+	// partition is created. If this is zero, then the largest free space
+	// available on the disk is used.
+	Size int `lang:"size" yaml:"size"`
+
+	// Type is the partition type. This can be a gpt type uuid, a dos type
+	// hex code, or one of the common aliases: linux, swap, home, uefi, lvm
+	// or raid. If empty, the default of linux is used on creation and the
+	// type of an existing partition is not managed.
+	Type string `lang:"type" yaml:"type"`
+
+	// Label is the partition name. This is only supported on gpt tables.
+	Label string `lang:"label" yaml:"label"`
+
+	// Grow specifies that the partition should be grown to fill any free
+	// space which directly follows it. This uses the growpart utility.
+	Grow bool `lang:"grow" yaml:"grow"`
+
+	// Force must be true to allow writing a new partition table onto a
+	// disk which has no partition table that we recognize, but which does
+	// contain some other signature such as a filesystem or an lvm pv. This
+	// destroys data!
+	Force bool `lang:"force" yaml:"force"`
+
+	disk string // the disk device, eg: /dev/vdb
+	num  int    // the partition number
+}
+
+// grower returns the storage utility struct that does the real work.
+func (obj *PartitionRes) grower() *grow.Grow {
+	return &grow.Grow{
+		Debug: obj.init.Debug,
+		Logf:  obj.init.Logf,
+	}
+}
+
+// parse returns the disk and partition number from the name.
+func (obj *PartitionRes) parse() (string, int, error) {
+	disk, part, err := (&grow.Grow{}).GrowPartArgs(obj.Name())
+	if err != nil {
+		return "", 0, err
+	}
+	num, err := strconv.Atoi(part)
+	if err != nil {
+		return "", 0, err
+	}
+	if num <= 0 {
+		return "", 0, fmt.Errorf("invalid partition number: %d", num)
+	}
+	return disk, num, nil
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *PartitionRes) Default() engine.Res {
+	return &PartitionRes{
+		State: "exists",
+		Table: "gpt",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *PartitionRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be 'exists', or 'absent'")
+	}
+
+	if !strings.HasPrefix(obj.Name(), grow.DevDir) {
+		return fmt.Errorf("the partition must be in: %s", grow.DevDir)
+	}
+	if _, _, err := obj.parse(); err != nil {
+		return errwrap.Wrapf(err, "invalid partition name")
+	}
+
+	if _, exists := grow.PartTypeAliases[obj.Table]; !exists {
+		return fmt.Errorf("the table must be 'gpt' or 'dos'")
+	}
+	if obj.Size < 0 {
+		return fmt.Errorf("the size must not be negative")
+	}
+	if obj.Label != "" && obj.Table != "gpt" {
+		return fmt.Errorf("the label is only supported on gpt tables")
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *PartitionRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	disk, num, err := obj.parse()
+	if err != nil {
+		return err
+	}
+	obj.disk = disk
+	obj.num = num
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *PartitionRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events. We
+// watch the /dev/disk/ tree which udev updates whenever the partitions change.
+func (obj *PartitionRes) Watch(ctx context.Context) error {
+	recurse := true // the by-path/ and by-partuuid/ dirs are inside
+	recWatcher, err := recwatch.NewRecWatcher(devDisk, recurse)
+	if err != nil {
+		return err
+	}
+	defer recWatcher.Close()
+
+	if err := obj.init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-recWatcher.Events():
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if event == nil {
+				// programming error
+				return fmt.Errorf("unexpected nil recwatch event")
+			}
+			if err := event.Error; err != nil {
+				return errwrap.Wrapf(err, "unknown %s watcher error", obj)
+			}
+			if obj.init.Debug { // don't access event.Body if event.Error isn't nil
+				obj.init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *PartitionRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	g := obj.grower()
+
+	table, err := g.PartTable(ctx, obj.disk)
+	if err != nil {
+		return false, err
+	}
+
+	var part *grow.Partition
+	if table != nil {
+		for _, p := range table.Partitions {
+			if p.Node == obj.Name() {
+				part = p
+				break
+			}
+		}
+	}
+
+	if obj.State == "absent" {
+		if part == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		if err := g.DelPart(ctx, obj.disk, obj.num); err != nil {
+			return false, errwrap.Wrapf(err, "could not delete the partition")
+		}
+		return false, nil
+	}
+
+	if table == nil { // no partition table yet
+		// The whole disk might be a filesystem or an lvm pv...
+		info, err := g.Blkid(ctx, obj.disk)
+		if err != nil {
+			return false, err
+		}
+		if !info.Empty() && !obj.Force {
+			return false, fmt.Errorf("refusing to make a partition table on %s which contains: %s", obj.disk, info)
+		}
+		if !apply {
+			return false, nil
+		}
+		if !info.Empty() {
+			if err := g.Wipefs(ctx, obj.disk); err != nil {
+				return false, errwrap.Wrapf(err, "could not wipe the disk")
+			}
+		}
+		if err := g.MkPartTable(ctx, obj.disk, obj.Table); err != nil {
+			return false, errwrap.Wrapf(err, "could not make the partition table")
+		}
+		if table, err = g.PartTable(ctx, obj.disk); err != nil {
+			return false, err
+		}
+		if table == nil {
+			return false, fmt.Errorf("the partition table is missing")
+		}
+	}
+
+	if table.Label != obj.Table {
+		return false, fmt.Errorf("the disk has an unexpected partition table of: %s", table.Label)
+	}
+
+	if part == nil {
+		if !apply {
+			return false, nil
+		}
+		// round up to the nearest sector
+		size := (int64(obj.Size) + table.SectorSize - 1) / table.SectorSize
+		if err := g.AddPart(ctx, obj.disk, obj.num, size, obj.Type, obj.Label); err != nil {
+			return false, errwrap.Wrapf(err, "could not add the partition")
+		}
+		return false, nil
+	}
+
+	checkOK := true
+
+	if typ := grow.PartType(table.Label, obj.Type); obj.Type != "" && !strings.EqualFold(typ, part.Type) {
+		checkOK = false
+		if !apply {
+			return false, nil
+		}
+		if err := g.SetPartType(ctx, obj.disk, obj.num, typ); err != nil {
+			return false, errwrap.Wrapf(err, "could not set the partition type")
+		}
+	}
+
+	if obj.Label != "" && obj.Label != part.Name {
+		checkOK = false
+		if !apply {
+			return false, nil
+		}
+		if err := g.SetPartName(ctx, obj.disk, obj.num, obj.Label); err != nil {
+			return false, errwrap.Wrapf(err, "could not set the partition name")
+		}
+	}
+
+	if !obj.Grow {
+		return checkOK, nil
+	}
+
+	if ok, err := g.GrowPartCheck(ctx, obj.Name()); err != nil {
+		return false, err
+	} else if !ok {
+		return checkOK, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+	if err := g.GrowPart(ctx, obj.Name()); err != nil {
+		return false, errwrap.Wrapf(err, "could not grow the partition")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *PartitionRes) Cmp(r engine.Res) error {
+	// we can only compare PartitionRes to others of the same resource kind
+	res, ok := r.(*PartitionRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Table != res.Table {
+		return fmt.Errorf("the Table differs")
+	}
+	if obj.Size != res.Size {
+		return fmt.Errorf("the Size differs")
+	}
+	if obj.Type != res.Type {
+		return fmt.Errorf("the Type differs")
+	}
+	if obj.Label != res.Label {
+		return fmt.Errorf("the Label differs")
+	}
+	if obj.Grow != res.Grow {
+		return fmt.Errorf("the Grow value differs")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force value differs")
+	}
+
+	return nil
+}
+
+// PartitionUID is the UID struct for PartitionRes.
+type PartitionUID struct {
+	engine.BaseUID
+
+	// device is the path to the partition device.
+	device string
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *PartitionUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*PartitionUID)
+	if !ok {
+		return false
+	}
+	return obj.device == res.device
+}
+
+// UIDHash returns the matching identity of this UID as a string. This is part
+// of the engine.ResUIDHashable interface.
+func (obj *PartitionUID) UIDHash() string {
+	return obj.device
+}
+
+// AutoEdges returns the AutoEdge interface. There are no automatic edges for
+// this resource, although other resources which use the partition will add
+// edges pointing at it.
+func (obj *PartitionRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	return nil, nil
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one although some resources can return multiple.
+func (obj *PartitionRes) UIDs() []engine.ResUID {
+	x := &PartitionUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		device:  obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *PartitionRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes PartitionRes // indirection to avoid infinite recursion
+
+	def := obj.Default()           // get the default
+	res, ok := def.(*PartitionRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to PartitionRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = PartitionRes(raw) // restore from indirection with type conversion!
+	return nil
+}
@@ -0,0 +1,334 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/util/podman"
+	"github.com/purpleidea/mgmt/util/recwatch"
+)
+
+const (
+	// podmanStateRunning is the running state of a container or pod.
+	podmanStateRunning = "running"
+	// podmanStateStopped is the stopped state of a container or pod.
+	podmanStateStopped = "stopped"
+	// podmanStateRemoved is the removed state of a container or pod.
+	podmanStateRemoved = "removed"
+
+	// podmanRetryInterval is how long we wait before reconnecting to the
+	// event stream after it ends unexpectedly.
+	podmanRetryInterval = 1 * time.Second
+)
+
+// podmanValidateConn checks the socket and user parameters which all of the
+// podman resources have. The Socket is the path to the podman API socket. If it
+// and the User are empty, then the rootful socket at /run/podman/podman.sock is
+// used. The User is the name of the user whose rootless socket we should use.
+func podmanValidateConn(socket, username string) error {
+	if socket != "" && username != "" {
+		return fmt.Errorf("can't specify both socket and user")
+	}
+	if s := strings.TrimPrefix(socket, "unix://"); socket != "" && !strings.HasPrefix(s, "/") {
+		return fmt.Errorf("the socket must be an absolute path")
+	}
+	return nil
+}
+
+// podmanUID returns the uid of the user, or the empty string if it's empty and
+// we're rootful.
+func podmanUID(username string) (string, error) {
+	if username == "" {
+		return "", nil
+	}
+	u, err := user.Lookup(username)
+	if err != nil {
+		return "", err
+	}
+	return u.Uid, nil
+}
+
+// podmanSocket returns the path to the socket that we should use.
+func podmanSocket(socket, username string) (string, error) {
+	if socket != "" {
+		return strings.TrimPrefix(socket, "unix://"), nil
+	}
+	uid, err := podmanUID(username)
+	if err != nil {
+		return "", err
+	}
+	if uid != "" {
+		return podman.UserSocket(uid), nil
+	}
+	return podman.DefaultSocket, nil
+}
+
+// podmanClient returns a new client for the socket. Don't forget to close it.
+func podmanClient(init *engine.Init, socket, username string) (*podman.Client, error) {
+	s, err := podmanSocket(socket, username)
+	if err != nil {
+		return nil, err
+	}
+	return &podman.Client{
+		Socket: s,
+		Debug:  init.Debug,
+		Logf: func(format string, v ...interface{}) {
+			init.Logf("podman: "+format, v...)
+		},
+	}, nil
+}
+
+// podmanWatch sends events whenever the podman events which match the filters
+// happen. If the service isn't running, then we watch for the socket to appear
+// and connect then. This supports socket activation, since the service starts
+// when we connect, and keeps running while we stream the events. If the file
+// parameter isn't empty, then that file is watched too.
+func podmanWatch(ctx context.Context, init *engine.Init, client *podman.Client, filters map[string][]string, file string) error {
+	socketWatcher, err := recwatch.NewRecWatcher(client.Socket, false)
+	if err != nil {
+		return err
+	}
+	defer socketWatcher.Close()
+
+	var fileEvents chan *recwatch.Event
+	if file != "" {
+		fileWatcher, err := recwatch.NewRecWatcher(file, false)
+		if err != nil {
+			return err
+		}
+		defer fileWatcher.Close()
+		fileEvents = fileWatcher.Events()
+	}
+
+	for {
+		events, errch, err := client.Events(ctx, filters)
+		if err != nil && ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// We'll try again when the socket changes.
+			if init.Debug {
+				init.Logf("could not stream events: %v", err)
+			}
+		}
+
+		// Either way, the state may have changed since the last time.
+		if err := init.Event(ctx); err != nil {
+			return err
+		}
+
+		if err := podmanWatchLoop(ctx, init, events, errch, socketWatcher.Events(), fileEvents); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(podmanRetryInterval): // don't spin
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// podmanWatchLoop sends events until the event stream ends, in which case it
+// returns nil so that we reconnect. If events is nil, then it also returns when
+// the socket changes, so that we can try to connect again.
+func podmanWatchLoop(ctx context.Context, init *engine.Init, events <-chan *podman.Event, errch <-chan error, socketEvents, fileEvents chan *recwatch.Event) error {
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok { // the stream ended, perhaps the service restarted
+				if err := <-errch; err != nil {
+					init.Logf("event stream error: %v", err)
+				}
+				return nil
+			}
+			if init.Debug {
+				init.Logf("event(%s): %s %s", event.Type, event.Action, event.Actor.Attributes["name"])
+			}
+
+		case event, ok := <-socketEvents:
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if err := event.Error; err != nil {
+				return err
+			}
+			if events == nil { // not connected, so try now
+				return nil
+			}
+			continue // connected, so the stream tells us what we need
+
+		case event, ok := <-fileEvents:
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if err := event.Error; err != nil {
+				return err
+			}
+			if init.Debug { // don't access event.Body if event.Error isn't nil
+				init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if err := init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// podmanPortMappings converts the ports in the format that the docker resource
+// uses into the list that the API wants. The list is sorted so that it hashes
+// consistently.
+func podmanPortMappings(ports map[string]map[int64]int64) []podman.PortMapping {
+	l := []podman.PortMapping{}
+	for _, proto := range []string{"tcp", "udp", "sctp"} { // sorted
+		v, exists := ports[proto]
+		if !exists {
+			continue
+		}
+		hosts := []int64{}
+		for p := range v {
+			hosts = append(hosts, p)
+		}
+		sort.Slice(hosts, func(i, j int) bool { return hosts[i] < hosts[j] })
+		for _, p := range hosts {
+			l = append(l, podman.PortMapping{
+				HostPort:      uint16(p),
+				ContainerPort: uint16(v[p]),
+				Protocol:      proto,
+			})
+		}
+	}
+	return l
+}
+
+// podmanValidatePorts validates ports in the format of podmanPortMappings.
+func podmanValidatePorts(ports map[string]map[int64]int64) error {
+	for k, v := range ports {
+		if k != "tcp" && k != "udp" && k != "sctp" {
+			return fmt.Errorf("ports primary key should be tcp, udp or sctp")
+		}
+		for p, q := range v {
+			if (p < 1 || p > 65535) || (q < 1 || q > 65535) {
+				return fmt.Errorf("ports must be between 1 and 65535")
+			}
+		}
+	}
+	return nil
+}
+
+// podmanNetworks converts a list of network names to the map the API wants.
+func podmanNetworks(networks []string) map[string]map[string]string {
+	if len(networks) == 0 {
+		return nil
+	}
+	m := make(map[string]map[string]string)
+	for _, x := range networks {
+		m[x] = map[string]string{}
+	}
+	return m
+}
+
+// podmanMapCmp compares two string maps and returns an error if they differ.
+func podmanMapCmp(x, y map[string]string) error {
+	if len(x) != len(y) {
+		return fmt.Errorf("lengths differ")
+	}
+	for k, v := range x {
+		if w, exists := y[k]; !exists || v != w {
+			return fmt.Errorf("key %s differs", k)
+		}
+	}
+	return nil
+}
+
+// podmanDrift decides what to do with an existing object whose labels are the
+// labels, when we expect it to have been created with the hash. If it was not
+// created by us, it has no hash, and we adopt it as it is. If it differs, then
+// we only recreate it if force is true, since that can destroy data.
+func podmanDrift(labels map[string]string, hash string, force bool) (bool, error) {
+	h, exists := labels[podman.LabelHash]
+	if !exists || h == hash {
+		return false, nil
+	}
+	if !force {
+		return false, fmt.Errorf("it exists but differs from the definition, and force is false")
+	}
+	return true, nil
+}
+
+// podmanLabels returns a copy of the labels with the hash added.
+func podmanLabels(labels map[string]string, hash string) map[string]string {
+	m := map[string]string{}
+	for k, v := range labels {
+		m[k] = v
+	}
+	m[podman.LabelHash] = hash
+	return m
+}
+
+// PodmanResAutoEdges holds the state of the auto edge generator which is shared
+// by the podman resources.
+type PodmanResAutoEdges struct {
+	UIDs    []engine.ResUID
+	pointer int
+}
+
+// Next returns the next automatic edge.
+func (obj *PodmanResAutoEdges) Next() []engine.ResUID {
+	if len(obj.UIDs) == 0 {
+		return nil
+	}
+	value := obj.UIDs[obj.pointer]
+	obj.pointer++
+	return []engine.ResUID{value}
+}
+
+// Test gets results of the earlier Next() call, & returns if we should
+// continue.
+func (obj *PodmanResAutoEdges) Test(input []bool) bool {
+	if len(obj.UIDs) <= obj.pointer {
+		return false
+	}
+	if len(input) != 1 { // in case we get given bad data
+		panic("Expecting a single value!")
+	}
+	return true // keep going
+}
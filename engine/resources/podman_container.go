@@ -0,0 +1,784 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/podman"
+)
+
+func init() {
+	engine.RegisterResource("podman:container", func() engine.Res { return &PodmanContainerRes{} })
+}
+
+var _ engine.EdgeableRes = &PodmanContainerRes{} // compile time check
+
+// PodmanContainerRes is a podman container resource. The resource's name is the
+// name of the container. It talks to the podman API socket, which can be the
+// rootless socket of a user. If the Quadlet parameter is true, then instead of
+// creating the container directly, we write a quadlet file so that systemd
+// runs it as a service named after the container, and we start or stop that.
+type PodmanContainerRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State of the container must be running, stopped, or removed.
+	State string `lang:"state" yaml:"state"`
+
+	// Image is the image, or image:tag. It's pulled if it's missing.
+	Image string `lang:"image" yaml:"image"`
+
+	// Cmd is the command and its arguments to run in the container. If
+	// empty, then the image default is used.
+	Cmd []string `lang:"cmd" yaml:"cmd"`
+
+	// Env is a list of environment variables. E.g. ["VAR=val"].
+	Env []string `lang:"env" yaml:"env"`
+
+	// Ports is a map of port bindings. E.g. {"tcp" => {8080 => 80}}. The
+	// key is the host port, and the val is the inner service port to
+	// forward to. This must be empty if the container is in a pod.
+	Ports map[string]map[int64]int64 `lang:"ports" yaml:"ports"`
+
+	// Volumes is a list of volumes to mount, in the src:dst[:opts] format.
+	// If the source is an absolute path, it's a bind mount, otherwise it
+	// is the name of a volume. E.g. ["data:/var/lib/data:Z"].
+	Volumes []string `lang:"volumes" yaml:"volumes"`
+
+	// Networks is the list of networks to join. This must be empty if the
+	// container is in a pod.
+	Networks []string `lang:"networks" yaml:"networks"`
+
+	// Pod is the optional name of the pod to run this container in.
+	Pod string `lang:"pod" yaml:"pod"`
+
+	// Labels are the labels to set on the container.
+	Labels map[string]string `lang:"labels" yaml:"labels"`
+
+	// HealthCmd is the healthcheck command. If it's a single string, then
+	// it's run with the shell. If empty, the image healthcheck is used if
+	// it has one.
+	HealthCmd []string `lang:"health_cmd" yaml:"health_cmd"`
+
+	// HealthInterval is the time between healthchecks, eg: 30s.
+	HealthInterval string `lang:"health_interval" yaml:"health_interval"`
+
+	// HealthTimeout is the maximum time a healthcheck may run, eg: 10s.
+	HealthTimeout string `lang:"health_timeout" yaml:"health_timeout"`
+
+	// HealthStartPeriod is the time to wait for the container to start up
+	// before failed healthchecks count, eg: 1m.
+	HealthStartPeriod string `lang:"health_start_period" yaml:"health_start_period"`
+
+	// HealthRetries is the number of failed healthchecks in a row before
+	// the container is unhealthy.
+	HealthRetries int `lang:"health_retries" yaml:"health_retries"`
+
+	// WaitHealthy, if true, causes us to wait until a container with a
+	// healthcheck is healthy, so that anything which depends on it doesn't
+	// run until it's ready. We error if it becomes unhealthy instead.
+	WaitHealthy bool `lang:"wait_healthy" yaml:"wait_healthy"`
+
+	// RestartUnhealthy, if true, restarts a running container whose
+	// healthcheck says it's unhealthy.
+	RestartUnhealthy bool `lang:"restart_unhealthy" yaml:"restart_unhealthy"`
+
+	// Quadlet, if true, runs the container as a systemd service by writing
+	// a quadlet file to /etc/containers/systemd/ or to the users/<uid>/
+	// directory in there for a rootless user. The service always restarts
+	// the container if it exits, and a running container starts on boot.
+	Quadlet bool `lang:"quadlet" yaml:"quadlet"`
+
+	// Force, if true, this will destroy and recreate the container if it
+	// differs from this definition.
+	Force bool `lang:"force" yaml:"force"`
+
+	// Socket is the path to the podman API socket. If this and User are
+	// empty, then the rootful socket at /run/podman/podman.sock is used.
+	Socket string `lang:"socket" yaml:"socket"`
+
+	// User is the name of the user whose rootless podman socket we use. In
+	// quadlet mode, the service is run by the systemd user manager of this
+	// user, which must be running, eg: with `loginctl enable-linger`.
+	User string `lang:"user" yaml:"user"`
+}
+
+// hasHealthcheck returns true if we define a healthcheck.
+func (obj *PodmanContainerRes) hasHealthcheck() bool {
+	return len(obj.HealthCmd) > 0
+}
+
+// spec returns the spec of the container without the hash label.
+func (obj *PodmanContainerRes) spec() (*podman.ContainerSpec, error) {
+	env := map[string]string{}
+	for _, x := range obj.Env {
+		k, v, _ := strings.Cut(x, "=")
+		env[k] = v
+	}
+
+	spec := &podman.ContainerSpec{
+		Name:         obj.Name(),
+		Image:        obj.Image,
+		Command:      obj.Cmd,
+		Env:          env,
+		Labels:       obj.Labels,
+		PortMappings: podmanPortMappings(obj.Ports),
+		Networks:     podmanNetworks(obj.Networks),
+		Pod:          obj.Pod,
+	}
+
+	for _, x := range obj.Volumes {
+		s := strings.Split(x, ":")
+		opts := []string{}
+		if len(s) == 3 {
+			opts = strings.Split(s[2], ",")
+		}
+		if strings.HasPrefix(s[0], "/") {
+			spec.Mounts = append(spec.Mounts, podman.Mount{
+				Type:        "bind",
+				Source:      s[0],
+				Destination: s[1],
+				Options:     opts,
+			})
+			continue
+		}
+		spec.Volumes = append(spec.Volumes, podman.NamedVolume{
+			Name:    s[0],
+			Dest:    s[1],
+			Options: opts,
+		})
+	}
+
+	if obj.hasHealthcheck() {
+		h := &podman.HealthConfig{
+			Test:    podman.HealthTest(obj.HealthCmd),
+			Retries: obj.HealthRetries,
+		}
+		var err error
+		if h.Interval, err = podman.ParseDuration(obj.HealthInterval); err != nil {
+			return nil, errwrap.Wrapf(err, "invalid health_interval")
+		}
+		if h.Timeout, err = podman.ParseDuration(obj.HealthTimeout); err != nil {
+			return nil, errwrap.Wrapf(err, "invalid health_timeout")
+		}
+		if h.StartPeriod, err = podman.ParseDuration(obj.HealthStartPeriod); err != nil {
+			return nil, errwrap.Wrapf(err, "invalid health_start_period")
+		}
+		spec.HealthConfig = h
+	}
+
+	return spec, nil
+}
+
+// quadletPath returns the path to the quadlet file for this container.
+func (obj *PodmanContainerRes) quadletPath() (string, error) {
+	uid, err := podmanUID(obj.User)
+	if err != nil {
+		return "", err
+	}
+	dir := podman.QuadletDir
+	if uid != "" {
+		dir = podman.QuadletUserDir(uid)
+	}
+	return dir + obj.Name() + ".container", nil
+}
+
+// unit returns the name of the systemd service that quadlet generates.
+func (obj *PodmanContainerRes) unit() string {
+	return obj.Name() + ".service"
+}
+
+// systemctl runs a systemctl command for the service. In rootless mode, this
+// is run against the systemd user manager of the user.
+func (obj *PodmanContainerRes) systemctl(ctx context.Context, args ...string) error {
+	if obj.User != "" {
+		args = append([]string{"--user", "--machine=" + obj.User + "@"}, args...)
+	}
+	opts := &util.SimpleCmdOpts{
+		Debug: obj.init.Debug,
+		Logf: func(format string, v ...interface{}) {
+			obj.init.Logf("systemctl: "+format, v...)
+		},
+	}
+	return util.SimpleCmd(ctx, "systemctl", args, opts)
+}
+
+// isActive returns true if the service is active.
+func (obj *PodmanContainerRes) isActive(ctx context.Context) (bool, error) {
+	args := []string{"is-active", "--quiet", obj.unit()}
+	if obj.User != "" {
+		args = append([]string{"--user", "--machine=" + obj.User + "@"}, args...)
+	}
+	err := exec.CommandContext(ctx, "systemctl", args...).Run()
+	if err == nil {
+		return true, nil
+	}
+	if _, ok := err.(*exec.ExitError); ok { // not active
+		return false, nil
+	}
+	return false, err
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *PodmanContainerRes) Default() engine.Res {
+	return &PodmanContainerRes{
+		State: podmanStateRunning,
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *PodmanContainerRes) Validate() error {
+	if obj.State != podmanStateRunning && obj.State != podmanStateStopped && obj.State != podmanStateRemoved {
+		return fmt.Errorf("state must be running, stopped or removed")
+	}
+	if obj.Name() == "" || strings.ContainsAny(obj.Name(), " \t\n/:") {
+		return fmt.Errorf("invalid container name")
+	}
+
+	if obj.Image == "" {
+		return fmt.Errorf("image must be specified")
+	}
+
+	for _, env := range obj.Env {
+		if !strings.Contains(env, "=") || strings.HasPrefix(env, "=") || strings.Contains(env, "\n") {
+			return fmt.Errorf("invalid environment variable: %s", env)
+		}
+	}
+
+	if err := podmanValidatePorts(obj.Ports); err != nil {
+		return err
+	}
+
+	for _, x := range obj.Volumes {
+		s := strings.Split(x, ":")
+		if len(s) < 2 || len(s) > 3 || s[0] == "" || !strings.HasPrefix(s[1], "/") {
+			return fmt.Errorf("invalid volume: %s", x)
+		}
+	}
+
+	if obj.Pod != "" && (len(obj.Ports) > 0 || len(obj.Networks) > 0) {
+		return fmt.Errorf("the ports and networks must be set on the pod")
+	}
+
+	if _, exists := obj.Labels[podman.LabelHash]; exists {
+		return fmt.Errorf("the %s label is reserved", podman.LabelHash)
+	}
+
+	if !obj.hasHealthcheck() && (obj.HealthInterval != "" || obj.HealthTimeout != "" || obj.HealthStartPeriod != "" || obj.HealthRetries != 0) {
+		return fmt.Errorf("the health parameters require a health_cmd")
+	}
+	if obj.HealthRetries < 0 {
+		return fmt.Errorf("the health_retries must not be negative")
+	}
+	if _, err := obj.spec(); err != nil { // checks the durations
+		return err
+	}
+
+	return podmanValidateConn(obj.Socket, obj.User)
+}
+
+// Init runs some startup code for this resource.
+func (obj *PodmanContainerRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *PodmanContainerRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events. This
+// includes the health_status events, so we notice when it becomes unhealthy.
+func (obj *PodmanContainerRes) Watch(ctx context.Context) error {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	file := ""
+	if obj.Quadlet {
+		if file, err = obj.quadletPath(); err != nil {
+			return err
+		}
+	}
+
+	filters := map[string][]string{
+		"type":      {"container"},
+		"container": {obj.Name()},
+	}
+	return podmanWatch(ctx, obj.init, client, filters, file)
+}
+
+// CheckApply method for Podman container resource.
+func (obj *PodmanContainerRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	if obj.Quadlet {
+		return obj.quadletCheckApply(ctx, client, apply)
+	}
+
+	info, err := client.InspectContainer(ctx, obj.Name())
+	if err != nil {
+		return false, errwrap.Wrapf(err, "error inspecting container")
+	}
+
+	if obj.State == podmanStateRemoved {
+		if info == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		obj.init.Logf("removing...")
+		if err := client.RemoveContainer(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "error removing container")
+		}
+		return false, nil
+	}
+
+	spec, err := obj.spec()
+	if err != nil {
+		return false, err
+	}
+	hash, err := podman.Hash(spec)
+	if err != nil {
+		return false, err
+	}
+
+	recreate := false
+	if info != nil {
+		if recreate, err = podmanDrift(info.Config.Labels, hash, obj.Force); err != nil {
+			return false, errwrap.Wrapf(err, "container %s", obj.Name())
+		}
+	}
+	running := info != nil && !recreate && info.State.Running
+	unhealthy := running && obj.RestartUnhealthy && info.Health() == podman.HealthUnhealthy
+
+	if obj.State == podmanStateStopped {
+		// NOTE: If the container doesn't exist, we accept "stopped" as
+		// valid, just like the docker resource does.
+		if info == nil || !running && !recreate {
+			return true, nil
+		}
+	}
+	if obj.State == podmanStateRunning && running && !unhealthy {
+		return true, obj.waitHealthy(ctx, client)
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if recreate {
+		obj.init.Logf("removing to recreate...")
+		if err := client.RemoveContainer(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "error removing container")
+		}
+		info = nil
+	}
+
+	if obj.State == podmanStateStopped {
+		if info == nil { // it was removed
+			return false, nil
+		}
+		obj.init.Logf("stopping...")
+		if err := client.StopContainer(ctx, obj.Name(), nil); err != nil {
+			return false, errwrap.Wrapf(err, "error stopping container")
+		}
+		return false, nil
+	}
+
+	if unhealthy {
+		obj.init.Logf("restarting unhealthy container...")
+		if err := client.StopContainer(ctx, obj.Name(), nil); err != nil {
+			return false, errwrap.Wrapf(err, "error stopping container")
+		}
+	}
+
+	if info == nil {
+		if err := obj.pull(ctx, client); err != nil {
+			return false, err
+		}
+		obj.init.Logf("creating...")
+		spec.Labels = podmanLabels(spec.Labels, hash)
+		if err := client.CreateContainer(ctx, spec); err != nil {
+			return false, errwrap.Wrapf(err, "error creating container")
+		}
+	}
+
+	obj.init.Logf("starting...")
+	if err := client.StartContainer(ctx, obj.Name()); err != nil {
+		return false, errwrap.Wrapf(err, "error starting container")
+	}
+
+	return false, obj.waitHealthy(ctx, client)
+}
+
+// quadletCheckApply is the CheckApply for when we run as a systemd service.
+func (obj *PodmanContainerRes) quadletCheckApply(ctx context.Context, client *podman.Client, apply bool) (bool, error) {
+	p, err := obj.quadletPath()
+	if err != nil {
+		return false, err
+	}
+
+	active, err := obj.isActive(ctx)
+	if err != nil {
+		return false, errwrap.Wrapf(err, "could not check the service")
+	}
+
+	var content []byte // nil means remove
+	if obj.State != podmanStateRemoved {
+		spec, err := obj.spec()
+		if err != nil {
+			return false, err
+		}
+		q := podman.ContainerQuadlet(spec)
+		q.Description = fmt.Sprintf("The %s container", obj.Name())
+		if obj.State == podmanStateRunning {
+			q.WantedBy = "multi-user.target"
+			if obj.User != "" {
+				q.WantedBy = "default.target"
+			}
+		}
+		content = []byte(q.String())
+	}
+
+	checkOK := true
+
+	if obj.State != podmanStateRunning && active {
+		if !apply {
+			return false, nil
+		}
+		obj.init.Logf("stopping...")
+		if err := obj.systemctl(ctx, "stop", obj.unit()); err != nil {
+			return false, errwrap.Wrapf(err, "could not stop the service")
+		}
+		active = false
+		checkOK = false
+	}
+
+	if apply && content != nil {
+		if err := os.MkdirAll(path.Dir(p), 0755); err != nil {
+			return false, err
+		}
+	}
+	fileOK, err := dropinCheckApply(obj.init, p, content, 0644, apply)
+	if err != nil {
+		return false, err
+	}
+	if !fileOK {
+		if !apply {
+			return false, nil
+		}
+		// the generator only runs on a daemon-reload
+		if err := obj.systemctl(ctx, "daemon-reload"); err != nil {
+			return false, errwrap.Wrapf(err, "could not reload systemd")
+		}
+		checkOK = false
+	}
+
+	if obj.State != podmanStateRunning {
+		return checkOK, nil
+	}
+
+	unhealthy := false
+	if active && obj.RestartUnhealthy {
+		info, err := client.InspectContainer(ctx, obj.Name())
+		if err != nil {
+			return false, errwrap.Wrapf(err, "error inspecting container")
+		}
+		unhealthy = info != nil && info.Health() == podman.HealthUnhealthy
+	}
+
+	if active && fileOK && !unhealthy {
+		return checkOK, obj.waitHealthy(ctx, client)
+	}
+	if !apply {
+		return false, nil
+	}
+
+	// restart if the definition changed, so that it takes effect
+	obj.init.Logf("restarting...")
+	if err := obj.systemctl(ctx, "restart", obj.unit()); err != nil {
+		return false, errwrap.Wrapf(err, "could not restart the service")
+	}
+
+	return false, obj.waitHealthy(ctx, client)
+}
+
+// pull pulls the image if we don't have it yet.
+func (obj *PodmanContainerRes) pull(ctx context.Context, client *podman.Client) error {
+	image := podmanImageNameTag(obj.Image)
+	info, err := client.InspectImage(ctx, image)
+	if err != nil {
+		return errwrap.Wrapf(err, "error inspecting image")
+	}
+	if info != nil {
+		return nil
+	}
+	obj.init.Logf("pulling...")
+	if err := client.PullImage(ctx, image); err != nil {
+		return errwrap.Wrapf(err, "error pulling image")
+	}
+	return nil
+}
+
+// waitHealthy waits for the container to become healthy if we were asked to.
+// It errors if the container becomes unhealthy instead.
+func (obj *PodmanContainerRes) waitHealthy(ctx context.Context, client *podman.Client) error {
+	if !obj.WaitHealthy {
+		return nil
+	}
+	logged := false
+	for {
+		info, err := client.InspectContainer(ctx, obj.Name())
+		if err != nil {
+			return errwrap.Wrapf(err, "error inspecting container")
+		}
+		if info == nil {
+			return fmt.Errorf("container %s disappeared", obj.Name())
+		}
+		switch health := info.Health(); health {
+		case "", podman.HealthHealthy: // no healthcheck or healthy
+			return nil
+		case podman.HealthUnhealthy:
+			return fmt.Errorf("container %s is unhealthy", obj.Name())
+		default:
+			if !logged {
+				obj.init.Logf("waiting to be healthy...")
+				logged = true
+			}
+		}
+
+		select {
+		case <-time.After(podmanRetryInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *PodmanContainerRes) Cmp(r engine.Res) error {
+	// we can only compare PodmanContainerRes to others of the same resource kind
+	res, ok := r.(*PodmanContainerRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Image != res.Image {
+		return fmt.Errorf("the Image differs")
+	}
+	// unlike the docker resource, the order of the arguments matters
+	if strings.Join(obj.Cmd, "\x00") != strings.Join(res.Cmd, "\x00") {
+		return fmt.Errorf("the Cmd field differs")
+	}
+	if err := util.SortedStrSliceCompare(obj.Env, res.Env); err != nil {
+		return errwrap.Wrapf(err, "the Env field differs")
+	}
+	if len(obj.Ports) != len(res.Ports) {
+		return fmt.Errorf("the Ports length differs")
+	}
+	for k, v := range obj.Ports {
+		if len(v) != len(res.Ports[k]) {
+			return fmt.Errorf("the Ports field differs")
+		}
+		for p, q := range v {
+			if w, ok := res.Ports[k][p]; !ok || q != w {
+				return fmt.Errorf("the Ports field differs")
+			}
+		}
+	}
+	if strings.Join(obj.Volumes, ",") != strings.Join(res.Volumes, ",") {
+		return fmt.Errorf("the Volumes differ")
+	}
+	if strings.Join(obj.Networks, ",") != strings.Join(res.Networks, ",") {
+		return fmt.Errorf("the Networks differ")
+	}
+	if obj.Pod != res.Pod {
+		return fmt.Errorf("the Pod differs")
+	}
+	if err := podmanMapCmp(obj.Labels, res.Labels); err != nil {
+		return errwrap.Wrapf(err, "the Labels differ")
+	}
+	if strings.Join(obj.HealthCmd, "\x00") != strings.Join(res.HealthCmd, "\x00") {
+		return fmt.Errorf("the HealthCmd differs")
+	}
+	if obj.HealthInterval != res.HealthInterval {
+		return fmt.Errorf("the HealthInterval differs")
+	}
+	if obj.HealthTimeout != res.HealthTimeout {
+		return fmt.Errorf("the HealthTimeout differs")
+	}
+	if obj.HealthStartPeriod != res.HealthStartPeriod {
+		return fmt.Errorf("the HealthStartPeriod differs")
+	}
+	if obj.HealthRetries != res.HealthRetries {
+		return fmt.Errorf("the HealthRetries differs")
+	}
+	if obj.WaitHealthy != res.WaitHealthy {
+		return fmt.Errorf("the WaitHealthy differs")
+	}
+	if obj.RestartUnhealthy != res.RestartUnhealthy {
+		return fmt.Errorf("the RestartUnhealthy differs")
+	}
+	if obj.Quadlet != res.Quadlet {
+		return fmt.Errorf("the Quadlet differs")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force field differs")
+	}
+	if obj.Socket != res.Socket {
+		return fmt.Errorf("the Socket differs")
+	}
+	if obj.User != res.User {
+		return fmt.Errorf("the User differs")
+	}
+
+	return nil
+}
+
+// PodmanContainerUID is the UID struct for PodmanContainerRes.
+type PodmanContainerUID struct {
+	engine.BaseUID
+
+	name   string
+	socket string // socket and user together
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *PodmanContainerRes) UIDs() []engine.ResUID {
+	x := &PodmanContainerUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+		socket:  obj.Socket + ":" + obj.User,
+	}
+	return []engine.ResUID{x}
+}
+
+// AutoEdges returns edges to the podman:image, podman:pod, podman:network and
+// podman:volume resources that this container uses.
+func (obj *PodmanContainerRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := obj.State != podmanStateRemoved
+	socket := obj.Socket + ":" + obj.User
+	base := engine.BaseUID{
+		Reversed: &reversed,
+	}
+
+	result := []engine.ResUID{}
+	result = append(result, &PodmanImageUID{
+		BaseUID: base,
+		image:   podmanImageNameTag(obj.Image),
+		socket:  socket,
+	})
+	if obj.Pod != "" {
+		result = append(result, &PodmanPodUID{
+			BaseUID: base,
+			name:    obj.Pod,
+			socket:  socket,
+		})
+	}
+	for _, x := range obj.Networks {
+		result = append(result, &PodmanNetworkUID{
+			BaseUID: base,
+			name:    x,
+			socket:  socket,
+		})
+	}
+	for _, x := range obj.Volumes {
+		src := strings.Split(x, ":")[0]
+		if strings.HasPrefix(src, "/") { // a bind mount
+			continue
+		}
+		result = append(result, &PodmanVolumeUID{
+			BaseUID: base,
+			name:    src,
+			socket:  socket,
+		})
+	}
+
+	return &PodmanResAutoEdges{
+		UIDs:    result,
+		pointer: 0,
+	}, nil
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *PodmanContainerUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*PodmanContainerUID)
+	if !ok {
+		return false
+	}
+	return obj.name == res.name && obj.socket == res.socket
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *PodmanContainerRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes PodmanContainerRes // indirection to avoid infinite recursion
+
+	def := obj.Default()                 // get the default
+	res, ok := def.(*PodmanContainerRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to PodmanContainerRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = PodmanContainerRes(raw) // restore from indirection with type conversion!
+	return nil
+}
@@ -0,0 +1,242 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+func init() {
+	engine.RegisterResource("podman:image", func() engine.Res { return &PodmanImageRes{} })
+}
+
+var _ engine.EdgeableRes = &PodmanImageRes{} // compile time check
+
+// PodmanImageRes is a podman image resource. The resource's name must be an
+// image in any supported format (url, image, or image:tag). It talks to the
+// podman API socket, which can be the rootless socket of a user.
+type PodmanImageRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State of the image must be exists or absent.
+	State string `lang:"state" yaml:"state"`
+
+	// Socket is the path to the podman API socket. If this and User are
+	// empty, then the rootful socket at /run/podman/podman.sock is used.
+	Socket string `lang:"socket" yaml:"socket"`
+
+	// User is the name of the user whose rootless podman socket we use. It
+	// is found at /run/user/<uid>/podman/podman.sock and is usually started
+	// with `systemctl --user enable --now podman.socket` by that user.
+	User string `lang:"user" yaml:"user"`
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *PodmanImageRes) Default() engine.Res {
+	return &PodmanImageRes{
+		State: "exists",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *PodmanImageRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be exists or absent")
+	}
+	if obj.Name() == "" || strings.ContainsAny(obj.Name(), " \t\n") {
+		return fmt.Errorf("invalid image name")
+	}
+	return podmanValidateConn(obj.Socket, obj.User)
+}
+
+// Init runs some startup code for this resource.
+func (obj *PodmanImageRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *PodmanImageRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *PodmanImageRes) Watch(ctx context.Context) error {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	filters := map[string][]string{
+		"type": {"image"},
+	}
+	return podmanWatch(ctx, obj.init, client, filters, "")
+}
+
+// CheckApply method for Podman image resource.
+func (obj *PodmanImageRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	image := podmanImageNameTag(obj.Name())
+
+	info, err := client.InspectImage(ctx, image)
+	if err != nil {
+		return false, errwrap.Wrapf(err, "error inspecting image")
+	}
+
+	if obj.State == "absent" && info == nil {
+		return true, nil
+	}
+	if obj.State == "exists" && info != nil {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if obj.State == "absent" {
+		obj.init.Logf("removing...")
+		if err := client.RemoveImage(ctx, image); err != nil {
+			return false, errwrap.Wrapf(err, "error removing image")
+		}
+		return false, nil
+	}
+
+	obj.init.Logf("pulling...")
+	if err := client.PullImage(ctx, image); err != nil {
+		return false, errwrap.Wrapf(err, "error pulling image")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *PodmanImageRes) Cmp(r engine.Res) error {
+	// we can only compare PodmanImageRes to others of the same resource kind
+	res, ok := r.(*PodmanImageRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Socket != res.Socket {
+		return fmt.Errorf("the Socket differs")
+	}
+	if obj.User != res.User {
+		return fmt.Errorf("the User differs")
+	}
+
+	return nil
+}
+
+// PodmanImageUID is the UID struct for PodmanImageRes.
+type PodmanImageUID struct {
+	engine.BaseUID
+
+	image  string
+	socket string // socket and user together
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *PodmanImageRes) UIDs() []engine.ResUID {
+	x := &PodmanImageUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		image:   podmanImageNameTag(obj.Name()),
+		socket:  obj.Socket + ":" + obj.User,
+	}
+	return []engine.ResUID{x}
+}
+
+// AutoEdges returns the AutoEdge interface.
+func (obj *PodmanImageRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	return nil, nil
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *PodmanImageUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*PodmanImageUID)
+	if !ok {
+		return false
+	}
+	return obj.image == res.image && obj.socket == res.socket
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *PodmanImageRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes PodmanImageRes // indirection to avoid infinite recursion
+
+	def := obj.Default()             // get the default
+	res, ok := def.(*PodmanImageRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to PodmanImageRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = PodmanImageRes(raw) // restore from indirection with type conversion!
+	return nil
+}
+
+// podmanImageNameTag adds the latest tag to an image name if it doesn't have a
+// tag or a digest. Unlike the simpler docker version, this works when the
+// registry has a port number.
+func podmanImageNameTag(image string) string {
+	if strings.Contains(image, "@") { // a digest
+		return image
+	}
+	last := image[strings.LastIndex(image, "/")+1:]
+	if strings.Contains(last, ":") {
+		return image
+	}
+	return image + ":latest"
+}
@@ -0,0 +1,348 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/podman"
+)
+
+func init() {
+	engine.RegisterResource("podman:network", func() engine.Res { return &PodmanNetworkRes{} })
+}
+
+var _ engine.EdgeableRes = &PodmanNetworkRes{} // compile time check
+
+// PodmanNetworkRes is a podman network resource. The resource's name is the name
+// of the network. If a network with this name already exists, but was not
+// created by mgmt, then it's left as it is.
+type PodmanNetworkRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State of the network must be exists or absent.
+	State string `lang:"state" yaml:"state"`
+
+	// Driver is the network driver. If empty, then podman uses bridge.
+	Driver string `lang:"driver" yaml:"driver"`
+
+	// Subnets is the list of subnets in CIDR notation. If empty, then one
+	// is chosen automatically.
+	Subnets []string `lang:"subnets" yaml:"subnets"`
+
+	// Gateways is the optional list of gateways for each of the subnets. If
+	// it's specified, it must be the same length as Subnets, although any
+	// entry may be empty to choose it automatically.
+	Gateways []string `lang:"gateways" yaml:"gateways"`
+
+	// Internal restricts external access from this network.
+	Internal bool `lang:"internal" yaml:"internal"`
+
+	// IPv6 enables IPv6 on this network.
+	IPv6 bool `lang:"ipv6" yaml:"ipv6"`
+
+	// DNS enables the DNS server on this network, so that containers can
+	// find each other by name. It defaults to true.
+	DNS bool `lang:"dns" yaml:"dns"`
+
+	// Labels are the labels to set on the network.
+	Labels map[string]string `lang:"labels" yaml:"labels"`
+
+	// Force must be true to allow removing and recreating a network which
+	// differs from this definition. It also removes any containers which
+	// use it when the state is absent.
+	Force bool `lang:"force" yaml:"force"`
+
+	// Socket is the path to the podman API socket. If this and User are
+	// empty, then the rootful socket at /run/podman/podman.sock is used.
+	Socket string `lang:"socket" yaml:"socket"`
+
+	// User is the name of the user whose rootless podman socket we use.
+	User string `lang:"user" yaml:"user"`
+}
+
+// spec returns the spec of the network without the hash label.
+func (obj *PodmanNetworkRes) spec() *podman.NetworkSpec {
+	subnets := []podman.Subnet{}
+	for i, x := range obj.Subnets {
+		subnet := podman.Subnet{Subnet: x}
+		if i < len(obj.Gateways) {
+			subnet.Gateway = obj.Gateways[i]
+		}
+		subnets = append(subnets, subnet)
+	}
+	return &podman.NetworkSpec{
+		Name:        obj.Name(),
+		Driver:      obj.Driver,
+		Subnets:     subnets,
+		Internal:    obj.Internal,
+		IPv6Enabled: obj.IPv6,
+		DNSEnabled:  obj.DNS,
+		Labels:      obj.Labels,
+	}
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *PodmanNetworkRes) Default() engine.Res {
+	return &PodmanNetworkRes{
+		State: "exists",
+		DNS:   true,
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *PodmanNetworkRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be exists or absent")
+	}
+	if obj.Name() == "" || strings.ContainsAny(obj.Name(), " \t\n/:") {
+		return fmt.Errorf("invalid network name")
+	}
+	for _, x := range obj.Subnets {
+		if _, _, err := net.ParseCIDR(x); err != nil {
+			return errwrap.Wrapf(err, "invalid subnet: %s", x)
+		}
+	}
+	if len(obj.Gateways) > 0 && len(obj.Gateways) != len(obj.Subnets) {
+		return fmt.Errorf("the number of gateways must match the number of subnets")
+	}
+	for i, x := range obj.Gateways {
+		if x == "" {
+			continue
+		}
+		ip := net.ParseIP(x)
+		if ip == nil {
+			return fmt.Errorf("invalid gateway: %s", x)
+		}
+		if _, ipnet, _ := net.ParseCIDR(obj.Subnets[i]); !ipnet.Contains(ip) {
+			return fmt.Errorf("gateway %s is not in subnet %s", x, obj.Subnets[i])
+		}
+	}
+	if _, exists := obj.Labels[podman.LabelHash]; exists {
+		return fmt.Errorf("the %s label is reserved", podman.LabelHash)
+	}
+	return podmanValidateConn(obj.Socket, obj.User)
+}
+
+// Init runs some startup code for this resource.
+func (obj *PodmanNetworkRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *PodmanNetworkRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *PodmanNetworkRes) Watch(ctx context.Context) error {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	filters := map[string][]string{
+		"type": {"network"},
+	}
+	return podmanWatch(ctx, obj.init, client, filters, "")
+}
+
+// CheckApply method for Podman network resource.
+func (obj *PodmanNetworkRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	info, err := client.InspectNetwork(ctx, obj.Name())
+	if err != nil {
+		return false, errwrap.Wrapf(err, "error inspecting network")
+	}
+
+	if obj.State == "absent" {
+		if info == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		obj.init.Logf("removing...")
+		if err := client.RemoveNetwork(ctx, obj.Name(), obj.Force); err != nil {
+			return false, errwrap.Wrapf(err, "error removing network")
+		}
+		return false, nil
+	}
+
+	spec := obj.spec()
+	hash, err := podman.Hash(spec)
+	if err != nil {
+		return false, err
+	}
+
+	if info != nil {
+		recreate, err := podmanDrift(info.Labels, hash, obj.Force)
+		if err != nil {
+			return false, errwrap.Wrapf(err, "network %s", obj.Name())
+		}
+		if !recreate {
+			return true, nil
+		}
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if info != nil {
+		obj.init.Logf("removing to recreate...")
+		if err := client.RemoveNetwork(ctx, obj.Name(), true); err != nil {
+			return false, errwrap.Wrapf(err, "error removing network")
+		}
+	}
+
+	obj.init.Logf("creating...")
+	spec.Labels = podmanLabels(spec.Labels, hash)
+	if err := client.CreateNetwork(ctx, spec); err != nil {
+		return false, errwrap.Wrapf(err, "error creating network")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *PodmanNetworkRes) Cmp(r engine.Res) error {
+	// we can only compare PodmanNetworkRes to others of the same resource kind
+	res, ok := r.(*PodmanNetworkRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Driver != res.Driver {
+		return fmt.Errorf("the Driver differs")
+	}
+	if strings.Join(obj.Subnets, ",") != strings.Join(res.Subnets, ",") {
+		return fmt.Errorf("the Subnets differ")
+	}
+	if strings.Join(obj.Gateways, ",") != strings.Join(res.Gateways, ",") {
+		return fmt.Errorf("the Gateways differ")
+	}
+	if obj.Internal != res.Internal {
+		return fmt.Errorf("the Internal differs")
+	}
+	if obj.IPv6 != res.IPv6 {
+		return fmt.Errorf("the IPv6 differs")
+	}
+	if obj.DNS != res.DNS {
+		return fmt.Errorf("the DNS differs")
+	}
+	if err := podmanMapCmp(obj.Labels, res.Labels); err != nil {
+		return errwrap.Wrapf(err, "the Labels differ")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force differs")
+	}
+	if obj.Socket != res.Socket {
+		return fmt.Errorf("the Socket differs")
+	}
+	if obj.User != res.User {
+		return fmt.Errorf("the User differs")
+	}
+
+	return nil
+}
+
+// PodmanNetworkUID is the UID struct for PodmanNetworkRes.
+type PodmanNetworkUID struct {
+	engine.BaseUID
+
+	name   string
+	socket string // socket and user together
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *PodmanNetworkRes) UIDs() []engine.ResUID {
+	x := &PodmanNetworkUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+		socket:  obj.Socket + ":" + obj.User,
+	}
+	return []engine.ResUID{x}
+}
+
+// AutoEdges returns the AutoEdge interface.
+func (obj *PodmanNetworkRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	return nil, nil
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *PodmanNetworkUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*PodmanNetworkUID)
+	if !ok {
+		return false
+	}
+	return obj.name == res.name && obj.socket == res.socket
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *PodmanNetworkRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes PodmanNetworkRes // indirection to avoid infinite recursion
+
+	def := obj.Default()               // get the default
+	res, ok := def.(*PodmanNetworkRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to PodmanNetworkRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = PodmanNetworkRes(raw) // restore from indirection with type conversion!
+	return nil
+}
@@ -0,0 +1,345 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/podman"
+)
+
+func init() {
+	engine.RegisterResource("podman:pod", func() engine.Res { return &PodmanPodRes{} })
+}
+
+var _ engine.EdgeableRes = &PodmanPodRes{} // compile time check
+
+// PodmanPodRes is a podman pod resource. The resource's name is the name of the
+// pod. Containers join it with their pod parameter. Since the containers in a
+// pod share its network namespace, the ports and networks are set here.
+type PodmanPodRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State of the pod must be running, stopped, or removed. Removing a pod
+	// also removes all of its containers.
+	State string `lang:"state" yaml:"state"`
+
+	// Ports is a map of port bindings. E.g. {"tcp" => {8080 => 80}}. The
+	// key is the host port, and the val is the inner service port to
+	// forward to.
+	Ports map[string]map[int64]int64 `lang:"ports" yaml:"ports"`
+
+	// Networks is the list of networks to join.
+	Networks []string `lang:"networks" yaml:"networks"`
+
+	// Labels are the labels to set on the pod.
+	Labels map[string]string `lang:"labels" yaml:"labels"`
+
+	// Force, if true, this will destroy and recreate the pod and all its
+	// containers if it differs from this definition.
+	Force bool `lang:"force" yaml:"force"`
+
+	// Socket is the path to the podman API socket. If this and User are
+	// empty, then the rootful socket at /run/podman/podman.sock is used.
+	Socket string `lang:"socket" yaml:"socket"`
+
+	// User is the name of the user whose rootless podman socket we use.
+	User string `lang:"user" yaml:"user"`
+}
+
+// spec returns the spec of the pod without the hash label.
+func (obj *PodmanPodRes) spec() *podman.PodSpec {
+	return &podman.PodSpec{
+		Name:         obj.Name(),
+		Labels:       obj.Labels,
+		PortMappings: podmanPortMappings(obj.Ports),
+		Networks:     podmanNetworks(obj.Networks),
+	}
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *PodmanPodRes) Default() engine.Res {
+	return &PodmanPodRes{
+		State: podmanStateRunning,
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *PodmanPodRes) Validate() error {
+	if obj.State != podmanStateRunning && obj.State != podmanStateStopped && obj.State != podmanStateRemoved {
+		return fmt.Errorf("state must be running, stopped or removed")
+	}
+	if obj.Name() == "" || strings.ContainsAny(obj.Name(), " \t\n/:") {
+		return fmt.Errorf("invalid pod name")
+	}
+	if err := podmanValidatePorts(obj.Ports); err != nil {
+		return err
+	}
+	if _, exists := obj.Labels[podman.LabelHash]; exists {
+		return fmt.Errorf("the %s label is reserved", podman.LabelHash)
+	}
+	return podmanValidateConn(obj.Socket, obj.User)
+}
+
+// Init runs some startup code for this resource.
+func (obj *PodmanPodRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *PodmanPodRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *PodmanPodRes) Watch(ctx context.Context) error {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	filters := map[string][]string{
+		"type": {"pod"},
+		"pod":  {obj.Name()},
+	}
+	return podmanWatch(ctx, obj.init, client, filters, "")
+}
+
+// CheckApply method for Podman pod resource.
+func (obj *PodmanPodRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	info, err := client.InspectPod(ctx, obj.Name())
+	if err != nil {
+		return false, errwrap.Wrapf(err, "error inspecting pod")
+	}
+
+	if obj.State == podmanStateRemoved {
+		if info == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		obj.init.Logf("removing...")
+		if err := client.RemovePod(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "error removing pod")
+		}
+		return false, nil
+	}
+
+	spec := obj.spec()
+	hash, err := podman.Hash(spec)
+	if err != nil {
+		return false, err
+	}
+
+	recreate := false
+	if info != nil {
+		if recreate, err = podmanDrift(info.Labels, hash, obj.Force); err != nil {
+			return false, errwrap.Wrapf(err, "pod %s", obj.Name())
+		}
+	}
+	running := info != nil && !recreate && info.State == podman.PodRunning
+
+	if obj.State == podmanStateStopped {
+		// NOTE: Like the container, a missing pod is as good as stopped.
+		if info == nil || !running && !recreate {
+			return true, nil
+		}
+	}
+	if obj.State == podmanStateRunning && running {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if recreate {
+		obj.init.Logf("removing to recreate...")
+		if err := client.RemovePod(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "error removing pod")
+		}
+		info = nil
+	}
+
+	if obj.State == podmanStateStopped {
+		if info == nil { // it was recreated
+			return false, nil
+		}
+		obj.init.Logf("stopping...")
+		if err := client.StopPod(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "error stopping pod")
+		}
+		return false, nil
+	}
+
+	if info == nil {
+		obj.init.Logf("creating...")
+		spec.Labels = podmanLabels(spec.Labels, hash)
+		if err := client.CreatePod(ctx, spec); err != nil {
+			return false, errwrap.Wrapf(err, "error creating pod")
+		}
+	}
+
+	obj.init.Logf("starting...")
+	if err := client.StartPod(ctx, obj.Name()); err != nil {
+		return false, errwrap.Wrapf(err, "error starting pod")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *PodmanPodRes) Cmp(r engine.Res) error {
+	// we can only compare PodmanPodRes to others of the same resource kind
+	res, ok := r.(*PodmanPodRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if len(obj.Ports) != len(res.Ports) {
+		return fmt.Errorf("the Ports length differs")
+	}
+	for k, v := range obj.Ports {
+		if len(v) != len(res.Ports[k]) {
+			return fmt.Errorf("the Ports field differs")
+		}
+		for p, q := range v {
+			if w, ok := res.Ports[k][p]; !ok || q != w {
+				return fmt.Errorf("the Ports field differs")
+			}
+		}
+	}
+	if strings.Join(obj.Networks, ",") != strings.Join(res.Networks, ",") {
+		return fmt.Errorf("the Networks differ")
+	}
+	if err := podmanMapCmp(obj.Labels, res.Labels); err != nil {
+		return errwrap.Wrapf(err, "the Labels differ")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force differs")
+	}
+	if obj.Socket != res.Socket {
+		return fmt.Errorf("the Socket differs")
+	}
+	if obj.User != res.User {
+		return fmt.Errorf("the User differs")
+	}
+
+	return nil
+}
+
+// PodmanPodUID is the UID struct for PodmanPodRes.
+type PodmanPodUID struct {
+	engine.BaseUID
+
+	name   string
+	socket string // socket and user together
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *PodmanPodRes) UIDs() []engine.ResUID {
+	x := &PodmanPodUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+		socket:  obj.Socket + ":" + obj.User,
+	}
+	return []engine.ResUID{x}
+}
+
+// AutoEdges returns edges to any podman:network resources that this pod joins.
+func (obj *PodmanPodRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := obj.State != podmanStateRemoved
+	socket := obj.Socket + ":" + obj.User
+	result := []engine.ResUID{}
+	for _, x := range obj.Networks {
+		result = append(result, &PodmanNetworkUID{
+			BaseUID: engine.BaseUID{
+				Reversed: &reversed,
+			},
+			name:   x,
+			socket: socket,
+		})
+	}
+	return &PodmanResAutoEdges{
+		UIDs:    result,
+		pointer: 0,
+	}, nil
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *PodmanPodUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*PodmanPodUID)
+	if !ok {
+		return false
+	}
+	return obj.name == res.name && obj.socket == res.socket
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *PodmanPodRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes PodmanPodRes // indirection to avoid infinite recursion
+
+	def := obj.Default()           // get the default
+	res, ok := def.(*PodmanPodRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to PodmanPodRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = PodmanPodRes(raw) // restore from indirection with type conversion!
+	return nil
+}
@@ -0,0 +1,132 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package resources
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/purpleidea/mgmt/util/podman"
+)
+
+func TestPodmanContainerValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *PodmanContainerRes
+		fail bool
+	}{
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx"}, false},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Env: []string{"A=b", "C="}, Ports: map[string]map[int64]int64{"tcp": {8080: 80}}}, false},
+		{"web", &PodmanContainerRes{State: "stopped", Image: "nginx", Volumes: []string{"data:/data:Z", "/srv:/srv"}}, false},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", HealthCmd: []string{"curl -f localhost"}, HealthInterval: "10s", HealthRetries: 3}, false},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Pod: "app"}, false},
+		{"web", &PodmanContainerRes{State: "exists", Image: "nginx"}, true},
+		{"web", &PodmanContainerRes{State: "running"}, true},
+		{"web/1", &PodmanContainerRes{State: "running", Image: "nginx"}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Env: []string{"A"}}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Volumes: []string{"data"}}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Volumes: []string{"data:data"}}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Pod: "app", Networks: []string{"net"}}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Labels: map[string]string{podman.LabelHash: "x"}}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", HealthInterval: "10s"}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", HealthCmd: []string{"true"}, HealthTimeout: "ten"}, true},
+		{"web", &PodmanContainerRes{State: "running", Image: "nginx", Socket: "podman.sock"}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("podman:container")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestPodmanImageNameTag(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                            "nginx:latest",
+		"nginx:1.25":                       "nginx:1.25",
+		"docker.io/library/nginx":          "docker.io/library/nginx:latest",
+		"localhost:5000/app":               "localhost:5000/app:latest",
+		"localhost:5000/app:v2":            "localhost:5000/app:v2",
+		"quay.io/app@sha256:0123456789abc": "quay.io/app@sha256:0123456789abc",
+	}
+	for image, expected := range tests {
+		if s := podmanImageNameTag(image); s != expected {
+			t.Errorf("image: %s, expected: %s, got: %s", image, expected, s)
+		}
+	}
+}
+
+func TestPodmanPortMappings(t *testing.T) {
+	ports := map[string]map[int64]int64{
+		"udp": {53: 5353},
+		"tcp": {8443: 443, 8080: 80},
+	}
+	expected := []podman.PortMapping{
+		{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		{HostPort: 8443, ContainerPort: 443, Protocol: "tcp"},
+		{HostPort: 53, ContainerPort: 5353, Protocol: "udp"},
+	}
+	if l := podmanPortMappings(ports); !reflect.DeepEqual(l, expected) {
+		t.Errorf("expected: %+v, got: %+v", expected, l)
+	}
+}
+
+func TestPodmanDrift(t *testing.T) {
+	tests := []struct {
+		labels   map[string]string
+		force    bool
+		recreate bool
+		fail     bool
+	}{
+		{nil, false, false, false}, // not ours, so we adopt it
+		{map[string]string{podman.LabelHash: "abc"}, false, false, false},
+		{map[string]string{podman.LabelHash: "abc"}, true, false, false},
+		{map[string]string{podman.LabelHash: "def"}, false, false, true},
+		{map[string]string{podman.LabelHash: "def"}, true, true, false},
+	}
+
+	for i, test := range tests {
+		recreate, err := podmanDrift(test.labels, "abc", test.force)
+		if err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+		if recreate != test.recreate {
+			t.Errorf("index: %d, expected recreate: %t", i, test.recreate)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/podman"
+)
+
+func init() {
+	engine.RegisterResource("podman:volume", func() engine.Res { return &PodmanVolumeRes{} })
+}
+
+var _ engine.EdgeableRes = &PodmanVolumeRes{} // compile time check
+
+// PodmanVolumeRes is a podman named volume resource. The resource's name is the
+// name of the volume. If a volume with this name already exists, but was not
+// created by mgmt, then it's left as it is.
+type PodmanVolumeRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State of the volume must be exists or absent.
+	State string `lang:"state" yaml:"state"`
+
+	// Driver is the volume driver. If empty, then podman uses local.
+	Driver string `lang:"driver" yaml:"driver"`
+
+	// Labels are the labels to set on the volume.
+	Labels map[string]string `lang:"labels" yaml:"labels"`
+
+	// Options are the driver specific options, eg: {"type" => "tmpfs",}.
+	Options map[string]string `lang:"options" yaml:"options"`
+
+	// Force must be true to allow removing and recreating a volume which
+	// differs from this definition. This destroys data! It also forces the
+	// removal of a volume that is in use when the state is absent.
+	Force bool `lang:"force" yaml:"force"`
+
+	// Socket is the path to the podman API socket. If this and User are
+	// empty, then the rootful socket at /run/podman/podman.sock is used.
+	Socket string `lang:"socket" yaml:"socket"`
+
+	// User is the name of the user whose rootless podman socket we use.
+	User string `lang:"user" yaml:"user"`
+}
+
+// spec returns the spec of the volume without the hash label.
+func (obj *PodmanVolumeRes) spec() *podman.VolumeSpec {
+	return &podman.VolumeSpec{
+		Name:    obj.Name(),
+		Driver:  obj.Driver,
+		Labels:  obj.Labels,
+		Options: obj.Options,
+	}
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *PodmanVolumeRes) Default() engine.Res {
+	return &PodmanVolumeRes{
+		State: "exists",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *PodmanVolumeRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be exists or absent")
+	}
+	if obj.Name() == "" || strings.ContainsAny(obj.Name(), " \t\n/:") {
+		return fmt.Errorf("invalid volume name")
+	}
+	if _, exists := obj.Labels[podman.LabelHash]; exists {
+		return fmt.Errorf("the %s label is reserved", podman.LabelHash)
+	}
+	return podmanValidateConn(obj.Socket, obj.User)
+}
+
+// Init runs some startup code for this resource.
+func (obj *PodmanVolumeRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *PodmanVolumeRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *PodmanVolumeRes) Watch(ctx context.Context) error {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	filters := map[string][]string{
+		"type":   {"volume"},
+		"volume": {obj.Name()},
+	}
+	return podmanWatch(ctx, obj.init, client, filters, "")
+}
+
+// CheckApply method for Podman volume resource.
+func (obj *PodmanVolumeRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	client, err := podmanClient(obj.init, obj.Socket, obj.User)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	info, err := client.InspectVolume(ctx, obj.Name())
+	if err != nil {
+		return false, errwrap.Wrapf(err, "error inspecting volume")
+	}
+
+	if obj.State == "absent" {
+		if info == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		obj.init.Logf("removing...")
+		if err := client.RemoveVolume(ctx, obj.Name(), obj.Force); err != nil {
+			return false, errwrap.Wrapf(err, "error removing volume")
+		}
+		return false, nil
+	}
+
+	spec := obj.spec()
+	hash, err := podman.Hash(spec)
+	if err != nil {
+		return false, err
+	}
+
+	if info != nil {
+		recreate, err := podmanDrift(info.Labels, hash, obj.Force)
+		if err != nil {
+			return false, errwrap.Wrapf(err, "volume %s", obj.Name())
+		}
+		if !recreate {
+			return true, nil
+		}
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if info != nil {
+		obj.init.Logf("removing to recreate...")
+		if err := client.RemoveVolume(ctx, obj.Name(), true); err != nil {
+			return false, errwrap.Wrapf(err, "error removing volume")
+		}
+	}
+
+	obj.init.Logf("creating...")
+	spec.Labels = podmanLabels(spec.Labels, hash)
+	if err := client.CreateVolume(ctx, spec); err != nil {
+		return false, errwrap.Wrapf(err, "error creating volume")
+	}
+
+	return false, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *PodmanVolumeRes) Cmp(r engine.Res) error {
+	// we can only compare PodmanVolumeRes to others of the same resource kind
+	res, ok := r.(*PodmanVolumeRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Driver != res.Driver {
+		return fmt.Errorf("the Driver differs")
+	}
+	if err := podmanMapCmp(obj.Labels, res.Labels); err != nil {
+		return errwrap.Wrapf(err, "the Labels differ")
+	}
+	if err := podmanMapCmp(obj.Options, res.Options); err != nil {
+		return errwrap.Wrapf(err, "the Options differ")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force differs")
+	}
+	if obj.Socket != res.Socket {
+		return fmt.Errorf("the Socket differs")
+	}
+	if obj.User != res.User {
+		return fmt.Errorf("the User differs")
+	}
+
+	return nil
+}
+
+// PodmanVolumeUID is the UID struct for PodmanVolumeRes.
+type PodmanVolumeUID struct {
+	engine.BaseUID
+
+	name   string
+	socket string // socket and user together
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *PodmanVolumeRes) UIDs() []engine.ResUID {
+	x := &PodmanVolumeUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+		socket:  obj.Socket + ":" + obj.User,
+	}
+	return []engine.ResUID{x}
+}
+
+// AutoEdges returns the AutoEdge interface.
+func (obj *PodmanVolumeRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	return nil, nil
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *PodmanVolumeUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*PodmanVolumeUID)
+	if !ok {
+		return false
+	}
+	return obj.name == res.name && obj.socket == res.socket
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *PodmanVolumeRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes PodmanVolumeRes // indirection to avoid infinite recursion
+
+	def := obj.Default()              // get the default
+	res, ok := def.(*PodmanVolumeRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to PodmanVolumeRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = PodmanVolumeRes(raw) // restore from indirection with type conversion!
+	return nil
+}
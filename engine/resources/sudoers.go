@@ -0,0 +1,510 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/recwatch"
+	"github.com/purpleidea/mgmt/util/sudoers"
+)
+
+func init() {
+	engine.RegisterResource("sudoers", func() engine.Res { return &SudoersRes{} })
+
+	if !strings.HasPrefix(SudoersDir, "/") {
+		panic("the SudoersDir does not start with a slash")
+	}
+	if !strings.HasSuffix(SudoersDir, "/") {
+		panic("the SudoersDir does not end with a slash")
+	}
+}
+
+const (
+	// SudoersDir is the directory where we store our sudoers files.
+	SudoersDir = "/etc/sudoers.d/"
+
+	// sudoersMode is the mode that sudo expects its files to have. It will
+	// refuse to read a file that is writable by anyone.
+	sudoersMode = 0440
+
+	// sudoersHeader is the comment at the top of every generated file.
+	sudoersHeader = "# This file is managed by mgmt. Do not edit.\n"
+)
+
+// SudoersRes is a resource that manages a file in the /etc/sudoers.d/ directory.
+// The name of the resource is the name of that file. The contents are generated
+// from the structured fields, and the syntax is checked before the file is
+// atomically replaced, so that a mistake can never leave you with a broken
+// sudo. If this is reversed, the file is removed when the resource goes away.
+type SudoersRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Reversible
+
+	init *engine.Init
+
+	// State must be exists or absent. If absent, the file is removed.
+	State string `lang:"state" yaml:"state"`
+
+	// Defaults is a list of Defaults parameters, which are each put on
+	// their own line. For example: `!requiretty` or `env_keep += "HOME"`.
+	// To bind one to a user, start it with a colon, eg: `:james !lecture`.
+	Defaults []string `lang:"defaults" yaml:"defaults"`
+
+	// Rules is the list of user specifications. They are written out in the
+	// order that they were given in, which matters to sudo, since the last
+	// matching rule wins.
+	Rules []*SudoersRule `lang:"rules" yaml:"rules"`
+}
+
+// SudoersRule is a single user specification in a sudoers file.
+type SudoersRule struct {
+	// Users is the list of users that this rule applies to. Groups are
+	// prefixed with a percent sign, eg: `%wheel`.
+	Users []string `lang:"users" yaml:"users"`
+
+	// Hosts is the list of hosts that this rule applies to. If empty, then
+	// this is ALL.
+	Hosts []string `lang:"hosts" yaml:"hosts"`
+
+	// RunAsUsers is the list of users that the commands can be run as. If
+	// this and RunAsGroups are both empty, then sudo defaults to root.
+	RunAsUsers []string `lang:"runas_users" yaml:"runas_users"`
+
+	// RunAsGroups is the list of groups that the commands can be run as.
+	RunAsGroups []string `lang:"runas_groups" yaml:"runas_groups"`
+
+	// Tags is the list of tags to apply, such as NOPASSWD or SETENV.
+	Tags []string `lang:"tags" yaml:"tags"`
+
+	// Commands is the list of commands that are permitted. They must be
+	// fully qualified paths, and may include arguments. Any commas, colons
+	// or equals signs in the arguments must be escaped with a backslash. If
+	// empty, then this is ALL.
+	Commands []string `lang:"commands" yaml:"commands"`
+}
+
+// Validate returns an error if the rule is not valid.
+func (obj *SudoersRule) Validate() error {
+	if len(obj.Users) == 0 {
+		return fmt.Errorf("the rule must have at least one user")
+	}
+	for _, x := range obj.Tags {
+		if !sudoers.Tags[x] {
+			return fmt.Errorf("unknown tag: %s", x)
+		}
+	}
+	return nil
+}
+
+// String returns the rule in the sudoers file format.
+func (obj *SudoersRule) String() string {
+	hosts := obj.Hosts
+	if len(hosts) == 0 {
+		hosts = []string{"ALL"}
+	}
+	commands := obj.Commands
+	if len(commands) == 0 {
+		commands = []string{"ALL"}
+	}
+
+	s := strings.Join(obj.Users, ", ") + " " + strings.Join(hosts, ", ") + " ="
+	if len(obj.RunAsUsers) > 0 || len(obj.RunAsGroups) > 0 {
+		s += " (" + strings.Join(obj.RunAsUsers, ", ")
+		if len(obj.RunAsGroups) > 0 {
+			s += " : " + strings.Join(obj.RunAsGroups, ", ")
+		}
+		s += ")"
+	}
+	for _, x := range obj.Tags {
+		s += " " + x + ":"
+	}
+	return s + " " + strings.Join(commands, ", ")
+}
+
+// Cmp compares two rules and returns an error if they differ.
+func (obj *SudoersRule) Cmp(rule *SudoersRule) error {
+	if obj.String() != rule.String() {
+		return fmt.Errorf("the rules differ")
+	}
+	return nil
+}
+
+// Copy returns a deep copy of the rule.
+func (obj *SudoersRule) Copy() *SudoersRule {
+	cp := func(in []string) []string {
+		if in == nil {
+			return nil
+		}
+		return append([]string{}, in...)
+	}
+	return &SudoersRule{
+		Users:       cp(obj.Users),
+		Hosts:       cp(obj.Hosts),
+		RunAsUsers:  cp(obj.RunAsUsers),
+		RunAsGroups: cp(obj.RunAsGroups),
+		Tags:        cp(obj.Tags),
+		Commands:    cp(obj.Commands),
+	}
+}
+
+// getPath returns the path to the managed file.
+func (obj *SudoersRes) getPath() string {
+	return SudoersDir + obj.Name()
+}
+
+// content returns the contents of the file that we manage.
+func (obj *SudoersRes) content() string {
+	s := sudoersHeader
+	for _, x := range obj.Defaults {
+		if strings.HasPrefix(x, ":") { // a binding
+			s += "Defaults" + x + "\n"
+			continue
+		}
+		s += "Defaults " + x + "\n"
+	}
+	for _, x := range obj.Rules {
+		s += x.String() + "\n"
+	}
+	return s
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *SudoersRes) Default() engine.Res {
+	return &SudoersRes{
+		State: "exists",
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *SudoersRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be 'exists', or 'absent'")
+	}
+
+	// sudo silently skips files with these, which would be surprising!
+	if obj.Name() == "" {
+		return fmt.Errorf("the name is empty")
+	}
+	if strings.Contains(obj.Name(), "/") {
+		return fmt.Errorf("the name must not contain a slash")
+	}
+	if strings.Contains(obj.Name(), ".") {
+		return fmt.Errorf("the name must not contain a period, sudo would ignore it")
+	}
+	if strings.HasSuffix(obj.Name(), "~") {
+		return fmt.Errorf("the name must not end with a tilde, sudo would ignore it")
+	}
+
+	if obj.State == "absent" && (len(obj.Defaults) > 0 || len(obj.Rules) > 0) {
+		return fmt.Errorf("can't specify defaults or rules when absent")
+	}
+
+	for _, x := range obj.Defaults {
+		if strings.Contains(x, "\n") {
+			return fmt.Errorf("defaults must not contain a newline")
+		}
+	}
+	for i, x := range obj.Rules {
+		if x == nil {
+			return fmt.Errorf("rule %d is nil", i)
+		}
+		if err := x.Validate(); err != nil {
+			return errwrap.Wrapf(err, "rule %d is invalid", i)
+		}
+		for _, s := range [][]string{x.Users, x.Hosts, x.RunAsUsers, x.RunAsGroups, x.Commands} {
+			for _, y := range s {
+				if strings.Contains(y, "\n") {
+					return fmt.Errorf("rule %d must not contain a newline", i)
+				}
+			}
+		}
+	}
+
+	// This is the equivalent of `visudo -c` on the file we'd generate.
+	if err := sudoers.Check(obj.content()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *SudoersRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *SudoersRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *SudoersRes) Watch(ctx context.Context) error {
+	return dropinWatch(ctx, obj.init, obj.getPath())
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *SudoersRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	var content []byte
+	if obj.State == "exists" {
+		s := obj.content()
+		// Check again right before we write, in case something is off.
+		if err := sudoers.Check(s); err != nil {
+			return false, errwrap.Wrapf(err, "refusing to write invalid sudoers file")
+		}
+		content = []byte(s)
+	}
+	return dropinCheckApply(obj.init, obj.getPath(), content, sudoersMode, apply)
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *SudoersRes) Cmp(r engine.Res) error {
+	// we can only compare SudoersRes to others of the same resource kind
+	res, ok := r.(*SudoersRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+
+	if len(obj.Defaults) != len(res.Defaults) {
+		return fmt.Errorf("the number of Defaults differs")
+	}
+	for i, x := range obj.Defaults {
+		if x != res.Defaults[i] {
+			return fmt.Errorf("the Defaults differ at index: %d", i)
+		}
+	}
+
+	if len(obj.Rules) != len(res.Rules) {
+		return fmt.Errorf("the number of Rules differs")
+	}
+	for i, x := range obj.Rules {
+		if err := x.Cmp(res.Rules[i]); err != nil {
+			return errwrap.Wrapf(err, "the Rules differ at index: %d", i)
+		}
+	}
+
+	return nil
+}
+
+// Copy copies the resource. Don't call it directly, use engine.ResCopy instead.
+// TODO: should this copy internal state?
+func (obj *SudoersRes) Copy() engine.CopyableRes {
+	defaults := []string{}
+	defaults = append(defaults, obj.Defaults...)
+	rules := []*SudoersRule{}
+	for _, x := range obj.Rules {
+		rules = append(rules, x.Copy())
+	}
+	return &SudoersRes{
+		State:    obj.State,
+		Defaults: defaults,
+		Rules:    rules,
+	}
+}
+
+// Reversed returns the "reverse" or "reciprocal" resource. This is used to
+// "clean" up after a previously defined resource has been removed. A file that
+// we added is removed, but we don't restore a file that we previously removed.
+func (obj *SudoersRes) Reversed() (engine.ReversibleRes, error) {
+	if obj.State == "absent" {
+		return nil, nil // nothing to do
+	}
+
+	cp, err := engine.ResCopy(obj)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not copy")
+	}
+	rev, ok := cp.(engine.ReversibleRes)
+	if !ok {
+		return nil, fmt.Errorf("not reversible")
+	}
+	rev.ReversibleMeta().Disabled = true // the reverse shouldn't run again
+
+	res, ok := cp.(*SudoersRes)
+	if !ok {
+		return nil, fmt.Errorf("copied res was not our kind")
+	}
+
+	res.State = "absent"
+	res.Defaults = nil
+	res.Rules = nil
+
+	return res, nil
+}
+
+// SudoersUID is the UID struct for SudoersRes.
+type SudoersUID struct {
+	engine.BaseUID
+
+	name string
+}
+
+// UIDs includes all params to make a unique identification of this object.
+// Most resources only return one although some resources can return multiple.
+func (obj *SudoersRes) UIDs() []engine.ResUID {
+	x := &SudoersUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:    obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *SudoersRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes SudoersRes // indirection to avoid infinite recursion
+
+	def := obj.Default()         // get the default
+	res, ok := def.(*SudoersRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to SudoersRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = SudoersRes(raw) // restore from indirection with type conversion!
+	return nil
+}
+
+// dropinWatch watches a single configuration file and sends events whenever it
+// changes. This is shared by the resources which manage a whole drop-in file.
+func dropinWatch(ctx context.Context, init *engine.Init, path string) error {
+	recWatcher, err := recwatch.NewRecWatcher(path, false)
+	if err != nil {
+		return err
+	}
+	defer recWatcher.Close()
+
+	if err := init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case event, ok := <-recWatcher.Events():
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if event == nil {
+				// programming error
+				return fmt.Errorf("unexpected nil recwatch event")
+			}
+			if err := event.Error; err != nil {
+				return err
+			}
+			if init.Debug { // don't access event.Body if event.Error isn't nil
+				init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if err := init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// dropinCheckApply makes sure that the file at path has exactly the content
+// and mode that we want. If content is nil, then the file is removed instead.
+// The file is replaced atomically so that it is never seen half written. This
+// is shared by the resources which manage a whole drop-in file.
+func dropinCheckApply(init *engine.Init, path string, content []byte, mode os.FileMode, apply bool) (bool, error) {
+	fileInfo, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return false, errwrap.Wrapf(err, "could not stat file")
+	}
+	exists := err == nil
+
+	if content == nil {
+		if !exists {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		init.Logf("removed: %s", path)
+		return false, nil
+	}
+
+	if exists {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return false, errwrap.Wrapf(err, "could not read file")
+		}
+		if bytes.Equal(b, content) {
+			if fileInfo.Mode().Perm() == mode {
+				return true, nil
+			}
+			if !apply {
+				return false, nil
+			}
+			if err := os.Chmod(path, mode); err != nil {
+				return false, err
+			}
+			init.Logf("chmod %#o: %s", mode, path)
+			return false, nil
+		}
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if err := util.AtomicWriteFile(path, content, mode); err != nil {
+		return false, errwrap.Wrapf(err, "could not write file")
+	}
+	init.Logf("wrote: %s", path)
+
+	return false, nil
+}
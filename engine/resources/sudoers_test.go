@@ -0,0 +1,162 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package resources
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/purpleidea/mgmt/engine"
+)
+
+func TestSudoersValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *SudoersRes
+		fail bool
+	}{
+		{"admins", &SudoersRes{State: "exists", Rules: []*SudoersRule{{Users: []string{"%wheel"}, Tags: []string{"NOPASSWD"}}}}, false},
+		{"web", &SudoersRes{State: "exists", Defaults: []string{":www-data !requiretty"}, Rules: []*SudoersRule{{Users: []string{"www-data"}, RunAsUsers: []string{"root"}, Commands: []string{"/usr/bin/systemctl reload nginx"}}}}, false},
+		{"old", &SudoersRes{State: "absent"}, false},
+		{"admins.conf", &SudoersRes{State: "exists"}, true},
+		{"admins~", &SudoersRes{State: "exists"}, true},
+		{"admins", &SudoersRes{State: "absent", Defaults: []string{"env_reset"}}, true},
+		{"admins", &SudoersRes{State: "exists", Rules: []*SudoersRule{{Users: []string{"james"}, Tags: []string{"NOPASS"}}}}, true},
+		{"admins", &SudoersRes{State: "exists", Rules: []*SudoersRule{{Users: []string{"james"}, Commands: []string{"systemctl"}}}}, true},
+		{"admins", &SudoersRes{State: "exists", Rules: []*SudoersRule{{Commands: []string{"/usr/bin/ls"}}}}, true},
+		{"admins", &SudoersRes{State: "exists", Defaults: []string{"env_keep = "}}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("sudoers")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestSudoersRuleString(t *testing.T) {
+	rule := &SudoersRule{
+		Users:       []string{"james", "%wheel"},
+		RunAsUsers:  []string{"root"},
+		RunAsGroups: []string{"adm"},
+		Tags:        []string{"NOPASSWD", "SETENV"},
+		Commands:    []string{"/usr/bin/make", "/usr/bin/ls"},
+	}
+	expected := "james, %wheel ALL = (root : adm) NOPASSWD: SETENV: /usr/bin/make, /usr/bin/ls"
+	if s := rule.String(); s != expected {
+		t.Errorf("unexpected rule: %s", s)
+	}
+}
+
+func TestLimitsValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *LimitsRes
+		fail bool
+	}{
+		{"nofile", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"*", "-", "nofile", "65536"}, {"@audio", "hard", "rtprio", "95"}}}, false},
+		{"range", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"1000:", "soft", "nproc", "unlimited"}, {"@:100", "hard", "core", "0"}}}, false},
+		{"logins", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"%staff", "-", "maxlogins", "4"}, {"james", "-", "nice", "-5"}}}, false},
+		{"old", &LimitsRes{State: "absent"}, false},
+		{"nofile.conf", &LimitsRes{State: "exists"}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"*", "both", "nofile", "1"}}}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"*", "-", "files", "1"}}}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"*", "-", "nofile", "lots"}}}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"*", "-", "nice", "20"}}}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"*", "-", "rtprio", "-1"}}}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"%staff", "-", "nofile", "1"}}}, true},
+		{"x", &LimitsRes{State: "exists", Limits: []*LimitsEntry{{"bad user", "-", "nofile", "1"}}}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("limits")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestDropinCheckApply(t *testing.T) {
+	init := &engine.Init{
+		Logf: func(format string, v ...interface{}) {
+			t.Logf("test: "+format, v...)
+		},
+	}
+	path := filepath.Join(t.TempDir(), "dropin")
+	content := []byte("hello\n")
+
+	for i, x := range []struct {
+		content []byte
+		apply   bool
+		checkOK bool
+	}{
+		{content, false, false}, // missing
+		{content, true, false},  // create
+		{content, true, true},   // converged
+		{nil, false, false},     // should be removed
+		{nil, true, false},      // remove
+		{nil, true, true},       // converged
+	} {
+		checkOK, err := dropinCheckApply(init, path, x.content, sudoersMode, x.apply)
+		if err != nil {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+			return
+		}
+		if checkOK != x.checkOK {
+			t.Errorf("index: %d, expected checkOK: %t", i, x.checkOK)
+		}
+	}
+
+	// a wrong mode should be fixed too
+	if _, err := dropinCheckApply(init, path, content, sudoersMode, true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if err := os.Chmod(path, 0644); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if checkOK, err := dropinCheckApply(init, path, content, sudoersMode, true); err != nil || checkOK {
+		t.Errorf("expected the mode to be fixed: %t, %v", checkOK, err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != sudoersMode {
+		t.Errorf("unexpected mode")
+	}
+}
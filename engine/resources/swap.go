@@ -0,0 +1,639 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/grow"
+	"github.com/purpleidea/mgmt/util/recwatch"
+
+	fstab "github.com/deniswernert/go-fstab"
+	"golang.org/x/sys/unix"
+)
+
+func init() {
+	engine.RegisterResource("swap", func() engine.Res { return &SwapRes{} })
+}
+
+const (
+	// swapFileUmask is the umask (permissions) used for new swap files.
+	// The kernel will complain loudly if they're readable by others.
+	swapFileUmask = 0600
+)
+
+// SwapRes is a resource that manages a swap area. The name is the path to the
+// swap partition or swap file. If the Size parameter is set, then this is a
+// swap file which we create if it's missing. The swap area is activated and
+// optionally persisted in /etc/fstab so that it is activated on boot. The list
+// of active swap areas can't be watched for changes, so if you want to notice
+// when someone runs swapoff, then use the Poll meta parameter.
+type SwapRes struct {
+	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
+
+	init *engine.Init
+
+	// State must be exists or absent. If absent, the swap area is
+	// deactivated, removed from /etc/fstab and a swap file is deleted.
+	// A swap partition is left as-is.
+	State string `lang:"state" yaml:"state"`
+
+	// Size is the size of the swap file in bytes. If this is zero, then the
+	// name must be an existing block device such as a partition.
+	Size int `lang:"size" yaml:"size"`
+
+	// Label is the optional swap label.
+	Label string `lang:"label" yaml:"label"`
+
+	// Priority is the optional swap priority. Higher values are used first.
+	Priority *int `lang:"priority" yaml:"priority"`
+
+	// Persist specifies whether this swap area should be stored in the
+	// /etc/fstab file so that it is activated on boot. It defaults to true.
+	Persist bool `lang:"persist" yaml:"persist"`
+
+	// Force must be true to allow running mkswap on a partition which
+	// already contains a different signature. This destroys data!
+	Force bool `lang:"force" yaml:"force"`
+}
+
+// grower returns the storage utility struct that does the real work.
+func (obj *SwapRes) grower() *grow.Grow {
+	return &grow.Grow{
+		Debug: obj.init.Debug,
+		Logf:  obj.init.Logf,
+	}
+}
+
+// isFile returns true if this is a swap file and not a partition.
+func (obj *SwapRes) isFile() bool {
+	return obj.Size > 0
+}
+
+// fstabMount returns the fstab entry that we expect for this swap area.
+func (obj *SwapRes) fstabMount() *fstab.Mount {
+	opts := map[string]string{"defaults": ""}
+	if obj.Priority != nil {
+		opts = map[string]string{"pri": strconv.Itoa(*obj.Priority)}
+	}
+	return &fstab.Mount{
+		Spec:    obj.Name(),
+		File:    "none",
+		VfsType: "swap",
+		MntOps:  opts,
+	}
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *SwapRes) Default() engine.Res {
+	return &SwapRes{
+		State:   "exists",
+		Persist: true,
+	}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *SwapRes) Validate() error {
+	if obj.State != "exists" && obj.State != "absent" {
+		return fmt.Errorf("state must be 'exists', or 'absent'")
+	}
+
+	if !strings.HasPrefix(obj.Name(), "/") {
+		return fmt.Errorf("the path must be absolute")
+	}
+	if strings.HasSuffix(obj.Name(), "/") {
+		return fmt.Errorf("the path must not be a directory")
+	}
+
+	if obj.Size < 0 {
+		return fmt.Errorf("the size must not be negative")
+	}
+	if obj.isFile() && strings.HasPrefix(obj.Name(), grow.DevDir) {
+		return fmt.Errorf("a swap file can't be in: %s", grow.DevDir)
+	}
+	if !obj.isFile() && !strings.HasPrefix(obj.Name(), grow.DevDir) {
+		return fmt.Errorf("a swap partition must be in: %s", grow.DevDir)
+	}
+
+	if len(obj.Label) > 16 {
+		return fmt.Errorf("the label is longer than 16 characters")
+	}
+
+	if obj.Priority != nil && (*obj.Priority < -1 || *obj.Priority > 32767) {
+		return fmt.Errorf("the priority must be between -1 and 32767")
+	}
+
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *SwapRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *SwapRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events. We
+// watch the swap file, the /dev/disk/ tree and the /etc/fstab file.
+func (obj *SwapRes) Watch(ctx context.Context) error {
+	var events1, events2, events3 chan *recwatch.Event
+
+	if obj.isFile() {
+		recWatcher, err := recwatch.NewRecWatcher(obj.Name(), false)
+		if err != nil {
+			return err
+		}
+		defer recWatcher.Close()
+		events1 = recWatcher.Events()
+
+	} else {
+		recWatcher, err := recwatch.NewRecWatcher(devDisk, true)
+		if err != nil {
+			return err
+		}
+		defer recWatcher.Close()
+		events2 = recWatcher.Events()
+	}
+
+	if obj.Persist || obj.State == "absent" {
+		recWatcher, err := recwatch.NewRecWatcher(fstabPath, false)
+		if err != nil {
+			return err
+		}
+		defer recWatcher.Close()
+		events3 = recWatcher.Events()
+	}
+
+	if err := obj.init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		var event *recwatch.Event
+		var ok bool
+		select {
+		case event, ok = <-events1:
+		case event, ok = <-events2:
+		case event, ok = <-events3:
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if !ok { // channel shutdown
+			return fmt.Errorf("unexpected close")
+		}
+		if event == nil {
+			// programming error
+			return fmt.Errorf("unexpected nil recwatch event")
+		}
+		if err := event.Error; err != nil {
+			return errwrap.Wrapf(err, "unknown %s watcher error", obj)
+		}
+		if obj.init.Debug { // don't access event.Body if event.Error isn't nil
+			obj.init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// active returns the entry from the list of active swap areas, or nil if this
+// swap area is not active.
+func (obj *SwapRes) active() (*grow.SwapInfo, error) {
+	p, err := filepath.EvalSymlinks(obj.Name())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	swaps, err := obj.grower().Swaps()
+	if err != nil {
+		return nil, err
+	}
+	for _, x := range swaps {
+		if x.Filename == p || x.Filename == obj.Name() {
+			return x, nil
+		}
+	}
+	return nil, nil
+}
+
+// fileCheckApply makes sure the swap file exists with the correct size. If the
+// size differs, then the file is recreated, since its contents are disposable.
+func (obj *SwapRes) fileCheckApply(ctx context.Context, apply bool) (bool, error) {
+	if !obj.isFile() {
+		return true, nil
+	}
+
+	fi, err := os.Stat(obj.Name())
+	if err != nil && !os.IsNotExist(err) {
+		return false, err // system or permissions error?
+	}
+	if err == nil && !fi.Mode().IsRegular() {
+		return false, fmt.Errorf("the swap file is not a regular file")
+	}
+	if err == nil && fi.Size() == int64(obj.Size) {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if err == nil { // wrong size, so start over
+		if info, err := obj.active(); err != nil {
+			return false, err
+		} else if info != nil {
+			if err := obj.grower().SwapOff(ctx, obj.Name()); err != nil {
+				return false, err
+			}
+		}
+		if err := os.Remove(obj.Name()); err != nil {
+			return false, err
+		}
+	}
+
+	obj.init.Logf("creating swap file of %d bytes", obj.Size)
+	f, err := os.OpenFile(obj.Name(), os.O_CREATE|os.O_EXCL|os.O_WRONLY, swapFileUmask)
+	if err != nil {
+		return false, err
+	}
+	// swap files must not have holes, so we can't use truncate
+	if err := unix.Fallocate(int(f.Fd()), 0, 0, int64(obj.Size)); err != nil {
+		f.Close()
+		os.Remove(obj.Name()) // don't leave behind a broken swap file
+		return false, errwrap.Wrapf(err, "could not allocate the swap file")
+	}
+	if err := f.Close(); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// mkswapCheckApply makes sure that the swap signature exists and is labelled.
+func (obj *SwapRes) mkswapCheckApply(ctx context.Context, apply bool) (bool, error) {
+	g := obj.grower()
+
+	info, err := g.Blkid(ctx, obj.Name())
+	if err != nil {
+		return false, err
+	}
+
+	isSwap := info.Type == "swap" && info.PTType == ""
+
+	if isSwap && (obj.Label == "" || obj.Label == info.Label) {
+		return true, nil
+	}
+
+	if isSwap { // only the label differs
+		if !apply {
+			return false, nil
+		}
+		if err := g.Relabel(ctx, obj.Name(), info.Type, obj.Label); err != nil {
+			return false, errwrap.Wrapf(err, "could not relabel the swap area")
+		}
+		return false, nil
+	}
+
+	// A new swap file of ours may contain random leftovers, but never
+	// overwrite a partition which contains something unless forced to.
+	if !info.Empty() && !obj.isFile() && !obj.Force {
+		return false, fmt.Errorf("refusing to overwrite %s which contains: %s", obj.Name(), info)
+	}
+
+	if !apply {
+		return false, nil
+	}
+	if !info.Empty() && !obj.isFile() { // mkswap doesn't erase everything
+		if err := g.Wipefs(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "could not wipe the device")
+		}
+	}
+	if err := g.MkSwap(ctx, obj.Name(), obj.Label, "", obj.isFile() || obj.Force); err != nil {
+		return false, errwrap.Wrapf(err, "could not make the swap area")
+	}
+
+	return false, nil
+}
+
+// swaponCheckApply makes sure the swap area is active with the right priority.
+func (obj *SwapRes) swaponCheckApply(ctx context.Context, apply bool) (bool, error) {
+	g := obj.grower()
+
+	info, err := obj.active()
+	if err != nil {
+		return false, err
+	}
+
+	if obj.State == "absent" {
+		if info == nil {
+			return true, nil
+		}
+		if !apply {
+			return false, nil
+		}
+		if err := g.SwapOff(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "could not deactivate the swap area")
+		}
+		return false, nil
+	}
+
+	if info != nil && (obj.Priority == nil || info.Priority == *obj.Priority) {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+
+	if info != nil { // the priority can only be changed by a cycle
+		if err := g.SwapOff(ctx, obj.Name()); err != nil {
+			return false, errwrap.Wrapf(err, "could not deactivate the swap area")
+		}
+	}
+	if err := g.SwapOn(ctx, obj.Name(), obj.Priority); err != nil {
+		return false, errwrap.Wrapf(err, "could not activate the swap area")
+	}
+
+	return false, nil
+}
+
+// fstabCheckApply makes sure that the swap area is in /etc/fstab if we want to
+// persist it, and that it's removed from there if we don't.
+func (obj *SwapRes) fstabCheckApply(ctx context.Context, apply bool) (bool, error) {
+	expected := obj.fstabMount()
+	want := obj.State == "exists" && obj.Persist
+
+	mounts, err := fstab.ParseFile(fstabPath)
+	if err != nil {
+		return false, errwrap.Wrapf(err, "error parsing file: %s", fstabPath)
+	}
+
+	found := false
+	filtered := fstab.Mounts{}
+	for _, m := range mounts {
+		if m.Spec != expected.Spec || m.VfsType != expected.VfsType {
+			filtered = append(filtered, m)
+			continue
+		}
+		// if there's more than one entry, then we rewrite it
+		if !found && want && m.Equals(expected) {
+			filtered = append(filtered, m)
+			found = true
+			continue
+		}
+	}
+	if want && !found {
+		filtered = append(filtered, expected)
+	}
+
+	if len(filtered) == len(mounts) && (found || !want) {
+		return true, nil
+	}
+
+	if !apply {
+		return false, nil
+	}
+	obj.init.Logf("updating: %s", fstabPath)
+
+	if err := fstabWrite(obj.init.Program, fstabPath, filtered); err != nil {
+		return false, err
+	}
+
+	return false, nil
+}
+
+// CheckApply checks the resource state and applies the resource if the bool
+// input is true. It returns error info and if the state check passed or not.
+func (obj *SwapRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	checkOK := true
+
+	if obj.State == "exists" {
+		if c, err := obj.fileCheckApply(ctx, apply); err != nil {
+			return false, err
+		} else if !c {
+			checkOK = false
+		}
+		if !checkOK && !apply {
+			return false, nil // the next steps need the file
+		}
+
+		if c, err := obj.mkswapCheckApply(ctx, apply); err != nil {
+			return false, err
+		} else if !c {
+			checkOK = false
+		}
+	}
+
+	// this deactivates first when absent, before we remove anything else
+	if c, err := obj.swaponCheckApply(ctx, apply); err != nil {
+		return false, err
+	} else if !c {
+		checkOK = false
+	}
+
+	if c, err := obj.fstabCheckApply(ctx, apply); err != nil {
+		return false, err
+	} else if !c {
+		checkOK = false
+	}
+
+	if obj.State == "absent" && obj.isFile() {
+		_, err := os.Stat(obj.Name())
+		if err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		if err == nil {
+			if !apply {
+				return false, nil
+			}
+			if err := os.Remove(obj.Name()); err != nil {
+				return false, err
+			}
+			checkOK = false
+		}
+	}
+
+	return checkOK, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *SwapRes) Cmp(r engine.Res) error {
+	// we can only compare SwapRes to others of the same resource kind
+	res, ok := r.(*SwapRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.State != res.State {
+		return fmt.Errorf("the State differs")
+	}
+	if obj.Size != res.Size {
+		return fmt.Errorf("the Size differs")
+	}
+	if obj.Label != res.Label {
+		return fmt.Errorf("the Label differs")
+	}
+	if (obj.Priority == nil) != (res.Priority == nil) { // xor
+		return fmt.Errorf("the Priority differs")
+	}
+	if obj.Priority != nil && res.Priority != nil && *obj.Priority != *res.Priority {
+		return fmt.Errorf("the contents of Priority differ")
+	}
+	if obj.Persist != res.Persist {
+		return fmt.Errorf("the Persist value differs")
+	}
+	if obj.Force != res.Force {
+		return fmt.Errorf("the Force value differs")
+	}
+
+	return nil
+}
+
+// SwapUID is the UID struct for SwapRes.
+type SwapUID struct {
+	engine.BaseUID
+
+	// path is the path to the swap file or partition.
+	path string
+}
+
+// IFF aka if and only if they are equivalent, return true. If not, false.
+func (obj *SwapUID) IFF(uid engine.ResUID) bool {
+	res, ok := uid.(*SwapUID)
+	if !ok {
+		return false
+	}
+	return obj.path == res.path
+}
+
+// SwapResAutoEdges holds the state of the auto edge generator.
+type SwapResAutoEdges struct {
+	uids    []engine.ResUID
+	pointer int
+}
+
+// Next returns the next automatic edge.
+func (obj *SwapResAutoEdges) Next() []engine.ResUID {
+	if len(obj.uids) == 0 {
+		return nil
+	}
+	value := obj.uids[obj.pointer]
+	obj.pointer++
+	return []engine.ResUID{value}
+}
+
+// Test gets results of the earlier Next() call, & returns if we should
+// continue.
+func (obj *SwapResAutoEdges) Test(input []bool) bool {
+	if len(obj.uids) <= obj.pointer {
+		return false
+	}
+	if len(input) != 1 { // in case we get given bad data
+		panic("expecting a single value")
+	}
+	return true // keep going
+}
+
+// AutoEdges returns an edge from the partition resource if this swap area is
+// on a partition that we manage. If this is a swap file, then it adds an edge
+// from the file resource that manages the parent directory.
+func (obj *SwapRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := true // the dependency comes first
+	var uid engine.ResUID = &PartitionUID{
+		BaseUID: engine.BaseUID{
+			Name:     obj.Name(),
+			Kind:     obj.Kind(),
+			Reversed: &reversed,
+		},
+		device: obj.Name(),
+	}
+	if obj.isFile() {
+		uid = &FileUID{
+			BaseUID: engine.BaseUID{
+				Name:     obj.Name(),
+				Kind:     obj.Kind(),
+				Reversed: &reversed,
+			},
+			path: filepath.Dir(obj.Name()) + "/", // directories end in a slash
+		}
+	}
+	return &SwapResAutoEdges{
+		uids: []engine.ResUID{uid},
+	}, nil
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one although some resources can return multiple.
+func (obj *SwapRes) UIDs() []engine.ResUID {
+	x := &SwapUID{
+		BaseUID: engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		path:    obj.Name(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *SwapRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes SwapRes // indirection to avoid infinite recursion
+
+	def := obj.Default()      // get the default
+	res, ok := def.(*SwapRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to SwapRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = SwapRes(raw) // restore from indirection with type conversion!
+	return nil
+}
@@ -0,0 +1,388 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package resources
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/traits"
+	engineUtil "github.com/purpleidea/mgmt/engine/util"
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/recwatch"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func init() {
+	engine.RegisterResource("timezone", func() engine.Res { return &TimezoneRes{} })
+}
+
+const (
+	timedate1Path  = "/org/freedesktop/timedate1"
+	timedate1Iface = "org.freedesktop.timedate1"
+
+	// localtimePath is the symlink which points to the system timezone.
+	localtimePath = "/etc/localtime"
+)
+
+// TimezoneRes is a resource that sets and watches the system timezone, as well
+// as whether NTP is used and whether the RTC is in local time. It talks to
+// systemd-timedated over dbus. If you don't specify the Timezone, the Name is
+// used. The NTP and LocalRTC fields are not managed if they are not set.
+type TimezoneRes struct {
+	traits.Base // add the base methods without re-implementation
+
+	init *engine.Init
+
+	// Timezone is the timezone to set, such as America/Toronto or UTC. It
+	// must be a valid entry in the system timezone database.
+	Timezone string `lang:"timezone" yaml:"timezone"`
+
+	// NTP specifies whether network time synchronization is enabled.
+	NTP *bool `lang:"ntp" yaml:"ntp"`
+
+	// LocalRTC specifies whether the hardware clock is kept in local time
+	// instead of UTC. This is usually a bad idea unless you dual boot.
+	LocalRTC *bool `lang:"local_rtc" yaml:"local_rtc"`
+}
+
+func (obj *TimezoneRes) getTimezone() string {
+	if obj.Timezone != "" {
+		return obj.Timezone
+	}
+
+	return obj.Name()
+}
+
+// Default returns some sensible defaults for this resource.
+func (obj *TimezoneRes) Default() engine.Res {
+	return &TimezoneRes{}
+}
+
+// Validate if the params passed in are valid data.
+func (obj *TimezoneRes) Validate() error {
+	tz := obj.getTimezone()
+	if tz == "" {
+		return ErrResourceInsufficientParameters
+	}
+	if tz == "Local" || strings.HasPrefix(tz, "/") || strings.Contains(tz, "..") {
+		return fmt.Errorf("invalid timezone: %s", tz)
+	}
+	if _, err := time.LoadLocation(tz); err != nil {
+		return errwrap.Wrapf(err, "invalid timezone: %s", tz)
+	}
+	return nil
+}
+
+// Init runs some startup code for this resource.
+func (obj *TimezoneRes) Init(init *engine.Init) error {
+	obj.init = init // save for later
+
+	return nil
+}
+
+// Cleanup is run by the engine to clean up after the resource is done.
+func (obj *TimezoneRes) Cleanup() error {
+	return nil
+}
+
+// Watch is the primary listener for this resource and it outputs events.
+func (obj *TimezoneRes) Watch(ctx context.Context) error {
+	return dbusPropertiesWatch(ctx, obj.init, timedate1Path, localtimePath)
+}
+
+// CheckApply method for Timezone resource.
+func (obj *TimezoneRes) CheckApply(ctx context.Context, apply bool) (bool, error) {
+	conn, err := util.SystemBusPrivateUsable()
+	if err != nil {
+		return false, errwrap.Wrapf(err, "failed to connect to the private system bus")
+	}
+	defer conn.Close()
+
+	object := conn.Object(timedate1Iface, timedate1Path)
+
+	checkOK := true
+
+	tz, err := dbusStringProperty(object, timedate1Iface, "Timezone")
+	if err != nil {
+		return false, err
+	}
+	if tz != obj.getTimezone() {
+		checkOK = false
+		if apply {
+			if err := object.CallWithContext(ctx, timedate1Iface+".SetTimezone", 0, obj.getTimezone(), false).Err; err != nil {
+				return false, errwrap.Wrapf(err, "failed to call %s.SetTimezone", timedate1Iface)
+			}
+			obj.init.Logf("changed Timezone: `%s` => `%s`", tz, obj.getTimezone())
+		}
+	}
+
+	if obj.NTP != nil {
+		ntp, err := dbusBoolProperty(object, timedate1Iface, "NTP")
+		if err != nil {
+			return false, err
+		}
+		if ntp != *obj.NTP {
+			checkOK = false
+			if apply {
+				if err := object.CallWithContext(ctx, timedate1Iface+".SetNTP", 0, *obj.NTP, false).Err; err != nil {
+					return false, errwrap.Wrapf(err, "failed to call %s.SetNTP", timedate1Iface)
+				}
+				obj.init.Logf("changed NTP: %t => %t", ntp, *obj.NTP)
+			}
+		}
+	}
+
+	if obj.LocalRTC != nil {
+		rtc, err := dbusBoolProperty(object, timedate1Iface, "LocalRTC")
+		if err != nil {
+			return false, err
+		}
+		if rtc != *obj.LocalRTC {
+			checkOK = false
+			if apply {
+				// The second arg is fix_system, which would set the
+				// system clock from the RTC. We keep the system clock.
+				if err := object.CallWithContext(ctx, timedate1Iface+".SetLocalRTC", 0, *obj.LocalRTC, false, false).Err; err != nil {
+					return false, errwrap.Wrapf(err, "failed to call %s.SetLocalRTC", timedate1Iface)
+				}
+				obj.init.Logf("changed LocalRTC: %t => %t", rtc, *obj.LocalRTC)
+			}
+		}
+	}
+
+	return checkOK, nil
+}
+
+// Cmp compares two resources and returns an error if they are not equivalent.
+func (obj *TimezoneRes) Cmp(r engine.Res) error {
+	// we can only compare TimezoneRes to others of the same resource kind
+	res, ok := r.(*TimezoneRes)
+	if !ok {
+		return fmt.Errorf("not a %s", obj.Kind())
+	}
+
+	if obj.getTimezone() != res.getTimezone() {
+		return fmt.Errorf("the Timezone differs")
+	}
+	if engineUtil.BoolPtrCmp(obj.NTP, res.NTP) != nil {
+		return fmt.Errorf("the NTP differs")
+	}
+	if engineUtil.BoolPtrCmp(obj.LocalRTC, res.LocalRTC) != nil {
+		return fmt.Errorf("the LocalRTC differs")
+	}
+
+	return nil
+}
+
+// TimezoneUID is the UID struct for TimezoneRes.
+type TimezoneUID struct {
+	engine.BaseUID
+
+	name     string
+	timezone string
+}
+
+// UIDs includes all params to make a unique identification of this object. Most
+// resources only return one, although some resources can return multiple.
+func (obj *TimezoneRes) UIDs() []engine.ResUID {
+	x := &TimezoneUID{
+		BaseUID:  engine.BaseUID{Name: obj.Name(), Kind: obj.Kind()},
+		name:     obj.Name(),
+		timezone: obj.getTimezone(),
+	}
+	return []engine.ResUID{x}
+}
+
+// UnmarshalYAML is the custom unmarshal handler for this struct. It is
+// primarily useful for setting the defaults.
+func (obj *TimezoneRes) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type rawRes TimezoneRes // indirection to avoid infinite recursion
+
+	def := obj.Default()          // get the default
+	res, ok := def.(*TimezoneRes) // put in the right format
+	if !ok {
+		return fmt.Errorf("could not convert to TimezoneRes")
+	}
+	raw := rawRes(*res) // convert; the defaults go here
+
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+
+	*obj = TimezoneRes(raw) // restore from indirection with type conversion!
+	return nil
+}
+
+// dbusPropertiesWatch sends an event whenever the PropertiesChanged signal is
+// seen for the dbus object at path, or when any of the files change. The files
+// are watched too, because the properties don't change if someone edits them
+// directly. This is shared by the resources which wrap a systemd daemon.
+func dbusPropertiesWatch(ctx context.Context, init *engine.Init, path string, files ...string) error {
+	var events []chan *recwatch.Event
+	for _, file := range files {
+		recWatcher, err := recwatch.NewRecWatcher(file, false) // single file
+		if err != nil {
+			return err
+		}
+		defer recWatcher.Close()
+		events = append(events, recWatcher.Events())
+	}
+
+	// merge all the file events into a single channel
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	done := make(chan struct{})
+	defer close(done) // runs before the wait
+	fileEvents := make(chan *recwatch.Event)
+	for _, ch := range events {
+		wg.Add(1)
+		go func(ch chan *recwatch.Event) {
+			defer wg.Done()
+			for {
+				var event *recwatch.Event
+				select {
+				case e, ok := <-ch:
+					if !ok {
+						return
+					}
+					event = e
+				case <-done:
+					return
+				}
+				select {
+				case fileEvents <- event:
+				case <-done:
+					return
+				}
+			}
+		}(ch)
+	}
+
+	// if we share the bus with others, we will get each others messages!!
+	bus, err := util.SystemBusPrivateUsable() // don't share the bus connection!
+	if err != nil {
+		return errwrap.Wrapf(err, "failed to connect to bus")
+	}
+	defer bus.Close()
+	// watch the PropertiesChanged signal on the dbus path
+	args := fmt.Sprintf(
+		"type='signal', path='%s', interface='%s', member='PropertiesChanged'",
+		path,
+		dbusPropertiesIface,
+	)
+	if call := bus.BusObject().Call(engineUtil.DBusAddMatch, 0, args); call.Err != nil {
+		return errwrap.Wrapf(call.Err, "failed to subscribe to DBus events for %s", path)
+	}
+	defer bus.BusObject().Call(engineUtil.DBusRemoveMatch, 0, args) // ignore the error
+
+	signals := make(chan *dbus.Signal, 10) // closed by dbus package
+	bus.Signal(signals)
+
+	if err := init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case signal, ok := <-signals:
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if init.Debug {
+				init.Logf("signal(%s): %v", signal.Path, signal.Name)
+			}
+
+		case event := <-fileEvents:
+			if event == nil {
+				// programming error
+				return fmt.Errorf("unexpected nil recwatch event")
+			}
+			if err := event.Error; err != nil {
+				return err
+			}
+			if init.Debug { // don't access event.Body if event.Error isn't nil
+				init.Logf("event(%s): %v", event.Body.Name, event.Body.Op)
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return ctx.Err()
+		}
+
+		if err := init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// dbusStringProperty reads a string property from a dbus object.
+func dbusStringProperty(object dbus.BusObject, iface, property string) (string, error) {
+	v, err := object.GetProperty(iface + "." + property)
+	if err != nil {
+		return "", errwrap.Wrapf(err, "failed to get %s.%s", iface, property)
+	}
+	s, ok := v.Value().(string)
+	if !ok {
+		return "", fmt.Errorf("received unexpected type as %s value, expected string got '%T'", property, v.Value())
+	}
+	return s, nil
+}
+
+// dbusBoolProperty reads a bool property from a dbus object.
+func dbusBoolProperty(object dbus.BusObject, iface, property string) (bool, error) {
+	v, err := object.GetProperty(iface + "." + property)
+	if err != nil {
+		return false, errwrap.Wrapf(err, "failed to get %s.%s", iface, property)
+	}
+	b, ok := v.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("received unexpected type as %s value, expected bool got '%T'", property, v.Value())
+	}
+	return b, nil
+}
+
+// dbusStringsProperty reads a string list property from a dbus object.
+func dbusStringsProperty(object dbus.BusObject, iface, property string) ([]string, error) {
+	v, err := object.GetProperty(iface + "." + property)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "failed to get %s.%s", iface, property)
+	}
+	l, ok := v.Value().([]string)
+	if !ok {
+		return nil, fmt.Errorf("received unexpected type as %s value, expected []string got '%T'", property, v.Value())
+	}
+	return l, nil
+}
@@ -0,0 +1,117 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package resources
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTimezoneValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *TimezoneRes
+		fail bool
+	}{
+		{"UTC", &TimezoneRes{}, false},
+		{"tz", &TimezoneRes{Timezone: "America/Toronto"}, false},
+		{"", &TimezoneRes{}, true},
+		{"tz", &TimezoneRes{Timezone: "Local"}, true},
+		{"tz", &TimezoneRes{Timezone: "../../etc/passwd"}, true},
+		{"tz", &TimezoneRes{Timezone: "Mars/Olympus_Mons"}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("timezone")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
+
+func TestLocaleValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		res  *LocaleRes
+		fail bool
+	}{
+		{"en_US.UTF-8", &LocaleRes{}, false},
+		{"locale", &LocaleRes{Lang: "C.UTF-8", Variables: map[string]string{"LC_TIME": "en_GB.UTF-8"}}, false},
+		{"", &LocaleRes{}, true},
+		{"locale", &LocaleRes{Lang: "en US"}, true},
+		{"locale", &LocaleRes{Lang: "C", Variables: map[string]string{"LANG": "C"}}, true},
+		{"locale", &LocaleRes{Lang: "C", Variables: map[string]string{"LC_FOO": "C"}}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("locale")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+
+	res := &LocaleRes{Lang: "C", Variables: map[string]string{"LC_TIME": "en_GB.UTF-8", "LC_CTYPE": "C.UTF-8"}}
+	if s := strings.Join(res.locale(), " "); s != "LANG=C LC_CTYPE=C.UTF-8 LC_TIME=en_GB.UTF-8" {
+		t.Errorf("unexpected locale: %s", s)
+	}
+}
+
+func TestKeymapValidate(t *testing.T) {
+	layout := "de"
+	bad := "de nodeadkeys"
+	tests := []struct {
+		name string
+		res  *KeymapRes
+		fail bool
+	}{
+		{"us", &KeymapRes{}, false},
+		{"keymap", &KeymapRes{Keymap: "de-latin1", X11Layout: &layout}, false},
+		{"", &KeymapRes{}, true},
+		{"keymap", &KeymapRes{Keymap: "de", X11Variant: &bad}, true},
+	}
+
+	for i, test := range tests {
+		test.res.SetKind("keymap")
+		test.res.SetName(test.name)
+		if err := test.res.Validate(); err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		}
+	}
+}
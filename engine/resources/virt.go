@@ -71,6 +71,7 @@ const (
 // TODO: some values inside here should be enum's!
 type VirtRes struct {
 	traits.Base // add the base methods without re-implementation
+	traits.Edgeable
 	traits.Refreshable
 
 	init *engine.Init
@@ -1043,9 +1044,15 @@ type DiskDevice struct {
 func (obj *DiskDevice) GetXML(idx int) string {
 	source, _ := util.ExpandHome(obj.Source) // TODO: should we handle errors?
 	var b string
-	b += "<disk type='file' device='disk'>"
-	b += fmt.Sprintf("<driver name='qemu' type='%s'/>", obj.Type)
-	b += fmt.Sprintf("<source file='%s'/>", source)
+	if strings.HasPrefix(source, "/dev/") { // a block device such as an lv
+		b += "<disk type='block' device='disk'>"
+		b += fmt.Sprintf("<driver name='qemu' type='%s'/>", obj.Type)
+		b += fmt.Sprintf("<source dev='%s'/>", source)
+	} else {
+		b += "<disk type='file' device='disk'>"
+		b += fmt.Sprintf("<driver name='qemu' type='%s'/>", obj.Type)
+		b += fmt.Sprintf("<source file='%s'/>", source)
+	}
 	b += fmt.Sprintf("<target dev='vd%s' bus='virtio'/>", util.NumToAlpha(idx))
 	b += "</disk>"
 	return b
@@ -1313,6 +1320,54 @@ func (obj *VirtRes) UIDs() []engine.ResUID {
 	return []engine.ResUID{x}
 }
 
+// VirtResAutoEdges holds the state of the auto edge generator.
+type VirtResAutoEdges struct {
+	uids    []engine.ResUID
+	pointer int
+}
+
+// Next returns the next automatic edge.
+func (obj *VirtResAutoEdges) Next() []engine.ResUID {
+	if len(obj.uids) == 0 {
+		return nil
+	}
+	value := obj.uids[obj.pointer]
+	obj.pointer++
+	return []engine.ResUID{value}
+}
+
+// Test gets results of the earlier Next() call, & returns if we should
+// continue.
+func (obj *VirtResAutoEdges) Test(input []bool) bool {
+	if len(obj.uids) <= obj.pointer {
+		return false
+	}
+	if len(input) != 1 { // in case we get given bad data
+		panic("expecting a single value")
+	}
+	return true // keep going
+}
+
+// AutoEdges returns edges from the lvm:lv resources which provide any of the
+// disks, so that the volumes exist before the machine uses them.
+func (obj *VirtRes) AutoEdges(ctx context.Context) (engine.AutoEdge, error) {
+	reversed := true
+	base := engine.BaseUID{
+		Name:     obj.Name(),
+		Kind:     obj.Kind(),
+		Reversed: &reversed,
+	}
+	uids := []engine.ResUID{}
+	for _, disk := range obj.Disk {
+		if uid, ok := lvmLVUID(base, disk.Source); ok {
+			uids = append(uids, uid)
+		}
+	}
+	return &VirtResAutoEdges{
+		uids: uids,
+	}, nil
+}
+
 // Background is a worker function which is run once per resource kind as long
 // as there is at least one of that kind running in the active resource graph.
 // The worker function is the generated (returned) function that is used here.
@@ -0,0 +1,761 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package ast
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/funcs/operators"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	langUtil "github.com/purpleidea/mgmt/lang/util"
+)
+
+const (
+	// LintUnusedVariable is the rule for a variable which is never read.
+	LintUnusedVariable = "unused-variable"
+
+	// LintUnusedImport is the rule for an import which is never used.
+	LintUnusedImport = "unused-import"
+
+	// LintShadowedBinding is the rule for a variable which hides another
+	// variable of the same name from an enclosing scope.
+	LintShadowedBinding = "shadowed-binding"
+
+	// LintConstantCondition is the rule for an if statement or expression
+	// with a condition that is a constant, so that one branch is dead.
+	LintConstantCondition = "constant-condition"
+
+	// LintDuplicateResource is the rule for resources of the same kind with
+	// names that only differ by their interpolated parts, since those might
+	// end up being the same name when the program runs.
+	LintDuplicateResource = "duplicate-resource"
+
+	// LintMissingDependency is the rule for a resource which has no edge to
+	// the resource it obviously depends on, such as a service which doesn't
+	// depend on the package which installs it.
+	LintMissingDependency = "missing-dependency"
+
+	// LintDeprecatedFunction is the rule for a call to a function which is
+	// deprecated.
+	LintDeprecatedFunction = "deprecated-function"
+
+	// LintIgnore is the marker of a comment which suppresses lint rules. It
+	// is followed by a comma separated list of rule names. It applies to
+	// the line it is on, or if it is alone on its line, to the next line.
+	LintIgnore = "lint:ignore"
+)
+
+// LintRules is the description of each lint rule, keyed by the rule name.
+var LintRules = map[string]string{
+	LintUnusedVariable:     "variable is never used",
+	LintUnusedImport:       "import is never used",
+	LintShadowedBinding:    "variable shadows one from an enclosing scope",
+	LintConstantCondition:  "condition is a constant, so a branch is unreachable",
+	LintDuplicateResource:  "resource names only differ by interpolation",
+	LintMissingDependency:  "resource has no edge to its obvious dependency",
+	LintDeprecatedFunction: "function is deprecated",
+}
+
+// lintIgnoreRegexp matches a suppression comment and captures the rule names.
+var lintIgnoreRegexp = regexp.MustCompile(`#\s*` + LintIgnore + `\s+([a-z-]+(?:\s*,\s*[a-z-]+)*)`)
+
+// LintIssue is a single problem which was found by Lint.
+type LintIssue struct {
+	// Rule is the name of the rule which found this issue.
+	Rule string
+
+	// Msg is the human readable description of this issue.
+	Msg string
+
+	// File is the source file that this issue is in.
+	File *interfaces.SourceFile
+
+	// Line is the one-based line number of this issue.
+	Line int
+
+	// Column is the one-based column number of this issue.
+	Column int
+}
+
+// String returns the issue in the usual file:line:column format.
+func (obj *LintIssue) String() string {
+	return fmt.Sprintf("%s:%d:%d: %s (%s)", obj.File.Filename(), obj.Line, obj.Column, obj.Msg, obj.Rule)
+}
+
+// lintNode is anything that knows where it is in the source code. This is
+// usually an AST node, but it can also be a Textarea on its own.
+type lintNode interface {
+	IsSet() bool
+	Pos() (int, int)
+	SourceFile() *interfaces.SourceFile
+}
+
+// lintKey returns a key that identifies the position of a node. Copies of a
+// node share the position of the original, such as the contents of a class for
+// each include, so this is what we use to count those only once. It returns
+// the empty string if the node has no position.
+func lintKey(node interface{}) string {
+	x, ok := node.(lintNode)
+	if !ok || !x.IsSet() {
+		return ""
+	}
+	line, col := x.Pos()
+	return fmt.Sprintf("%s:%d:%d", x.SourceFile().URI(), line, col)
+}
+
+// linter holds the state of a single run of Lint.
+type linter struct {
+	root   interfaces.Stmt
+	issues map[string]*LintIssue // keyed by rule and position
+}
+
+// report adds an issue about a node. Nodes without a position are skipped,
+// since there would be nowhere to show it, and nothing to suppress it with.
+func (obj *linter) report(x lintNode, rule, format string, v ...interface{}) {
+	key := lintKey(x)
+	if key == "" {
+		return
+	}
+	line, col := x.Pos()
+	obj.issues[rule+"@"+key] = &LintIssue{
+		Rule:   rule,
+		Msg:    fmt.Sprintf(format, v...),
+		File:   x.SourceFile(),
+		Line:   line + 1, // one-based for display
+		Column: col + 1,
+	}
+}
+
+// Lint looks for suspicious code in the AST. It must run after SetScope, since
+// most rules need to know which definition each name refers to. The issues are
+// returned sorted by position, and any that have a suppression comment for
+// their rule have been removed already.
+func Lint(ast interfaces.Stmt) ([]*LintIssue, error) {
+	obj := &linter{
+		root:   ast,
+		issues: make(map[string]*LintIssue),
+	}
+
+	obj.unusedVariables()
+	obj.unusedImports()
+	obj.shadowedBindings()
+	obj.constantConditions()
+	obj.duplicateResources()
+	obj.missingDependencies()
+	obj.deprecatedFunctions()
+
+	sources := make(map[string][]string) // file contents split into lines
+	issues := []*LintIssue{}
+	for _, issue := range obj.issues {
+		uri := issue.File.URI()
+		lines, exists := sources[uri]
+		if !exists {
+			if b, err := issue.File.Source(); err == nil {
+				lines = strings.Split(string(b), "\n")
+			}
+			sources[uri] = lines // nil if we can't read it
+		}
+		if lintIgnored(lines, issue.Line-1, issue.Rule) {
+			continue
+		}
+		issues = append(issues, issue)
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		a, b := issues[i], issues[j]
+		if x, y := a.File.Filename(), b.File.Filename(); x != y {
+			return x < y
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return a.Rule < b.Rule
+	})
+	return issues, nil
+}
+
+// lintIgnored returns true if the rule is suppressed for the zero-based line.
+// This is the case if it has a suppression comment for that rule, or if the
+// line above it is only that comment.
+func lintIgnored(lines []string, line int, rule string) bool {
+	match := func(s string) bool {
+		m := lintIgnoreRegexp.FindStringSubmatch(s)
+		if m == nil {
+			return false
+		}
+		for _, x := range strings.Split(m[1], ",") {
+			if strings.TrimSpace(x) == rule {
+				return true
+			}
+		}
+		return false
+	}
+	if line < 0 || line >= len(lines) {
+		return false
+	}
+	if match(lines[line]) {
+		return true
+	}
+	if line == 0 {
+		return false
+	}
+	above := strings.TrimSpace(lines[line-1])
+	return strings.HasPrefix(above, "#") && match(above)
+}
+
+// progs returns every program in the AST which had its scope set, along with
+// the set of those which are the top-level of an imported module. A class
+// which is never included has a body with no scope, so it is skipped, since
+// nothing inside of it can be resolved.
+func (obj *linter) progs() ([]*StmtProg, map[*StmtProg]struct{}) {
+	progs := []*StmtProg{}
+	modules := make(map[*StmtProg]struct{})
+	obj.root.Apply(func(node interfaces.Node) error {
+		prog, ok := node.(*StmtProg)
+		if !ok || prog.scope == nil {
+			return nil
+		}
+		progs = append(progs, prog)
+		for _, x := range prog.importProgs {
+			modules[x] = struct{}{}
+		}
+		return nil
+	})
+	return progs, modules
+}
+
+// unusedVariables finds each bind which is never read. The top-level binds of
+// an imported module are skipped, since they're what that module exports.
+func (obj *linter) unusedVariables() {
+	used := make(map[string]struct{})
+	obj.root.Apply(func(node interfaces.Node) error {
+		switch node.(type) {
+		case *ExprVar, *ExprCall:
+		default:
+			return nil
+		}
+		if def := Definition(node); def != nil {
+			if key := lintKey(def); key != "" {
+				used[key] = struct{}{}
+			}
+		}
+		return nil
+	})
+
+	progs, modules := obj.progs()
+	for _, prog := range progs {
+		if _, exists := modules[prog]; exists {
+			continue
+		}
+		for _, x := range prog.Body {
+			bind, ok := x.(*StmtBind)
+			if !ok {
+				continue
+			}
+			key := lintKey(trueCallee(bind.Value))
+			if key == "" {
+				continue
+			}
+			if _, exists := used[key]; exists {
+				continue
+			}
+			obj.report(bind, LintUnusedVariable, "variable `$%s` is never used", bind.Ident)
+		}
+	}
+}
+
+// unusedImports finds each import with a name that is never used as a prefix
+// by the program it is in. Star imports can't be checked like this.
+func (obj *linter) unusedImports() {
+	progs, _ := obj.progs()
+	for _, prog := range progs {
+		imports := []*StmtImport{}
+		names := make(map[string]struct{})
+		for _, x := range prog.Body {
+			if imp, ok := x.(*StmtImport); ok {
+				imports = append(imports, imp)
+				continue
+			}
+			x.Apply(func(node interfaces.Node) error {
+				// skip what was included from elsewhere
+				if n, ok := node.(lintNode); ok && n.SourceFile().URI() != prog.SourceFile().URI() {
+					return nil
+				}
+				for _, name := range lintNames(node) {
+					names[name] = struct{}{}
+				}
+				return nil
+			})
+		}
+
+		for _, imp := range imports {
+			alias := imp.Alias
+			if alias == "" {
+				result, err := langUtil.ParseImportName(imp.Name)
+				if err != nil {
+					continue // already caught by SetScope
+				}
+				alias = result.Alias
+			}
+			if alias == interfaces.BareSymbol {
+				continue
+			}
+			found := false
+			for name := range names {
+				if strings.HasPrefix(name, alias+interfaces.ModuleSep) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				obj.report(imp, LintUnusedImport, "import `%s` is never used", imp.Name)
+			}
+		}
+	}
+}
+
+// lintNames returns each name that a node refers to. This includes the names
+// of any types, since they can come from an import as well.
+func lintNames(node interfaces.Node) []string {
+	typs := []*types.Type{}
+	names := []string{}
+	switch x := node.(type) {
+	case *ExprVar:
+		names = append(names, x.Name)
+	case *ExprCall:
+		names = append(names, x.Name)
+	case *StmtInclude:
+		names = append(names, x.Name)
+	case *StmtBind:
+		typs = append(typs, x.Type)
+	case *StmtType:
+		typs = append(typs, x.Type)
+	case *StmtClass:
+		for _, arg := range x.Args {
+			typs = append(typs, arg.Type)
+		}
+	case *StmtFor:
+		typs = append(typs, x.TypeIndex, x.TypeValue)
+	case *StmtForKV:
+		typs = append(typs, x.TypeKey, x.TypeVal)
+	case *ExprFunc:
+		for _, arg := range x.Args {
+			typs = append(typs, arg.Type)
+		}
+		typs = append(typs, x.Return)
+	}
+	for _, typ := range typs {
+		names = append(names, lintTypeNames(typ)...)
+	}
+	return names
+}
+
+// lintTypeNames returns the names of a type and of any types that it contains.
+func lintTypeNames(typ *types.Type) []string {
+	if typ == nil {
+		return nil
+	}
+	names := []string{}
+	if typ.Name != "" {
+		names = append(names, typ.Name)
+	}
+	for _, t := range []*types.Type{typ.Val, typ.Key, typ.Out, typ.Var} {
+		names = append(names, lintTypeNames(t)...)
+	}
+	for _, t := range typ.Map {
+		names = append(names, lintTypeNames(t)...)
+	}
+	return names
+}
+
+// shadowedBindings finds each variable which has the same name as another one
+// in an enclosing scope. It doesn't descend into includes, since the body of a
+// class is checked where it's defined.
+func (obj *linter) shadowedBindings() {
+	obj.shadowed(obj.root, map[string]struct{}{})
+}
+
+// shadowed is the recursive helper for shadowedBindings. The outer argument has
+// the names of all the variables of the enclosing scopes.
+func (obj *linter) shadowed(stmt interfaces.Stmt, outer map[string]struct{}) {
+	// scope returns a copy of outer with more names in it
+	scope := func(names ...string) map[string]struct{} {
+		m := make(map[string]struct{})
+		for k := range outer {
+			m[k] = struct{}{}
+		}
+		for _, k := range names {
+			m[k] = struct{}{}
+		}
+		return m
+	}
+	check := func(node lintNode, name string) {
+		if _, exists := outer[name]; exists {
+			obj.report(node, LintShadowedBinding, "variable `$%s` shadows a variable of the same name", name)
+		}
+	}
+
+	switch x := stmt.(type) {
+	case *StmtProg:
+		names := []string{}
+		for _, s := range x.Body {
+			if bind, ok := s.(*StmtBind); ok {
+				check(bind, bind.Ident)
+				names = append(names, bind.Ident)
+			}
+		}
+		inner := scope(names...)
+		for _, s := range x.Body {
+			obj.shadowed(s, inner)
+		}
+
+	case *StmtIf:
+		if x.ThenBranch != nil {
+			obj.shadowed(x.ThenBranch, outer)
+		}
+		if x.ElseBranch != nil {
+			obj.shadowed(x.ElseBranch, outer)
+		}
+
+	case *StmtClass:
+		names := []string{}
+		for _, arg := range x.Args {
+			check(x, arg.Name)
+			names = append(names, arg.Name)
+		}
+		obj.shadowed(x.Body, scope(names...))
+
+	case *StmtFor:
+		check(lintLocate(x.Textarea, x.IndexTextarea), x.Index)
+		check(lintLocate(x.Textarea, x.ValueTextarea), x.Value)
+		if x.Body != nil {
+			obj.shadowed(x.Body, scope(x.Index, x.Value))
+		}
+
+	case *StmtForKV:
+		check(lintLocate(x.Textarea, x.KeyTextarea), x.Key)
+		check(lintLocate(x.Textarea, x.ValTextarea), x.Val)
+		if x.Body != nil {
+			obj.shadowed(x.Body, scope(x.Key, x.Val))
+		}
+	}
+}
+
+// lintLocate returns the position of a part of a statement, such as one of the
+// loop variables, which only has its coordinates stored. It inherits the source
+// file from the statement, and it falls back to the statement if the part was
+// never located.
+func lintLocate(parent, part interfaces.Textarea) *interfaces.Textarea {
+	t := parent // copy
+	if part.IsSet() {
+		startLine, startColumn := part.Pos()
+		endLine, endColumn := part.End()
+		t.Locate(startLine, startColumn, endLine, endColumn)
+	}
+	return &t
+}
+
+// constantConditions finds each if statement or expression with a condition
+// that is a literal bool.
+func (obj *linter) constantConditions() {
+	obj.root.Apply(func(node interfaces.Node) error {
+		var cond interfaces.Expr
+		switch x := node.(type) {
+		case *StmtIf:
+			cond = x.Condition
+		case *ExprIf:
+			cond = x.Condition
+		default:
+			return nil
+		}
+		if b, ok := cond.(*ExprBool); ok {
+			obj.report(node.(lintNode), LintConstantCondition, "condition is always %t", b.V)
+		}
+		return nil
+	})
+}
+
+// lintHole is the placeholder for an interpolated part of a string.
+const lintHole = "\x00"
+
+// lintSkeleton returns the literal parts of an interpolated string, with a
+// placeholder for each part that was interpolated, as well as the text of the
+// whole string, with the interpolated expressions written out. It returns false
+// if this expression isn't a string or an interpolated one.
+func lintSkeleton(expr interfaces.Expr) (string, string, bool) {
+	switch x := expr.(type) {
+	case *ExprStr:
+		return x.V, x.V, true
+
+	case *ExprVar:
+		return lintHole, "${" + x.Name + "}", true
+
+	case *ExprCall:
+		args := x.Args
+		switch {
+		case x.Name == operators.OperatorFuncName && len(args) == 3:
+			if op, ok := args[0].(*ExprStr); !ok || op.V != "+" {
+				return "", "", false
+			}
+			args = args[1:]
+		case x.Name == funcs.ConcatFuncName:
+		default:
+			return lintHole, "${" + x.String() + "}", true
+		}
+		skeleton, text := "", ""
+		for _, arg := range args {
+			s, t, ok := lintSkeleton(arg)
+			if !ok {
+				return "", "", false
+			}
+			skeleton += s
+			text += t
+		}
+		return skeleton, text, true
+	}
+	return "", "", false
+}
+
+// duplicateResources finds resources of the same kind with names that are the
+// same except for the parts that are interpolated, but which aren't identical.
+func (obj *linter) duplicateResources() {
+	type entry struct {
+		res  *StmtRes
+		text string
+	}
+	groups := make(map[string][]*entry)
+	keys := []string{}
+	seen := make(map[string]struct{})
+	obj.root.Apply(func(node interfaces.Node) error {
+		res, ok := node.(*StmtRes)
+		if !ok {
+			return nil
+		}
+		key := lintKey(res)
+		if _, exists := seen[key]; exists || key == "" {
+			return nil
+		}
+		seen[key] = struct{}{}
+		skeleton, text, ok := lintSkeleton(res.Name)
+		if !ok || !strings.Contains(skeleton, lintHole) {
+			return nil
+		}
+		group := res.Kind + ":" + skeleton
+		if _, exists := groups[group]; !exists {
+			keys = append(keys, group)
+		}
+		groups[group] = append(groups[group], &entry{res: res, text: text})
+		return nil
+	})
+
+	for _, group := range keys {
+		entries := groups[group]
+		for i, x := range entries {
+			for _, y := range entries[:i] {
+				if x.text == y.text {
+					continue
+				}
+				line, _ := y.res.Pos()
+				obj.report(x.res, LintDuplicateResource, "%s[%q] might have the same name as %s[%q] on line %d", x.res.Kind, x.text, y.res.Kind, y.text, line+1)
+				break
+			}
+		}
+	}
+}
+
+// missingDependencies finds each service which isn't connected by any edges to
+// the package of the same name, or to a config file of the same name. This is
+// only done for resources which have a constant name.
+func (obj *linter) missingDependencies() {
+	// name returns the constant name of an expression, if it has one
+	name := func(expr interfaces.Expr) (string, bool) {
+		x, ok := expr.(*ExprStr)
+		if !ok {
+			return "", false
+		}
+		return x.V, true
+	}
+	// id is how we identify resources when we connect them
+	id := func(kind, name string) string {
+		return strings.ToLower(kind) + "[" + name + "]"
+	}
+
+	resources := make(map[string]*StmtRes)
+	ids := []string{}
+	parent := make(map[string]string) // union-find over the edges
+	var find func(string) string
+	find = func(x string) string {
+		if p, exists := parent[x]; exists && p != x {
+			r := find(p)
+			parent[x] = r
+			return r
+		}
+		return x
+	}
+	union := func(a, b string) {
+		parent[find(a)] = find(b)
+	}
+
+	obj.root.Apply(func(node interfaces.Node) error {
+		switch x := node.(type) {
+		case *StmtRes:
+			n, ok := name(x.Name)
+			if !ok {
+				return nil
+			}
+			self := id(x.Kind, n)
+			if _, exists := resources[self]; !exists {
+				resources[self] = x
+				ids = append(ids, self)
+			}
+			for _, c := range x.Contents {
+				edge, ok := c.(*StmtResEdge)
+				if !ok || edge.EdgeHalf == nil {
+					continue
+				}
+				if m, ok := name(edge.EdgeHalf.Name); ok {
+					union(self, id(edge.EdgeHalf.Kind, m))
+				}
+			}
+
+		case *StmtEdge:
+			for i := 1; i < len(x.EdgeHalfList); i++ {
+				a, b := x.EdgeHalfList[i-1], x.EdgeHalfList[i]
+				m, ok1 := name(a.Name)
+				n, ok2 := name(b.Name)
+				if ok1 && ok2 {
+					union(id(a.Kind, m), id(b.Kind, n))
+				}
+			}
+		}
+		return nil
+	})
+
+	for _, self := range ids {
+		res := resources[self]
+		if res.Kind != "svc" {
+			continue
+		}
+		n, _ := name(res.Name)
+		n = strings.TrimSuffix(n, ".service")
+
+		deps := []string{id("pkg", n)}
+		for _, other := range ids {
+			r := resources[other]
+			p, _ := name(r.Name)
+			if r.Kind == "file" && (p == "/etc/"+n+".conf" || strings.HasPrefix(p, "/etc/"+n+"/")) {
+				deps = append(deps, other)
+			}
+		}
+		missing := []string{}
+		for _, dep := range deps {
+			if _, exists := resources[dep]; !exists {
+				continue
+			}
+			if find(self) == find(dep) {
+				continue
+			}
+			missing = append(missing, dep)
+		}
+		if len(missing) > 0 {
+			obj.report(res, LintMissingDependency, "%s has no edge to %s", self, strings.Join(missing, ", "))
+		}
+	}
+}
+
+// deprecatedFunctions finds each call to a builtin function that is marked as
+// deprecated. The name of the function is found from the imports of the file
+// that the call is in, since that's what the function was registered with.
+func (obj *linter) deprecatedFunctions() {
+	// imports of each file, keyed by the alias, where "*" has a list
+	imports := make(map[string]map[string][]string)
+	progs, _ := obj.progs()
+	for _, prog := range progs {
+		uri := prog.SourceFile().URI()
+		if _, exists := imports[uri]; !exists {
+			imports[uri] = make(map[string][]string)
+		}
+		for _, x := range prog.Body {
+			imp, ok := x.(*StmtImport)
+			if !ok {
+				continue
+			}
+			result, err := langUtil.ParseImportName(imp.Name)
+			if err != nil || !result.IsSystem {
+				continue
+			}
+			alias := imp.Alias
+			if alias == "" {
+				alias = result.Alias
+			}
+			imports[uri][alias] = append(imports[uri][alias], result.Name)
+		}
+	}
+
+	obj.root.Apply(func(node interfaces.Node) error {
+		call, ok := node.(*ExprCall)
+		if !ok || call.Name == "" {
+			return nil
+		}
+		fn, ok := Definition(call).(*ExprFunc)
+		if !ok || fn.Body != nil { // only builtins
+			return nil
+		}
+		aliases := imports[call.SourceFile().URI()]
+
+		candidates := []string{call.Name}
+		if i := strings.LastIndex(call.Name, interfaces.ModuleSep); i >= 0 {
+			for _, x := range aliases[call.Name[:i]] {
+				candidates = append(candidates, x+interfaces.ModuleSep+call.Name[i+1:])
+			}
+		}
+		for _, x := range aliases[interfaces.BareSymbol] {
+			candidates = append(candidates, x+interfaces.ModuleSep+call.Name)
+		}
+		for _, name := range candidates {
+			if !strings.HasSuffix(name, fn.Title) {
+				continue
+			}
+			if notice, exists := funcs.LookupDeprecation(name); exists {
+				obj.report(call, LintDeprecatedFunction, "function `%s` is deprecated: %s", call.Name, notice)
+				return nil
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,257 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package ast_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/purpleidea/mgmt/lang/ast"
+	_ "github.com/purpleidea/mgmt/lang/core" // import so the funcs register
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/interpolate"
+	"github.com/purpleidea/mgmt/lang/parser"
+	"github.com/purpleidea/mgmt/pgraph"
+	"github.com/purpleidea/mgmt/util"
+)
+
+// lint runs the code through the stages that come before Lint, and then lints
+// it. Each issue is returned as a short "line:column rule" string.
+func lint(t *testing.T, code string) []string {
+	t.Helper()
+	fs := util.NewMemFs()
+	if err := fs.WriteFile("/main.mcl", []byte(code), 0600); err != nil {
+		t.Fatalf("could not write file: %+v", err)
+	}
+
+	xast, err := parser.LexParse(strings.NewReader(code))
+	if err != nil {
+		t.Fatalf("could not parse: %+v", err)
+	}
+	importGraph, err := pgraph.NewGraph("importGraph")
+	if err != nil {
+		t.Fatalf("could not create graph: %+v", err)
+	}
+	importVertex := &pgraph.SelfVertex{
+		Name:  "",          // first node is the empty string
+		Graph: importGraph, // store a reference to ourself
+	}
+	importGraph.AddVertex(importVertex)
+	data := &interfaces.Data{
+		Fs:    fs,
+		FsURI: fs.URI(),
+		Base:  "/",
+		Files: []string{"/main.mcl"},
+		Metadata: &interfaces.Metadata{
+			Main: "main.mcl",
+		},
+		Imports: importVertex,
+
+		LexParser:       parser.LexParse,
+		StrInterpolater: interpolate.StrInterpolate,
+
+		Logf: func(format string, v ...interface{}) {
+			t.Logf("test: "+format, v...)
+		},
+	}
+	if err := xast.Init(data); err != nil {
+		t.Fatalf("could not init: %+v", err)
+	}
+	iast, err := xast.Interpolate()
+	if err != nil {
+		t.Fatalf("could not interpolate: %+v", err)
+	}
+	scope := &interfaces.Scope{
+		Variables: map[string]interfaces.Expr{},
+		Functions: ast.FuncPrefixToFunctionsScope(""),
+	}
+	if err := iast.SetScope(scope); err != nil {
+		t.Fatalf("could not set scope: %+v", err)
+	}
+
+	issues, err := ast.Lint(iast)
+	if err != nil {
+		t.Fatalf("could not lint: %+v", err)
+	}
+	result := []string{}
+	for _, issue := range issues {
+		t.Logf("issue: %s", issue)
+		result = append(result, fmt.Sprintf("%d:%d %s", issue.Line, issue.Column, issue.Rule))
+	}
+	return result
+}
+
+func TestLint0(t *testing.T) {
+	type test struct { // an individual test
+		name string
+		code string
+		fail []string // expected issues
+	}
+	testCases := []test{
+		{
+			name: "clean",
+			code: `
+import "fmt"
+$x = "hello"
+test fmt.printf("%s", $x) {}
+`,
+			fail: []string{},
+		},
+		{
+			name: "unused variable",
+			code: `
+$x = "hello"
+$y = "world"
+test $x {}
+`,
+			fail: []string{"3:1 unused-variable"},
+		},
+		{
+			name: "unused variable in class",
+			code: `
+class c1($a) {
+	$b = "nope"
+	test $a {}
+}
+include c1("hello")
+include c1("world")
+`,
+			fail: []string{"3:2 unused-variable"},
+		},
+		{
+			name: "unused import",
+			code: `
+import "fmt"
+import "math"
+test fmt.printf("%d", 42) {}
+`,
+			fail: []string{"3:1 unused-import"},
+		},
+		{
+			name: "shadowed binding",
+			code: `
+$x = "hello"
+if true {
+	$x = "world"
+	test $x {}
+}
+test $x {}
+`,
+			fail: []string{"3:1 constant-condition", "4:2 shadowed-binding"},
+		},
+		{
+			name: "shadowed loop variable",
+			code: `
+$i = 0
+for $i, $v in ["a", "b"] {
+	test $v {}
+}
+test "x" {
+	int64ptr => $i,
+}
+`,
+			fail: []string{"3:5 shadowed-binding"},
+		},
+		{
+			name: "constant condition expression",
+			code: `
+test if false { "a" } else { "b" } {}
+`,
+			fail: []string{"2:6 constant-condition"},
+		},
+		{
+			name: "duplicate resource",
+			code: `
+$a = "hello"
+$b = "world"
+file "/tmp/${a}.txt" {}
+file "/tmp/${b}.txt" {}
+file "/tmp/${b}.conf" {}
+`,
+			fail: []string{"5:1 duplicate-resource"},
+		},
+		{
+			name: "missing dependency",
+			code: `
+pkg "nginx" {}
+file "/etc/nginx/nginx.conf" {}
+svc "nginx" {}
+pkg "cups" {}
+svc "cups" {
+	Depend => Pkg["cups"],
+}
+`,
+			fail: []string{"4:1 missing-dependency"},
+		},
+		{
+			name: "dependency through a chain",
+			code: `
+pkg "nginx" {}
+file "/etc/nginx.conf" {}
+svc "nginx" {}
+Pkg["nginx"] -> File["/etc/nginx.conf"] -> Svc["nginx"]
+`,
+			fail: []string{},
+		},
+		{
+			name: "deprecated function",
+			code: `
+import "golang/strings"
+test strings.title("hello") {}
+`,
+			fail: []string{"3:6 deprecated-function"},
+		},
+		{
+			name: "suppressed",
+			code: `
+import "golang/strings"
+$x = "hello" # lint:ignore unused-variable
+# lint:ignore deprecated-function, unused-import
+test strings.title("hello") {}
+$y = "world" # lint:ignore deprecated-function
+`,
+			fail: []string{"6:1 unused-variable"},
+		},
+	}
+
+	for index, tc := range testCases { // run all the tests
+		name, code, fail := tc.name, tc.code, tc.fail
+		t.Run(fmt.Sprintf("test #%d (%s)", index, name), func(t *testing.T) {
+			out := lint(t, code)
+			if a, b := strings.Join(out, ", "), strings.Join(fail, ", "); a != b {
+				t.Errorf("expected: %s", b)
+				t.Errorf("got: %s", a)
+			}
+		})
+	}
+}
@@ -0,0 +1,475 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package ast
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/funcs/operators"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+)
+
+const (
+	// MatchArgName is the name of the function arg that the desugared match
+	// expression uses to hold the value that it's matching on. It's a valid
+	// variable name, but since identifiers can't start with a digit, and
+	// match is a keyword, it cannot be used from the lexer.
+	MatchArgName = "match.0"
+)
+
+// MatchPatternKind specifies which kind of pattern a MatchPattern is.
+type MatchPatternKind int
+
+const (
+	// MatchPatternWildcard is the `_` pattern which matches anything.
+	MatchPatternWildcard MatchPatternKind = iota
+
+	// MatchPatternValue is a literal bool, str, int or float pattern which
+	// matches values that are equal to it.
+	MatchPatternValue
+
+	// MatchPatternList is a list pattern which matches lists of the same
+	// length whose elements each match the corresponding element pattern.
+	MatchPatternList
+
+	// MatchPatternStruct is a struct pattern which matches structs whose
+	// named fields each match the corresponding field pattern. Any fields
+	// which are not named are not looked at.
+	MatchPatternStruct
+)
+
+// MatchPattern is the pattern of a match expression arm.
+type MatchPattern struct {
+	interfaces.Textarea
+
+	Kind MatchPatternKind
+
+	// Value is the literal expression for a MatchPatternValue pattern.
+	Value interfaces.Expr
+
+	// List is the list of element patterns for a MatchPatternList pattern.
+	List []*MatchPattern
+
+	// Fields is the list of field patterns for a MatchPatternStruct
+	// pattern.
+	Fields []*MatchPatternField
+}
+
+// MatchPatternField is a named field pattern inside of a struct pattern.
+type MatchPatternField struct {
+	interfaces.Textarea
+
+	Name    string
+	Pattern *MatchPattern
+}
+
+// String returns a short representation of this pattern.
+func (obj *MatchPattern) String() string {
+	switch obj.Kind {
+	case MatchPatternWildcard:
+		return "_"
+
+	case MatchPatternValue:
+		return obj.Value.String()
+
+	case MatchPatternList:
+		elements := []string{}
+		for _, x := range obj.List {
+			elements = append(elements, x.String())
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+
+	case MatchPatternStruct:
+		fields := []string{}
+		for _, x := range obj.Fields {
+			fields = append(fields, x.Name+" => "+x.Pattern.String())
+		}
+		return "struct{" + strings.Join(fields, ", ") + "}"
+	}
+
+	return fmt.Sprintf("<unknown pattern kind: %d>", obj.Kind)
+}
+
+// validate sets up the textarea of this pattern and of its children, and
+// returns an error if this pattern wasn't built correctly.
+func (obj *MatchPattern) validate(data *interfaces.Data) error {
+	obj.Textarea.Setup(data)
+
+	switch obj.Kind {
+	case MatchPatternWildcard:
+		return nil
+
+	case MatchPatternValue:
+		switch obj.Value.(type) {
+		case *ExprBool, *ExprStr, *ExprInt, *ExprFloat:
+			return nil
+		}
+		err := fmt.Errorf("unexpected pattern value: %s", obj.Value)
+		return interfaces.HighlightHelper(obj, data.Logf, err)
+
+	case MatchPatternList:
+		for _, x := range obj.List {
+			if err := x.validate(data); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case MatchPatternStruct:
+		names := make(map[string]struct{})
+		for _, x := range obj.Fields {
+			x.Textarea.Setup(data)
+			if _, exists := names[x.Name]; exists {
+				err := fmt.Errorf("duplicate field name: %s", x.Name)
+				return interfaces.HighlightHelper(x, data.Logf, err)
+			}
+			names[x.Name] = struct{}{}
+			if err := x.Pattern.validate(data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown pattern kind: %d", obj.Kind)
+}
+
+// irrefutable returns true if this pattern matches every value that it could be
+// compared against.
+func (obj *MatchPattern) irrefutable() bool {
+	switch obj.Kind {
+	case MatchPatternWildcard:
+		return true
+
+	case MatchPatternStruct:
+		for _, x := range obj.Fields {
+			if !x.Pattern.irrefutable() {
+				return false
+			}
+		}
+		return true
+	}
+
+	return false // lists have a length and values are specific
+}
+
+// condition returns the boolean expression which is true when the value built
+// by the subject function matches this pattern. It returns nil if every value
+// matches. The subject function gets called once per use, so that every node
+// appears only once in the AST.
+func (obj *MatchPattern) condition(subject func() interfaces.Expr) interfaces.Expr {
+	switch obj.Kind {
+	case MatchPatternValue:
+		return obj.equals(subject(), obj.Value)
+
+	case MatchPatternList:
+		length := &ExprCall{
+			Textarea: obj.Textarea,
+			Name:     funcs.LenFuncName,
+			Args:     []interfaces.Expr{subject()},
+		}
+		size := &ExprInt{
+			Textarea: obj.Textarea,
+			V:        int64(len(obj.List)),
+		}
+		// The length check comes first, so that the lookups which follow
+		// can't be out of range.
+		conditions := []interfaces.Expr{obj.equals(length, size)}
+		for i, x := range obj.List {
+			element := func() interfaces.Expr {
+				return &ExprCall{
+					Textarea: x.Textarea,
+					Name:     funcs.LookupFuncName,
+					Args: []interfaces.Expr{
+						subject(),
+						&ExprInt{
+							Textarea: x.Textarea,
+							V:        int64(i),
+						},
+					},
+				}
+			}
+			if condition := x.condition(element); condition != nil {
+				conditions = append(conditions, condition)
+			}
+		}
+		return obj.and(conditions)
+
+	case MatchPatternStruct:
+		conditions := []interfaces.Expr{}
+		for _, x := range obj.Fields {
+			field := func() interfaces.Expr {
+				return &ExprCall{
+					Textarea: x.Textarea,
+					Name:     funcs.StructLookupFuncName,
+					Args: []interfaces.Expr{
+						subject(),
+						&ExprStr{
+							Textarea: x.Textarea,
+							V:        x.Name,
+						},
+					},
+				}
+			}
+			if condition := x.Pattern.condition(field); condition != nil {
+				conditions = append(conditions, condition)
+			}
+		}
+		return obj.and(conditions)
+	}
+
+	return nil // wildcard
+}
+
+// equals builds the `a == b` operator expression.
+func (obj *MatchPattern) equals(a, b interfaces.Expr) interfaces.Expr {
+	return &ExprCall{
+		Textarea: obj.Textarea,
+		Name:     operators.OperatorFuncName,
+		Args: []interfaces.Expr{
+			&ExprStr{ // operator first
+				Textarea: obj.Textarea,
+				V:        "==",
+			},
+			a,
+			b,
+		},
+	}
+}
+
+// and builds the conjunction of these conditions. It uses nested if expressions
+// instead of the `and` operator, so that a later condition only runs when every
+// earlier one was true, which lets the list length guard the list lookups.
+func (obj *MatchPattern) and(conditions []interfaces.Expr) interfaces.Expr {
+	if len(conditions) == 0 {
+		return nil
+	}
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return &ExprIf{
+		Textarea:   obj.Textarea,
+		Condition:  conditions[0],
+		ThenBranch: obj.and(conditions[1:]),
+		ElseBranch: &ExprBool{
+			Textarea: obj.Textarea,
+			V:        false,
+		},
+	}
+}
+
+// desugar builds the if expression chain that this match expression is sugar
+// for. The value gets passed into an anonymous function so that it is only
+// computed once, no matter how many times the patterns need to look at it. The
+// last arm doesn't get a condition, because the exhaustiveness check during
+// type unification guarantees that it matches if nothing before it did.
+func (obj *ExprMatch) desugar() interfaces.Expr {
+	var chain interfaces.Expr
+	for i := len(obj.Arms) - 1; i >= 0; i-- {
+		arm := obj.Arms[i]
+		subject := func() interfaces.Expr {
+			return &ExprVar{
+				Textarea: arm.Pattern.Textarea,
+				Name:     MatchArgName,
+			}
+		}
+		condition := arm.Pattern.condition(subject)
+		if chain == nil || condition == nil {
+			chain = arm.Body
+			continue
+		}
+		chain = &ExprIf{
+			Textarea:   arm.Textarea,
+			Condition:  condition,
+			ThenBranch: arm.Body,
+			ElseBranch: chain,
+		}
+	}
+
+	return &ExprCall{
+		Textarea: obj.Textarea,
+		Args:     []interfaces.Expr{obj.Expr},
+		Anon: &ExprFunc{
+			Textarea: obj.Textarea,
+			Title:    "match",
+			Args: []*interfaces.Arg{
+				{
+					Name: MatchArgName,
+				},
+			},
+			Body: chain,
+		},
+	}
+}
+
+// matchMissing checks if the rows of patterns are exhaustive. Each row is one
+// arm, and each row must have n patterns. It returns nil if every possible list
+// of n values matches at least one row, and otherwise it returns an example of
+// n patterns that no row matches, for use in an error message. This is the
+// classic algorithm from "Warnings for pattern matching" by Luc Maranget. Our
+// bools have a complete signature when both values are present, every struct
+// is a single constructor over the union of the fields that the patterns name,
+// and everything else has an infinite signature which only a wildcard covers.
+func matchMissing(rows [][]*MatchPattern, n int) []string {
+	if n == 0 {
+		if len(rows) == 0 {
+			return []string{} // nothing matched the empty row
+		}
+		return nil
+	}
+
+	heads := []*MatchPattern{}
+	for _, row := range rows {
+		if row[0].Kind != MatchPatternWildcard {
+			heads = append(heads, row[0])
+		}
+	}
+
+	if fields, ok := matchStructFields(heads); ok {
+		specialized := [][]*MatchPattern{}
+		for _, row := range rows {
+			patterns := make(map[string]*MatchPattern)
+			for _, x := range row[0].Fields { // none if wildcard
+				patterns[x.Name] = x.Pattern
+			}
+			expanded := []*MatchPattern{}
+			for _, name := range fields {
+				pattern, exists := patterns[name]
+				if !exists {
+					pattern = &MatchPattern{Kind: MatchPatternWildcard}
+				}
+				expanded = append(expanded, pattern)
+			}
+			specialized = append(specialized, append(expanded, row[1:]...))
+		}
+		missing := matchMissing(specialized, len(fields)+n-1)
+		if missing == nil {
+			return nil
+		}
+		values := []string{}
+		for i, name := range fields {
+			values = append(values, name+" => "+missing[i])
+		}
+		example := "struct{" + strings.Join(values, ", ") + "}"
+		return append([]string{example}, missing[len(fields):]...)
+	}
+
+	bools := matchBools(heads)
+	if bools[true] && bools[false] {
+		for _, b := range []bool{true, false} {
+			specialized := [][]*MatchPattern{}
+			for _, row := range rows {
+				if x, ok := matchBool(row[0]); ok && x != b {
+					continue
+				}
+				specialized = append(specialized, row[1:])
+			}
+			if missing := matchMissing(specialized, n-1); missing != nil {
+				return append([]string{strconv.FormatBool(b)}, missing...)
+			}
+		}
+		return nil
+	}
+
+	// The signature is incomplete, so only the wildcard rows can help.
+	defaults := [][]*MatchPattern{}
+	for _, row := range rows {
+		if row[0].Kind == MatchPatternWildcard {
+			defaults = append(defaults, row[1:])
+		}
+	}
+	missing := matchMissing(defaults, n-1)
+	if missing == nil {
+		return nil
+	}
+	example := "_"
+	if bools[true] && len(bools) == 1 {
+		example = "false"
+	}
+	if bools[false] && len(bools) == 1 {
+		example = "true"
+	}
+	return append([]string{example}, missing...)
+}
+
+// matchStructFields returns the sorted union of the field names in these struct
+// patterns. It returns false if they're not all struct patterns, or if there
+// are none.
+func matchStructFields(patterns []*MatchPattern) ([]string, bool) {
+	if len(patterns) == 0 {
+		return nil, false
+	}
+	names := make(map[string]struct{})
+	for _, x := range patterns {
+		if x.Kind != MatchPatternStruct {
+			return nil, false
+		}
+		for _, field := range x.Fields {
+			names[field.Name] = struct{}{}
+		}
+	}
+	fields := []string{}
+	for name := range names {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+	return fields, true
+}
+
+// matchBool returns the value of this pattern if it's a bool value pattern.
+func matchBool(pattern *MatchPattern) (bool, bool) {
+	if pattern.Kind != MatchPatternValue {
+		return false, false
+	}
+	x, ok := pattern.Value.(*ExprBool)
+	if !ok {
+		return false, false
+	}
+	return x.V, true
+}
+
+// matchBools returns the set of bool values in these patterns. If any of them
+// is not a bool value pattern, then the set is empty, since there can't be a
+// complete bool signature among them.
+func matchBools(patterns []*MatchPattern) map[bool]bool {
+	bools := make(map[bool]bool)
+	for _, x := range patterns {
+		b, ok := matchBool(x)
+		if !ok {
+			return map[bool]bool{}
+		}
+		bools[b] = true
+	}
+	return bools
+}
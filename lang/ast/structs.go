@@ -327,6 +327,18 @@ func (obj *StmtBind) Ordering(produces map[string]interfaces.Node) (*pgraph.Grap
 // SetScope stores the scope for later use in this resource and its children,
 // which it propagates this downwards to.
 func (obj *StmtBind) SetScope(scope *interfaces.Scope) error {
+	if obj.Type.HasNamedRef() {
+		typ, err := resolveType(scope, obj.Type)
+		if err != nil {
+			return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+		}
+		obj.Type = typ
+		// The parser would have done this if the type was known then.
+		if err := obj.Value.SetType(typ); err != nil {
+			return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+		}
+	}
+
 	emptyContext := map[string]interfaces.Expr{}
 	return obj.Value.SetScope(scope, emptyContext)
 }
@@ -5736,6 +5748,7 @@ func (obj *StmtProg) SetScope(scope *interfaces.Scope) error {
 	newVariables := make(map[string]string)
 	newFunctions := make(map[string]string)
 	newClasses := make(map[string]string)
+	newTypes := make(map[string]string)
 	// TODO: If we added .Ordering() for *StmtImport, we could combine this
 	// loop with the main nodeOrder sorted topological ordering loop below!
 	for _, x := range obj.Body {
@@ -5828,6 +5841,23 @@ func (obj *StmtProg) SetScope(scope *interfaces.Scope) error {
 			newClasses[newName] = imp.Name
 			newScope.Classes[newName] = x
 		}
+		for name, x := range importedScope.Types {
+			newName := alias + interfaces.ModuleSep + name
+			if alias == interfaces.BareSymbol {
+				if !AllowBareImports {
+					err := fmt.Errorf("bare imports disabled at compile time for import of `%s`", imp.Name)
+					return interfaces.HighlightHelper(imp, obj.data.Logf, err)
+				}
+				newName = name
+			}
+			if previous, exists := newTypes[newName]; exists && alias != interfaces.BareSymbol {
+				// don't overwrite in same scope
+				err := fmt.Errorf("can't squash type `%s` from `%s` by import of `%s`", newName, previous, imp.Name)
+				return interfaces.HighlightHelper(imp, obj.data.Logf, err)
+			}
+			newTypes[newName] = imp.Name
+			newScope.Types[newName] = x
+		}
 
 		// everything has been merged, move on to next import...
 		imports[imp.Name] = struct{}{} // mark as found in scope
@@ -5836,6 +5866,12 @@ func (obj *StmtProg) SetScope(scope *interfaces.Scope) error {
 		}
 	}
 
+	// Now that the imported types are known, we can add our own. These are
+	// not part of the ordering, because they can always be done up front.
+	if err := obj.scopeTypes(newScope); err != nil {
+		return err
+	}
+
 	// TODO: this could be called once at the top-level, and then cached...
 	// TODO: it currently gets called inside child programs, which is slow!
 	orderingGraph, _, err := obj.Ordering(nil) // XXX: pass in globals from scope?
@@ -6223,6 +6259,84 @@ func (obj *StmtProg) SetScope(scope *interfaces.Scope) error {
 	return nil
 }
 
+// scopeTypes resolves all of the type statements in this program and adds them
+// to the scope. Since they can refer to each other in any order, this happens
+// recursively, and a type which would (eventually) contain itself is an error.
+func (obj *StmtProg) scopeTypes(scope *interfaces.Scope) error {
+	stmts := make(map[string]*StmtType)
+	names := []string{} // in order of definition, for consistent errors
+	for _, x := range obj.Body {
+		stmt, ok := x.(*StmtType)
+		if !ok {
+			continue
+		}
+		// check for duplicates *in this scope*
+		if _, exists := stmts[stmt.Name]; exists {
+			err := fmt.Errorf("type `%s` already exists in this scope", stmt.Name)
+			return interfaces.HighlightHelper(stmt, obj.data.Logf, err)
+		}
+		stmts[stmt.Name] = stmt
+		names = append(names, stmt.Name)
+	}
+
+	resolved := make(map[string]*types.Type)
+	visiting := make(map[string]struct{})
+	var failed *StmtType // the innermost statement that errored
+	var lookup func(name string) (*types.Type, error)
+	lookup = func(name string) (*types.Type, error) {
+		if typ, exists := resolved[name]; exists {
+			return typ, nil
+		}
+		stmt, exists := stmts[name]
+		if !exists { // it might be from an import or a parent scope
+			typ, exists := scope.Types[name]
+			if !exists {
+				return nil, fmt.Errorf("type `%s` does not exist in this scope", name)
+			}
+			return typ, nil
+		}
+		if _, exists := visiting[name]; exists {
+			return nil, fmt.Errorf("recursive type `%s` found", name)
+		}
+		visiting[name] = struct{}{}
+		typ, err := stmt.Type.Resolve(lookup)
+		if err != nil {
+			if failed == nil {
+				failed = stmt
+			}
+			return nil, err
+		}
+		delete(visiting, name)
+
+		named := *typ // shallow copy so that we can name it
+		named.Name = name
+		resolved[name] = &named
+		return &named, nil
+	}
+
+	for _, name := range names {
+		typ, err := lookup(name)
+		if err != nil {
+			return interfaces.HighlightHelper(failed, obj.data.Logf, err)
+		}
+		// add to scope, (overwriting, aka shadowing is ok)
+		scope.Types[name] = typ
+	}
+
+	return nil
+}
+
+// Types returns the named types which are in scope in the body of this program.
+// This includes its own type statements and those from any imports. It is empty
+// until SetScope has run. Tools such as the docs generator use this to print the
+// name of a type instead of its structure.
+func (obj *StmtProg) Types() map[string]*types.Type {
+	if obj.scope == nil {
+		return nil
+	}
+	return obj.scope.Types
+}
+
 // TypeCheck returns the list of invariants that this node produces. It does so
 // recursively on any children elements that exist in the AST, and returns the
 // collection to the caller. It calls TypeCheck for child statements, and
@@ -6463,13 +6577,14 @@ func (obj *StmtProg) Output(table interfaces.Table) (*interfaces.Output, error)
 // TODO: technically this could be a method on Stmt, possibly using Apply...
 func (obj *StmtProg) IsModuleUnsafe() error { // TODO: rename this function?
 	for _, x := range obj.Body {
-		// stmt's allowed: import, bind, func, class
+		// stmt's allowed: import, bind, func, class, type
 		// stmt's not-allowed: for, forkv, if, include, res, edge
 		switch x.(type) {
 		case *StmtImport:
 		case *StmtBind:
 		case *StmtFunc:
 		case *StmtClass:
+		case *StmtType:
 		case *StmtComment: // possibly not even parsed
 			// all of these are safe
 		default:
@@ -6632,7 +6747,18 @@ func (obj *StmtFunc) Ordering(produces map[string]interfaces.Node) (*pgraph.Grap
 // necessary in order to reach this, in particular in situations when a bound
 // expression points to a previously bound expression.
 func (obj *StmtFunc) SetScope(scope *interfaces.Scope) error {
-	return obj.Func.SetScope(scope, map[string]interfaces.Expr{})
+	// The func resolves its own signature first, for more precise errors.
+	if err := obj.Func.SetScope(scope, map[string]interfaces.Expr{}); err != nil {
+		return err
+	}
+	if obj.Type.HasNamedRef() {
+		typ, err := resolveType(scope, obj.Type)
+		if err != nil {
+			return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+		}
+		obj.Type = typ
+	}
+	return nil
 }
 
 // TypeCheck returns the list of invariants that this node produces. It does so
@@ -6740,6 +6866,10 @@ func (obj *StmtClass) Init(data *interfaces.Data) error {
 		return fmt.Errorf("class name is empty")
 	}
 
+	if err := initArgs(obj.Args, data); err != nil {
+		return err
+	}
+
 	return obj.Body.Init(data)
 }
 
@@ -6752,9 +6882,9 @@ func (obj *StmtClass) Interpolate() (interfaces.Stmt, error) {
 		return nil, err
 	}
 
-	args := obj.Args
-	if obj.Args == nil {
-		args = []*interfaces.Arg{}
+	args, err := interpolateArgs(obj.Args)
+	if err != nil {
+		return nil, err
 	}
 
 	return &StmtClass{
@@ -6762,7 +6892,7 @@ func (obj *StmtClass) Interpolate() (interfaces.Stmt, error) {
 		data:     obj.data,
 		scope:    obj.scope,
 		Name:     obj.Name,
-		Args:     args, // ensure this has length == 0 instead of nil
+		Args:     args, // this has length == 0 instead of nil
 		Body:     interpolated,
 	}, nil
 }
@@ -6852,6 +6982,15 @@ func (obj *StmtClass) Ordering(produces map[string]interfaces.Node) (*pgraph.Gra
 		newCons[k] = v // "remaining" values from cons
 	}
 
+	// The defaults are scoped at the definition, so they use our parent.
+	c, err := orderingArgs(graph, obj, obj.Args, produces)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range c {
+		newCons[k] = v
+	}
+
 	return graph, newCons, nil
 }
 
@@ -6869,6 +7008,12 @@ func (obj *StmtClass) SetScope(scope *interfaces.Scope) error {
 	// site and not the variables which were in scope at the include site.
 	obj.scope = scope // store for later
 
+	args, arg, err := resolveArgs(scope, obj.Args)
+	if err != nil {
+		return highlightArg(obj.Textarea, arg, obj.data.Logf, err)
+	}
+	obj.Args = args
+
 	return nil
 }
 
@@ -6924,6 +7069,7 @@ type StmtInclude struct {
 
 	Name        string
 	Args        []interfaces.Expr
+	ArgNames    []string // name of each named arg, or empty if positional
 	argsEnvKeys []*ExprIterated
 	Alias       string
 }
@@ -6965,6 +7111,9 @@ func (obj *StmtInclude) Init(data *interfaces.Data) error {
 	if obj.Name == "" {
 		return fmt.Errorf("include name is empty")
 	}
+	if len(obj.ArgNames) != 0 && len(obj.ArgNames) != len(obj.Args) {
+		return fmt.Errorf("include has %d arg names for %d args", len(obj.ArgNames), len(obj.Args))
+	}
 
 	for _, x := range obj.Args {
 		if err := x.Init(data); err != nil {
@@ -6999,6 +7148,7 @@ func (obj *StmtInclude) Interpolate() (interfaces.Stmt, error) {
 		orig:        orig,
 		Name:        obj.Name,
 		Args:        args,
+		ArgNames:    obj.ArgNames,
 		argsEnvKeys: obj.argsEnvKeys, // update this if we interpolate after SetScope
 		Alias:       obj.Alias,
 	}, nil
@@ -7055,6 +7205,7 @@ func (obj *StmtInclude) Copy() (interfaces.Stmt, error) {
 		orig:        orig,
 		Name:        obj.Name,
 		Args:        args,
+		ArgNames:    obj.ArgNames,
 		argsEnvKeys: obj.argsEnvKeys,
 		Alias:       obj.Alias,
 	}, nil
@@ -7153,6 +7304,15 @@ func (obj *StmtInclude) SetScope(scope *interfaces.Scope) error {
 		return fmt.Errorf("class scope of `%s` does not contain a class", obj.Name)
 	}
 
+	// Match any named args, and fill in any defaults, so that from here
+	// onwards, the args are in the same order as the class definition.
+	args, err := bindArgs("class", obj.Name, class.Args, obj.Args, obj.ArgNames, class.scope)
+	if err != nil {
+		return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+	}
+	obj.Args = args
+	obj.ArgNames = nil
+
 	// Is it even possible for the signatures to not match?
 	if len(class.Args) != len(obj.Args) {
 		err := fmt.Errorf("class `%s` expected %d args but got %d", obj.Name, len(class.Args), len(obj.Args))
@@ -7518,6 +7678,110 @@ func (obj *StmtImport) Output(interfaces.Table) (*interfaces.Output, error) {
 	return interfaces.EmptyOutput(), nil
 }
 
+// StmtType is a representation of a type statement, which gives a name to a
+// type, eg: `type endpoint = struct{name str; port int}`. These are collected by
+// StmtProg before anything else runs, and they get added to the scope, so that
+// they can be used in the signatures of functions, classes and binds, in any
+// order of definition. They can also be imported from other modules. When the
+// scope is set on any of those nodes, the names are replaced by the types that
+// they stand for, so that type unification only ever compares the structure.
+type StmtType struct {
+	interfaces.Textarea
+
+	data *interfaces.Data
+
+	Name string
+	Type *types.Type
+}
+
+// String returns a short representation of this statement.
+func (obj *StmtType) String() string {
+	return "type(" + obj.Name + ")"
+}
+
+// Apply is a general purpose iterator method that operates on any AST node. It
+// is not used as the primary AST traversal function because it is less readable
+// and easy to reason about than manually implementing traversal for each node.
+// Nevertheless, it is a useful facility for operations that might only apply to
+// a select number of node types, since they won't need extra noop iterators...
+func (obj *StmtType) Apply(fn func(interfaces.Node) error) error { return fn(obj) }
+
+// Init initializes this branch of the AST, and returns an error if it fails to
+// validate.
+func (obj *StmtType) Init(data *interfaces.Data) error {
+	obj.data = data
+	obj.Textarea.Setup(data)
+
+	if obj.Name == "" {
+		return fmt.Errorf("type name is empty")
+	}
+	if obj.Type == nil {
+		return fmt.Errorf("type `%s` is empty", obj.Name)
+	}
+	return nil
+}
+
+// Interpolate returns a new node (aka a copy) once it has been expanded. This
+// generally increases the size of the AST when it is used. It calls Interpolate
+// on any child elements and builds the new node with those new node contents.
+func (obj *StmtType) Interpolate() (interfaces.Stmt, error) {
+	return &StmtType{
+		Textarea: obj.Textarea,
+		data:     obj.data,
+		Name:     obj.Name,
+		Type:     obj.Type,
+	}, nil
+}
+
+// Copy returns a light copy of this struct. Anything static will not be copied.
+func (obj *StmtType) Copy() (interfaces.Stmt, error) {
+	return obj, nil // always static
+}
+
+// Ordering returns a graph of the scope ordering that represents the data flow.
+// This can be used in SetScope so that it knows the correct order to run it in.
+// Nothing special happens in this method, since StmtProg resolves all the type
+// statements before anything else, which is why they can appear in any order.
+func (obj *StmtType) Ordering(produces map[string]interfaces.Node) (*pgraph.Graph, map[interfaces.Node]string, error) {
+	graph, err := pgraph.NewGraph("ordering")
+	if err != nil {
+		return nil, nil, err
+	}
+	graph.AddVertex(obj)
+
+	cons := make(map[interfaces.Node]string)
+	return graph, cons, nil
+}
+
+// SetScope stores the scope for later use in this resource and its children,
+// which it propagates this downwards to. The type is added to the scope by the
+// StmtProg that contains it, so there is nothing to do here.
+func (obj *StmtType) SetScope(*interfaces.Scope) error { return nil }
+
+// TypeCheck returns the list of invariants that this node produces. It does so
+// recursively on any children elements that exist in the AST, and returns the
+// collection to the caller. It calls TypeCheck for child statements, and
+// Infer/Check for child expressions.
+func (obj *StmtType) TypeCheck() ([]*interfaces.UnificationInvariant, error) {
+	return []*interfaces.UnificationInvariant{}, nil
+}
+
+// Graph returns the reactive function graph which is expressed by this node. It
+// includes any vertices produced by this node, and the appropriate edges to any
+// vertices that are produced by its children. Nodes which fulfill the Expr
+// interface directly produce vertices (and possible children) where as nodes
+// that fulfill the Stmt interface do not produces vertices, where as their
+// children might. This particular statement just returns an empty graph.
+func (obj *StmtType) Graph(*interfaces.Env) (*pgraph.Graph, error) {
+	return pgraph.NewGraph("type") // empty graph
+}
+
+// Output for the type statement produces no output. It only gives a name to a
+// type which other statements can then use.
+func (obj *StmtType) Output(interfaces.Table) (*interfaces.Output, error) {
+	return interfaces.EmptyOutput(), nil
+}
+
 // StmtComment is a representation of a comment. It is currently unused. It
 // probably makes sense to make a third kind of Node (not a Stmt or an Expr) so
 // that comments can still be part of the AST (for eventual automatic code
@@ -9778,6 +10042,9 @@ func (obj *ExprFunc) Init(data *interfaces.Data) error {
 	}
 
 	if obj.Body != nil {
+		if err := initArgs(obj.Args, data); err != nil {
+			return err
+		}
 		if err := obj.Body.Init(data); err != nil {
 			return err
 		}
@@ -9839,9 +10106,9 @@ func (obj *ExprFunc) Interpolate() (interfaces.Expr, error) {
 		}
 	}
 
-	args := obj.Args
-	if obj.Args == nil {
-		args = []*interfaces.Arg{}
+	args, err := interpolateArgs(obj.Args)
+	if err != nil {
+		return nil, err
 	}
 
 	return &ExprFunc{
@@ -10011,6 +10278,15 @@ func (obj *ExprFunc) Ordering(produces map[string]interfaces.Node) (*pgraph.Grap
 		newCons[k] = v // "remaining" values from cons
 	}
 
+	// The defaults are scoped at the definition, so they use our parent.
+	c, err := orderingArgs(graph, obj, obj.Args, produces)
+	if err != nil {
+		return nil, nil, err
+	}
+	for k, v := range c {
+		newCons[k] = v
+	}
+
 	return graph, newCons, nil
 }
 
@@ -10022,6 +10298,10 @@ func (obj *ExprFunc) SetScope(scope *interfaces.Scope, sctx map[string]interface
 	}
 	obj.scope = scope // store for later
 
+	if err := obj.resolveTypes(scope); err != nil {
+		return err
+	}
+
 	if obj.Body != nil {
 		sctxBody := make(map[string]interfaces.Expr)
 		for k, v := range sctx {
@@ -10069,6 +10349,56 @@ func (obj *ExprFunc) SetScope(scope *interfaces.Scope, sctx map[string]interface
 	return nil
 }
 
+// resolveTypes replaces any named types in the signature of this function with
+// the types they stand for in the scope. If this makes the signature complete,
+// then the type gets set, which the parser would have done if it could have.
+// Any error that it returns has already been highlighted.
+func (obj *ExprFunc) resolveTypes(scope *interfaces.Scope) error {
+	if !obj.Return.HasNamedRef() {
+		found := false
+		for _, arg := range obj.Args {
+			found = found || arg.Type.HasNamedRef()
+		}
+		if !found {
+			return nil // nothing to do
+		}
+	}
+
+	args, arg, err := resolveArgs(scope, obj.Args)
+	if err != nil {
+		return highlightArg(obj.Textarea, arg, obj.data.Logf, err)
+	}
+	out, err := resolveType(scope, obj.Return)
+	if err != nil {
+		return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+	}
+	obj.Args = args
+	obj.Return = out
+
+	if obj.Return == nil || obj.typ != nil {
+		return nil
+	}
+	m := make(map[string]*types.Type)
+	ord := []string{}
+	for _, arg := range obj.Args {
+		if arg.Type == nil {
+			return nil // not fully typed
+		}
+		m[arg.Name] = arg.Type
+		ord = append(ord, arg.Name)
+	}
+	typ := &types.Type{
+		Kind: types.KindFunc,
+		Map:  m,
+		Ord:  ord,
+		Out:  obj.Return,
+	}
+	if err := obj.SetType(typ); err != nil {
+		return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+	}
+	return nil
+}
+
 // SetType is used to set the type of this expression once it is known. This
 // usually happens during type unification, but it can also happen during
 // parsing if a type is specified explicitly. Since types are static and don't
@@ -10664,6 +10994,11 @@ type ExprCall struct {
 	// Args are the list of inputs to this function.
 	Args []interfaces.Expr // list of args in parsed order
 
+	// ArgNames are the names of each named arg, or the empty string if it
+	// was passed positionally. If none of the args are named, this can be
+	// nil. They are matched to the params and removed during SetScope.
+	ArgNames []string
+
 	// Var specifies whether the function being called is a lambda in a var.
 	Var bool
 
@@ -10716,6 +11051,9 @@ func (obj *ExprCall) Init(data *interfaces.Data) error {
 	if obj.Anon != nil && (obj.Name != "" || obj.Var) {
 		return fmt.Errorf("anon call is invalid")
 	}
+	if len(obj.ArgNames) != 0 && len(obj.ArgNames) != len(obj.Args) {
+		return fmt.Errorf("call has %d arg names for %d args", len(obj.ArgNames), len(obj.Args))
+	}
 
 	for _, x := range obj.Args {
 		if err := x.Init(data); err != nil {
@@ -10763,13 +11101,14 @@ func (obj *ExprCall) Interpolate() (interfaces.Expr, error) {
 		typ:      obj.typ,
 		// XXX: Copy copies this, do we want to here as well? (or maybe
 		// we want to do it here, but not in Copy?)
-		expr: obj.expr,
-		orig: orig,
-		V:    obj.V,
-		Name: obj.Name,
-		Args: args,
-		Var:  obj.Var,
-		Anon: anon,
+		expr:     obj.expr,
+		orig:     orig,
+		V:        obj.V,
+		Name:     obj.Name,
+		Args:     args,
+		ArgNames: obj.ArgNames,
+		Var:      obj.Var,
+		Anon:     anon,
 	}, nil
 }
 
@@ -10839,6 +11178,7 @@ func (obj *ExprCall) Copy() (interfaces.Expr, error) {
 		V:        obj.V,
 		Name:     obj.Name,
 		Args:     args,
+		ArgNames: obj.ArgNames,
 		Var:      obj.Var,
 		Anon:     anon,
 	}, nil
@@ -10957,6 +11297,12 @@ func (obj *ExprCall) SetScope(scope *interfaces.Scope, sctx map[string]interface
 		obj.data.Logf("call: %s(%t): scope: functions: %+v", obj.Name, obj.Var, obj.scope.Functions)
 	}
 
+	// Match any named args, and fill in any defaults, so that from here
+	// onwards, the args are in the same order as the function definition.
+	if err := obj.bindArgs(sctx); err != nil {
+		return interfaces.HighlightHelper(obj, obj.data.Logf, err)
+	}
+
 	// scope-check the arguments
 	for _, x := range obj.Args {
 		if err := x.SetScope(scope, sctx); err != nil {
@@ -10970,41 +11316,16 @@ func (obj *ExprCall) SetScope(scope *interfaces.Scope, sctx map[string]interface
 		}
 	}
 
-	var prefixedName string
-	var target interfaces.Expr
-	if obj.Var {
-		// The call looks like $f().
-		prefixedName = interfaces.VarPrefix + obj.Name
-		if f, exists := sctx[obj.Name]; exists {
-			// $f refers to a parameter bound by an enclosing lambda definition.
-			target = f
-		} else {
-			f, exists := obj.scope.Variables[obj.Name]
-			if !exists {
-				if obj.data.Debug || true { // TODO: leave this on permanently?
-					lambdaScopeFeedback(obj.scope, obj.data.Logf)
-				}
-				err := fmt.Errorf("lambda `$%s` does not exist in this scope", prefixedName)
-				return interfaces.HighlightHelper(obj, obj.data.Logf, err)
-			}
-			target = f
-		}
-	} else if obj.Name == "" && obj.Anon != nil {
-		// The call looks like <anon>().
-
-		target = obj.Anon
-	} else {
-		// The call looks like f().
-		prefixedName = obj.Name
-		f, exists := obj.scope.Functions[obj.Name]
-		if !exists {
-			if obj.data.Debug || true { // TODO: leave this on permanently?
+	prefixedName, target, err := obj.lookup(sctx)
+	if err != nil {
+		if obj.data.Debug || true { // TODO: leave this on permanently?
+			if obj.Var {
+				lambdaScopeFeedback(obj.scope, obj.data.Logf)
+			} else {
 				functionScopeFeedback(obj.scope, obj.data.Logf)
 			}
-			err := fmt.Errorf("func `%s` does not exist in this scope", prefixedName)
-			return interfaces.HighlightHelper(obj, obj.data.Logf, err)
 		}
-		target = f
+		return interfaces.HighlightHelper(obj, obj.data.Logf, err)
 	}
 
 	// NOTE: We previously used a findExprPoly helper function here.
@@ -11053,6 +11374,84 @@ func (obj *ExprCall) SetScope(scope *interfaces.Scope, sctx map[string]interface
 	return nil
 }
 
+// lookup finds the expression that this call refers to in the scope. It must
+// be run after the scope has been stored. It returns the name used for errors.
+func (obj *ExprCall) lookup(sctx map[string]interfaces.Expr) (string, interfaces.Expr, error) {
+	if obj.Var {
+		// The call looks like $f().
+		prefixedName := interfaces.VarPrefix + obj.Name
+		if f, exists := sctx[obj.Name]; exists {
+			// $f refers to a parameter bound by an enclosing lambda definition.
+			return prefixedName, f, nil
+		}
+		f, exists := obj.scope.Variables[obj.Name]
+		if !exists {
+			return "", nil, fmt.Errorf("lambda `$%s` does not exist in this scope", prefixedName)
+		}
+		return prefixedName, f, nil
+	}
+
+	if obj.Name == "" && obj.Anon != nil {
+		// The call looks like <anon>().
+		return "", obj.Anon, nil
+	}
+
+	// The call looks like f().
+	f, exists := obj.scope.Functions[obj.Name]
+	if !exists {
+		return "", nil, fmt.Errorf("func `%s` does not exist in this scope", obj.Name)
+	}
+	return obj.Name, f, nil
+}
+
+// bindArgs matches any named args to the params of the function that this call
+// refers to, and fills in the defaults of any omitted params. Afterwards, all
+// the args are positional. Only functions which were defined in mcl have named
+// params. If the function can't be found, this does nothing, and the error is
+// left for the caller to report.
+func (obj *ExprCall) bindArgs(sctx map[string]interfaces.Expr) error {
+	prefixedName, target, err := obj.lookup(sctx)
+	if err != nil {
+		return nil // the error is reported by SetScope
+	}
+	if prefixedName == "" {
+		prefixedName = "<anon>"
+	}
+
+	named := false
+	for _, x := range obj.ArgNames {
+		named = named || x != ""
+	}
+
+	fn, ok := trueCallee(target).(*ExprFunc)
+	if !ok || fn.Body == nil { // builtins and lambda params have no names
+		if named {
+			return fmt.Errorf("func `%s` does not accept named args", prefixedName)
+		}
+		obj.ArgNames = nil
+		return nil
+	}
+
+	// Defaults are scoped where the function was defined. An anonymous
+	// function is defined right here, and isn't scoped yet.
+	scope := capturedScope(target)
+	if scope == nil {
+		scope = fn.scope
+	}
+	if scope == nil {
+		scope = obj.scope
+	}
+
+	args, err := bindArgs("func", prefixedName, fn.Args, obj.Args, obj.ArgNames, scope)
+	if err != nil {
+		return err
+	}
+	obj.Args = args
+	obj.ArgNames = nil
+
+	return nil
+}
+
 // SetType is used to set the type of this expression once it is known. This
 // usually happens during type unification, but it can also happen during
 // parsing if a type is specified explicitly. Since types are static and don't
@@ -11552,6 +11951,14 @@ func (obj *ExprCall) funcValueFunc(env *interfaces.Env) (*pgraph.Graph, interfac
 		// surrounding function. We should be able to find this
 		// parameter in the environment.
 
+		// If obj.Anon, then the function being called is a lambda which
+		// is defined right here at the use site, so its body can refer
+		// to the parameters of any surrounding function, and it must
+		// capture the real environment. Eg: `func($x) { func() { $x }() }`
+		if obj.Anon != nil {
+			useEnv = env
+		}
+
 		// If obj.Var, then the function being called is a top-level
 		// definition. The parameters which are visible at this use site
 		// must not be visible at the definition site, so we pass an
@@ -14021,3 +14428,283 @@ func (obj *ExprBlock) SetValue(value types.Value) error {
 func (obj *ExprBlock) Value() (types.Value, error) {
 	return obj.Inner.Value()
 }
+
+// ExprMatch represents a match expression. It compares the value of an
+// expression against the pattern of each arm in order, and returns the body of
+// the first arm that matches. It is sugar for a chain of if expressions, which
+// is built during Init, and every other method delegates to that. Unlike the
+// other sugar nodes it stays in the AST through type unification, so that the
+// Infer step can check that the arms are exhaustive.
+type ExprMatch struct {
+	interfaces.Textarea
+
+	data *interfaces.Data
+
+	Expr interfaces.Expr // the value to match on
+	Arms []*ExprMatchArm // tried in order
+
+	desugared interfaces.Expr // the equivalent if expression chain
+}
+
+// ExprMatchArm represents one arm of a match expression. The body is used when
+// the pattern is the first one to match.
+type ExprMatchArm struct {
+	interfaces.Textarea
+
+	Pattern *MatchPattern
+	Body    interfaces.Expr
+}
+
+// String returns a short representation of this expression.
+func (obj *ExprMatch) String() string {
+	arms := []string{}
+	for _, arm := range obj.Arms {
+		arms = append(arms, arm.Pattern.String()+" => "+arm.Body.String())
+	}
+	return "match(" + obj.Expr.String() + ") { " + strings.Join(arms, ", ") + " }"
+}
+
+// Apply is a general purpose iterator method that operates on any AST node. It
+// is not used as the primary AST traversal function because it is less readable
+// and easy to reason about than manually implementing traversal for each node.
+// Nevertheless, it is a useful facility for operations that might only apply to
+// a select number of node types, since they won't need extra noop iterators...
+func (obj *ExprMatch) Apply(fn func(interfaces.Node) error) error {
+	if obj.desugared != nil { // the arms were moved in here
+		if err := obj.desugared.Apply(fn); err != nil {
+			return err
+		}
+		return fn(obj)
+	}
+
+	if err := obj.Expr.Apply(fn); err != nil {
+		return err
+	}
+	for _, arm := range obj.Arms {
+		if err := arm.Apply(fn); err != nil {
+			return err
+		}
+	}
+	return fn(obj)
+}
+
+// String returns a short representation of this match arm.
+func (obj *ExprMatchArm) String() string {
+	return fmt.Sprintf("matcharm(%s => %s)", obj.Pattern.String(), obj.Body.String())
+}
+
+// Apply is a general purpose iterator method that operates on any AST node. It
+// is not used as the primary AST traversal function because it is less readable
+// and easy to reason about than manually implementing traversal for each node.
+// Nevertheless, it is a useful facility for operations that might only apply to
+// a select number of node types, since they won't need extra noop iterators...
+func (obj *ExprMatchArm) Apply(fn func(interfaces.Node) error) error {
+	if err := obj.Body.Apply(fn); err != nil {
+		return err
+	}
+	return fn(obj)
+}
+
+// Init initializes this branch of the AST, and returns an error if it fails to
+// validate. This is where the equivalent if expression chain gets built.
+func (obj *ExprMatch) Init(data *interfaces.Data) error {
+	obj.data = data
+	obj.Textarea.Setup(data)
+
+	if len(obj.Arms) == 0 {
+		return interfaces.HighlightHelper(obj, data.Logf, fmt.Errorf("match has no arms"))
+	}
+	for _, arm := range obj.Arms {
+		arm.Textarea.Setup(data)
+	}
+	for i, arm := range obj.Arms {
+		if err := arm.Pattern.validate(data); err != nil {
+			return err
+		}
+		// Anything after a pattern that matches everything would never
+		// get used, and it would also never get type checked.
+		if arm.Pattern.irrefutable() && i < len(obj.Arms)-1 {
+			err := fmt.Errorf("match arm is unreachable")
+			return interfaces.HighlightHelper(obj.Arms[i+1], data.Logf, err)
+		}
+	}
+
+	if obj.desugared == nil {
+		obj.desugared = obj.desugar()
+	}
+	return obj.desugared.Init(data)
+}
+
+// Interpolate returns a new node (aka a copy) once it has been expanded. This
+// generally increases the size of the AST when it is used. It calls Interpolate
+// on any child elements and builds the new node with those new node contents.
+// This particular implementation interpolates the desugared if expression chain
+// and keeps the wrapper, since we still need the patterns for unification.
+func (obj *ExprMatch) Interpolate() (interfaces.Expr, error) {
+	if obj.desugared == nil {
+		return nil, fmt.Errorf("match was not initialized")
+	}
+	desugared, err := obj.desugared.Interpolate()
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not interpolate match")
+	}
+
+	return &ExprMatch{
+		Textarea:  obj.Textarea,
+		data:      obj.data,
+		Expr:      obj.Expr,
+		Arms:      obj.Arms,
+		desugared: desugared,
+	}, nil
+}
+
+// Copy returns a light copy of this struct. Anything static will not be copied.
+func (obj *ExprMatch) Copy() (interfaces.Expr, error) {
+	if obj.desugared == nil {
+		return obj, nil // nothing to copy yet
+	}
+	desugared, err := obj.desugared.Copy()
+	if err != nil {
+		return nil, err
+	}
+	if desugared == obj.desugared { // it's static
+		return obj, nil
+	}
+
+	return &ExprMatch{
+		Textarea:  obj.Textarea,
+		data:      obj.data,
+		Expr:      obj.Expr,
+		Arms:      obj.Arms,
+		desugared: desugared,
+	}, nil
+}
+
+// Ordering returns a graph of the scope ordering that represents the data flow.
+// This can be used in SetScope so that it knows the correct order to run it in.
+func (obj *ExprMatch) Ordering(produces map[string]interfaces.Node) (*pgraph.Graph, map[interfaces.Node]string, error) {
+	graph, err := pgraph.NewGraph("ordering")
+	if err != nil {
+		return nil, nil, err
+	}
+	graph.AddVertex(obj)
+
+	// Additional constraint: We know the desugared expression has to be
+	// satisfied before this ExprMatch expression itself can be used, since
+	// ExprMatch delegates to it.
+	edge := &pgraph.SimpleEdge{Name: "exprmatch1"}
+	graph.AddEdge(obj.desugared, obj, edge) // prod -> cons
+
+	cons := make(map[interfaces.Node]string)
+
+	g, c, err := obj.desugared.Ordering(produces)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph.AddGraph(g) // add in the child graph
+
+	for k, v := range c { // c is consumes
+		x, exists := cons[k]
+		if exists && v != x {
+			return nil, nil, fmt.Errorf("consumed value is different, got `%+v`, expected `%+v`", x, v)
+		}
+		cons[k] = v // add to map
+
+		n, exists := produces[v]
+		if !exists {
+			continue
+		}
+		edge := &pgraph.SimpleEdge{Name: "exprmatch2"}
+		graph.AddEdge(n, k, edge)
+	}
+
+	return graph, cons, nil
+}
+
+// SetScope stores the scope for later use in this resource and its children,
+// which it propagates this downwards to.
+func (obj *ExprMatch) SetScope(scope *interfaces.Scope, sctx map[string]interfaces.Expr) error {
+	return obj.desugared.SetScope(scope, sctx)
+}
+
+// SetType is used to set the type of this expression once it is known. This
+// usually happens during type unification, but it can also happen during
+// parsing if a type is specified explicitly. Since types are static and don't
+// change on expressions, if you attempt to set a different type than what has
+// previously been set (when not initially known) this will error.
+func (obj *ExprMatch) SetType(typ *types.Type) error {
+	return obj.desugared.SetType(typ)
+}
+
+// Type returns the type of this expression.
+func (obj *ExprMatch) Type() (*types.Type, error) {
+	return obj.desugared.Type()
+}
+
+// Infer returns the type of itself and a collection of invariants. The returned
+// type may contain unification variables. It collects the invariants by calling
+// Check on its children expressions. In making those calls, it passes in the
+// known type for that child to get it to "Check" it. When the type is not
+// known, it should create a new unification variable to pass in to the child
+// Check calls. Infer usually only calls Check on things inside of it, and often
+// does not call another Infer. This Infer is an exception to that pattern. It
+// is also where we error if the arms don't cover every possible value, because
+// the desugared if expression chain has no arm to fall back to if none match.
+func (obj *ExprMatch) Infer() (*types.Type, []*interfaces.UnificationInvariant, error) {
+	rows := [][]*MatchPattern{}
+	for _, arm := range obj.Arms {
+		rows = append(rows, []*MatchPattern{arm.Pattern})
+	}
+	if missing := matchMissing(rows, 1); missing != nil {
+		err := fmt.Errorf("non-exhaustive match, missing: %s", missing[0])
+		return nil, nil, interfaces.HighlightHelper(obj, obj.data.Logf, err)
+	}
+
+	typ, invariants, err := obj.desugared.Infer()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// This adds the obj ptr, so it's seen as an expr that we need to solve.
+	invar := &interfaces.UnificationInvariant{
+		Node:   obj,
+		Expr:   obj,
+		Expect: typ,
+		Actual: typ,
+	}
+	invariants = append(invariants, invar)
+
+	return typ, invariants, nil
+}
+
+// Check is checking that the input type is equal to the object that Check is
+// running on. In doing so, it adds any invariants that are necessary. Check
+// must always call Infer to produce the invariant. The implementation can be
+// generic for all expressions.
+func (obj *ExprMatch) Check(typ *types.Type) ([]*interfaces.UnificationInvariant, error) {
+	return interfaces.GenericCheck(obj, typ)
+}
+
+// Graph returns the reactive function graph which is expressed by this node. It
+// includes any vertices produced by this node, and the appropriate edges to any
+// vertices that are produced by its children. Nodes which fulfill the Expr
+// interface directly produce vertices (and possible children) where as nodes
+// that fulfill the Stmt interface do not produces vertices, where as their
+// children might.
+func (obj *ExprMatch) Graph(env *interfaces.Env) (*pgraph.Graph, interfaces.Func, error) {
+	return obj.desugared.Graph(env)
+}
+
+// SetValue passes the value through to the desugared expression which this
+// match expression stands for, and which checks the type. That is the one which
+// is actually in the function graph, and Value also defers to it.
+func (obj *ExprMatch) SetValue(value types.Value) error {
+	return obj.desugared.SetValue(value)
+}
+
+// Value returns the value of this expression in our type system. This will
+// usually only be valid once the engine has run and values have been produced.
+// This might get called speculatively (early) during unification to learn more.
+func (obj *ExprMatch) Value() (types.Value, error) {
+	return obj.desugared.Value()
+}
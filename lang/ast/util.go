@@ -378,6 +378,8 @@ func getScope(node interfaces.Expr) (*interfaces.Scope, error) {
 		return expr.scope, nil
 	case *ExprExcept:
 		return expr.scope, nil
+	case *ExprMatch:
+		return getScope(expr.desugared)
 
 	// These shouldn't be seen here, because they're removed during the
 	// Interpolate step, but delegate to the inner expression if one is.
@@ -513,6 +515,9 @@ func checkParamScope(node interfaces.Expr, freeVars map[interfaces.Expr]struct{}
 		}
 		return nil
 
+	case *ExprMatch:
+		return checkParamScope(obj.desugared, freeVars)
+
 	// These shouldn't be seen here, because they're removed during the
 	// Interpolate step, but delegate to the inner expression if one is.
 	case *ExprParen:
@@ -550,6 +555,65 @@ func trueCallee(apparentCallee interfaces.Expr) interfaces.Expr {
 	}
 }
 
+// Definition returns the node which defines the name that a variable, call or
+// include refers to. This is the bound expression for a variable, the function
+// for a call, and the class for an include. It can only be used after SetScope
+// has run. It returns nil if the node doesn't refer to a name, or if the name
+// can't be found. Builtin functions are returned too, even though they have no
+// position in any source file, so the caller should check for that.
+func Definition(node interfaces.Node) interfaces.Node {
+	switch obj := node.(type) {
+	case *ExprVar:
+		if obj.scope == nil {
+			return nil
+		}
+		target, exists := obj.scope.Variables[obj.Name]
+		if !exists {
+			return nil
+		}
+		return trueCallee(target)
+
+	case *ExprCall:
+		if obj.scope == nil || obj.Anon != nil {
+			return nil
+		}
+		_, target, err := obj.lookup(map[string]interfaces.Expr{})
+		if err != nil {
+			return nil
+		}
+		return trueCallee(target)
+
+	case *StmtInclude:
+		if obj.scope == nil {
+			return nil
+		}
+		class, exists := obj.scope.Classes[obj.Name]
+		if !exists {
+			return nil
+		}
+		return class
+	}
+	return nil
+}
+
+// capturedScope returns the scope that was captured at the definition site of
+// a function that is being called, if it can be found, and nil otherwise.
+func capturedScope(apparentCallee interfaces.Expr) *interfaces.Scope {
+	switch x := apparentCallee.(type) {
+	case *ExprTopLevel:
+		return x.CapturedScope
+	case *ExprSingleton:
+		return capturedScope(x.Definition)
+	case *ExprIterated:
+		return capturedScope(x.Definition)
+	case *ExprPoly:
+		return capturedScope(x.Definition)
+
+	default:
+		return nil
+	}
+}
+
 // findExprPoly is a helper used in SetScope.
 func findExprPoly(apparentCallee interfaces.Expr) *ExprPoly {
 	switch x := apparentCallee.(type) {
@@ -614,6 +678,201 @@ func newExprIterated(name string, definition interfaces.Expr) *ExprIterated {
 	return expr
 }
 
+// resolveType returns the type with any references to a named type replaced by
+// the type which that name has in the scope. It errors if one isn't in scope.
+func resolveType(scope *interfaces.Scope, typ *types.Type) (*types.Type, error) {
+	return typ.Resolve(func(name string) (*types.Type, error) {
+		t, exists := scope.Types[name]
+		if !exists {
+			return nil, fmt.Errorf("type `%s` does not exist in this scope", name)
+		}
+		return t, nil
+	})
+}
+
+// resolveArgs is like resolveType, except that it runs on a list of args. If
+// there is nothing to resolve then the same list is returned, otherwise it is a
+// new list, so that any other copies of the node which share it are unchanged.
+// If it errors, then it also returns the arg which failed.
+func resolveArgs(scope *interfaces.Scope, args []*interfaces.Arg) ([]*interfaces.Arg, *interfaces.Arg, error) {
+	found := false
+	for _, arg := range args {
+		if arg.Type.HasNamedRef() {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return args, nil, nil
+	}
+
+	resolved := []*interfaces.Arg{}
+	for _, arg := range args {
+		typ, err := resolveType(scope, arg.Type)
+		if err != nil {
+			return nil, arg, err
+		}
+		a := *arg // copy
+		a.Type = typ
+		resolved = append(resolved, &a)
+	}
+	return resolved, nil, nil
+}
+
+// highlightArg is like interfaces.HighlightHelper, except that it points at an
+// arg of a function or of a class. Args don't know which file they're in, so
+// they borrow that from the parent, which is used instead if it's not located.
+func highlightArg(parent interfaces.Textarea, arg *interfaces.Arg, logf func(format string, v ...interface{}), err error) error {
+	ta := parent // copy
+	if arg != nil && arg.IsSet() {
+		startLine, startColumn := arg.Pos()
+		endLine, endColumn := arg.End()
+		ta.Locate(startLine, startColumn, endLine, endColumn)
+	}
+	return interfaces.HighlightHelper(&ta, logf, err)
+}
+
+// initArgs runs Init on the default expressions of a list of args.
+func initArgs(args []*interfaces.Arg, data *interfaces.Data) error {
+	for _, arg := range args {
+		if arg.Default == nil {
+			continue
+		}
+		if err := arg.Default.Init(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// interpolateArgs returns a copy of the list of args with any of the default
+// expressions interpolated. It always returns a list, even if it's empty.
+func interpolateArgs(args []*interfaces.Arg) ([]*interfaces.Arg, error) {
+	interpolated := []*interfaces.Arg{}
+	for _, arg := range args {
+		if arg.Default == nil {
+			interpolated = append(interpolated, arg)
+			continue
+		}
+		def, err := arg.Default.Interpolate()
+		if err != nil {
+			return nil, err
+		}
+		a := *arg // copy
+		a.Default = def
+		interpolated = append(interpolated, &a)
+	}
+	return interpolated, nil
+}
+
+// orderingArgs adds the ordering of the default expressions of a list of args
+// to the graph, with an edge from each default to the node that defines them.
+// Defaults can't see the other args, so they only consume from the parent. It
+// returns what they consume.
+func orderingArgs(graph *pgraph.Graph, node interfaces.Node, args []*interfaces.Arg, produces map[string]interfaces.Node) (map[interfaces.Node]string, error) {
+	cons := make(map[interfaces.Node]string)
+	for _, arg := range args {
+		if arg.Default == nil {
+			continue
+		}
+		g, c, err := arg.Default.Ordering(produces)
+		if err != nil {
+			return nil, err
+		}
+		graph.AddGraph(g) // add in the child graph
+
+		// additional constraint...
+		edge := &pgraph.SimpleEdge{Name: "argdefault1"}
+		graph.AddEdge(arg.Default, node, edge) // prod -> cons
+
+		for k, v := range c { // c is consumes
+			cons[k] = v // add to map
+
+			n, exists := produces[v]
+			if !exists {
+				continue
+			}
+			edge := &pgraph.SimpleEdge{Name: "argdefault2"}
+			graph.AddEdge(n, k, edge)
+		}
+	}
+	return cons, nil
+}
+
+// bindArgs matches the positional and the named args at a call or include site
+// against the params of the definition, and returns them as a purely positional
+// list in param order. Any param which was omitted gets a copy of its default
+// expression, which is wrapped so that it's scoped at the definition site. If
+// there are more positional args than params, they are returned unchanged, so
+// that the usual arg count error happens. The kind and name are only used for
+// the error messages.
+func bindArgs(kind, name string, params []*interfaces.Arg, args []interfaces.Expr, names []string, scope *interfaces.Scope) ([]interfaces.Expr, error) {
+	if len(names) != 0 && len(names) != len(args) {
+		// programming error
+		return nil, fmt.Errorf("%s `%s` has %d arg names for %d args", kind, name, len(names), len(args))
+	}
+	named := false
+	for _, x := range names {
+		named = named || x != ""
+	}
+	defaults := false
+	for _, param := range params {
+		defaults = defaults || param.Default != nil
+	}
+	if !named && (!defaults || len(args) >= len(params)) {
+		return args, nil // nothing to do
+	}
+
+	indexes := make(map[string]int)
+	for i, param := range params {
+		indexes[param.Name] = i
+	}
+
+	bound := make([]interfaces.Expr, len(params))
+	seen := false // have we seen a named arg yet?
+	for i, x := range args {
+		if !named || names[i] == "" { // positional
+			if seen {
+				return nil, fmt.Errorf("%s `%s` has a positional arg after a named arg", kind, name)
+			}
+			if i >= len(params) {
+				return args, nil // let the arg count check error
+			}
+			bound[i] = x
+			continue
+		}
+
+		seen = true
+		ix, exists := indexes[names[i]]
+		if !exists {
+			return nil, fmt.Errorf("%s `%s` has no arg named `$%s`", kind, name, names[i])
+		}
+		if bound[ix] != nil {
+			return nil, fmt.Errorf("%s `%s` got arg `$%s` more than once", kind, name, names[i])
+		}
+		bound[ix] = x
+	}
+
+	for i, param := range params {
+		if bound[i] != nil {
+			continue
+		}
+		if param.Default == nil {
+			return nil, fmt.Errorf("%s `%s` is missing arg `$%s`", kind, name, param.Name)
+		}
+		def, err := param.Default.Copy()
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not copy the default of arg `$%s`", param.Name)
+		}
+		bound[i] = &ExprTopLevel{
+			Definition:    def,
+			CapturedScope: scope,
+		}
+	}
+
+	return bound, nil
+}
+
 // variableScopeFeedback logs some messages about what is actually in scope so
 // that the user gets a hint about what's going on. This is useful for catching
 // bugs in our programming or in user code!
@@ -0,0 +1,126 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package lang
+
+import (
+	"context"
+
+	"github.com/purpleidea/mgmt/lang/ast"
+	"github.com/purpleidea/mgmt/lang/funcs/vars"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/lang/unification"
+	"github.com/purpleidea/mgmt/pgraph"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+// NewImports returns the first vertex of a new import graph. This is what the
+// Imports field of the interfaces.Data struct should start out as.
+func NewImports() (*pgraph.SelfVertex, error) {
+	importGraph, err := pgraph.NewGraph("importGraph")
+	if err != nil {
+		return nil, err
+	}
+	importVertex := &pgraph.SelfVertex{
+		Name:  "",          // first node is the empty string
+		Graph: importGraph, // store a reference to ourself
+	}
+	importGraph.AddVertex(importVertex)
+	return importVertex, nil
+}
+
+// NewScope returns the top-level, built-in, initial global scope that all mcl
+// code runs in. The hostname can be empty if the code is not going to run.
+func NewScope(hostname string) (*interfaces.Scope, error) {
+	variables := map[string]interfaces.Expr{
+		"purpleidea": &ast.ExprStr{V: "hello world!"}, // james says hi
+		// TODO: change to a func when we can change hostname dynamically!
+		"hostname": &ast.ExprStr{V: hostname},
+	}
+	// TODO: pass `data` into ast.VarPrefixToVariablesScope ?
+	consts := ast.VarPrefixToVariablesScope(vars.ConstNamespace) // strips prefix!
+	addback := vars.ConstNamespace + interfaces.ModuleSep        // add it back...
+	variables, err := ast.MergeExprMaps(variables, consts, addback)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "couldn't merge in consts")
+	}
+
+	return &interfaces.Scope{
+		Variables: variables,
+		// all the built-in top-level, core functions enter here...
+		Functions: ast.FuncPrefixToFunctionsScope(""), // runs funcs.LookupPrefix
+	}, nil
+}
+
+// Compile initializes and validates the parsed AST, interpolates it, and then
+// sets the scope on it, which also follows all of the imports. It returns the
+// interpolated AST, which is the one to run type unification on.
+func Compile(xast interfaces.Stmt, data *interfaces.Data, scope *interfaces.Scope) (interfaces.Stmt, error) {
+	// some of this might happen *after* interpolate in SetScope or Unify...
+	if err := xast.Init(data); err != nil {
+		return nil, errwrap.Wrapf(err, "could not init and validate AST")
+	}
+
+	// interpolate strings and other expansionable nodes in AST
+	iast, err := xast.Interpolate()
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not interpolate AST")
+	}
+
+	// propagate the scope down through the AST...
+	if err := iast.SetScope(scope); err != nil {
+		return nil, errwrap.Wrapf(err, "could not set scope")
+	}
+
+	return iast, nil
+}
+
+// Unify runs type unification with the default solver on an AST which has had
+// its scope set. The strategy is optional.
+func Unify(ctx context.Context, iast interfaces.Stmt, strategy map[string]string, debug bool, logf func(format string, v ...interface{})) error {
+	solver, err := unification.LookupDefault()
+	if err != nil {
+		return errwrap.Wrapf(err, "could not get default solver")
+	}
+	unifier := &unification.Unifier{
+		AST:          iast,
+		Solver:       solver,
+		Strategy:     strategy,
+		UnifiedState: types.NewUnifiedState(),
+		Debug:        debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("unification: "+format, v...)
+		},
+	}
+	if err := unifier.Unify(ctx); err != nil {
+		return errwrap.Wrapf(err, "could not unify types")
+	}
+	return nil
+}
@@ -37,6 +37,7 @@ import (
 
 	// import so the funcs register
 	_ "github.com/purpleidea/mgmt/lang/core/convert"
+	_ "github.com/purpleidea/mgmt/lang/core/crypto"
 	_ "github.com/purpleidea/mgmt/lang/core/datetime"
 	_ "github.com/purpleidea/mgmt/lang/core/deploy"
 	_ "github.com/purpleidea/mgmt/lang/core/embedded"
@@ -0,0 +1,176 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package corecrypto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"hash"
+	"testing"
+
+	"github.com/purpleidea/mgmt/lang/types"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+	"golang.org/x/crypto/curve25519"
+)
+
+func str(s string) types.Value {
+	return &types.StrValue{V: s}
+}
+
+func TestDigest0(t *testing.T) {
+	blake2b512 := func() hash.Hash { h, _ := blake2b.New512(nil); return h }
+	blake2s256 := func() hash.Hash { h, _ := blake2s.New256(nil); return h }
+	testCases := []struct {
+		fn   func() hash.Hash
+		data string
+		exp  string
+	}{
+		{sha256.New, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{sha512.New, "abc", "ddaf35a193617abacc417349ae20413112e6fa4e89a97ea20a9eeee64b55d39a2192992a274fc1a836ba3c23a3feebbd454d4423643ce80e2a9ac94fa54ca49f"},
+		{blake2b512, "", "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce"},
+		{blake2s256, "", "69217a3079908094e11121d042354a7c1f55b6482ca1a51e1b250dfd1ed0eef9"},
+	}
+	for i, tc := range testCases {
+		if s := Digest(tc.fn, tc.data).Str(); s != tc.exp {
+			t.Errorf("test #%d: expected: %s, got: %s", i, tc.exp, s)
+		}
+	}
+}
+
+func TestHMAC0(t *testing.T) {
+	// from rfc4231, test case 2
+	exp := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if s := HMAC(sha256.New, "Jefe", "what do ya want for nothing?").Str(); s != exp {
+		t.Errorf("expected: %s, got: %s", exp, s)
+	}
+}
+
+func TestSHA512Crypt0(t *testing.T) {
+	// from https://www.akkadia.org/drepper/SHA-crypt.txt
+	exp := "$6$saltstring$svn8UoSVapNtMuq1ukKS4tPQd8iKwSMHWjl/O817G3uBnIFNjnQJuesI68u4OTLiBFdcbYEdFCoEOfaS35inz1"
+	for _, salt := range []string{"saltstring", "$6$saltstring"} {
+		v, err := SHA512Crypt(context.Background(), []types.Value{str("Hello world!"), str(salt)})
+		if err != nil {
+			t.Errorf("salt %s errored: %+v", salt, err)
+			continue
+		}
+		if s := v.Str(); s != exp {
+			t.Errorf("salt %s: expected: %s, got: %s", salt, exp, s)
+		}
+	}
+	if _, err := SHA512Crypt(context.Background(), []types.Value{str("hello"), str("")}); err == nil {
+		t.Errorf("empty salt should error")
+	}
+}
+
+func TestBcrypt0(t *testing.T) {
+	hash, err := Bcrypt(context.Background(), []types.Value{str("hunter2")})
+	if err != nil {
+		t.Errorf("bcrypt errored: %+v", err)
+		return
+	}
+	for password, exp := range map[string]bool{"hunter2": true, "hunter3": false} {
+		v, err := BcryptCheck(context.Background(), []types.Value{hash, str(password)})
+		if err != nil {
+			t.Errorf("bcrypt check errored: %+v", err)
+			return
+		}
+		if v.Bool() != exp {
+			t.Errorf("password %s: expected: %t", password, exp)
+		}
+	}
+}
+
+func TestUUID50(t *testing.T) {
+	exp := "886313e1-3b8a-5372-9b90-0c9aee199e5d" // python: uuid5(NAMESPACE_DNS, ...)
+	for _, ns := range []string{"dns", "6ba7b810-9dad-11d1-80b4-00c04fd430c8"} {
+		v, err := UUID5(context.Background(), []types.Value{str(ns), str("python.org")})
+		if err != nil {
+			t.Errorf("namespace %s errored: %+v", ns, err)
+			continue
+		}
+		if s := v.Str(); s != exp {
+			t.Errorf("namespace %s: expected: %s, got: %s", ns, exp, s)
+		}
+	}
+	if _, err := UUID5(context.Background(), []types.Value{str("nope"), str("python.org")}); err == nil {
+		t.Errorf("invalid namespace should error")
+	}
+}
+
+func TestEd25519Keypair0(t *testing.T) {
+	v1, err := Ed25519Keypair(context.Background(), []types.Value{str("secret")})
+	if err != nil {
+		t.Errorf("keypair errored: %+v", err)
+		return
+	}
+	v2, _ := Ed25519Keypair(context.Background(), []types.Value{str("secret")})
+	if err := v1.Cmp(v2); err != nil {
+		t.Errorf("keypair is not deterministic: %+v", err)
+	}
+
+	pub, _ := base64.StdEncoding.DecodeString(v1.Struct()["public"].Str())
+	priv, _ := base64.StdEncoding.DecodeString(v1.Struct()["private"].Str())
+	sig := ed25519.Sign(ed25519.PrivateKey(priv), []byte("hello"))
+	if !ed25519.Verify(ed25519.PublicKey(pub), []byte("hello"), sig) {
+		t.Errorf("keypair does not match")
+	}
+}
+
+func TestX25519Keypair0(t *testing.T) {
+	a, err := X25519Keypair(context.Background(), []types.Value{str("alice")})
+	if err != nil {
+		t.Errorf("keypair errored: %+v", err)
+		return
+	}
+	b, _ := X25519Keypair(context.Background(), []types.Value{str("bob")})
+
+	// both sides of a key exchange must agree
+	decode := func(v types.Value, field string) []byte {
+		x, _ := base64.StdEncoding.DecodeString(v.Struct()[field].Str())
+		return x
+	}
+	s1, err := curve25519.X25519(decode(a, "private"), decode(b, "public"))
+	if err != nil {
+		t.Errorf("exchange errored: %+v", err)
+		return
+	}
+	s2, _ := curve25519.X25519(decode(b, "private"), decode(a, "public"))
+	if string(s1) != string(s2) {
+		t.Errorf("shared secrets do not match")
+	}
+}
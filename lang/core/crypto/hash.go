@@ -0,0 +1,119 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corecrypto
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/blake2s"
+)
+
+func init() {
+	digests := map[string]func() hash.Hash{
+		"sha256": sha256.New,
+		"sha512": sha512.New,
+		"blake2b": func() hash.Hash {
+			h, _ := blake2b.New512(nil) // only errors with a bad key
+			return h
+		},
+		"blake2s": func() hash.Hash {
+			h, _ := blake2s.New256(nil) // only errors with a bad key
+			return h
+		},
+	}
+	for name, fn := range digests {
+		fn := fn
+		simple.ModuleRegister(ModuleName, name, &simple.Scaffold{
+			I: &simple.Info{
+				Pure: true,
+				Memo: true,
+				Fast: true,
+				Spec: true,
+			},
+			T: types.NewType("func(data str) str"),
+			F: func(ctx context.Context, input []types.Value) (types.Value, error) {
+				return Digest(fn, input[0].Str()), nil
+			},
+			D: Digest, // get the docs from this
+		})
+	}
+
+	hmacs := map[string]func() hash.Hash{
+		"hmac_sha256": sha256.New,
+		"hmac_sha512": sha512.New,
+	}
+	for name, fn := range hmacs {
+		fn := fn
+		simple.ModuleRegister(ModuleName, name, &simple.Scaffold{
+			I: &simple.Info{
+				Pure: true,
+				Memo: true,
+				Fast: true,
+				Spec: true,
+			},
+			T: types.NewType("func(key str, data str) str"),
+			F: func(ctx context.Context, input []types.Value) (types.Value, error) {
+				return HMAC(fn, input[0].Str(), input[1].Str()), nil
+			},
+			D: HMAC, // get the docs from this
+		})
+	}
+}
+
+// Digest returns the lowercase hex encoded digest of the data. The sha256 and
+// sha512 functions are the standard SHA-2 digests, blake2b is the 512 bit
+// BLAKE2b digest, and blake2s is the 256 bit BLAKE2s digest.
+func Digest(fn func() hash.Hash, data string) types.Value {
+	h := fn()
+	h.Write([]byte(data)) // never errors
+	return &types.StrValue{
+		V: hex.EncodeToString(h.Sum(nil)),
+	}
+}
+
+// HMAC returns the lowercase hex encoded keyed hash of the data, using either
+// SHA-256 or SHA-512 as specified by the function name. This is useful for
+// signing some data with a shared secret.
+func HMAC(fn func() hash.Hash, key, data string) types.Value {
+	h := hmac.New(fn, []byte(key))
+	h.Write([]byte(data)) // never errors
+	return &types.StrValue{
+		V: hex.EncodeToString(h.Sum(nil)),
+	}
+}
@@ -0,0 +1,113 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corecrypto
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// keypairType is the type of the returned keypair struct.
+var keypairType = types.NewType("struct{public str; private str}")
+
+func init() {
+	simple.ModuleRegister(ModuleName, "ed25519_keypair", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(seed str) " + keypairType.String()),
+		F: Ed25519Keypair,
+	})
+	simple.ModuleRegister(ModuleName, "x25519_keypair", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(seed str) " + keypairType.String()),
+		F: X25519Keypair,
+	})
+}
+
+// Ed25519Keypair deterministically derives an ed25519 signing keypair from the
+// seed. The seed is hashed with SHA-256 to get the 32 bytes of key material, so
+// it can be any string, but it must be kept secret and have enough entropy for
+// the result to be secure. The public key and the private key are returned
+// base64 encoded, with the private key in the 64 byte golang format.
+func Ed25519Keypair(ctx context.Context, input []types.Value) (types.Value, error) {
+	seed := sha256.Sum256([]byte(input[0].Str()))
+	priv := ed25519.NewKeyFromSeed(seed[:])
+	pub := priv.Public().(ed25519.PublicKey)
+
+	return keypair(pub, priv)
+}
+
+// X25519Keypair deterministically derives an x25519 key exchange keypair from
+// the seed. The seed is hashed with SHA-256 to get the 32 byte private key, so
+// it can be any string, but it must be kept secret and have enough entropy for
+// the result to be secure. The keys are returned base64 encoded, which is the
+// same format that wireguard uses.
+func X25519Keypair(ctx context.Context, input []types.Value) (types.Value, error) {
+	priv := sha256.Sum256([]byte(input[0].Str()))
+	// clamp the key like wireguard does, the public key is the same anyways
+	priv[0] &= 248
+	priv[31] = (priv[31] & 127) | 64
+
+	pub, err := curve25519.X25519(priv[:], curve25519.Basepoint)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not derive public key")
+	}
+
+	return keypair(pub, priv[:])
+}
+
+// keypair is a helper to build the returned struct.
+func keypair(pub, priv []byte) (types.Value, error) {
+	st := types.NewStruct(keypairType)
+	if err := st.Set("public", &types.StrValue{V: base64.StdEncoding.EncodeToString(pub)}); err != nil {
+		return nil, err
+	}
+	if err := st.Set("private", &types.StrValue{V: base64.StdEncoding.EncodeToString(priv)}); err != nil {
+		return nil, err
+	}
+	return st, nil
+}
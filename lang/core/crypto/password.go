@@ -0,0 +1,119 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corecrypto
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	sha512Crypt "github.com/tredoe/osutil/user/crypt/sha512_crypt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "bcrypt", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: false, // random salt
+			Memo: false,
+			Fast: false, // slow on purpose
+			Spec: false,
+		},
+		T: types.NewType("func(password str) str"),
+		F: Bcrypt,
+	})
+	simple.ModuleRegister(ModuleName, "bcrypt_check", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: false, // slow on purpose
+			Spec: true,
+		},
+		T: types.NewType("func(hash str, password str) bool"),
+		F: BcryptCheck,
+	})
+	simple.ModuleRegister(ModuleName, "sha512_crypt", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: false, // slow on purpose
+			Spec: true,
+		},
+		T: types.NewType("func(password str, salt str) str"),
+		F: SHA512Crypt,
+	})
+}
+
+// Bcrypt hashes the password with bcrypt using the default cost. Since a new
+// random salt is chosen each time, this returns a different hash every time it
+// runs, so if you need a stable value, then you probably want sha512_crypt.
+func Bcrypt(ctx context.Context, input []types.Value) (types.Value, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(input[0].Str()), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not hash password")
+	}
+	return &types.StrValue{
+		V: string(b),
+	}, nil
+}
+
+// BcryptCheck returns true if the password matches the bcrypt hash.
+func BcryptCheck(ctx context.Context, input []types.Value) (types.Value, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(input[0].Str()), []byte(input[1].Str()))
+	return &types.BoolValue{
+		V: err == nil,
+	}, nil
+}
+
+// SHA512Crypt hashes the password with Ulrich Drepper's salted SHA-512 unix
+// crypt, as used in /etc/shadow and kickstart files. The salt may be given with
+// or without the leading $6$ prefix, and may include a rounds=N parameter. Since
+// the salt is specified, the output is stable, which is what you want when you
+// use this as the crypted password of a user. An empty salt errors.
+func SHA512Crypt(ctx context.Context, input []types.Value) (types.Value, error) {
+	salt := input[1].Str()
+	if salt == "" {
+		return nil, fmt.Errorf("salt is empty")
+	}
+	if !strings.HasPrefix(salt, sha512Crypt.MagicPrefix) {
+		salt = sha512Crypt.MagicPrefix + salt
+	}
+	hash, err := sha512Crypt.New().Generate([]byte(input[0].Str()), []byte(salt))
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not hash password")
+	}
+	return &types.StrValue{
+		V: hash,
+	}, nil
+}
@@ -0,0 +1,76 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corecrypto
+
+import (
+	"context"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "uuid5", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(namespace str, name str) str"),
+		F: UUID5,
+	})
+}
+
+// UUID5 returns the deterministic version 5 (SHA-1 based) UUID of the name in
+// the namespace. The namespace is either a UUID, or one of the well-known names
+// of "dns", "url", "oid" or "x500". This is useful for building stable unique
+// identifiers out of names that you already have.
+func UUID5(ctx context.Context, input []types.Value) (types.Value, error) {
+	namespaces := map[string]uuid.UUID{
+		"dns":  uuid.NameSpaceDNS,
+		"url":  uuid.NameSpaceURL,
+		"oid":  uuid.NameSpaceOID,
+		"x500": uuid.NameSpaceX500,
+	}
+	ns, exists := namespaces[input[0].Str()]
+	if !exists {
+		var err error
+		if ns, err = uuid.Parse(input[0].Str()); err != nil {
+			return nil, errwrap.Wrapf(err, "invalid namespace: %s", input[0].Str())
+		}
+	}
+	return &types.StrValue{
+		V: uuid.NewSHA1(ns, []byte(input[1].Str())).String(),
+	}, nil
+}
@@ -0,0 +1,160 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coredatetime
+
+import (
+	"context"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "add", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, duration str) int"),
+		F: Add,
+	})
+	simple.ModuleRegister(ModuleName, "sub", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, duration str) int"),
+		F: Sub,
+	})
+	simple.ModuleRegister(ModuleName, "add_date", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, years int, months int, days int) int"),
+		F: AddDate,
+	})
+	simple.ModuleRegister(ModuleName, "diff", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, b int) int"),
+		F: Diff,
+	})
+	simple.ModuleRegister(ModuleName, "before", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, b int) bool"),
+		F: Before,
+	})
+	simple.ModuleRegister(ModuleName, "after", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, b int) bool"),
+		F: After,
+	})
+}
+
+// Add returns the time plus the duration, such as 1h30m. The time is the number
+// of seconds since the epoch, and matches what comes from our Now function.
+func Add(ctx context.Context, input []types.Value) (types.Value, error) {
+	d, err := parseDuration(input[1].Str())
+	if err != nil {
+		return nil, err
+	}
+	return &types.IntValue{
+		V: input[0].Int() + d,
+	}, nil
+}
+
+// Sub returns the time minus the duration, such as 1h30m. The time is the
+// number of seconds since the epoch, and matches what comes from our Now
+// function.
+func Sub(ctx context.Context, input []types.Value) (types.Value, error) {
+	d, err := parseDuration(input[1].Str())
+	if err != nil {
+		return nil, err
+	}
+	return &types.IntValue{
+		V: input[0].Int() - d,
+	}, nil
+}
+
+// AddDate returns the time plus the number of years, months and days, which can
+// be negative, in the local time zone. This keeps the same time of day across a
+// daylight saving change, which adding 24h would not. Like the golang function,
+// the result is normalized, so adding a month to October 31 gives December 1.
+func AddDate(ctx context.Context, input []types.Value) (types.Value, error) {
+	t := time.Unix(input[0].Int(), 0)
+	years, months, days := input[1].Int(), input[2].Int(), input[3].Int()
+	return &types.IntValue{
+		V: t.AddDate(int(years), int(months), int(days)).Unix(),
+	}, nil
+}
+
+// Diff returns the number of seconds from b to a, which is negative if a is the
+// earlier one. Use format_duration to show it in a readable way.
+func Diff(ctx context.Context, input []types.Value) (types.Value, error) {
+	return &types.IntValue{
+		V: input[0].Int() - input[1].Int(),
+	}, nil
+}
+
+// Before returns true if the time a is earlier than the time b.
+func Before(ctx context.Context, input []types.Value) (types.Value, error) {
+	return &types.BoolValue{
+		V: input[0].Int() < input[1].Int(),
+	}, nil
+}
+
+// After returns true if the time a is later than the time b.
+func After(ctx context.Context, input []types.Value) (types.Value, error) {
+	return &types.BoolValue{
+		V: input[0].Int() > input[1].Int(),
+	}, nil
+}
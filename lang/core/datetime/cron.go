@@ -0,0 +1,286 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coredatetime
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// cronZonePrefix lets a cron expression pick its time zone, eg:
+	// CRON_TZ=Europe/Paris 0 9 * * mon-fri
+	cronZonePrefix = "CRON_TZ="
+
+	// cronSearchYears is how far ahead we look for a match, before we give
+	// up on an expression that can never match, such as February 30.
+	cronSearchYears = 5
+)
+
+// cronMacros are the shortcuts which replace a whole expression.
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// cronField describes the values that one field of a cron expression can have.
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string // optional names, starting at min
+}
+
+var (
+	cronMinute = &cronField{name: "minute", min: 0, max: 59}
+	cronHour   = &cronField{name: "hour", min: 0, max: 23}
+	cronDom    = &cronField{name: "day of month", min: 1, max: 31}
+	cronMonth  = &cronField{name: "month", min: 1, max: 12, names: []string{
+		"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec",
+	}}
+	// Sunday can be 0 or 7, so we allow 7 here and then fold it into 0.
+	cronDow = &cronField{name: "day of week", min: 0, max: 7, names: []string{
+		"sun", "mon", "tue", "wed", "thu", "fri", "sat",
+	}}
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "cron_after", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(expr str, a int) int"),
+		F: CronAfter,
+	})
+}
+
+// CronAfter returns the first time after the given one which matches the cron
+// expression. The times are the number of seconds since the epoch, and match
+// what comes from our Now function. See cron_next for the expression syntax.
+func CronAfter(ctx context.Context, input []types.Value) (types.Value, error) {
+	schedule, err := parseCron(input[0].Str())
+	if err != nil {
+		return nil, err
+	}
+	t, err := schedule.next(time.Unix(input[1].Int(), 0))
+	if err != nil {
+		return nil, err
+	}
+	return &types.IntValue{
+		V: t.Unix(),
+	}, nil
+}
+
+// cronSchedule is a parsed cron expression. Each field is a bit set of the
+// values that match.
+type cronSchedule struct {
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// If both of the day fields are restricted, then a day matches if
+	// either of them does, which is the traditional cron behaviour.
+	domStar bool
+	dowStar bool
+
+	loc *time.Location
+}
+
+// parseCron parses a standard five field cron expression: minute, hour, day of
+// month, month and day of week. Each field can be a *, a number, a range such as
+// 1-5, a list such as 1,3,5, and any of these can have a step such as */15 or
+// 0-30/10. Months and days of the week can also be given by their first three
+// letters, such as jan or mon. The @hourly, @daily, @weekly, @monthly and
+// @yearly macros are also supported. The expression uses the local time zone,
+// unless it starts with a CRON_TZ=Zone/Name prefix.
+func parseCron(expr string) (*cronSchedule, error) {
+	schedule := &cronSchedule{
+		loc: time.Local,
+	}
+
+	expr = strings.TrimSpace(expr)
+	if strings.HasPrefix(expr, cronZonePrefix) {
+		zone, rest, _ := strings.Cut(strings.TrimPrefix(expr, cronZonePrefix), " ")
+		loc, err := loadLocation(zone)
+		if err != nil {
+			return nil, err
+		}
+		schedule.loc = loc
+		expr = strings.TrimSpace(rest)
+	}
+	if s, exists := cronMacros[strings.ToLower(expr)]; exists {
+		expr = s
+	}
+
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("cron expression must have five fields, got %d", len(fields))
+	}
+
+	var err error
+	if schedule.minute, err = cronMinute.parse(fields[0]); err != nil {
+		return nil, err
+	}
+	if schedule.hour, err = cronHour.parse(fields[1]); err != nil {
+		return nil, err
+	}
+	if schedule.dom, err = cronDom.parse(fields[2]); err != nil {
+		return nil, err
+	}
+	if schedule.month, err = cronMonth.parse(fields[3]); err != nil {
+		return nil, err
+	}
+	if schedule.dow, err = cronDow.parse(fields[4]); err != nil {
+		return nil, err
+	}
+	if schedule.dow&(1<<7) != 0 { // sunday
+		schedule.dow = schedule.dow&^(1<<7) | 1
+	}
+	schedule.domStar = strings.HasPrefix(fields[2], "*")
+	schedule.dowStar = strings.HasPrefix(fields[4], "*")
+
+	return schedule, nil
+}
+
+// parse returns the bit set of the values which match this field.
+func (obj *cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		expr, step, hasStep := strings.Cut(item, "/")
+		lo, hi := obj.min, obj.max
+		if expr != "*" {
+			a, b, isRange := strings.Cut(expr, "-")
+			var err error
+			if lo, err = obj.value(a); err != nil {
+				return 0, err
+			}
+			hi = lo
+			if isRange {
+				if hi, err = obj.value(b); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				hi = obj.max // 5/15 means from 5 to the end
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("invalid %s range: %s", obj.name, item)
+		}
+
+		n := 1
+		if hasStep {
+			var err error
+			if n, err = strconv.Atoi(step); err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid %s step: %s", obj.name, item)
+			}
+		}
+		for i := lo; i <= hi; i += n {
+			bits |= 1 << uint(i)
+		}
+	}
+	return bits, nil
+}
+
+// value parses a single number or name for this field.
+func (obj *cronField) value(s string) (int, error) {
+	for i, name := range obj.names {
+		if strings.EqualFold(s, name) {
+			return obj.min + i, nil
+		}
+	}
+	i, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, errwrap.Wrapf(err, "invalid %s: %s", obj.name, s)
+	}
+	if i < obj.min || i > obj.max {
+		return 0, fmt.Errorf("%s out of range: %d", obj.name, i)
+	}
+	return i, nil
+}
+
+// next returns the first time after t which matches. It skips ahead by the
+// largest amount that it can each time, so that this is quick.
+func (obj *cronSchedule) next(t time.Time) (time.Time, error) {
+	t = t.In(obj.loc)
+	// start at the next whole minute
+	t = t.Add(time.Minute - time.Duration(t.Second())*time.Second - time.Duration(t.Nanosecond()))
+	limit := t.AddDate(cronSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		if obj.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, obj.loc)
+			continue
+		}
+		if !obj.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, obj.loc)
+			continue
+		}
+		// We add the time here, rather than using time.Date, so that we
+		// never go backwards when the clocks go back.
+		if obj.hour&(1<<uint(t.Hour())) == 0 {
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute)
+			continue
+		}
+		if obj.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("cron expression never matches")
+}
+
+// dayMatches returns true if the day of t matches the day of month and the day
+// of week fields.
+func (obj *cronSchedule) dayMatches(t time.Time) bool {
+	dom := obj.dom&(1<<uint(t.Day())) != 0
+	dow := obj.dow&(1<<uint(t.Weekday())) != 0
+	if obj.domStar || obj.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,189 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coredatetime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+const (
+	// CronNextFuncName is the name this func is registered as.
+	CronNextFuncName = "cron_next"
+
+	// arg names...
+	cronNextArgNameExpr = "expr"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, CronNextFuncName, func() interfaces.Func { return &CronNext{} })
+}
+
+// CronNext is a func which returns the next time that matches a cron
+// expression, as the number of seconds since the epoch. When that time comes,
+// it sends the one after it, so you can use this to change the graph on a
+// schedule. The expression has five fields: minute, hour, day of month, month
+// and day of week. Each one can be a *, a number, a range such as 1-5, a list
+// such as 1,3,5, and any of these can have a step such as */15. Months and days
+// of the week can also be given by name, such as jan or mon. The @hourly,
+// @daily, @weekly, @monthly and @yearly macros are also supported. It uses the
+// local time zone, unless the expression starts with a prefix such as
+// CRON_TZ=Europe/Paris. For example, 30 9 * * mon-fri is weekdays at 9:30.
+type CronNext struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+
+	input chan time.Time // when to send the next event
+}
+
+// String returns a simple name for this func. This is needed so this struct can
+// satisfy the pgraph.Vertex interface.
+func (obj *CronNext) String() string {
+	return CronNextFuncName
+}
+
+// ArgGen returns the Nth arg name for this function.
+func (obj *CronNext) ArgGen(index int) (string, error) {
+	seq := []string{cronNextArgNameExpr}
+	if l := len(seq); index >= l {
+		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
+	}
+	return seq[index], nil
+}
+
+// Validate makes sure we've built our struct properly.
+func (obj *CronNext) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *CronNext) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // non-constant funcs can't be pure!
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func(%s str) int", cronNextArgNameExpr)),
+	}
+}
+
+// Init runs some startup code for this func.
+func (obj *CronNext) Init(init *interfaces.Init) error {
+	obj.init = init
+	obj.input = make(chan time.Time)
+	return nil
+}
+
+// Stream waits for each Call to tell it the next time, and then it sends an
+// event at that time so that Call can work out the one after it.
+func (obj *CronNext) Stream(ctx context.Context) error {
+	//defer close(obj.input)  // if we close, this is a race with the sender
+	timer := time.NewTimer(time.Hour)
+	timer.Stop() // wait for the first Call to start it
+	defer timer.Stop()
+
+	for {
+		select {
+		case t, ok := <-obj.input:
+			if !ok {
+				obj.input = nil // don't infinite loop back
+				return fmt.Errorf("unexpected close")
+			}
+			if obj.init.Debug {
+				obj.init.Logf("next event at: %s", t)
+			}
+			timer.Reset(time.Until(t)) // any old timer was stopped or has fired
+			continue
+
+		case <-timer.C:
+			// it's time
+
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Call this func and return the value if it is possible to do so at this time.
+func (obj *CronNext) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	schedule, err := parseCron(args[0].Str())
+	if err != nil {
+		return nil, err
+	}
+
+	// Check before we send to a chan where we'd need Stream to be running.
+	if obj.init == nil {
+		return nil, funcs.ErrCantSpeculate
+	}
+
+	t, err := schedule.next(time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	// Tell the Stream when to wake up... This doesn't block because Stream
+	// should always be ready to consume unless it's closing down... If it
+	// dies, then a ctx closure should come soon.
+	select {
+	case obj.input <- t:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return &types.IntValue{
+		V: t.Unix(),
+	}, nil
+}
+
+// Cleanup runs after that function was removed from the graph.
+func (obj *CronNext) Cleanup(ctx context.Context) error {
+	// Even if the expression stops changing, we never shutdown Stream
+	// because the time moves on.
+	return nil
+}
+
+// Done is a message from the engine to tell us that no more Call's are coming.
+func (obj *CronNext) Done() error {
+	close(obj.input) // At this point we know obj.input won't be used.
+	return nil
+}
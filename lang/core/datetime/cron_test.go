@@ -0,0 +1,153 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package coredatetime
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	var tests = []struct {
+		expr string
+		from string
+		next string
+	}{
+		{"* * * * *", "2024-01-01T00:00:00Z", "2024-01-01T00:01:00Z"},
+		{"* * * * *", "2024-01-01T00:00:30Z", "2024-01-01T00:01:00Z"},
+		{"*/15 * * * *", "2024-01-01T00:14:59Z", "2024-01-01T00:15:00Z"},
+		{"5/20 * * * *", "2024-01-01T00:26:00Z", "2024-01-01T00:45:00Z"},
+		{"30 9 * * mon-fri", "2024-01-05T10:00:00Z", "2024-01-08T09:30:00Z"}, // fri to mon
+		{"0 0 * * 7", "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},        // sunday is 7 too
+		{"0 12 29 feb *", "2024-03-01T00:00:00Z", "2028-02-29T12:00:00Z"},
+		{"0 0 1 jan,jul *", "2024-02-01T00:00:00Z", "2024-07-01T00:00:00Z"},
+		{"0 0 13 * fri", "2024-01-01T00:00:00Z", "2024-01-05T00:00:00Z"}, // either day field
+		{"0 0 */10 * *", "2024-01-01T00:00:00Z", "2024-01-11T00:00:00Z"},
+		{"0-10/5 22-23 * * *", "2024-01-01T22:10:00Z", "2024-01-01T23:00:00Z"},
+		{"@daily", "2024-12-31T23:59:59Z", "2025-01-01T00:00:00Z"},
+		{"@hourly", "2024-01-01T10:00:00Z", "2024-01-01T11:00:00Z"},
+		{"@weekly", "2024-01-01T00:00:00Z", "2024-01-07T00:00:00Z"},
+		{"@yearly", "2024-06-01T00:00:00Z", "2025-01-01T00:00:00Z"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr+" "+tt.from, func(t *testing.T) {
+			schedule, err := parseCron(cronZonePrefix + "UTC " + tt.expr)
+			if err != nil {
+				t.Errorf("could not parse: %+v", err)
+				return
+			}
+			from, err := time.Parse(time.RFC3339, tt.from)
+			if err != nil {
+				t.Errorf("bad test: %+v", err)
+				return
+			}
+			next, err := schedule.next(from)
+			if err != nil {
+				t.Errorf("could not find next: %+v", err)
+				return
+			}
+			if s := next.UTC().Format(time.RFC3339); s != tt.next {
+				t.Errorf("expected %s, got %s", tt.next, s)
+			}
+		})
+	}
+}
+
+func TestCronNextZone(t *testing.T) {
+	if _, err := time.LoadLocation("Europe/Paris"); err != nil {
+		t.Skipf("no time zone data: %+v", err)
+	}
+	schedule, err := parseCron("CRON_TZ=Europe/Paris 30 2 * * *")
+	if err != nil {
+		t.Errorf("could not parse: %+v", err)
+		return
+	}
+
+	// 2:30 doesn't exist when the clocks go forward on 2024-03-31, so we
+	// get the day after, and it's 2:30 in summer time.
+	from, _ := time.Parse(time.RFC3339, "2024-03-30T12:00:00Z")
+	next, err := schedule.next(from)
+	if err != nil {
+		t.Errorf("could not find next: %+v", err)
+		return
+	}
+	if s, exp := next.UTC().Format(time.RFC3339), "2024-04-01T00:30:00Z"; s != exp {
+		t.Errorf("expected %s, got %s", exp, s)
+	}
+
+	// 2:30 happens twice when the clocks go back on 2024-10-27, so make
+	// sure we don't go backwards from the second one.
+	from, _ = time.Parse(time.RFC3339, "2024-10-27T01:30:00Z") // the second 2:30
+	next, err = schedule.next(from)
+	if err != nil {
+		t.Errorf("could not find next: %+v", err)
+		return
+	}
+	if !next.After(from) {
+		t.Errorf("went backwards from %s to %s", from, next)
+	}
+	if s, exp := next.UTC().Format(time.RFC3339), "2024-10-28T01:30:00Z"; s != exp {
+		t.Errorf("expected %s, got %s", exp, s)
+	}
+}
+
+func TestCronParseErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"* * * foo *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"CRON_TZ=Nowhere/Nope * * * * *",
+	} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("expected error for: %q", expr)
+		}
+	}
+
+	schedule, err := parseCron("0 0 30 feb *")
+	if err != nil {
+		t.Errorf("could not parse: %+v", err)
+		return
+	}
+	if _, err := schedule.next(time.Now()); err == nil {
+		t.Errorf("expected an error for an impossible date")
+	}
+}
@@ -0,0 +1,98 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coredatetime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "parse_duration", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a str) int"),
+		F: ParseDuration,
+	})
+	simple.ModuleRegister(ModuleName, "format_duration", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int) str"),
+		F: FormatDuration,
+	})
+}
+
+// ParseDuration reads a duration such as 1h30m or -90s and returns it as a
+// number of seconds, so that it can be used with the times from our other
+// functions. The valid units are h, m, s, ms, us and ns, but since the result
+// is in whole seconds, it errors if there's a fractional part left over.
+// Golang documentation: https://golang.org/pkg/time/#ParseDuration
+func ParseDuration(ctx context.Context, input []types.Value) (types.Value, error) {
+	d, err := parseDuration(input[0].Str())
+	if err != nil {
+		return nil, err
+	}
+	return &types.IntValue{
+		V: d,
+	}, nil
+}
+
+// FormatDuration takes a number of seconds and returns it as a duration string
+// such as 1h30m0s, which ParseDuration can read.
+func FormatDuration(ctx context.Context, input []types.Value) (types.Value, error) {
+	return &types.StrValue{
+		V: (time.Duration(input[0].Int()) * time.Second).String(),
+	}, nil
+}
+
+// parseDuration parses a duration string into a whole number of seconds.
+func parseDuration(s string) (int64, error) {
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errwrap.Wrapf(err, "could not parse duration")
+	}
+	if d%time.Second != 0 {
+		return 0, fmt.Errorf("duration is not a whole number of seconds: %s", s)
+	}
+	return int64(d / time.Second), nil
+}
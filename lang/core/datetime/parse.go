@@ -0,0 +1,150 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coredatetime
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/funcs/vars"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+// layouts are some common layouts which we offer as variables, so that you
+// don't need to remember the magic golang reference time.
+var layouts = map[string]string{
+	"rfc3339":   time.RFC3339,
+	"rfc1123":   time.RFC1123,
+	"rfc1123z":  time.RFC1123Z,
+	"date_time": time.DateTime,
+	"date_only": time.DateOnly,
+	"time_only": time.TimeOnly,
+	"kitchen":   time.Kitchen,
+}
+
+func init() {
+	for name, layout := range layouts {
+		vars.ModuleRegister(ModuleName, name, func() vars.Value {
+			return &types.StrValue{
+				V: layout,
+			}
+		})
+	}
+
+	simple.ModuleRegister(ModuleName, "parse", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(value str, layout str) int"),
+		F: Parse,
+	})
+	simple.ModuleRegister(ModuleName, "parse_in", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(value str, layout str, zone str) int"),
+		F: ParseIn,
+	})
+	simple.ModuleRegister(ModuleName, "format_in", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a int, layout str, zone str) str"),
+		F: FormatIn,
+	})
+}
+
+// Parse reads a time from a string, and returns it as the number of seconds
+// since the epoch, which matches what comes from our Now function. The layout
+// is defined like specified by the golang "time" package, and some common ones
+// are available as variables in this module, such as $datetime.rfc3339. If the
+// value doesn't include a time zone, then it's in the local one. Golang
+// documentation: https://golang.org/pkg/time/#Parse
+func Parse(ctx context.Context, input []types.Value) (types.Value, error) {
+	return parseIn(input[0].Str(), input[1].Str(), "Local")
+}
+
+// ParseIn is like Parse, except that a value without a time zone is in the one
+// that's named, such as Europe/Paris, UTC or Local.
+func ParseIn(ctx context.Context, input []types.Value) (types.Value, error) {
+	return parseIn(input[0].Str(), input[1].Str(), input[2].Str())
+}
+
+// FormatIn is like Format, except that it shows the time in the named zone,
+// such as Europe/Paris, UTC or Local.
+func FormatIn(ctx context.Context, input []types.Value) (types.Value, error) {
+	loc, err := loadLocation(input[2].Str())
+	if err != nil {
+		return nil, err
+	}
+	return &types.StrValue{
+		V: time.Unix(input[0].Int(), 0).In(loc).Format(input[1].Str()),
+	}, nil
+}
+
+// parseIn implements Parse and ParseIn.
+func parseIn(value, layout, zone string) (types.Value, error) {
+	loc, err := loadLocation(zone)
+	if err != nil {
+		return nil, err
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse time")
+	}
+	return &types.IntValue{
+		V: t.Unix(),
+	}, nil
+}
+
+// loadLocation returns the named time zone. Unlike the golang function, the
+// empty string is an error, since it's probably a mistake.
+func loadLocation(zone string) (*time.Location, error) {
+	if zone == "" {
+		return nil, fmt.Errorf("empty time zone")
+	}
+	loc, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not load time zone")
+	}
+	return loc, nil
+}
@@ -44,33 +44,48 @@ const (
 	// DecodeJSONFuncName is the name this function is registered as.
 	DecodeJSONFuncName = "decode_json"
 
+	// DecodeYAMLFuncName is the name this function is registered as.
+	DecodeYAMLFuncName = "decode_yaml"
+
+	// DecodeTOMLFuncName is the name this function is registered as.
+	DecodeTOMLFuncName = "decode_toml"
+
 	// arg names...
-	decodeJSONArgNameData = "data"
-	decodeJSONArgNameType = "type"
+	decodeArgNameData = "data"
+	decodeArgNameType = "type"
 )
 
 func init() {
-	funcs.ModuleRegister(ModuleName, DecodeJSONFuncName, func() interfaces.Func { return &DecodeJSONFunc{} })
-	funcs.ModuleRegister(ModuleName, DecodeJSONFuncName+"_flexible", func() interfaces.Func { return &DecodeJSONFunc{flexible: true} })
+	formats := map[string]string{
+		DecodeJSONFuncName: formatJSON,
+		DecodeYAMLFuncName: formatYAML,
+		DecodeTOMLFuncName: formatTOML,
+	}
+	for name, format := range formats {
+		format := format
+		funcs.ModuleRegister(ModuleName, name, func() interfaces.Func { return &DecodeFunc{format: format} })
+		funcs.ModuleRegister(ModuleName, name+"_flexible", func() interfaces.Func { return &DecodeFunc{format: format, flexible: true} })
+	}
 }
 
-var _ interfaces.InferableFunc = &DecodeJSONFunc{} // ensure it meets this expectation
-
-// DecodeJSONFunc is a static polymorphic function that accepts some json data
-// and returns an mcl struct representing that data. You currently should pass
-// in an mcl type representation in the second arg so that we know what type to
-// parse the json as. There are some cases when the type can be inferred, and
-// you don't need to specify the second arg. It's your problem if the type
-// unification doesn't work though! The "flexible" version of this function
-// differs in that if a struct field is present in the type, but missing from
-// the data, then it will substitute a zero value for the data instead of
-// erroring. This is useful for cases when you have an initial schema
+var _ interfaces.InferableFunc = &DecodeFunc{} // ensure it meets this expectation
+
+// DecodeFunc is a static polymorphic function that accepts some json, yaml or
+// toml data and returns an mcl struct representing that data. You currently
+// should pass in an mcl type representation in the second arg so that we know
+// what type to parse the data as. There are some cases when the type can be
+// inferred, and you don't need to specify the second arg. It's your problem if
+// the type unification doesn't work though! The "flexible" version of this
+// function differs in that if a struct field is present in the type, but
+// missing from the data, then it will substitute a zero value for the data
+// instead of erroring. This is useful for cases when you have an initial schema
 // represented by the type in your mcl code, and you gradually expand it over
 // time before the data has caught up and added all those new fields.
-type DecodeJSONFunc struct {
+type DecodeFunc struct {
 	interfaces.Textarea
 
-	flexible bool // "flexible" version of this function
+	format   string // one of the format constants
+	flexible bool   // "flexible" version of this function
 
 	// Type is the type of the type specification (2nd) arg if one is
 	// specified. Nil is the special undetermined value that is used before
@@ -85,13 +100,13 @@ type DecodeJSONFunc struct {
 
 // String returns a simple name for this function. This is needed so this struct
 // can satisfy the pgraph.Vertex interface.
-func (obj *DecodeJSONFunc) String() string {
-	return DecodeJSONFuncName
+func (obj *DecodeFunc) String() string {
+	return "decode_" + obj.format
 }
 
 // ArgGen returns the Nth arg name for this function.
-func (obj *DecodeJSONFunc) ArgGen(index int) (string, error) {
-	seq := []string{decodeJSONArgNameData, decodeJSONArgNameType}
+func (obj *DecodeFunc) ArgGen(index int) (string, error) {
+	seq := []string{decodeArgNameData, decodeArgNameType}
 	if l := len(seq); index >= l {
 		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
 	}
@@ -99,7 +114,7 @@ func (obj *DecodeJSONFunc) ArgGen(index int) (string, error) {
 }
 
 // helper
-func (obj *DecodeJSONFunc) sig() *types.Type {
+func (obj *DecodeFunc) sig() *types.Type {
 	if obj.length == 0 { // not yet known
 		return nil
 	}
@@ -110,19 +125,19 @@ func (obj *DecodeJSONFunc) sig() *types.Type {
 	}
 
 	if obj.length == 1 {
-		typ := fmt.Sprintf("func(%s str) %s", decodeJSONArgNameData, v)
+		typ := fmt.Sprintf("func(%s str) %s", decodeArgNameData, v)
 		return types.NewType(typ)
 	}
 
 	// obj.length == 2
-	typ := fmt.Sprintf("func(%s str, %s str) %s", decodeJSONArgNameData, decodeJSONArgNameType, v)
+	typ := fmt.Sprintf("func(%s str, %s str) %s", decodeArgNameData, decodeArgNameType, v)
 	return types.NewType(typ)
 }
 
 // FuncInfer takes partial type and value information from the call site of this
 // function so that it can build an appropriate type signature for it. The type
 // signature may include unification variables.
-func (obj *DecodeJSONFunc) FuncInfer(partialType *types.Type, partialValues []types.Value) (*types.Type, []*interfaces.UnificationInvariant, error) {
+func (obj *DecodeFunc) FuncInfer(partialType *types.Type, partialValues []types.Value) (*types.Type, []*interfaces.UnificationInvariant, error) {
 	// func(data str) ?1
 	// OR
 	// func(data str, type str) ?1
@@ -160,7 +175,7 @@ func (obj *DecodeJSONFunc) FuncInfer(partialType *types.Type, partialValues []ty
 
 // Build takes the now known function signature and stores it so that this
 // function can appear to be static.
-func (obj *DecodeJSONFunc) Build(typ *types.Type) (*types.Type, error) {
+func (obj *DecodeFunc) Build(typ *types.Type) (*types.Type, error) {
 	if typ.Kind != types.KindFunc {
 		return nil, fmt.Errorf("input type must be of kind func")
 	}
@@ -212,7 +227,7 @@ func (obj *DecodeJSONFunc) Build(typ *types.Type) (*types.Type, error) {
 
 // Validate makes sure we've built our struct properly. It is usually unused for
 // normal functions that users can use directly.
-func (obj *DecodeJSONFunc) Validate() error {
+func (obj *DecodeFunc) Validate() error {
 	if obj.length == 0 {
 		return fmt.Errorf("function not built correctly")
 	}
@@ -223,7 +238,7 @@ func (obj *DecodeJSONFunc) Validate() error {
 }
 
 // Info returns some static info about itself.
-func (obj *DecodeJSONFunc) Info() *interfaces.Info {
+func (obj *DecodeFunc) Info() *interfaces.Info {
 	// Since this function implements FuncInfer we want sig to return nil to
 	// avoid an accidental return of unification variables when we should be
 	// getting them from FuncInfer, and not from here. (During unification!)
@@ -242,17 +257,18 @@ func (obj *DecodeJSONFunc) Info() *interfaces.Info {
 }
 
 // Init runs some startup code for this function.
-func (obj *DecodeJSONFunc) Init(init *interfaces.Init) error {
+func (obj *DecodeFunc) Init(init *interfaces.Init) error {
 	obj.init = init
 	return nil
 }
 
 // Copy is implemented so that the obj.built value is not lost if we copy this
 // function.
-func (obj *DecodeJSONFunc) Copy() interfaces.Func {
-	return &DecodeJSONFunc{
+func (obj *DecodeFunc) Copy() interfaces.Func {
+	return &DecodeFunc{
 		Textarea: obj.Textarea,
 
+		format:   obj.format,
 		flexible: obj.flexible,
 
 		Type:   obj.Type, // don't copy because we use this after unification
@@ -265,7 +281,7 @@ func (obj *DecodeJSONFunc) Copy() interfaces.Func {
 
 // Call this function with the input args and return the value if it is possible
 // to do so at this time.
-func (obj *DecodeJSONFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+func (obj *DecodeFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
 	if len(args) < 1 {
 		return nil, fmt.Errorf("not enough args")
 	}
@@ -293,11 +309,22 @@ func (obj *DecodeJSONFunc) Call(ctx context.Context, args []types.Value) (types.
 		return nil, funcs.ErrCantSpeculate
 	}
 
-	if obj.flexible {
-		return jsonUtil.FlexibleValueOfJSON(data, typ)
+	switch obj.format {
+	case formatJSON:
+		if obj.flexible {
+			return jsonUtil.FlexibleValueOfJSON(data, typ)
+		}
+
+		// XXX: This particular function, requires typ and can't guess the type!
+		// Perhaps a future version with a better markup language can just know!
+		return jsonUtil.ValueOfJSON(data, typ)
+
+	case formatYAML:
+		return valueOfYAML(data, typ, obj.flexible)
+
+	case formatTOML:
+		return valueOfTOML(data, typ, obj.flexible)
 	}
 
-	// XXX: This particular function, requires typ and can't guess the type!
-	// Perhaps a future version with a better markup language can just know!
-	return jsonUtil.ValueOfJSON(data, typ)
+	return nil, fmt.Errorf("unknown format: %s", obj.format)
 }
@@ -0,0 +1,230 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreencoding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	jsonUtil "github.com/purpleidea/mgmt/lang/types/json"
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	encoders := map[string]interfaces.FuncSig{
+		"encode_json":        EncodeJSON,
+		"encode_json_pretty": EncodeJSONPretty,
+		"encode_yaml":        EncodeYAML,
+		"encode_toml":        EncodeTOML,
+		"encode_ini":         EncodeINI,
+	}
+	for name, fn := range encoders {
+		simple.ModuleRegister(ModuleName, name, &simple.Scaffold{
+			I: &simple.Info{
+				Pure: true,
+				Memo: true,
+				Fast: true,
+				Spec: true,
+			},
+			T: types.NewType("func(value ?1) str"),
+			C: encodable,
+			F: fn,
+		})
+	}
+}
+
+// encodable checks that the value we were built with can be encoded at all.
+func encodable(typ *types.Type) error {
+	if typ == nil || len(typ.Ord) != 1 {
+		return fmt.Errorf("the function needs exactly one arg")
+	}
+	return jsonUtil.NativeKinds(typ.Map[typ.Ord[0]])
+}
+
+// EncodeJSON encodes any value as compact json. Structs and maps become json
+// objects with their keys sorted, so that the output is stable. Map keys must
+// be strings.
+func EncodeJSON(ctx context.Context, input []types.Value) (types.Value, error) {
+	return encodeJSON(input[0], "")
+}
+
+// EncodeJSONPretty encodes any value as json, the same way that EncodeJSON
+// does, except that the output is indented with tabs and ends with a newline,
+// which is usually what you want when rendering a file.
+func EncodeJSONPretty(ctx context.Context, input []types.Value) (types.Value, error) {
+	return encodeJSON(input[0], "\t")
+}
+
+// encodeJSON is the helper for the json encoders. An empty indent produces the
+// compact form.
+func encodeJSON(value types.Value, indent string) (types.Value, error) {
+	v, err := jsonUtil.NativeOfValue(value)
+	if err != nil {
+		return nil, err
+	}
+	b := &bytes.Buffer{}
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false) // we're not embedding this in html
+	enc.SetIndent("", indent)
+	if err := enc.Encode(v); err != nil {
+		return nil, errwrap.Wrapf(err, "could not encode json")
+	}
+	s := b.String()
+	if indent == "" {
+		s = strings.TrimSuffix(s, "\n")
+	}
+	return &types.StrValue{
+		V: s,
+	}, nil
+}
+
+// EncodeYAML encodes any value as yaml. Structs and maps become yaml mappings
+// with their keys sorted, so that the output is stable. Map keys must be
+// strings.
+func EncodeYAML(ctx context.Context, input []types.Value) (types.Value, error) {
+	v, err := jsonUtil.NativeOfValue(input[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not encode yaml")
+	}
+	return &types.StrValue{
+		V: string(b),
+	}, nil
+}
+
+// EncodeTOML encodes a struct or a map as toml. Keys are sorted, so that the
+// output is stable. Nested structs and maps become tables. Map keys must be
+// strings.
+func EncodeTOML(ctx context.Context, input []types.Value) (types.Value, error) {
+	if k := input[0].Type().Kind; k != types.KindStruct && k != types.KindMap {
+		return nil, fmt.Errorf("toml can only encode a struct or a map, got: %s", k)
+	}
+	v, err := jsonUtil.NativeOfValue(input[0])
+	if err != nil {
+		return nil, err
+	}
+	b, err := toml.Marshal(v)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not encode toml")
+	}
+	return &types.StrValue{
+		V: string(b),
+	}, nil
+}
+
+// EncodeINI encodes a struct or a map as an ini file. Any scalar values at the
+// top level are printed first as global keys, and any struct or map values are
+// printed afterwards as named sections containing their scalar values. Keys
+// and sections are sorted, so that the output is stable. Lists and any deeper
+// nesting can't be represented, and cause an error.
+func EncodeINI(ctx context.Context, input []types.Value) (types.Value, error) {
+	if k := input[0].Type().Kind; k != types.KindStruct && k != types.KindMap {
+		return nil, fmt.Errorf("ini can only encode a struct or a map, got: %s", k)
+	}
+	v, err := jsonUtil.NativeOfValue(input[0])
+	if err != nil {
+		return nil, err
+	}
+	m := v.(map[string]interface{}) // we checked the kind above
+
+	globals := []string{}
+	sections := []string{}
+	for k, x := range m {
+		if _, ok := x.(map[string]interface{}); ok {
+			sections = append(sections, k)
+			continue
+		}
+		globals = append(globals, k)
+	}
+	sort.Strings(globals)
+	sort.Strings(sections)
+
+	b := &bytes.Buffer{}
+	for _, k := range globals {
+		s, err := iniScalar(m[k])
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "key %s", k)
+		}
+		fmt.Fprintf(b, "%s = %s\n", k, s)
+	}
+	for i, section := range sections {
+		if i > 0 || len(globals) > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(b, "[%s]\n", section)
+
+		sm := m[section].(map[string]interface{})
+		keys := []string{}
+		for k := range sm {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s, err := iniScalar(sm[k])
+			if err != nil {
+				return nil, errwrap.Wrapf(err, "key %s in section %s", k, section)
+			}
+			fmt.Fprintf(b, "%s = %s\n", k, s)
+		}
+	}
+
+	return &types.StrValue{
+		V: b.String(),
+	}, nil
+}
+
+// iniScalar formats a single ini value. Only scalars are allowed.
+func iniScalar(v interface{}) (string, error) {
+	switch x := v.(type) {
+	case bool:
+		return strconv.FormatBool(x), nil
+	case string:
+		return x, nil
+	case int64:
+		return strconv.FormatInt(x, 10), nil
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), nil
+	}
+	return "", fmt.Errorf("ini values must be scalars")
+}
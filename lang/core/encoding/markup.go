@@ -0,0 +1,138 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreencoding
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/types"
+	jsonUtil "github.com/purpleidea/mgmt/lang/types/json"
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	formatJSON = "json"
+	formatYAML = "yaml"
+	formatTOML = "toml"
+)
+
+// valueOfYAML parses some yaml data, and if it matches the expected type, it
+// returns the equivalent value. It reuses the type-directed json conversion.
+func valueOfYAML(data string, typ *types.Type, flexible bool) (types.Value, error) {
+	var v interface{}
+	if err := yaml.Unmarshal([]byte(data), &v); err != nil {
+		return nil, errwrap.Wrapf(err, "invalid YAML")
+	}
+	n, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonUtil.ValueOfNative(n, typ, flexible)
+}
+
+// valueOfTOML parses some toml data, and if it matches the expected type, it
+// returns the equivalent value. It reuses the type-directed json conversion.
+func valueOfTOML(data string, typ *types.Type, flexible bool) (types.Value, error) {
+	var v interface{}
+	if err := toml.Unmarshal([]byte(data), &v); err != nil {
+		return nil, errwrap.Wrapf(err, "invalid TOML")
+	}
+	n, err := normalize(v)
+	if err != nil {
+		return nil, err
+	}
+	return jsonUtil.ValueOfNative(n, typ, flexible)
+}
+
+// normalize converts the data that the yaml and toml decoders produce into the
+// shape that the json decoder produces, so that we can convert it the same way.
+// Numbers become json.Number, map keys become strings, and timestamps become
+// strings, since we don't have a native type for them.
+func normalize(val interface{}) (interface{}, error) {
+	switch v := val.(type) {
+	case nil, bool, string:
+		return v, nil
+
+	case int:
+		return json.Number(strconv.FormatInt(int64(v), 10)), nil
+	case int64:
+		return json.Number(strconv.FormatInt(v, 10)), nil
+	case uint64:
+		return json.Number(strconv.FormatUint(v, 10)), nil
+	case float64:
+		return json.Number(strconv.FormatFloat(v, 'g', -1, 64)), nil
+
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	case fmt.Stringer: // toml local dates and times
+		return v.String(), nil
+
+	case []interface{}:
+		l := []interface{}{}
+		for _, x := range v {
+			xx, err := normalize(x) // recurse
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, xx)
+		}
+		return l, nil
+
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for k, x := range v {
+			xx, err := normalize(x) // recurse
+			if err != nil {
+				return nil, err
+			}
+			m[k] = xx
+		}
+		return m, nil
+
+	case map[interface{}]interface{}: // yaml allows non-string keys
+		m := make(map[string]interface{})
+		for k, x := range v {
+			xx, err := normalize(x) // recurse
+			if err != nil {
+				return nil, err
+			}
+			m[fmt.Sprintf("%v", k)] = xx
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("unexpected data of type %T", val)
+}
@@ -34,6 +34,7 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 	"text/template"
 
@@ -48,6 +49,10 @@ const (
 	// TemplateFuncName is the name this function is registered as.
 	TemplateFuncName = "template"
 
+	// TemplateSafeFuncName is the name the safe version of this function is
+	// registered as.
+	TemplateSafeFuncName = "template_safe"
+
 	// TemplateName is the name of our template as required by the template
 	// library.
 	TemplateName = "template"
@@ -70,6 +75,7 @@ var (
 
 func init() {
 	funcs.ModuleRegister(ModuleName, TemplateFuncName, func() interfaces.Func { return &TemplateFunc{} })
+	funcs.ModuleRegister(ModuleName, TemplateSafeFuncName, func() interfaces.Func { return &TemplateFunc{safe: true} })
 }
 
 var _ interfaces.InferableFunc = &TemplateFunc{} // ensure it meets this expectation
@@ -79,17 +85,27 @@ var _ interfaces.InferableFunc = &TemplateFunc{} // ensure it meets this expecta
 // to it. It examines the type of the second argument (the input data vars) at
 // compile time and then determines the static functions signature by including
 // that in the overall signature. Every struct field in a template is accessed
-// by its Title-cased representation.
+// by its Title-cased representation. Functions from the other modules can be
+// called by their usual name, eg: strings.to_upper, or by their older template
+// name, eg: strings_to_upper. If the template string is known at compile time,
+// then the function names and any field accesses on the vars are checked then,
+// instead of when the template runs. The "safe" version of this function only
+// exposes pure functions, and errors on the expensive constructs such as range
+// loops, template definitions and calls, and the call builtin. This is useful
+// if the template comes from somewhere that you don't entirely trust.
 // TODO: We *might* need to add events for internal function changes over time,
 // but only if they are not pure. We currently only use simple, pure functions.
 type TemplateFunc struct {
 	interfaces.Textarea
 
+	safe bool // "safe" version of this function
+
 	// Type is the type of the input vars (2nd) arg if one is specified. Nil
 	// is the special undetermined value that is used before type is known.
 	Type *types.Type // type of vars
 
-	built bool // was this function built yet?
+	template *string // the template text, if it is known at compile time
+	built    bool    // was this function built yet?
 
 	init *interfaces.Init
 }
@@ -97,6 +113,9 @@ type TemplateFunc struct {
 // String returns a simple name for this function. This is needed so this struct
 // can satisfy the pgraph.Vertex interface.
 func (obj *TemplateFunc) String() string {
+	if obj.safe {
+		return TemplateSafeFuncName
+	}
 	return TemplateFuncName
 }
 
@@ -141,6 +160,11 @@ func (obj *TemplateFunc) FuncInfer(partialType *types.Type, partialValues []type
 		typ = types.NewType(fmt.Sprintf("func(%s str, %s ?1) str", templateArgNameTemplate, templateArgNameVars))
 	}
 
+	if partialValues[0] != nil { // static template, so check it in Build
+		s := partialValues[0].Str()
+		obj.template = &s
+	}
+
 	return typ, []*interfaces.UnificationInvariant{}, nil
 }
 
@@ -173,16 +197,19 @@ func (obj *TemplateFunc) Build(typ *types.Type) (*types.Type, error) {
 		return nil, fmt.Errorf("first arg for template must be an str")
 	}
 
-	if len(typ.Ord) == 1 { // no args being passed in (boring template)
-		obj.built = true
-		return obj.sig(), nil
+	if len(typ.Ord) == 2 {
+		t1, exists := typ.Map[typ.Ord[1]]
+		if !exists || t1 == nil {
+			return nil, fmt.Errorf("second arg must be specified")
+		}
+		obj.Type = t1 // extracted vars type is now known!
 	}
 
-	t1, exists := typ.Map[typ.Ord[1]]
-	if !exists || t1 == nil {
-		return nil, fmt.Errorf("second arg must be specified")
+	if obj.template != nil { // catch the errors early if we can
+		if _, err := parseTemplate(*obj.template, obj.checker()); err != nil {
+			return nil, errwrap.Wrapf(err, "template: check error")
+		}
 	}
-	obj.Type = t1 // extracted vars type is now known!
 
 	obj.built = true
 	return obj.sig(), nil
@@ -222,6 +249,47 @@ func (obj *TemplateFunc) Init(init *interfaces.Init) error {
 	return nil
 }
 
+// scaffolds returns the simple functions which can be used in the template,
+// keyed by the name they have inside of it. In safe mode, only the pure ones
+// are included.
+func (obj *TemplateFunc) scaffolds() map[string]*simple.Scaffold {
+	scaffolds := make(map[string]*simple.Scaffold)
+	for name, scaffold := range simple.RegisteredFuncs {
+		if scaffold.T == nil || scaffold.T.HasUni() {
+			if obj.init != nil && obj.init.Debug {
+				obj.init.Logf("warning, function named: `%s` is not unified", name)
+			}
+			continue
+		}
+		if obj.safe && (scaffold.I == nil || !scaffold.I.Pure) {
+			continue
+		}
+		scaffolds[safename(name)] = scaffold // TODO: rename since we can't include dot
+	}
+	return scaffolds
+}
+
+// checker returns a new checker for our template with all the function names.
+func (obj *TemplateFunc) checker() *templateChecker {
+	names := make(map[string]struct{})
+	for name := range obj.scaffolds() {
+		names[name] = struct{}{}
+	}
+	for _, name := range templateBuiltins {
+		names[name] = struct{}{}
+	}
+	if obj.safe {
+		for _, name := range templateUnsafeBuiltins {
+			delete(names, name)
+		}
+	}
+	return &templateChecker{
+		names: names,
+		root:  obj.Type,
+		safe:  obj.safe,
+	}
+}
+
 // run runs a template and returns the result.
 func (obj *TemplateFunc) run(ctx context.Context, templateText string, vars types.Value) (string, error) {
 	// see: https://golang.org/pkg/text/template/#FuncMap for more info
@@ -244,16 +312,15 @@ func (obj *TemplateFunc) run(ctx context.Context, templateText string, vars type
 
 	// FIXME: should we do this once in init() instead, or in the Register
 	// function in the simple package?
-	// TODO: loop through this map in a sorted, deterministic order
 	// XXX: should this use the scope instead (so imports are used properly) ?
-	for name, scaffold := range simple.RegisteredFuncs {
-		if scaffold.T == nil || scaffold.T.HasUni() {
-			if obj.init.Debug {
-				obj.init.Logf("warning, function named: `%s` is not unified", name)
-			}
-			continue
-		}
-		name = safename(name) // TODO: rename since we can't include dot
+	scaffolds := obj.scaffolds()
+	names := []string{}
+	for name := range scaffolds {
+		names = append(names, name)
+	}
+	sort.Strings(names) // deterministic order
+	for _, name := range names {
+		scaffold := scaffolds[name]
 		if _, exists := funcMap[name]; exists {
 			obj.init.Logf("warning, existing function named: `%s` exists", name)
 			continue
@@ -274,14 +341,18 @@ func (obj *TemplateFunc) run(ctx context.Context, templateText string, vars type
 		funcMap[name] = f // add it
 	}
 
-	var err error
 	tmpl := template.New(TemplateName)
 	tmpl = tmpl.Option("missingkey=error") // avoid "<no value>" strings!
 	tmpl = tmpl.Funcs(funcMap)
-	tmpl, err = tmpl.Parse(templateText)
+	trees, err := parseTemplate(templateText, obj.checker())
 	if err != nil {
 		return "", errwrap.Wrapf(err, "template: parse error")
 	}
+	for name, tree := range trees {
+		if _, err := tmpl.AddParseTree(name, tree); err != nil {
+			return "", errwrap.Wrapf(err, "template: parse error")
+		}
+	}
 
 	buf := new(bytes.Buffer)
 
@@ -517,8 +588,11 @@ func (obj *TemplateFunc) Copy() interfaces.Func {
 	return &TemplateFunc{
 		Textarea: obj.Textarea,
 
-		Type:  obj.Type, // don't copy because we use this after unification
-		built: obj.built,
+		safe: obj.safe,
+
+		Type:     obj.Type, // don't copy because we use this after unification
+		template: obj.template,
+		built:    obj.built,
 
 		init: obj.init, // likely gets overwritten anyways
 	}
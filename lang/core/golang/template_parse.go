@@ -0,0 +1,325 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coregolang
+
+import (
+	"fmt"
+	"strings"
+	"text/template/parse"
+
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+// templateBuiltins are the functions which the template library provides.
+var templateBuiltins = []string{
+	"and",
+	"call",
+	"eq",
+	"ge",
+	"gt",
+	"html",
+	"index",
+	"js",
+	"le",
+	"len",
+	"lt",
+	"ne",
+	"not",
+	"or",
+	"print",
+	"printf",
+	"println",
+	"slice",
+	"urlquery",
+}
+
+// templateUnsafeBuiltins are the builtins which are not allowed in safe mode.
+var templateUnsafeBuiltins = []string{
+	"call", // can run arbitrary function values
+}
+
+// parseTemplate parses the template text and then walks it with the checker.
+// It returns the set of named trees which should be added to the template.
+func parseTemplate(text string, checker *templateChecker) (map[string]*parse.Tree, error) {
+	t := parse.New(TemplateName)
+	t.Mode = parse.SkipFuncCheck // we check them ourselves after the rewrite
+	treeSet := make(map[string]*parse.Tree)
+	if _, err := t.Parse(text, "", "", treeSet); err != nil {
+		return nil, err
+	}
+
+	for name, tree := range treeSet {
+		if name != TemplateName && checker.safe {
+			return nil, fmt.Errorf("template: %s: defining templates is not allowed in safe mode", name)
+		}
+		var dot *types.Type // the dot of a defined template is unknown
+		if name == TemplateName {
+			dot = checker.root
+		}
+		checker.tree = tree
+		if _, err := checker.walk(tree.Root, dot); err != nil {
+			return nil, err
+		}
+	}
+
+	return treeSet, nil
+}
+
+// templateChecker walks a parsed template. It rewrites the module-qualified
+// function names (eg: strings.to_upper) into the names that they're available
+// under in the template (eg: strings_to_upper) and it checks that all of the
+// functions exist. If the type of the vars is known, it also checks that every
+// field access in the template is valid for that type. In safe mode, it errors
+// on any expensive constructs such as loops and template calls.
+type templateChecker struct {
+	// names is the set of available function names.
+	names map[string]struct{}
+
+	// root is the type of the vars, or nil if it's not known.
+	root *types.Type
+
+	// safe specifies if we disallow expensive constructs.
+	safe bool
+
+	tree *parse.Tree // the tree we're currently walking
+}
+
+// errorf returns an error which includes the location of the node.
+func (obj *templateChecker) errorf(node parse.Node, format string, args ...interface{}) error {
+	location, context := obj.tree.ErrorContext(node)
+	return fmt.Errorf("template: %s: at <%s>: %s", location, context, fmt.Sprintf(format, args...))
+}
+
+// walk checks the node, and returns the type of the value it produces if it is
+// known. The dot is the type of the value of dot at this point in the template.
+// A nil type means that it is not known, in which case we can't check it.
+func (obj *templateChecker) walk(node parse.Node, dot *types.Type) (*types.Type, error) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil, nil
+		}
+		for _, x := range n.Nodes {
+			if _, err := obj.walk(x, dot); err != nil {
+				return nil, err
+			}
+		}
+		return nil, nil
+
+	case *parse.ActionNode:
+		return obj.walk(n.Pipe, dot)
+
+	case *parse.PipeNode:
+		if n == nil {
+			return nil, nil
+		}
+		var typ *types.Type
+		for _, cmd := range n.Cmds {
+			t, err := obj.walk(cmd, dot)
+			if err != nil {
+				return nil, err
+			}
+			typ = t
+		}
+		return typ, nil
+
+	case *parse.CommandNode:
+		for i, arg := range n.Args {
+			n.Args[i] = obj.rewrite(arg)
+		}
+		var typ *types.Type
+		for _, arg := range n.Args {
+			t, err := obj.walk(arg, dot)
+			if err != nil {
+				return nil, err
+			}
+			typ = t
+		}
+		if len(n.Args) != 1 { // a function call, which we can't type
+			return nil, nil
+		}
+		return typ, nil
+
+	case *parse.ChainNode:
+		if ident, ok := n.Node.(*parse.IdentifierNode); ok {
+			if _, exists := obj.names[ident.Ident]; !exists { // rewrite failed
+				name := strings.Join(append([]string{ident.Ident}, n.Field...), ".")
+				return nil, obj.errorf(n, "function %q not defined", name)
+			}
+		}
+		typ, err := obj.walk(n.Node, dot)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := n.Node.(*parse.IdentifierNode); ok {
+			typ = nil // function result
+		}
+		return obj.fields(n, typ, n.Field)
+
+	case *parse.IdentifierNode:
+		if _, exists := obj.names[n.Ident]; !exists {
+			return nil, obj.errorf(n, "function %q not defined", n.Ident)
+		}
+		return nil, nil
+
+	case *parse.FieldNode:
+		return obj.fields(n, dot, n.Ident)
+
+	case *parse.VariableNode:
+		if n.Ident[0] != "$" { // we don't track the other variables
+			return nil, nil
+		}
+		return obj.fields(n, obj.root, n.Ident[1:])
+
+	case *parse.DotNode:
+		return dot, nil
+
+	case *parse.IfNode:
+		if _, err := obj.walk(n.Pipe, dot); err != nil {
+			return nil, err
+		}
+		if _, err := obj.walk(n.List, dot); err != nil {
+			return nil, err
+		}
+		return obj.walk(n.ElseList, dot)
+
+	case *parse.RangeNode:
+		if obj.safe {
+			return nil, obj.errorf(n, "range is not allowed in safe mode")
+		}
+		typ, err := obj.walk(n.Pipe, dot)
+		if err != nil {
+			return nil, err
+		}
+		var elem *types.Type
+		if typ != nil && (typ.Kind == types.KindList || typ.Kind == types.KindMap) {
+			elem = typ.Val
+		}
+		if _, err := obj.walk(n.List, elem); err != nil {
+			return nil, err
+		}
+		return obj.walk(n.ElseList, dot)
+
+	case *parse.WithNode:
+		typ, err := obj.walk(n.Pipe, dot)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := obj.walk(n.List, typ); err != nil {
+			return nil, err
+		}
+		return obj.walk(n.ElseList, dot)
+
+	case *parse.TemplateNode:
+		if obj.safe {
+			return nil, obj.errorf(n, "template calls are not allowed in safe mode")
+		}
+		return obj.walk(n.Pipe, dot)
+	}
+
+	// text, comments, constants and so on...
+	return nil, nil
+}
+
+// rewrite turns a chain such as strings.to_upper, which the parser sees as a
+// call to a function named strings with a field access, into the function that
+// it names. If there's no such function, then the node is returned unchanged.
+func (obj *templateChecker) rewrite(node parse.Node) parse.Node {
+	chain, ok := node.(*parse.ChainNode)
+	if !ok {
+		return node
+	}
+	ident, ok := chain.Node.(*parse.IdentifierNode)
+	if !ok {
+		return node
+	}
+	if _, exists := obj.names[ident.Ident]; exists {
+		return node // a real function, with a field access on its result
+	}
+
+	for i := len(chain.Field); i > 0; i-- { // longest match wins
+		name := strings.Join(append([]string{ident.Ident}, chain.Field[:i]...), "_")
+		if _, exists := obj.names[name]; !exists {
+			continue
+		}
+		fn := parse.NewIdentifier(name).SetTree(obj.tree).SetPos(ident.Position())
+		if i == len(chain.Field) {
+			return fn
+		}
+		return &parse.ChainNode{
+			NodeType: parse.NodeChain,
+			Pos:      chain.Pos,
+			Node:     fn,
+			// Add wants a leading dot, which these don't have
+			Field: append([]string{}, chain.Field[i:]...),
+		}
+	}
+
+	return node
+}
+
+// fields returns the type of a chain of field accesses on the type, and errors
+// if one of them is not valid.
+func (obj *templateChecker) fields(node parse.Node, typ *types.Type, fields []string) (*types.Type, error) {
+	for _, field := range fields {
+		if typ == nil { // unknown
+			return nil, nil
+		}
+
+		switch typ.Kind {
+		case types.KindStruct:
+			var next *types.Type
+			for _, k := range typ.Ord {
+				if strings.Title(k) == field { // see convert
+					next = typ.Map[k]
+					break
+				}
+			}
+			if next == nil {
+				return nil, obj.errorf(node, "struct %s has no field named %s", typ, field)
+			}
+			typ = next
+
+		case types.KindMap:
+			if typ.Key.Cmp(types.TypeStr) != nil {
+				return nil, obj.errorf(node, "can't access field %s of %s, the keys are not str", field, typ)
+			}
+			typ = typ.Val // we can't know which keys will exist
+
+		case types.KindVariant:
+			return nil, nil // unknown
+
+		default:
+			return nil, obj.errorf(node, "can't access field %s of %s", field, typ)
+		}
+	}
+
+	return typ, nil
+}
@@ -33,12 +33,13 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/purpleidea/mgmt/lang/funcs"
 	"github.com/purpleidea/mgmt/lang/funcs/simple"
 	"github.com/purpleidea/mgmt/lang/types"
 )
 
 func init() {
-	simple.Register("len", &simple.Scaffold{
+	simple.Register(funcs.LenFuncName, &simple.Scaffold{
 		I: &simple.Info{
 			Pure: true,
 			Memo: true,
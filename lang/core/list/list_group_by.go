@@ -0,0 +1,97 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corelist
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "group_by", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(list []?1, field str) map{str: []?1}"),
+		C: func(typ *types.Type) error {
+			if t := typ.Map[typ.Ord[0]]; t == nil || t.Val == nil || t.Val.Kind != types.KindStruct {
+				return fmt.Errorf("list must contain structs")
+			}
+			return nil
+		},
+		F: ListGroupBy,
+	})
+}
+
+// ListGroupBy takes a list of structs and groups them by the value of the named
+// field. It returns a map from each distinct value of that field, to the list
+// of structs which have it, in their original order. If the field is not a str,
+// then its value is printed as it would be in mcl, eg: 42 or true. It errors if
+// the field does not exist.
+func ListGroupBy(ctx context.Context, input []types.Value) (types.Value, error) {
+	l := input[0].(*types.ListValue)
+	field := input[1].Str()
+
+	if _, exists := l.Type().Val.Map[field]; !exists {
+		return nil, fmt.Errorf("field %s does not exist in %s", field, l.Type().Val)
+	}
+
+	groups := make(map[string][]types.Value)
+	for _, v := range l.List() {
+		x, exists := v.Struct()[field]
+		if !exists {
+			// programming error
+			return nil, fmt.Errorf("field %s is missing", field)
+		}
+		key := x.String()
+		if x.Type().Kind == types.KindStr {
+			key = x.Str()
+		}
+		groups[key] = append(groups[key], v)
+	}
+
+	m := types.NewMap(types.NewType(fmt.Sprintf("map{str: %s}", l.Type())))
+	for k, values := range groups {
+		val := &types.ListValue{
+			T: l.Type(),
+			V: values,
+		}
+		if err := m.Set(&types.StrValue{V: k}, val); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
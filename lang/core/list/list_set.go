@@ -0,0 +1,102 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corelist
+
+import (
+	"context"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	for name, fn := range map[string]func(a, b []types.Value) []types.Value{
+		"union":        union,
+		"intersection": intersection,
+		"difference":   difference,
+	} {
+		fn := fn
+		simple.ModuleRegister(ModuleName, name, &simple.Scaffold{
+			I: &simple.Info{
+				Pure: true,
+				Memo: true,
+				Fast: true,
+				Spec: true,
+			},
+			T: types.NewType("func(a []?1, b []?1) []?1"),
+			C: checkComparable,
+			F: func(ctx context.Context, input []types.Value) (types.Value, error) {
+				return ListSet(fn, input)
+			},
+			D: ListSet, // get the docs from this
+		})
+	}
+}
+
+// ListSet treats both lists as sets and returns either their union, their
+// intersection, or their difference, which is the values of a which are not in
+// b. The result has no duplicates, and keeps the order in which the values are
+// first seen in a and then in b.
+func ListSet(fn func(a, b []types.Value) []types.Value, input []types.Value) (types.Value, error) {
+	a := input[0].(*types.ListValue)
+	b := input[1].(*types.ListValue)
+
+	return &types.ListValue{
+		T: a.Type(),
+		V: fn(a.List(), b.List()),
+	}, nil
+}
+
+// union returns the values in either list.
+func union(a, b []types.Value) []types.Value {
+	return unique(append(append([]types.Value{}, a...), b...))
+}
+
+// intersection returns the values in both lists.
+func intersection(a, b []types.Value) []types.Value {
+	out := []types.Value{}
+	for _, v := range unique(a) {
+		if contains(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// difference returns the values in a which are not in b.
+func difference(a, b []types.Value) []types.Value {
+	out := []types.Value{}
+	for _, v := range unique(a) {
+		if !contains(b, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
@@ -0,0 +1,79 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corelist
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "sort", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(list []?1) []?1"),
+		C: checkSortable,
+		F: ListSort,
+	})
+}
+
+// ListSort returns a copy of the list, sorted in ascending order. Equal values
+// keep their original relative order. Strings sort lexicographically, numbers
+// numerically, and false sorts before true. Only lists of these basic types can
+// be sorted.
+func ListSort(ctx context.Context, input []types.Value) (types.Value, error) {
+	l := input[0].(*types.ListValue)
+
+	values := types.ValueSlice(append([]types.Value{}, l.List()...)) // copy
+	sort.Stable(values)
+
+	return &types.ListValue{
+		T: l.Type(),
+		V: values,
+	}, nil
+}
+
+// checkSortable is the type check for sort. Only the basic types have a real
+// ordering, the Less of the container types isn't a consistent one.
+func checkSortable(typ *types.Type) error {
+	switch typ.Out.Val.Kind {
+	case types.KindBool, types.KindStr, types.KindInt, types.KindFloat:
+		return nil
+	}
+	return fmt.Errorf("can only sort lists of bool, str, int or float values")
+}
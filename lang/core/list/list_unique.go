@@ -0,0 +1,93 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corelist
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "unique", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(list []?1) []?1"),
+		C: checkComparable,
+		F: ListUnique,
+	})
+}
+
+// ListUnique returns a copy of the list with any duplicate values removed. The
+// first occurrence of each value is kept, so the order is otherwise preserved.
+func ListUnique(ctx context.Context, input []types.Value) (types.Value, error) {
+	l := input[0].(*types.ListValue)
+
+	return &types.ListValue{
+		T: l.Type(),
+		V: unique(l.List()),
+	}, nil
+}
+
+// unique returns the values without any duplicates, in their original order.
+func unique(values []types.Value) []types.Value {
+	out := []types.Value{}
+	for _, v := range values {
+		if !contains(out, v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// checkComparable is the type check for the functions which need to compare the
+// values in a list. Function values can't be compared, so these are rejected.
+func checkComparable(typ *types.Type) error {
+	if typ.Out.HasFunc() {
+		return fmt.Errorf("list values can't contain functions")
+	}
+	return nil
+}
+
+// contains returns true if the value is in the list of values.
+func contains(values []types.Value, v types.Value) bool {
+	for _, x := range values {
+		if x.Cmp(v) == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coremap
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+const (
+	// MergePolicyLeft keeps the value from the first map on conflict.
+	MergePolicyLeft = "left"
+
+	// MergePolicyRight keeps the value from the second map on conflict.
+	MergePolicyRight = "right"
+
+	// MergePolicyError errors if both maps have the same key with different
+	// values.
+	MergePolicyError = "error"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "merge", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: true,
+			Spec: true,
+		},
+		T: types.NewType("func(a map{?1: ?2}, b map{?1: ?2}, policy str) map{?1: ?2}"),
+		C: func(typ *types.Type) error {
+			if typ.Out.HasFunc() { // we compare the keys and values
+				return fmt.Errorf("map keys and values can't contain functions")
+			}
+			return nil
+		},
+		F: MapMerge,
+	})
+}
+
+// MapMerge returns a new map containing the keys of both maps. The policy says
+// what to do when both maps contain the same key: "left" keeps the value from
+// the first map, "right" keeps the value from the second map, and "error"
+// errors unless both values are the same.
+func MapMerge(ctx context.Context, input []types.Value) (types.Value, error) {
+	a := input[0].(*types.MapValue)
+	b := input[1].(*types.MapValue)
+	policy := input[2].Str()
+
+	if policy != MergePolicyLeft && policy != MergePolicyRight && policy != MergePolicyError {
+		return nil, fmt.Errorf("invalid merge policy: %s", policy)
+	}
+
+	m := types.NewMap(a.Type())
+	for k, v := range a.Map() {
+		if err := m.Set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	for k, v := range b.Map() {
+		if old, exists := m.Lookup(k); exists {
+			if policy == MergePolicyLeft {
+				continue
+			}
+			if policy == MergePolicyError && old.Cmp(v) != nil {
+				return nil, fmt.Errorf("conflicting values for key %s", k)
+			}
+		}
+		if err := m.Set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
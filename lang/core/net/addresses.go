@@ -0,0 +1,127 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corenet
+
+import (
+	"context"
+	"net"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// AddressesFuncName is the name this function is registered as.
+	AddressesFuncName = "addresses"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, AddressesFuncName, func() interfaces.Func {
+		return &AddressesFunc{}
+	})
+}
+
+// AddressesFunc returns all of the addresses on each interface and streams
+// events when network links or addresses change.
+type AddressesFunc struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this function.
+func (obj *AddressesFunc) String() string {
+	return AddressesFuncName
+}
+
+// Validate makes sure the function was built correctly.
+func (obj *AddressesFunc) Validate() error {
+	return nil
+}
+
+// Info returns static information about this function.
+func (obj *AddressesFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false,
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType("func() map{str: []str}"),
+	}
+}
+
+// Init initializes this function.
+func (obj *AddressesFunc) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream emits an initial event and subsequent network change events.
+func (obj *AddressesFunc) Stream(ctx context.Context) error {
+	return networkEventStream(ctx, obj.init.Event)
+}
+
+// Call returns the current addresses of each interface.
+func (obj *AddressesFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	return Addresses(ctx, args)
+}
+
+// Addresses returns a map from each interface name to the list of addresses on
+// that interface in CIDR notation, eg: 192.0.2.42/24. Both IPv4 and IPv6 ones
+// are included, in the order that the kernel lists them. Interfaces without an
+// address are included with an empty list.
+func Addresses(ctx context.Context, input []types.Value) (types.Value, error) {
+	ifs, err := net.Interfaces()
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not list interfaces")
+	}
+
+	m := types.NewType("map{str: []str}").New().(*types.MapValue)
+	for _, iface := range ifs {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not list addresses on interface `%s`", iface.Name)
+		}
+
+		l := &types.ListValue{
+			T: types.TypeListStr,
+		}
+		for _, addr := range addrs {
+			l.V = append(l.V, &types.StrValue{V: addr.String()})
+		}
+		if err := m.Set(&types.StrValue{V: iface.Name}, l); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
@@ -0,0 +1,263 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corenet
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// ListeningFuncName is the name this function is registered as.
+	ListeningFuncName = "listening"
+
+	listeningSignature = "struct{protocol str; address str; port int}"
+
+	listeningPollInterval = 5 * time.Second
+
+	// These are the socket states from the kernel's tcp_states.h which we
+	// care about. An unconnected udp socket shows up as closed.
+	tcpStateListen = "0A"
+	tcpStateClose  = "07"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, ListeningFuncName, func() interfaces.Func {
+		return &ListeningFunc{}
+	})
+}
+
+// socket is a single listening socket.
+type socket struct {
+	protocol string
+	address  string
+	port     int
+}
+
+// ListeningFunc returns the listening sockets and polls for changes, since the
+// kernel has no events for these.
+type ListeningFunc struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this function.
+func (obj *ListeningFunc) String() string {
+	return ListeningFuncName
+}
+
+// Validate makes sure the function was built correctly.
+func (obj *ListeningFunc) Validate() error {
+	return nil
+}
+
+// Info returns static information about this function.
+func (obj *ListeningFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false,
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func() []%s", listeningSignature)),
+	}
+}
+
+// Init initializes this function.
+func (obj *ListeningFunc) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream emits an initial event and then polls.
+func (obj *ListeningFunc) Stream(ctx context.Context) error {
+	ticker := time.NewTicker(listeningPollInterval)
+	defer ticker.Stop()
+
+	if err := obj.init.Event(ctx); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := obj.init.Event(ctx); err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// Call returns the current listening sockets.
+func (obj *ListeningFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	return Listening(ctx, args)
+}
+
+// Listening returns the list of tcp sockets which are listening, and of udp
+// sockets which are bound but not connected, sorted by protocol, port and then
+// address. The protocol is one of tcp, tcp6, udp or udp6, and the address is
+// the local one, where 0.0.0.0 or :: means all of them. This reads the socket
+// tables in /proc, so it's only supported on Linux.
+func Listening(ctx context.Context, input []types.Value) (types.Value, error) {
+	sockets := []*socket{}
+	for _, protocol := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		f, err := os.Open("/proc/net/" + protocol)
+		if os.IsNotExist(err) && strings.HasSuffix(protocol, "6") {
+			continue // ipv6 is disabled
+		}
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not read %s sockets", protocol)
+		}
+		s, err := parseProcNet(f, protocol)
+		f.Close()
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not parse %s sockets", protocol)
+		}
+		sockets = append(sockets, s...)
+	}
+	sockets = sortSockets(sockets)
+
+	typ := types.NewType(listeningSignature)
+	values := []types.Value{}
+	for _, s := range sockets {
+		st := types.NewStruct(typ)
+		fields := map[string]types.Value{
+			"protocol": &types.StrValue{V: s.protocol},
+			"address":  &types.StrValue{V: s.address},
+			"port":     &types.IntValue{V: int64(s.port)},
+		}
+		for k, v := range fields {
+			if err := st.Set(k, v); err != nil {
+				return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+			}
+		}
+		values = append(values, st)
+	}
+
+	return &types.ListValue{
+		T: types.NewType(fmt.Sprintf("[]%s", listeningSignature)),
+		V: values,
+	}, nil
+}
+
+// parseProcNet parses one of the socket tables in /proc/net, and returns the
+// sockets which are listening for this protocol.
+func parseProcNet(r io.Reader, protocol string) ([]*socket, error) {
+	state := tcpStateListen
+	if strings.HasPrefix(protocol, "udp") {
+		state = tcpStateClose
+	}
+
+	result := []*socket{}
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // skip the header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		if fields[3] != state {
+			continue
+		}
+		addr, port, ok := strings.Cut(fields[1], ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid local address: %s", fields[1])
+		}
+		ip, err := parseProcNetIP(addr)
+		if err != nil {
+			return nil, err
+		}
+		p, err := strconv.ParseUint(port, 16, 16)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "invalid port: %s", port)
+		}
+		result = append(result, &socket{
+			protocol: protocol,
+			address:  ip.String(),
+			port:     int(p),
+		})
+	}
+	return result, scanner.Err()
+}
+
+// parseProcNetIP decodes an address from /proc/net. The kernel prints it as a
+// sequence of 32 bit words in hex, each of which is in host byte order.
+func parseProcNetIP(s string) (net.IP, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || (len(b) != net.IPv4len && len(b) != net.IPv6len) {
+		return nil, fmt.Errorf("invalid address: %s", s)
+	}
+	ip := make(net.IP, len(b))
+	for i := 0; i < len(b); i += 4 {
+		binary.NativeEndian.PutUint32(ip[i:], binary.BigEndian.Uint32(b[i:]))
+	}
+	return ip, nil
+}
+
+// sortSockets sorts the sockets and removes any duplicates, which are common
+// when a program uses SO_REUSEPORT.
+func sortSockets(sockets []*socket) []*socket {
+	sort.Slice(sockets, func(i, j int) bool {
+		a, b := sockets[i], sockets[j]
+		if a.protocol != b.protocol {
+			return a.protocol < b.protocol
+		}
+		if a.port != b.port {
+			return a.port < b.port
+		}
+		return a.address < b.address
+	})
+	result := []*socket{}
+	for i, s := range sockets {
+		if i > 0 && *s == *sockets[i-1] {
+			continue
+		}
+		result = append(result, s)
+	}
+	return result
+}
@@ -0,0 +1,136 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package corenet
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+)
+
+// procNetHex encodes an address like the kernel does in /proc/net, so that the
+// test works on hosts of either endianness.
+func procNetHex(s string) string {
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	b := make([]byte, len(ip))
+	for i := 0; i < len(ip); i += 4 {
+		binary.BigEndian.PutUint32(b[i:], binary.NativeEndian.Uint32(ip[i:]))
+	}
+	return strings.ToUpper(hex.EncodeToString(b))
+}
+
+func TestParseProcNet(t *testing.T) {
+	header := "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+	line := func(i int, addr string, port int, state string) string {
+		return fmt.Sprintf("   %d: %s:%04X 00000000:0000 %s 00000000:00000000 00:00000000 00000000     0        0 1234 1\n", i, procNetHex(addr), port, state)
+	}
+
+	data := header +
+		line(0, "127.0.0.1", 631, tcpStateListen) +
+		line(1, "0.0.0.0", 22, tcpStateListen) +
+		line(2, "192.0.2.7", 40000, "01") // established
+	sockets, err := parseProcNet(strings.NewReader(data), "tcp")
+	if err != nil {
+		t.Errorf("could not parseProcNet: %+v", err)
+		return
+	}
+	expected := []socket{
+		{protocol: "tcp", address: "127.0.0.1", port: 631},
+		{protocol: "tcp", address: "0.0.0.0", port: 22},
+	}
+	if len(sockets) != len(expected) {
+		t.Errorf("expected %d sockets, got %d", len(expected), len(sockets))
+		return
+	}
+	for i, s := range sockets {
+		if *s != expected[i] {
+			t.Errorf("socket %d: expected %+v, got %+v", i, expected[i], *s)
+		}
+	}
+
+	data = header +
+		line(0, "::", 53, tcpStateClose) +
+		line(1, "fe80::1", 5353, tcpStateClose) +
+		line(2, "::1", 123, tcpStateListen) // not a udp state
+	sockets, err = parseProcNet(strings.NewReader(data), "udp6")
+	if err != nil {
+		t.Errorf("could not parseProcNet: %+v", err)
+		return
+	}
+	expected = []socket{
+		{protocol: "udp6", address: "::", port: 53},
+		{protocol: "udp6", address: "fe80::1", port: 5353},
+	}
+	if len(sockets) != len(expected) {
+		t.Errorf("expected %d sockets, got %d", len(expected), len(sockets))
+		return
+	}
+	for i, s := range sockets {
+		if *s != expected[i] {
+			t.Errorf("socket %d: expected %+v, got %+v", i, expected[i], *s)
+		}
+	}
+
+	if _, err := parseProcNet(strings.NewReader(header+"   0: XYZ:0016 00000000:0000 0A\n"), "tcp"); err == nil {
+		t.Errorf("expected an error for an invalid address")
+	}
+}
+
+func TestSortSockets(t *testing.T) {
+	sockets := []*socket{
+		{protocol: "udp", address: "0.0.0.0", port: 53},
+		{protocol: "tcp", address: "0.0.0.0", port: 80},
+		{protocol: "tcp", address: "0.0.0.0", port: 22},
+		{protocol: "tcp", address: "0.0.0.0", port: 80}, // SO_REUSEPORT
+	}
+	out := sortSockets(sockets)
+	expected := []socket{
+		{protocol: "tcp", address: "0.0.0.0", port: 22},
+		{protocol: "tcp", address: "0.0.0.0", port: 80},
+		{protocol: "udp", address: "0.0.0.0", port: 53},
+	}
+	if len(out) != len(expected) {
+		t.Errorf("expected %d sockets, got %d", len(expected), len(out))
+		return
+	}
+	for i, s := range out {
+		if *s != expected[i] {
+			t.Errorf("socket %d: expected %+v, got %+v", i, expected[i], *s)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corenet
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+const (
+	// LookupHostFuncName is the name this function is registered as.
+	LookupHostFuncName = "lookup_host"
+
+	// LookupSRVFuncName is the name this function is registered as.
+	LookupSRVFuncName = "lookup_srv"
+
+	// LookupTXTFuncName is the name this function is registered as.
+	LookupTXTFuncName = "lookup_txt"
+
+	// arg names...
+	lookupArgNameName = "name"
+
+	srvSignature = "struct{target str; port int; priority int; weight int}"
+
+	// LookupMinRefresh is the shortest time we wait before we look up a
+	// name again, so that a tiny TTL can't make us spin.
+	LookupMinRefresh = 5 * time.Second
+
+	// LookupMaxRefresh is the longest time we wait before we look up a name
+	// again, even if the TTL is longer.
+	LookupMaxRefresh = 1 * time.Hour
+
+	// LookupErrorRefresh is how long we wait before we try again after a
+	// lookup failed.
+	LookupErrorRefresh = 30 * time.Second
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, LookupHostFuncName, func() interfaces.Func {
+		return &LookupFunc{name: LookupHostFuncName}
+	})
+	funcs.ModuleRegister(ModuleName, LookupSRVFuncName, func() interfaces.Func {
+		return &LookupFunc{name: LookupSRVFuncName}
+	})
+	funcs.ModuleRegister(ModuleName, LookupTXTFuncName, func() interfaces.Func {
+		return &LookupFunc{name: LookupTXTFuncName}
+	})
+}
+
+// LookupFunc looks up a name in DNS, and then looks it up again when the TTL of
+// the answer runs out, so that it streams a new value whenever the records
+// change. The lookup_host variant returns the sorted IPv4 and IPv6 addresses,
+// the lookup_srv variant returns the SRV records in order of priority and then
+// weight, and the lookup_txt variant returns the sorted TXT records. A name
+// with no records gives an empty list. If the lookup fails, then it errors, and
+// it will try again later. The names are always absolute, so search domains in
+// the resolver config are not used. The lookup_host variant checks /etc/hosts
+// before it asks DNS, but any other sources of names in nsswitch.conf, such as
+// mdns or ldap, are not used, so a name which only exists there gives an empty
+// list. An IP address given to lookup_host is returned as is. The TTL is kept
+// between LookupMinRefresh and LookupMaxRefresh.
+type LookupFunc struct {
+	interfaces.Textarea
+
+	name string // which lookup we do
+
+	init *interfaces.Init
+
+	input chan time.Duration // when to refresh
+}
+
+// String returns a simple name for this function.
+func (obj *LookupFunc) String() string {
+	return obj.name
+}
+
+// ArgGen returns the Nth argument name for this function.
+func (obj *LookupFunc) ArgGen(index int) (string, error) {
+	seq := []string{lookupArgNameName}
+	if l := len(seq); index >= l {
+		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
+	}
+	return seq[index], nil
+}
+
+// Validate makes sure the function was built correctly.
+func (obj *LookupFunc) Validate() error {
+	switch obj.name {
+	case LookupHostFuncName, LookupSRVFuncName, LookupTXTFuncName:
+		return nil
+	}
+	return fmt.Errorf("unknown lookup: %s", obj.name)
+}
+
+// Info returns static information about this function.
+func (obj *LookupFunc) Info() *interfaces.Info {
+	var sig *types.Type
+	if obj.name == LookupSRVFuncName {
+		sig = types.NewType(fmt.Sprintf("func(%s str) []%s", lookupArgNameName, srvSignature))
+	} else {
+		sig = types.NewType(fmt.Sprintf("func(%s str) []str", lookupArgNameName))
+	}
+	return &interfaces.Info{
+		Pure: false, // the records can change
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  sig,
+	}
+}
+
+// Init initializes this function.
+func (obj *LookupFunc) Init(init *interfaces.Init) error {
+	obj.init = init
+	obj.input = make(chan time.Duration)
+	return nil
+}
+
+// Stream waits for each lookup to tell it when the answer expires, and then it
+// sends an event at that time so that Call looks it up again.
+func (obj *LookupFunc) Stream(ctx context.Context) error {
+	//defer close(obj.input)  // if we close, this is a race with the sender
+	timer := time.NewTimer(LookupMaxRefresh)
+	timer.Stop() // wait for the first lookup to start it
+	defer timer.Stop()
+
+	for {
+		select {
+		case d, ok := <-obj.input:
+			if !ok {
+				obj.input = nil // don't infinite loop back
+				return fmt.Errorf("unexpected close")
+			}
+			if d < LookupMinRefresh {
+				d = LookupMinRefresh
+			}
+			if d > LookupMaxRefresh {
+				d = LookupMaxRefresh
+			}
+			if obj.init.Debug {
+				obj.init.Logf("refreshing in: %s", d)
+			}
+			timer.Reset(d) // any old timer was stopped or has fired
+			continue
+
+		case <-timer.C:
+			// the answer expired
+
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Call looks up the name, and then tells Stream when to look it up again.
+func (obj *LookupFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	name := args[0].Str()
+
+	// Check before we send to a chan where we'd need Stream to be running.
+	if obj.init == nil {
+		return nil, funcs.ErrCantSpeculate
+	}
+
+	result, ttl, err := obj.lookup(ctx, name)
+	if err != nil {
+		ttl = LookupErrorRefresh
+	}
+
+	// Tell the Stream when to refresh... This doesn't block because Stream
+	// should always be ready to consume unless it's closing down... If it
+	// dies, then a ctx closure should come soon.
+	select {
+	case obj.input <- ttl:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	if err != nil {
+		return nil, interfaces.Sentinelf("lookup of %s failed: %v", name, err)
+	}
+	return result, nil
+}
+
+// lookup runs the lookup and builds the result.
+func (obj *LookupFunc) lookup(ctx context.Context, name string) (types.Value, time.Duration, error) {
+	switch obj.name {
+	case LookupHostFuncName:
+		addrs, ttl, err := DefaultResolver.LookupHost(ctx, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		return strList(addrs), ttl, nil
+
+	case LookupTXTFuncName:
+		records, ttl, err := DefaultResolver.LookupTXT(ctx, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		return strList(records), ttl, nil
+
+	case LookupSRVFuncName:
+		records, ttl, err := DefaultResolver.LookupSRV(ctx, name)
+		if err != nil {
+			return nil, 0, err
+		}
+		typ := types.NewType(srvSignature)
+		values := []types.Value{}
+		for _, x := range records {
+			st := types.NewStruct(typ)
+			fields := map[string]types.Value{
+				"target":   &types.StrValue{V: x.Target},
+				"port":     &types.IntValue{V: int64(x.Port)},
+				"priority": &types.IntValue{V: int64(x.Priority)},
+				"weight":   &types.IntValue{V: int64(x.Weight)},
+			}
+			for k, v := range fields {
+				if err := st.Set(k, v); err != nil {
+					return nil, 0, err
+				}
+			}
+			values = append(values, st)
+		}
+		return &types.ListValue{
+			T: types.NewType(fmt.Sprintf("[]%s", srvSignature)),
+			V: values,
+		}, ttl, nil
+	}
+	return nil, 0, fmt.Errorf("unknown lookup: %s", obj.name) // programming error
+}
+
+// Cleanup runs after that function was removed from the graph.
+func (obj *LookupFunc) Cleanup(ctx context.Context) error {
+	// Even if the name stops changing, we never shutdown Stream because the
+	// records may change.
+	return nil
+}
+
+// Done is a message from the engine to tell us that no more Call's are coming.
+func (obj *LookupFunc) Done() error {
+	close(obj.input) // At this point we know obj.input won't be used.
+	return nil
+}
+
+// strList builds a list value from a list of strings.
+func strList(l []string) types.Value {
+	values := []types.Value{}
+	for _, x := range l {
+		values = append(values, &types.StrValue{V: x})
+	}
+	return &types.ListValue{
+		T: types.TypeListStr,
+		V: values,
+	}
+}
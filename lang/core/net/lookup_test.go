@@ -0,0 +1,109 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package corenet
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestLookupFunc(t *testing.T) {
+	server := &testDNSServer{
+		records: map[dnsmessage.Question][]dnsmessage.Resource{
+			testQuestion("www.example.", dnsmessage.TypeA): {
+				testResource("www.example.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}}),
+			},
+		},
+	}
+	defer func(r Resolver) { DefaultResolver = r }(DefaultResolver)
+	DefaultResolver = &DNSResolver{
+		Servers: []string{server.start(t)},
+		Timeout: 2 * time.Second,
+	}
+
+	obj := &LookupFunc{name: LookupHostFuncName}
+	if err := obj.Validate(); err != nil {
+		t.Errorf("could not validate: %+v", err)
+		return
+	}
+	args := []types.Value{&types.StrValue{V: "www.example"}}
+	if _, err := obj.Call(context.Background(), args); !errors.Is(err, funcs.ErrCantSpeculate) {
+		t.Errorf("expected a speculation error, got: %v", err)
+	}
+
+	if err := obj.Init(&interfaces.Init{
+		Event: func(ctx context.Context) error { return nil },
+		Logf:  t.Logf,
+	}); err != nil {
+		t.Errorf("could not init: %+v", err)
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	defer cancel()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := obj.Stream(ctx); err != nil {
+			t.Errorf("stream errored: %+v", err)
+		}
+	}()
+
+	result, err := obj.Call(ctx, args)
+	if err != nil {
+		t.Errorf("could not call: %+v", err)
+		return
+	}
+	if s, exp := result.String(), `["192.0.2.10"]`; s != exp {
+		t.Errorf("expected %s, got %s", exp, s)
+	}
+
+	// a name with no records is an empty list, and not an error
+	result, err = obj.Call(ctx, []types.Value{&types.StrValue{V: "nope.example"}})
+	if err != nil {
+		t.Errorf("could not call: %+v", err)
+		return
+	}
+	if s, exp := result.String(), `[]`; s != exp {
+		t.Errorf("expected %s, got %s", exp, s)
+	}
+}
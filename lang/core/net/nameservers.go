@@ -0,0 +1,184 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corenet
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/recwatch"
+)
+
+const (
+	// NameserversFuncName is the name this function is registered as.
+	NameserversFuncName = "nameservers"
+
+	resolvConfPath = "/etc/resolv.conf"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, NameserversFuncName, func() interfaces.Func {
+		return &NameserversFunc{}
+	})
+}
+
+// NameserversFunc returns the nameservers from the resolver config and streams
+// events when that file changes.
+type NameserversFunc struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this function.
+func (obj *NameserversFunc) String() string {
+	return NameserversFuncName
+}
+
+// Validate makes sure the function was built correctly.
+func (obj *NameserversFunc) Validate() error {
+	return nil
+}
+
+// Info returns static information about this function.
+func (obj *NameserversFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false,
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType("func() []str"),
+	}
+}
+
+// Init initializes this function.
+func (obj *NameserversFunc) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream emits an initial event and then an event whenever the resolver config
+// changes.
+func (obj *NameserversFunc) Stream(ctx context.Context) error {
+	recurse := false // single file
+	recWatcher, err := recwatch.NewRecWatcher(resolvConfPath, recurse)
+	if err != nil {
+		return err
+	}
+	defer recWatcher.Close()
+
+	// streams must generate an initial event on startup
+	startChan := make(chan struct{}) // start signal
+	close(startChan)                 // kick it off!
+
+	for {
+		select {
+		case <-startChan:
+			startChan = nil // disable
+
+		case event, ok := <-recWatcher.Events():
+			if !ok { // channel shutdown
+				return fmt.Errorf("unexpected close")
+			}
+			if event == nil {
+				// programming error
+				return fmt.Errorf("unexpected nil recwatch event")
+			}
+			if err := event.Error; err != nil {
+				return err
+			}
+
+		case <-ctx.Done(): // closed by the engine to signal shutdown
+			return nil
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Call returns the current nameservers.
+func (obj *NameserversFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	return Nameservers(ctx, args)
+}
+
+// Nameservers returns the list of nameserver addresses from /etc/resolv.conf in
+// the order that the resolver tries them. If the file doesn't exist, then the
+// list is empty.
+func Nameservers(ctx context.Context, input []types.Value) (types.Value, error) {
+	servers := []string{}
+	f, err := os.Open(resolvConfPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errwrap.Wrapf(err, "could not read resolver config")
+	}
+	if err == nil {
+		defer f.Close()
+		if servers, err = parseResolvConf(f); err != nil {
+			return nil, errwrap.Wrapf(err, "could not parse resolver config")
+		}
+	}
+
+	values := []types.Value{}
+	for _, x := range servers {
+		values = append(values, &types.StrValue{V: x})
+	}
+	return &types.ListValue{
+		T: types.TypeListStr,
+		V: values,
+	}, nil
+}
+
+// parseResolvConf returns the nameserver addresses from a resolv.conf file.
+// Comments start with a hash or a semicolon.
+func parseResolvConf(r io.Reader) ([]string, error) {
+	result := []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexAny(line, "#;"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		result = append(result, fields[1])
+	}
+	return result, scanner.Err()
+}
@@ -44,9 +44,23 @@ import (
 // network link or address changes. Subscriptions are established before the
 // initial event so a change cannot occur between the initial call and watch.
 func networkEventStream(ctx context.Context, event func(context.Context) error) error {
+	return netlinkEventStream(ctx, false, event)
+}
+
+// routeEventStream is like networkEventStream, but it also emits an event
+// whenever a route changes.
+func routeEventStream(ctx context.Context, event func(context.Context) error) error {
+	return netlinkEventStream(ctx, true, event)
+}
+
+// netlinkEventStream implements networkEventStream and routeEventStream. The
+// route subscription is only made if it's requested, since the route table can
+// be busy on some machines.
+func netlinkEventStream(ctx context.Context, routes bool, event func(context.Context) error) error {
 	done := make(chan struct{})
 	linkEvents := make(chan netlink.LinkUpdate)
 	addrEvents := make(chan netlink.AddrUpdate)
+	var routeEvents chan netlink.RouteUpdate // nil blocks forever
 	errors := make(chan error, 1)
 	errorCallback := func(err error) {
 		select {
@@ -72,9 +86,24 @@ func networkEventStream(ctx context.Context, event func(context.Context) error)
 		return errwrap.Wrapf(err, "could not subscribe to network address events")
 	}
 
+	if routes {
+		routeEvents = make(chan netlink.RouteUpdate)
+		routeOptions := netlink.RouteSubscribeOptions{
+			ErrorCallback: errorCallback,
+		}
+		if err := netlink.RouteSubscribeWithOptions(routeEvents, done, routeOptions); err != nil {
+			close(done)
+			for range linkEvents {
+			}
+			for range addrEvents {
+			}
+			return errwrap.Wrapf(err, "could not subscribe to network route events")
+		}
+	}
+
 	defer func() {
 		close(done)
-		for linkEvents != nil || addrEvents != nil {
+		for linkEvents != nil || addrEvents != nil || routeEvents != nil {
 			select {
 			case _, ok := <-linkEvents:
 				if !ok {
@@ -84,6 +113,10 @@ func networkEventStream(ctx context.Context, event func(context.Context) error)
 				if !ok {
 					addrEvents = nil
 				}
+			case _, ok := <-routeEvents:
+				if !ok {
+					routeEvents = nil
+				}
 			}
 		}
 	}()
@@ -104,6 +137,11 @@ func networkEventStream(ctx context.Context, event func(context.Context) error)
 				return networkEventSubscriptionClosed("address", errors)
 			}
 
+		case _, ok := <-routeEvents:
+			if !ok {
+				return networkEventSubscriptionClosed("route", errors)
+			}
+
 		case err := <-errors:
 			return errwrap.Wrapf(err, "network event subscription failed")
 
@@ -60,3 +60,8 @@ func networkEventStream(ctx context.Context, event func(context.Context) error)
 		}
 	}
 }
+
+// routeEventStream is like networkEventStream, and it polls in the same way.
+func routeEventStream(ctx context.Context, event func(context.Context) error) error {
+	return networkEventStream(ctx, event)
+}
@@ -0,0 +1,459 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corenet
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultDNSTimeout is how long we wait for each server to answer.
+	DefaultDNSTimeout = 5 * time.Second
+
+	// DefaultNegativeTTL is how long we remember that a name has no records,
+	// when the server doesn't tell us with an SOA record.
+	DefaultNegativeTTL = 60 * time.Second
+
+	// HostsTTL is how long an answer from the hosts file is used for. That
+	// file doesn't have TTL's, so we read it again after this much time.
+	HostsTTL = 60 * time.Second
+
+	hostsPath = "/etc/hosts"
+
+	// maxUDPSize is the largest udp response we accept. We don't do EDNS,
+	// so anything bigger gets truncated and then we retry over tcp.
+	maxUDPSize = 512
+)
+
+// DefaultResolver is the resolver that the lookup functions use. Tests can
+// replace it to point the functions at a local DNS stand-in.
+var DefaultResolver Resolver = &DNSResolver{}
+
+// SRV is a single SRV record.
+type SRV struct {
+	Target   string
+	Port     int
+	Priority int
+	Weight   int
+}
+
+// Resolver looks up DNS records. Each method also returns how long the answer
+// can be cached for, which is the smallest TTL of the records that it used. An
+// answer with no records is not an error.
+type Resolver interface {
+	// LookupHost returns the sorted IPv4 and IPv6 addresses of a host.
+	LookupHost(ctx context.Context, name string) ([]string, time.Duration, error)
+
+	// LookupSRV returns the SRV records of a name, such as
+	// _http._tcp.example.com, in order of priority and then weight.
+	LookupSRV(ctx context.Context, name string) ([]*SRV, time.Duration, error)
+
+	// LookupTXT returns the sorted TXT records of a name. The strings in
+	// each record are joined together.
+	LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error)
+}
+
+// DNSResolver is a simple stub resolver which asks the nameservers directly, so
+// that it can see the TTL of each answer, which the golang resolver hides. It
+// doesn't use the search domains, so names are always treated as absolute. Like
+// the system resolver with the common `hosts: files dns` config, host lookups
+// check the hosts file first. Other sources of names from nsswitch.conf, such as
+// mdns or ldap, are not used.
+type DNSResolver struct {
+	// Servers is the list of host:port addresses of the nameservers to ask,
+	// in order. If it's empty, then the ones in /etc/resolv.conf are used.
+	Servers []string
+
+	// Hosts is the path to the hosts file. If it's empty, then /etc/hosts
+	// is used.
+	Hosts string
+
+	// Timeout is how long to wait for each server. If it's zero, then we
+	// use DefaultDNSTimeout.
+	Timeout time.Duration
+}
+
+// LookupHost returns the sorted IPv4 and IPv6 addresses of a host. If the host
+// is in the hosts file, then only those addresses are returned, and DNS is not
+// asked. Like with net.LookupHost, an IP address is returned as is.
+func (obj *DNSResolver) LookupHost(ctx context.Context, name string) ([]string, time.Duration, error) {
+	if net.ParseIP(name) != nil {
+		return []string{name}, HostsTTL, nil
+	}
+
+	hosts, err := obj.lookupHosts(name)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(hosts) > 0 {
+		sort.Strings(hosts)
+		return hosts, HostsTTL, nil
+	}
+
+	result := []string{}
+	var ttl time.Duration
+	for _, typ := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, t, err := obj.query(ctx, name, typ)
+		if err != nil {
+			return nil, 0, err
+		}
+		for _, x := range answers {
+			switch body := x.Body.(type) {
+			case *dnsmessage.AResource:
+				result = append(result, net.IP(body.A[:]).String())
+			case *dnsmessage.AAAAResource:
+				result = append(result, net.IP(body.AAAA[:]).String())
+			}
+		}
+		ttl = minTTL(ttl, t)
+	}
+	sort.Strings(result)
+	return result, ttl, nil
+}
+
+// LookupSRV returns the SRV records of a name, in order of priority and then
+// weight, with the highest weight first.
+func (obj *DNSResolver) LookupSRV(ctx context.Context, name string) ([]*SRV, time.Duration, error) {
+	answers, ttl, err := obj.query(ctx, name, dnsmessage.TypeSRV)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := []*SRV{}
+	for _, x := range answers {
+		body, ok := x.Body.(*dnsmessage.SRVResource)
+		if !ok {
+			continue
+		}
+		result = append(result, &SRV{
+			Target:   strings.TrimSuffix(body.Target.String(), "."),
+			Port:     int(body.Port),
+			Priority: int(body.Priority),
+			Weight:   int(body.Weight),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.Priority != b.Priority {
+			return a.Priority < b.Priority
+		}
+		if a.Weight != b.Weight {
+			return a.Weight > b.Weight
+		}
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		return a.Port < b.Port
+	})
+	return result, ttl, nil
+}
+
+// LookupTXT returns the sorted TXT records of a name.
+func (obj *DNSResolver) LookupTXT(ctx context.Context, name string) ([]string, time.Duration, error) {
+	answers, ttl, err := obj.query(ctx, name, dnsmessage.TypeTXT)
+	if err != nil {
+		return nil, 0, err
+	}
+	result := []string{}
+	for _, x := range answers {
+		if body, ok := x.Body.(*dnsmessage.TXTResource); ok {
+			result = append(result, strings.Join(body.TXT, ""))
+		}
+	}
+	sort.Strings(result)
+	return result, ttl, nil
+}
+
+// lookupHosts returns the addresses of a host from the hosts file. A missing
+// hosts file is the same as an empty one.
+func (obj *DNSResolver) lookupHosts(name string) ([]string, error) {
+	p := obj.Hosts
+	if p == "" {
+		p = hostsPath
+	}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not read hosts file")
+	}
+	defer f.Close()
+	result, err := parseHosts(f, name)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse hosts file")
+	}
+	return result, nil
+}
+
+// parseHosts returns the unique addresses which the hosts file data has for the
+// name. Names are matched without case, and a trailing dot is ignored.
+func parseHosts(r io.Reader, name string) ([]string, error) {
+	name = strings.TrimSuffix(name, ".")
+	result := []string{}
+	found := make(map[string]struct{})
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		addr, _, _ := strings.Cut(fields[0], "%") // drop any ipv6 zone
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+		for _, x := range fields[1:] {
+			if !strings.EqualFold(strings.TrimSuffix(x, "."), name) {
+				continue
+			}
+			if _, exists := found[ip.String()]; !exists {
+				found[ip.String()] = struct{}{}
+				result = append(result, ip.String())
+			}
+			break
+		}
+	}
+	return result, scanner.Err()
+}
+
+// servers returns the list of servers to ask.
+func (obj *DNSResolver) servers() ([]string, error) {
+	if len(obj.Servers) > 0 {
+		return obj.Servers, nil
+	}
+	f, err := os.Open(resolvConfPath)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not read resolver config")
+	}
+	defer f.Close()
+	servers, err := parseResolvConf(f)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse resolver config")
+	}
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("no nameservers found in %s", resolvConfPath)
+	}
+	result := []string{}
+	for _, x := range servers {
+		result = append(result, net.JoinHostPort(x, "53"))
+	}
+	return result, nil
+}
+
+// query asks each server in turn for the records of this type, until one of
+// them gives us an answer. It returns the matching records and the smallest
+// TTL of them, or the negative caching TTL if there aren't any. CNAME records
+// are expected to be followed by the server, but their TTL is included too.
+func (obj *DNSResolver) query(ctx context.Context, name string, typ dnsmessage.Type) ([]dnsmessage.Resource, time.Duration, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	qname, err := dnsmessage.NewName(name)
+	if err != nil {
+		return nil, 0, errwrap.Wrapf(err, "invalid name: %s", name)
+	}
+	question := dnsmessage.Question{
+		Name:  qname,
+		Type:  typ,
+		Class: dnsmessage.ClassINET,
+	}
+
+	servers, err := obj.servers()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var errs error
+	for _, server := range servers {
+		msg, err := obj.exchange(ctx, server, question)
+		if err != nil {
+			errs = errwrap.Append(errs, errwrap.Wrapf(err, "server %s failed", server))
+			continue
+		}
+
+		switch msg.RCode {
+		case dnsmessage.RCodeSuccess, dnsmessage.RCodeNameError:
+		default:
+			errs = errwrap.Append(errs, fmt.Errorf("server %s failed with: %s", server, msg.RCode))
+			continue
+		}
+
+		answers := []dnsmessage.Resource{}
+		var ttl time.Duration
+		for _, x := range msg.Answers {
+			if x.Header.Class != dnsmessage.ClassINET {
+				continue
+			}
+			if x.Header.Type != typ && x.Header.Type != dnsmessage.TypeCNAME {
+				continue
+			}
+			ttl = minTTL(ttl, time.Duration(x.Header.TTL)*time.Second)
+			if x.Header.Type == typ {
+				answers = append(answers, x)
+			}
+		}
+		if len(answers) > 0 {
+			return answers, ttl, nil
+		}
+
+		// Negative caching uses the smaller of the SOA record's TTL and
+		// its minimum field. (RFC 2308)
+		ttl = DefaultNegativeTTL
+		for _, x := range msg.Authorities {
+			if body, ok := x.Body.(*dnsmessage.SOAResource); ok {
+				ttl = time.Duration(min(x.Header.TTL, body.MinTTL)) * time.Second
+				break
+			}
+		}
+		return answers, ttl, nil
+	}
+	return nil, 0, errs
+}
+
+// exchange sends the question to the server and returns the response. It uses
+// udp first, and then retries over tcp if the response was truncated.
+func (obj *DNSResolver) exchange(ctx context.Context, server string, question dnsmessage.Question) (*dnsmessage.Message, error) {
+	timeout := obj.Timeout
+	if timeout == 0 {
+		timeout = DefaultDNSTimeout
+	}
+
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	query := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               binary.BigEndian.Uint16(b[:]),
+			RecursionDesired: true,
+		},
+		Questions: []dnsmessage.Question{question},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not build query")
+	}
+
+	for _, network := range []string{"udp", "tcp"} {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		msg, err := exchangeOnce(ctx, network, server, packed)
+		cancel()
+		if err != nil {
+			return nil, err
+		}
+		if msg.ID != query.ID || !msg.Response {
+			return nil, fmt.Errorf("invalid response")
+		}
+		if len(msg.Questions) != 1 || msg.Questions[0] != question {
+			return nil, fmt.Errorf("response is for the wrong question")
+		}
+		if msg.Truncated && network == "udp" {
+			continue // retry with tcp
+		}
+		return msg, nil
+	}
+	return nil, fmt.Errorf("response was truncated") // programming error
+}
+
+// exchangeOnce sends the packed query to the server over this network and then
+// unpacks the response. Over tcp, each message has a two byte length prefix.
+func exchangeOnce(ctx context.Context, network, server string, packed []byte) (*dnsmessage.Message, error) {
+	d := &net.Dialer{}
+	conn, err := d.DialContext(ctx, network, server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf []byte
+	if network == "udp" {
+		if _, err := conn.Write(packed); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, maxUDPSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		buf = buf[:n]
+	} else {
+		prefixed := make([]byte, 2+len(packed))
+		binary.BigEndian.PutUint16(prefixed, uint16(len(packed))) //nolint:gosec // G115: a dns message is always less than 64k
+		copy(prefixed[2:], packed)
+		if _, err := conn.Write(prefixed); err != nil {
+			return nil, err
+		}
+		var l [2]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return nil, err
+		}
+		buf = make([]byte, binary.BigEndian.Uint16(l[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil, err
+		}
+	}
+
+	msg := &dnsmessage.Message{}
+	if err := msg.Unpack(buf); err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse response")
+	}
+	return msg, nil
+}
+
+// minTTL returns the smaller of the two TTL's, where zero means unset.
+func minTTL(a, b time.Duration) time.Duration {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,395 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package corenet
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// testDNSServer is a local DNS stand-in which answers from a fixed set of
+// records, over both udp and tcp on the same port.
+type testDNSServer struct {
+	// records are the answers for each name and type.
+	records map[dnsmessage.Question][]dnsmessage.Resource
+
+	// truncate are the names whose udp responses are truncated.
+	truncate map[string]bool
+
+	// rcode is sent back instead of any answers, if it's set.
+	rcode dnsmessage.RCode
+
+	udp *net.UDPConn
+	tcp *net.TCPListener
+	wg  *sync.WaitGroup
+}
+
+// start runs the server on a random local port and returns its address.
+func (obj *testDNSServer) start(t *testing.T) string {
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("could not listen: %+v", err)
+	}
+	port := udp.LocalAddr().(*net.UDPAddr).Port
+	tcp, err := net.ListenTCP("tcp", &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: port})
+	if err != nil {
+		udp.Close()
+		t.Skipf("could not listen on the same tcp port: %+v", err)
+	}
+	obj.udp, obj.tcp = udp, tcp
+	obj.wg = &sync.WaitGroup{}
+
+	obj.wg.Add(2)
+	go func() {
+		defer obj.wg.Done()
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := udp.ReadFromUDP(buf)
+			if err != nil {
+				return // closed
+			}
+			if b := obj.respond(buf[:n], true); b != nil {
+				_, _ = udp.WriteToUDP(b, addr)
+			}
+		}
+	}()
+	go func() {
+		defer obj.wg.Done()
+		for {
+			conn, err := tcp.Accept()
+			if err != nil {
+				return // closed
+			}
+			var l [2]byte
+			if _, err := io.ReadFull(conn, l[:]); err == nil {
+				buf := make([]byte, binary.BigEndian.Uint16(l[:]))
+				if _, err := io.ReadFull(conn, buf); err == nil {
+					if b := obj.respond(buf, false); b != nil {
+						binary.BigEndian.PutUint16(l[:], uint16(len(b))) //nolint:gosec // G115: a dns message is always less than 64k
+						_, _ = conn.Write(append(l[:], b...))
+					}
+				}
+			}
+			conn.Close()
+		}
+	}()
+
+	t.Cleanup(obj.stop)
+	return udp.LocalAddr().String()
+}
+
+// stop shuts down the server.
+func (obj *testDNSServer) stop() {
+	obj.udp.Close()
+	obj.tcp.Close()
+	obj.wg.Wait()
+}
+
+// respond builds the response to a packed query.
+func (obj *testDNSServer) respond(b []byte, udp bool) []byte {
+	query := &dnsmessage.Message{}
+	if err := query.Unpack(b); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	q := query.Questions[0]
+	msg := &dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:       query.ID,
+			Response: true,
+			RCode:    obj.rcode,
+		},
+		Questions: query.Questions,
+	}
+	if obj.rcode == dnsmessage.RCodeSuccess {
+		if udp && obj.truncate[q.Name.String()] {
+			msg.Truncated = true
+		} else {
+			msg.Answers = obj.records[q]
+		}
+		if len(msg.Answers) == 0 && !msg.Truncated {
+			msg.RCode = dnsmessage.RCodeNameError
+			msg.Authorities = []dnsmessage.Resource{{
+				Header: dnsmessage.ResourceHeader{
+					Name:  dnsmessage.MustNewName("example."),
+					Type:  dnsmessage.TypeSOA,
+					Class: dnsmessage.ClassINET,
+					TTL:   600,
+				},
+				Body: &dnsmessage.SOAResource{
+					NS:     dnsmessage.MustNewName("ns.example."),
+					MBox:   dnsmessage.MustNewName("admin.example."),
+					MinTTL: 42,
+				},
+			}}
+		}
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil
+	}
+	return packed
+}
+
+// testResource builds an answer for a test record.
+func testResource(name string, ttl uint32, body dnsmessage.ResourceBody) dnsmessage.Resource {
+	var typ dnsmessage.Type
+	switch body.(type) {
+	case *dnsmessage.AResource:
+		typ = dnsmessage.TypeA
+	case *dnsmessage.AAAAResource:
+		typ = dnsmessage.TypeAAAA
+	case *dnsmessage.SRVResource:
+		typ = dnsmessage.TypeSRV
+	case *dnsmessage.TXTResource:
+		typ = dnsmessage.TypeTXT
+	}
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{
+			Name:  dnsmessage.MustNewName(name),
+			Type:  typ,
+			Class: dnsmessage.ClassINET,
+			TTL:   ttl,
+		},
+		Body: body,
+	}
+}
+
+// testQuestion builds the question that a record answers.
+func testQuestion(name string, typ dnsmessage.Type) dnsmessage.Question {
+	return dnsmessage.Question{
+		Name:  dnsmessage.MustNewName(name),
+		Type:  typ,
+		Class: dnsmessage.ClassINET,
+	}
+}
+
+func TestDNSResolver(t *testing.T) {
+	server := &testDNSServer{
+		records: map[dnsmessage.Question][]dnsmessage.Resource{
+			testQuestion("www.example.", dnsmessage.TypeA): {
+				testResource("www.example.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 20}}),
+				testResource("www.example.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}}),
+			},
+			testQuestion("www.example.", dnsmessage.TypeAAAA): {
+				testResource("www.example.", 120, &dnsmessage.AAAAResource{AAAA: [16]byte{0x20, 0x01, 0x0d, 0xb8, 15: 1}}),
+			},
+			testQuestion("_http._tcp.example.", dnsmessage.TypeSRV): {
+				testResource("_http._tcp.example.", 60, &dnsmessage.SRVResource{Priority: 20, Weight: 5, Port: 80, Target: dnsmessage.MustNewName("c.example.")}),
+				testResource("_http._tcp.example.", 60, &dnsmessage.SRVResource{Priority: 10, Weight: 5, Port: 8080, Target: dnsmessage.MustNewName("b.example.")}),
+				testResource("_http._tcp.example.", 30, &dnsmessage.SRVResource{Priority: 10, Weight: 50, Port: 8080, Target: dnsmessage.MustNewName("a.example.")}),
+			},
+			testQuestion("big.example.", dnsmessage.TypeTXT): {
+				testResource("big.example.", 3600, &dnsmessage.TXTResource{TXT: []string{"v=spf1 ", "-all"}}),
+				testResource("big.example.", 3600, &dnsmessage.TXTResource{TXT: []string{"hello"}}),
+			},
+		},
+		truncate: map[string]bool{
+			"big.example.": true,
+		},
+	}
+	addr := server.start(t)
+	hosts := filepath.Join(t.TempDir(), "hosts")
+	if err := os.WriteFile(hosts, []byte("192.0.2.99 db.example\n"), 0644); err != nil {
+		t.Errorf("could not write hosts file: %+v", err)
+		return
+	}
+	resolver := &DNSResolver{
+		Servers: []string{addr},
+		Hosts:   hosts,
+		Timeout: 2 * time.Second,
+	}
+	ctx := context.Background()
+
+	t.Run("host", func(t *testing.T) {
+		addrs, ttl, err := resolver.LookupHost(ctx, "www.example")
+		if err != nil {
+			t.Errorf("could not lookup: %+v", err)
+			return
+		}
+		if exp := []string{"192.0.2.10", "192.0.2.20", "2001:db8::1"}; !reflect.DeepEqual(addrs, exp) {
+			t.Errorf("expected %v, got %v", exp, addrs)
+		}
+		if exp := 120 * time.Second; ttl != exp {
+			t.Errorf("expected ttl %s, got %s", exp, ttl)
+		}
+	})
+
+	t.Run("hosts file", func(t *testing.T) {
+		addrs, ttl, err := resolver.LookupHost(ctx, "db.example.")
+		if err != nil {
+			t.Errorf("could not lookup: %+v", err)
+			return
+		}
+		if exp := []string{"192.0.2.99"}; !reflect.DeepEqual(addrs, exp) {
+			t.Errorf("expected %v, got %v", exp, addrs)
+		}
+		if ttl != HostsTTL {
+			t.Errorf("expected ttl %s, got %s", HostsTTL, ttl)
+		}
+	})
+
+	t.Run("ip", func(t *testing.T) {
+		for _, ip := range []string{"10.0.0.1", "2001:db8::1"} {
+			addrs, ttl, err := resolver.LookupHost(ctx, ip)
+			if err != nil {
+				t.Errorf("could not lookup: %+v", err)
+				continue
+			}
+			if exp := []string{ip}; !reflect.DeepEqual(addrs, exp) {
+				t.Errorf("expected %v, got %v", exp, addrs)
+			}
+			if ttl != HostsTTL {
+				t.Errorf("expected ttl %s, got %s", HostsTTL, ttl)
+			}
+		}
+	})
+
+	t.Run("srv", func(t *testing.T) {
+		records, ttl, err := resolver.LookupSRV(ctx, "_http._tcp.example.")
+		if err != nil {
+			t.Errorf("could not lookup: %+v", err)
+			return
+		}
+		targets := []string{}
+		for _, x := range records {
+			targets = append(targets, x.Target)
+		}
+		if exp := []string{"a.example", "b.example", "c.example"}; !reflect.DeepEqual(targets, exp) {
+			t.Errorf("expected %v, got %v", exp, targets)
+		}
+		if exp := (&SRV{Target: "a.example", Port: 8080, Priority: 10, Weight: 50}); !reflect.DeepEqual(records[0], exp) {
+			t.Errorf("expected %+v, got %+v", exp, records[0])
+		}
+		if exp := 30 * time.Second; ttl != exp {
+			t.Errorf("expected ttl %s, got %s", exp, ttl)
+		}
+	})
+
+	t.Run("txt over tcp", func(t *testing.T) {
+		records, ttl, err := resolver.LookupTXT(ctx, "big.example")
+		if err != nil {
+			t.Errorf("could not lookup: %+v", err)
+			return
+		}
+		if exp := []string{"hello", "v=spf1 -all"}; !reflect.DeepEqual(records, exp) {
+			t.Errorf("expected %v, got %v", exp, records)
+		}
+		if exp := time.Hour; ttl != exp {
+			t.Errorf("expected ttl %s, got %s", exp, ttl)
+		}
+	})
+
+	t.Run("nxdomain", func(t *testing.T) {
+		records, ttl, err := resolver.LookupTXT(ctx, "nope.example")
+		if err != nil {
+			t.Errorf("could not lookup: %+v", err)
+			return
+		}
+		if len(records) != 0 {
+			t.Errorf("expected no records, got %v", records)
+		}
+		if exp := 42 * time.Second; ttl != exp { // from the SOA
+			t.Errorf("expected ttl %s, got %s", exp, ttl)
+		}
+	})
+}
+
+func TestDNSResolverFailover(t *testing.T) {
+	broken := &testDNSServer{
+		rcode: dnsmessage.RCodeServerFailure,
+	}
+	working := &testDNSServer{
+		records: map[dnsmessage.Question][]dnsmessage.Resource{
+			testQuestion("www.example.", dnsmessage.TypeA): {
+				testResource("www.example.", 300, &dnsmessage.AResource{A: [4]byte{192, 0, 2, 10}}),
+			},
+		},
+	}
+	resolver := &DNSResolver{
+		Servers: []string{broken.start(t), working.start(t)},
+		Timeout: 2 * time.Second,
+	}
+	addrs, _, err := resolver.LookupHost(context.Background(), "www.example")
+	if err != nil {
+		t.Errorf("could not lookup: %+v", err)
+		return
+	}
+	if exp := []string{"192.0.2.10"}; !reflect.DeepEqual(addrs, exp) {
+		t.Errorf("expected %v, got %v", exp, addrs)
+	}
+
+	resolver.Servers = resolver.Servers[:1] // only the broken one
+	if _, _, err := resolver.LookupHost(context.Background(), "www.example"); err == nil || !strings.Contains(err.Error(), "ServerFailure") {
+		t.Errorf("expected a server failure, got: %v", err)
+	}
+}
+
+func TestParseHosts(t *testing.T) {
+	data := `# static names
+127.0.0.1	localhost localhost.localdomain
+::1		localhost ip6-localhost
+192.0.2.10	www.example www # the web server
+192.0.2.11	WWW.Example.
+fe80::1%eth0	www.example
+2001:db8::10	www.example
+192.0.2.10	www.example
+bogus		www.example
+192.0.2.12
+`
+	tests := map[string][]string{
+		"localhost":    {"127.0.0.1", "::1"},
+		"www.example.": {"192.0.2.10", "192.0.2.11", "fe80::1", "2001:db8::10"},
+		"www":          {"192.0.2.10"},
+		"nope.example": {},
+	}
+	for name, expected := range tests {
+		addrs, err := parseHosts(strings.NewReader(data), name)
+		if err != nil {
+			t.Errorf("name: %s, could not parseHosts: %+v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(addrs, expected) {
+			t.Errorf("name: %s, expected %v, got %v", name, expected, addrs)
+		}
+	}
+}
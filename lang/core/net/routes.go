@@ -0,0 +1,242 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package corenet
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// RoutesFuncName is the name this function is registered as.
+	RoutesFuncName = "routes"
+
+	// DefaultGatewayFuncName is the name this function is registered as.
+	DefaultGatewayFuncName = "default_gateway"
+
+	routeSignature = "struct{destination str; gateway str; interface str; metric int}"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, RoutesFuncName, func() interfaces.Func {
+		return &RoutesFunc{}
+	})
+	funcs.ModuleRegister(ModuleName, DefaultGatewayFuncName, func() interfaces.Func {
+		return &DefaultGatewayFunc{}
+	})
+}
+
+// route is a single entry from the main routing table.
+type route struct {
+	// destination is the network in CIDR notation. The default route uses
+	// 0.0.0.0/0 or ::/0.
+	destination string
+
+	// gateway is the next hop, or empty if the network is directly
+	// connected.
+	gateway string
+
+	// iface is the name of the outgoing interface.
+	iface string
+
+	// metric is the priority of the route, where lower numbers win.
+	metric int
+}
+
+// RoutesFunc returns the main routing table and streams events when network
+// links, addresses or routes change.
+type RoutesFunc struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this function.
+func (obj *RoutesFunc) String() string {
+	return RoutesFuncName
+}
+
+// Validate makes sure the function was built correctly.
+func (obj *RoutesFunc) Validate() error {
+	return nil
+}
+
+// Info returns static information about this function.
+func (obj *RoutesFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false,
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func() []%s", routeSignature)),
+	}
+}
+
+// Init initializes this function.
+func (obj *RoutesFunc) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream emits an initial event and subsequent network change events.
+func (obj *RoutesFunc) Stream(ctx context.Context) error {
+	return routeEventStream(ctx, obj.init.Event)
+}
+
+// Call returns the current routes.
+func (obj *RoutesFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	return Routes(ctx, args)
+}
+
+// Routes returns the IPv4 and IPv6 routes in the main routing table, sorted by
+// destination and then by metric. This is only supported on Linux.
+func Routes(ctx context.Context, input []types.Value) (types.Value, error) {
+	routes, err := routeList()
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not list routes")
+	}
+
+	typ := types.NewType(routeSignature)
+	values := []types.Value{}
+	for _, r := range routes {
+		st := types.NewStruct(typ)
+		fields := map[string]types.Value{
+			"destination": &types.StrValue{V: r.destination},
+			"gateway":     &types.StrValue{V: r.gateway},
+			"interface":   &types.StrValue{V: r.iface},
+			"metric":      &types.IntValue{V: int64(r.metric)},
+		}
+		for k, v := range fields {
+			if err := st.Set(k, v); err != nil {
+				return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+			}
+		}
+		values = append(values, st)
+	}
+
+	return &types.ListValue{
+		T: types.NewType(fmt.Sprintf("[]%s", routeSignature)),
+		V: values,
+	}, nil
+}
+
+// DefaultGatewayFunc returns the IPv4 default gateway and streams events when
+// network links, addresses or routes change.
+type DefaultGatewayFunc struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this function.
+func (obj *DefaultGatewayFunc) String() string {
+	return DefaultGatewayFuncName
+}
+
+// Validate makes sure the function was built correctly.
+func (obj *DefaultGatewayFunc) Validate() error {
+	return nil
+}
+
+// Info returns static information about this function.
+func (obj *DefaultGatewayFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false,
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType("func() str"),
+	}
+}
+
+// Init initializes this function.
+func (obj *DefaultGatewayFunc) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream emits an initial event and subsequent network change events.
+func (obj *DefaultGatewayFunc) Stream(ctx context.Context) error {
+	return routeEventStream(ctx, obj.init.Event)
+}
+
+// Call returns the current default gateway.
+func (obj *DefaultGatewayFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	return DefaultGateway(ctx, args)
+}
+
+// DefaultGateway returns the gateway of the IPv4 default route with the lowest
+// metric. If there is no such route, then it returns the empty string, so that
+// the value changes when one appears. This is only supported on Linux.
+func DefaultGateway(ctx context.Context, input []types.Value) (types.Value, error) {
+	routes, err := routeList()
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not list routes")
+	}
+
+	return &types.StrValue{
+		V: defaultGateway(routes),
+	}, nil
+}
+
+// defaultGateway returns the gateway of the IPv4 default route with the lowest
+// metric, or the empty string if there isn't one.
+func defaultGateway(routes []*route) string {
+	var best *route
+	for _, r := range routes {
+		if r.destination != "0.0.0.0/0" || r.gateway == "" {
+			continue
+		}
+		if best == nil || r.metric < best.metric {
+			best = r
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.gateway
+}
+
+// sortRoutes sorts the routes by destination and then by metric, so that the
+// output doesn't change when the kernel lists them in a different order.
+func sortRoutes(routes []*route) {
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].destination != routes[j].destination {
+			return routes[i].destination < routes[j].destination
+		}
+		return routes[i].metric < routes[j].metric
+	})
+}
@@ -0,0 +1,79 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build linux
+
+package corenet
+
+import (
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// routeList returns the routes in the main routing table, in a stable order.
+func routeList() ([]*route, error) {
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make(map[int]string) // cache of interface names by index
+	result := []*route{}
+	for _, r := range routes {
+		dst := r.Dst
+		if dst == nil { // the default route
+			dst = &net.IPNet{IP: net.IPv4zero, Mask: net.CIDRMask(0, 32)}
+			if r.Family == netlink.FAMILY_V6 {
+				dst = &net.IPNet{IP: net.IPv6zero, Mask: net.CIDRMask(0, 128)}
+			}
+		}
+
+		name, exists := names[r.LinkIndex]
+		if !exists && r.LinkIndex > 0 {
+			if iface, err := net.InterfaceByIndex(r.LinkIndex); err == nil {
+				name = iface.Name
+			}
+			names[r.LinkIndex] = name
+		}
+
+		gateway := ""
+		if r.Gw != nil {
+			gateway = r.Gw.String()
+		}
+		result = append(result, &route{
+			destination: dst.String(),
+			gateway:     gateway,
+			iface:       name,
+			metric:      r.Priority,
+		})
+	}
+	sortRoutes(result)
+	return result, nil
+}
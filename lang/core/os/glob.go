@@ -0,0 +1,158 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreos
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// GlobFuncName is the name this function is registered as.
+	GlobFuncName = "glob"
+
+	// arg names...
+	globArgNamePattern = "pattern"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, GlobFuncName, func() interfaces.Func { return &GlobFunc{} }) // must register the func and name
+}
+
+// GlobFunc is a function that returns the sorted list of paths which match the
+// shell pattern, using the same syntax as the golang filepath.Match function.
+// It watches the directory that the pattern is in, and it sends a new value
+// when the list of matches might have changed, so that you can build a graph
+// which adapts to any files that are dropped into a directory, such as with the
+// pattern /etc/foo.d/*.conf for example. Matching directories do not have a
+// trailing slash.
+type GlobFunc struct {
+	interfaces.Textarea
+
+	pathWatcher // watches the path and implements Stream
+}
+
+// String returns a simple name for this function. This is needed so this struct
+// can satisfy the pgraph.Vertex interface.
+func (obj *GlobFunc) String() string {
+	return GlobFuncName
+}
+
+// ArgGen returns the Nth arg name for this function.
+func (obj *GlobFunc) ArgGen(index int) (string, error) {
+	seq := []string{globArgNamePattern}
+	if l := len(seq); index >= l {
+		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
+	}
+	return seq[index], nil
+}
+
+// Validate makes sure we've built our struct properly. It is usually unused for
+// normal functions that users can use directly.
+func (obj *GlobFunc) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *GlobFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // the filesystem can change
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func(%s str) []str", globArgNamePattern)),
+	}
+}
+
+// Call this function with the input args and return the value if it is possible
+// to do so at this time.
+func (obj *GlobFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	pattern := args[0].Str()
+
+	if !filepath.IsAbs(pattern) {
+		return nil, fmt.Errorf("pattern must be absolute")
+	}
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, errwrap.Wrapf(err, "invalid pattern")
+	}
+
+	// Watch the longest directory prefix without any special chars. If the
+	// pattern has one in a directory part, then we need to watch deeper.
+	dir, rest := globBase(pattern)
+	if err := obj.watch(ctx, dir, strings.Contains(rest, "/")); err != nil {
+		return nil, err
+	}
+
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "glob failed")
+	}
+	sort.Strings(matches)
+
+	values := []types.Value{}
+	for _, x := range matches {
+		values = append(values, &types.StrValue{V: x})
+	}
+	return &types.ListValue{
+		T: types.NewType("[]str"),
+		V: values,
+	}, nil
+}
+
+// globBase splits the glob pattern into the longest directory prefix which has
+// no special chars, and the remaining part of the pattern.
+func globBase(pattern string) (string, string) {
+	dir := pattern
+	for {
+		d := filepath.Dir(dir)
+		if d == dir { // root
+			break
+		}
+		dir = d
+		if !strings.ContainsAny(dir, `*?[\`) {
+			break
+		}
+	}
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir, strings.TrimPrefix(pattern, dir)
+}
@@ -0,0 +1,136 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// LsFuncName is the name this function is registered as.
+	LsFuncName = "ls"
+
+	// arg names...
+	lsArgNamePath = "path"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, LsFuncName, func() interfaces.Func { return &LsFunc{} }) // must register the func and name
+}
+
+// LsFunc is a function that returns the sorted list of the names of the entries
+// in a directory. Directories have a trailing slash, like the rest of mgmt. It
+// watches the directory and sends a new value whenever the entries change. If
+// the directory does not exist, then the list is empty.
+type LsFunc struct {
+	interfaces.Textarea
+
+	pathWatcher // watches the path and implements Stream
+}
+
+// String returns a simple name for this function. This is needed so this struct
+// can satisfy the pgraph.Vertex interface.
+func (obj *LsFunc) String() string {
+	return LsFuncName
+}
+
+// ArgGen returns the Nth arg name for this function.
+func (obj *LsFunc) ArgGen(index int) (string, error) {
+	seq := []string{lsArgNamePath}
+	if l := len(seq); index >= l {
+		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
+	}
+	return seq[index], nil
+}
+
+// Validate makes sure we've built our struct properly. It is usually unused for
+// normal functions that users can use directly.
+func (obj *LsFunc) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *LsFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // the filesystem can change
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func(%s str) %s", lsArgNamePath, "[]str")),
+	}
+}
+
+// Call this function with the input args and return the value if it is possible
+// to do so at this time.
+func (obj *LsFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	dir := args[0].Str()
+
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("path must be absolute")
+	}
+	if err := obj.watch(ctx, dir, false); err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errwrap.Wrapf(err, "could not read dir")
+	}
+	names := []string{}
+	for _, x := range entries {
+		name := x.Name()
+		if x.IsDir() {
+			name += "/"
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	values := []types.Value{}
+	for _, x := range names {
+		values = append(values, &types.StrValue{V: x})
+	}
+	return &types.ListValue{
+		T: types.NewType("[]str"),
+		V: values,
+	}, nil
+}
@@ -0,0 +1,127 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// ReadlinkFuncName is the name this function is registered as.
+	ReadlinkFuncName = "readlink"
+
+	// arg names...
+	readlinkArgNamePath = "path"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, ReadlinkFuncName, func() interfaces.Func { return &ReadlinkFunc{} }) // must register the func and name
+}
+
+// ReadlinkFunc is a function that returns the destination of a symbolic link.
+// It watches the path and sends a new value whenever it changes. If the path
+// does not exist, or if it is not a symbolic link, then it returns the empty
+// string.
+type ReadlinkFunc struct {
+	interfaces.Textarea
+
+	pathWatcher // watches the path and implements Stream
+}
+
+// String returns a simple name for this function. This is needed so this struct
+// can satisfy the pgraph.Vertex interface.
+func (obj *ReadlinkFunc) String() string {
+	return ReadlinkFuncName
+}
+
+// ArgGen returns the Nth arg name for this function.
+func (obj *ReadlinkFunc) ArgGen(index int) (string, error) {
+	seq := []string{readlinkArgNamePath}
+	if l := len(seq); index >= l {
+		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
+	}
+	return seq[index], nil
+}
+
+// Validate makes sure we've built our struct properly. It is usually unused for
+// normal functions that users can use directly.
+func (obj *ReadlinkFunc) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *ReadlinkFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // the filesystem can change
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func(%s str) %s", readlinkArgNamePath, "str")),
+	}
+}
+
+// Call this function with the input args and return the value if it is possible
+// to do so at this time.
+func (obj *ReadlinkFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	path := args[0].Str()
+
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path must be absolute")
+	}
+	if err := obj.watch(ctx, path, false); err != nil {
+		return nil, err
+	}
+
+	var target string
+	fi, err := os.Lstat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errwrap.Wrapf(err, "could not stat path")
+	}
+	if err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if target, err = os.Readlink(path); err != nil {
+			return nil, errwrap.Wrapf(err, "could not read link")
+		}
+	}
+
+	return &types.StrValue{
+		V: target,
+	}, nil
+}
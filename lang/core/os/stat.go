@@ -0,0 +1,182 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreos
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// StatFuncName is the name this function is registered as.
+	StatFuncName = "stat"
+
+	// arg names...
+	statArgNamePath = "path"
+
+	// statType is the type of the returned struct.
+	statType = "struct{exists bool; is_dir bool; size int; mode str; owner str; group str; mtime int}"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, StatFuncName, func() interfaces.Func { return &StatFunc{} }) // must register the func and name
+}
+
+// StatFunc is a function that returns some information about a path. It watches
+// the path and sends a new value whenever it changes. If the path does not
+// exist, then the exists field is false, and the other fields are zero. The
+// mode is the octal string of the permission bits, eg: 0644, the owner and
+// group are names if they can be found, or numbers otherwise, and the mtime is
+// the modification time in seconds since the epoch. Symbolic links are
+// followed.
+type StatFunc struct {
+	interfaces.Textarea
+
+	pathWatcher // watches the path and implements Stream
+}
+
+// String returns a simple name for this function. This is needed so this struct
+// can satisfy the pgraph.Vertex interface.
+func (obj *StatFunc) String() string {
+	return StatFuncName
+}
+
+// ArgGen returns the Nth arg name for this function.
+func (obj *StatFunc) ArgGen(index int) (string, error) {
+	seq := []string{statArgNamePath}
+	if l := len(seq); index >= l {
+		return "", fmt.Errorf("index %d exceeds arg length of %d", index, l)
+	}
+	return seq[index], nil
+}
+
+// Validate makes sure we've built our struct properly. It is usually unused for
+// normal functions that users can use directly.
+func (obj *StatFunc) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *StatFunc) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // the filesystem can change
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func(%s str) %s", statArgNamePath, statType)),
+	}
+}
+
+// Call this function with the input args and return the value if it is possible
+// to do so at this time.
+func (obj *StatFunc) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	if len(args) < 1 {
+		return nil, fmt.Errorf("not enough args")
+	}
+	path := args[0].Str()
+
+	if !filepath.IsAbs(path) {
+		return nil, fmt.Errorf("path must be absolute")
+	}
+	if err := obj.watch(ctx, path, false); err != nil {
+		return nil, err
+	}
+
+	st := types.NewStruct(types.NewType(statType))
+	fi, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return st, nil // zero value
+	}
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not stat path")
+	}
+
+	fields := map[string]types.Value{
+		"exists": &types.BoolValue{V: true},
+		"is_dir": &types.BoolValue{V: fi.IsDir()},
+		"size":   &types.IntValue{V: fi.Size()},
+		"mode":   &types.StrValue{V: fmt.Sprintf("%04o", modeBits(fi.Mode()))},
+		"mtime":  &types.IntValue{V: fi.ModTime().Unix()},
+	}
+	if sys, ok := fi.Sys().(*syscall.Stat_t); ok {
+		fields["owner"] = &types.StrValue{V: ownerName(sys.Uid)}
+		fields["group"] = &types.StrValue{V: groupName(sys.Gid)}
+	}
+	for k, v := range fields {
+		if err := st.Set(k, v); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// modeBits returns the permission bits of the mode, including the special bits,
+// in the usual unix layout, so that they print correctly as octal.
+func modeBits(mode os.FileMode) uint32 {
+	bits := uint32(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		bits |= 04000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 02000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 01000
+	}
+	return bits
+}
+
+// ownerName returns the name of the user with this uid, or the uid if unknown.
+func ownerName(uid uint32) string {
+	s := strconv.FormatUint(uint64(uid), 10)
+	if u, err := user.LookupId(s); err == nil {
+		return u.Username
+	}
+	return s
+}
+
+// groupName returns the name of the group with this gid, or the gid if unknown.
+func groupName(gid uint32) string {
+	s := strconv.FormatUint(uint64(gid), 10)
+	if g, err := user.LookupGroupId(s); err == nil {
+		return g.Name
+	}
+	return s
+}
@@ -0,0 +1,208 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreos
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/recwatch"
+)
+
+// watchRequest is what the Call method of a watching function sends to Stream.
+type watchRequest struct {
+	path    string
+	recurse bool
+}
+
+// pathWatcher is the common part of the functions in this module which watch a
+// path on the filesystem, and which send a new event whenever it changes. The
+// functions embed it to get the Init, Stream, Cleanup and Done methods, and
+// then they call watch with the path that they care about from their Call
+// method.
+type pathWatcher struct {
+	init *interfaces.Init
+
+	recWatcher *recwatch.RecWatcher
+	events     chan error // internal events
+
+	input   chan *watchRequest // stream of inputs
+	request *watchRequest      // the active request
+}
+
+// Init runs some startup code for this function.
+func (obj *pathWatcher) Init(init *interfaces.Init) error {
+	obj.init = init
+	obj.input = make(chan *watchRequest)
+	obj.events = make(chan error)
+	return nil
+}
+
+// Stream returns the changing values that this func has over time.
+func (obj *pathWatcher) Stream(ctx context.Context) error {
+	//defer close(obj.input)  // if we close, this is a race with the sender
+	defer close(obj.events) // clean up for fun
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	defer func() {
+		if obj.recWatcher != nil {
+			_ = obj.recWatcher.Close() // close previous watcher
+			wg.Wait()
+		}
+	}()
+	for {
+		select {
+		case request, ok := <-obj.input:
+			if !ok {
+				obj.input = nil // don't infinite loop back
+				return fmt.Errorf("unexpected close")
+			}
+
+			if obj.request != nil && *obj.request == *request {
+				continue // nothing changed
+			}
+			obj.request = request
+
+			if obj.recWatcher != nil {
+				_ = obj.recWatcher.Close() // close previous watcher
+				wg.Wait()
+			}
+			// create new watcher
+			obj.recWatcher = &recwatch.RecWatcher{
+				Path:    request.path,
+				Recurse: request.recurse,
+				Opts: []recwatch.Option{
+					recwatch.Logf(obj.init.Logf),
+					recwatch.Debug(obj.init.Debug),
+				},
+			}
+			if err := obj.recWatcher.Init(); err != nil {
+				obj.recWatcher = nil
+				return errwrap.Wrapf(err, "could not watch path")
+			}
+
+			// Send one initial event, since a change could happen in
+			// between our Call looking at the path, and the watcher
+			// starting up.
+			startup := make(chan struct{})
+			close(startup)
+
+			// watch recwatch events in a proxy goroutine, since
+			// changing the recwatch object would panic the main
+			// select when it's nil...
+			wg.Add(1)
+			go func(recWatcher *recwatch.RecWatcher) {
+				defer wg.Done()
+				for {
+					var err error
+					select {
+					case <-startup:
+						startup = nil
+						// send an initial event
+
+					case event, ok := <-recWatcher.Events():
+						if !ok {
+							return // file watcher shut down
+						}
+						if event == nil {
+							// programming error
+							err = fmt.Errorf("unexpected nil recwatch event")
+							break
+						}
+						if err = event.Error; err != nil {
+							err = errwrap.Wrapf(err, "error event received")
+						}
+					}
+
+					select {
+					case obj.events <- err:
+						// send event...
+
+					case <-ctx.Done():
+						// don't block here on shutdown
+						return
+					}
+				}
+			}(obj.recWatcher)
+			continue // wait for an actual event or we'd send empty!
+
+		case err, ok := <-obj.events:
+			if !ok {
+				return fmt.Errorf("no more events")
+			}
+			if err != nil {
+				return errwrap.Wrapf(err, "error event received")
+			}
+
+			if err := obj.init.Event(ctx); err != nil { // send event
+				return err
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watch tells Stream which path we want to watch now. It must be called from
+// Call before we look at the filesystem, so that we don't miss any changes.
+func (obj *pathWatcher) watch(ctx context.Context, path string, recurse bool) error {
+	// Check before we send to a chan where we'd need Stream to be running.
+	if obj.init == nil {
+		return funcs.ErrCantSpeculate
+	}
+
+	// Tell the Stream what we're watching now... This doesn't block because
+	// Stream should always be ready to consume unless it's closing down...
+	// If it dies, then a ctx closure should come soon.
+	select {
+	case obj.input <- &watchRequest{path: path, recurse: recurse}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Cleanup runs after that function was removed from the graph.
+func (obj *pathWatcher) Cleanup(ctx context.Context) error {
+	// Even if the path stops changing, we never shutdown Stream because the
+	// contents may change.
+	return nil
+}
+
+// Done is a message from the engine to tell us that no more Call's are coming.
+func (obj *pathWatcher) Done() error {
+	close(obj.input) // At this point we know obj.input won't be used.
+	return nil
+}
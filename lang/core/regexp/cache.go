@@ -0,0 +1,74 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreregexp
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// CacheSize is the maximum number of compiled patterns that we keep. When
+	// the cache is full, we throw it away and start again. This is simple,
+	// and since most programs only use a handful of patterns, it's plenty.
+	CacheSize = 1024
+)
+
+var (
+	cacheMutex = &sync.Mutex{}
+	cache      = make(map[string]*regexp.Regexp)
+)
+
+// compile returns the compiled pattern, re-using a previously compiled one if
+// we've already seen it. Since function values are re-evaluated frequently, it
+// would be wasteful to compile the same pattern each time. A compiled regexp is
+// safe for concurrent use, so it's fine to share them.
+func compile(pattern string) (*regexp.Regexp, error) {
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	if re, exists := cache[pattern]; exists {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "pattern did not compile")
+	}
+
+	if len(cache) >= CacheSize {
+		cache = make(map[string]*regexp.Regexp)
+	}
+	cache[pattern] = re
+
+	return re, nil
+}
@@ -0,0 +1,97 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package coreregexp
+
+import (
+	"context"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func init() {
+	simple.ModuleRegister(ModuleName, "find_submatch", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: false, // TODO: should we consider this fast?
+			Spec: true,
+		},
+		T: types.NewType("func(pattern str, s str) []str"),
+		F: FindSubmatch,
+	})
+	simple.ModuleRegister(ModuleName, "find_submatch_named", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: true,
+			Memo: true,
+			Fast: false, // TODO: should we consider this fast?
+			Spec: true,
+		},
+		T: types.NewType("func(pattern str, s str) map{str: str}"),
+		F: FindSubmatchNamed,
+	})
+}
+
+// FindSubmatch returns the leftmost match of the regexp pattern in the string,
+// followed by the text of each of its capture groups, in order. Groups that did
+// not participate in the match are the empty string. If there is no match, the
+// list is empty.
+func FindSubmatch(ctx context.Context, input []types.Value) (types.Value, error) {
+	re, err := compile(input[0].Str())
+	if err != nil {
+		return nil, err
+	}
+	return strList(re.FindStringSubmatch(input[1].Str())), nil
+}
+
+// FindSubmatchNamed returns a map from the name of each named capture group in
+// the regexp pattern, to the text it matched in the leftmost match in the
+// string. Unnamed groups are skipped. If there is no match, the map is empty.
+func FindSubmatchNamed(ctx context.Context, input []types.Value) (types.Value, error) {
+	re, err := compile(input[0].Str())
+	if err != nil {
+		return nil, err
+	}
+
+	m := types.NewMap(types.NewType("map{str: str}"))
+	matches := re.FindStringSubmatch(input[1].Str())
+	if matches == nil {
+		return m, nil
+	}
+	for i, name := range re.SubexpNames() {
+		if i == 0 || name == "" {
+			continue
+		}
+		if err := m.Set(&types.StrValue{V: name}, &types.StrValue{V: matches[i]}); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
@@ -31,11 +31,9 @@ package coreregexp
 
 import (
 	"context"
-	"regexp"
 
 	"github.com/purpleidea/mgmt/lang/funcs/simple"
 	"github.com/purpleidea/mgmt/lang/types"
-	"github.com/purpleidea/mgmt/util/errwrap"
 )
 
 func init() {
@@ -56,11 +54,9 @@ func Match(ctx context.Context, input []types.Value) (types.Value, error) {
 	pattern := input[0].Str()
 	s := input[1].Str()
 
-	// TODO: We could make this more efficient with the regular function API
-	// by only compiling the pattern when it changes.
-	re, err := regexp.Compile(pattern)
+	re, err := compile(pattern)
 	if err != nil {
-		return nil, errwrap.Wrapf(err, "pattern did not compile")
+		return nil, err
 	}
 
 	result := re.MatchString(s)
@@ -29,7 +29,23 @@
 
 package coreregexp
 
+import (
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
 const (
 	// ModuleName is the prefix given to all the functions in this module.
 	ModuleName = "regexp"
 )
+
+// strList is a helper to build a list of strings.
+func strList(l []string) types.Value {
+	values := []types.Value{}
+	for _, s := range l {
+		values = append(values, &types.StrValue{V: s})
+	}
+	return &types.ListValue{
+		T: types.NewType("[]str"),
+		V: values,
+	}
+}
@@ -0,0 +1,95 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package coreregexp
+
+import (
+	"context"
+	"testing"
+
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+)
+
+func TestRegexpFuncs0(t *testing.T) {
+	str := func(s string) types.Value { return &types.StrValue{V: s} }
+	list := func(l ...string) types.Value { return strList(l) }
+
+	named := types.NewMap(types.NewType("map{str: str}"))
+	for k, v := range map[string]string{"user": "root", "host": "example.com"} {
+		if err := named.Set(str(k), str(v)); err != nil {
+			t.Errorf("map could not set key, error: %v", err)
+			return
+		}
+	}
+
+	values := []struct {
+		fn       interfaces.FuncSig
+		input    []types.Value
+		expected types.Value
+	}{
+		{ReplaceAll, []types.Value{str(`a(x*)b`), str("-ab-axxb-"), str("${1}W")}, str("-W-xxW-")},
+		{Find, []types.Value{str(`\d+`), str("abc 123 def 45")}, str("123")},
+		{Find, []types.Value{str(`\d+`), str("abc")}, str("")},
+		{FindAll, []types.Value{str(`\d+`), str("abc 123 def 45")}, list("123", "45")},
+		{FindAll, []types.Value{str(`\d+`), str("abc")}, list()},
+		{FindSubmatch, []types.Value{str(`(\w+)@(\w+)`), str("root@host")}, list("root@host", "root", "host")},
+		{FindSubmatch, []types.Value{str(`(\w+)@(\w+)`), str("nothing")}, list()},
+		{FindSubmatchNamed, []types.Value{str(`(?P<user>\w+)@(?P<host>[\w.]+)`), str("to: root@example.com")}, named},
+		{Split, []types.Value{str(`\s*,\s*`), str("a , b,c")}, list("a", "b", "c")},
+	}
+
+	for i, x := range values {
+		val, err := x.fn(context.Background(), x.input)
+		if err != nil {
+			t.Errorf("test index %d failed with: %+v", i, err)
+			continue
+		}
+		if err := val.Cmp(x.expected); err != nil {
+			t.Errorf("test index %d expected %s, got %s", i, x.expected, val)
+		}
+	}
+}
+
+func TestCompile0(t *testing.T) {
+	re1, err := compile(`^a+$`)
+	if err != nil {
+		t.Errorf("compile failed with: %+v", err)
+		return
+	}
+	re2, _ := compile(`^a+$`)
+	if re1 != re2 {
+		t.Errorf("pattern was not cached")
+	}
+	if _, err := compile(`(`); err == nil {
+		t.Errorf("invalid pattern should error")
+	}
+}
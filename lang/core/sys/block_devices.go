@@ -0,0 +1,229 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/socketset"
+)
+
+const (
+	// BlockDevicesFuncName is the name this func is registered as.
+	BlockDevicesFuncName = "block_devices"
+
+	blockDeviceSignature = "struct{name str; size int; model str; serial str; rotational bool; removable bool}"
+
+	sysBlockPath = "/sys/block/"
+	udevDataPath = "/run/udev/data/"
+
+	// sectorSize is the unit that sysfs uses for block device sizes, no
+	// matter what the real sector size of the device is.
+	sectorSize = 512
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, BlockDevicesFuncName, func() interfaces.Func { return &BlockDevices{} })
+}
+
+// BlockDevices is a func which returns the list of block devices that the
+// kernel knows about, sorted by name. The size is in bytes, and the model and
+// serial are empty if they're not known. Partitions are not included. It
+// receives UEvents from the kernel as devices are added, removed or changed.
+type BlockDevices struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this func. This is needed so this struct can
+// satisfy the pgraph.Vertex interface.
+func (obj *BlockDevices) String() string {
+	return BlockDevicesFuncName
+}
+
+// Validate makes sure we've built our struct properly.
+func (obj *BlockDevices) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *BlockDevices) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // non-constant funcs can't be pure!
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func() []%s", blockDeviceSignature)),
+	}
+}
+
+// Init runs some startup code for this func.
+func (obj *BlockDevices) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream starts a mainloop and runs Event when it's time to Call() again.
+func (obj *BlockDevices) Stream(ctx context.Context) error {
+	sub, err := uevents.subscribe(isBlockEvent)
+	if err != nil {
+		return err
+	}
+	defer sub.Close()
+
+	// streams must generate an initial event on startup
+	startChan := make(chan struct{}) // start signal
+	close(startChan)                 // kick it off!
+	for {
+		select {
+		case <-startChan:
+			startChan = nil // disable
+
+		case _, ok := <-sub.Events():
+			if !ok {
+				return sub.Err()
+			}
+			if obj.init.Debug {
+				obj.init.Logf("received block uevent")
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Call this func and return the value if it is possible to do so at this time.
+func (obj *BlockDevices) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	entries, err := os.ReadDir(sysBlockPath)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not list block devices")
+	}
+	names := []string{}
+	for _, x := range entries {
+		names = append(names, x.Name())
+	}
+	sort.Strings(names)
+
+	typ := types.NewType(blockDeviceSignature)
+	values := []types.Value{}
+	for _, name := range names {
+		dir := path.Join(sysBlockPath, name)
+		size, err := strconv.ParseInt(readSysfs(path.Join(dir, "size")), 10, 64)
+		if err != nil {
+			continue // the device went away or is not ready
+		}
+		serial := readSysfs(path.Join(dir, "device/serial"))
+		if serial == "" {
+			serial = udevProperty(readSysfs(path.Join(dir, "dev")), "ID_SERIAL_SHORT")
+		}
+
+		st := types.NewStruct(typ)
+		fields := map[string]types.Value{
+			"name":       &types.StrValue{V: name},
+			"size":       &types.IntValue{V: size * sectorSize},
+			"model":      &types.StrValue{V: readSysfs(path.Join(dir, "device/model"))},
+			"serial":     &types.StrValue{V: serial},
+			"rotational": &types.BoolValue{V: readSysfs(path.Join(dir, "queue/rotational")) == "1"},
+			"removable":  &types.BoolValue{V: readSysfs(path.Join(dir, "removable")) == "1"},
+		}
+		for k, v := range fields {
+			if err := st.Set(k, v); err != nil {
+				return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+			}
+		}
+		values = append(values, st)
+	}
+
+	return &types.ListValue{
+		T: types.NewType(fmt.Sprintf("[]%s", blockDeviceSignature)),
+		V: values,
+	}, nil
+}
+
+// readSysfs returns the trimmed contents of a small sysfs file, or the empty
+// string if it can't be read, since many of these attributes are optional.
+func readSysfs(p string) string {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+// udevProperty looks up a property of a block device in the udev database. The
+// dev arg is the major:minor number of the device. It returns the empty string
+// if it's not found. We need this because the kernel doesn't expose the serial
+// number of many disks, such as the ATA ones, in sysfs.
+func udevProperty(dev, key string) string {
+	if dev == "" {
+		return ""
+	}
+	f, err := os.Open(path.Join(udevDataPath, "b"+dev))
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	prefix := "E:" + key + "="
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if s, ok := strings.CutPrefix(scanner.Text(), prefix); ok {
+			return s
+		}
+	}
+	return ""
+}
+
+// isBlockEvent filters the udev events down to those which indicate that a
+// block device was added, removed or changed, which includes media changes.
+func isBlockEvent(event *socketset.UEvent) bool {
+	if event.Subsystem != "block" {
+		return false
+	}
+	return event.Action == "add" || event.Action == "remove" || event.Action == "change"
+}
@@ -37,15 +37,12 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
-	"sync"
 
 	"github.com/purpleidea/mgmt/lang/funcs"
 	"github.com/purpleidea/mgmt/lang/interfaces"
 	"github.com/purpleidea/mgmt/lang/types"
 	"github.com/purpleidea/mgmt/util/errwrap"
 	"github.com/purpleidea/mgmt/util/socketset"
-
-	"golang.org/x/sys/unix"
 )
 
 const (
@@ -101,46 +98,11 @@ func (obj *CPUCount) Init(init *interfaces.Init) error {
 // will first poll sysfs to get the initial cpu count, and then receives UEvents
 // from the kernel as CPUs are added/removed.
 func (obj *CPUCount) Stream(ctx context.Context) error {
-	ss, err := socketset.NewSocketSet(rtmGrps, socketFile, unix.NETLINK_KOBJECT_UEVENT)
+	sub, err := uevents.subscribe(isCPUEvent)
 	if err != nil {
-		return errwrap.Wrapf(err, "error creating socket set")
+		return err
 	}
-
-	// waitgroup for netlink receive goroutine
-	wg := &sync.WaitGroup{}
-	defer ss.Close()
-	// We must wait for the Shutdown() AND the select inside of SocketSet to
-	// complete before we Close, since the unblocking in SocketSet is not a
-	// synchronous operation.
-	defer wg.Wait()
-	defer ss.Shutdown() // close the netlink socket and unblock conn.receive()
-
-	eventChan := make(chan *nlChanEvent) // updated in goroutine when we receive uevent
-	closeChan := make(chan struct{})     // channel to unblock selects in goroutine
-	defer close(closeChan)
-
-	// wait for kernel to poke us about new device changes on the system
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		defer close(eventChan)
-		for {
-			// XXX: This does *not* generate an initial event on
-			// startup, so instead, use startChan below...
-			uevent, err := ss.ReceiveUEvent() // calling Shutdown will stop this from blocking
-			if obj.init.Debug {
-				obj.init.Logf("sending uevent SEQNUM: %s", uevent.Data["SEQNUM"])
-			}
-			select {
-			case eventChan <- &nlChanEvent{
-				uevent: uevent,
-				err:    err,
-			}:
-			case <-closeChan:
-				return
-			}
-		}
-	}()
+	defer sub.Close()
 
 	// streams must generate an initial event on startup
 	startChan := make(chan struct{}) // start signal
@@ -150,18 +112,12 @@ func (obj *CPUCount) Stream(ctx context.Context) error {
 		case <-startChan:
 			startChan = nil // disable
 
-		case event, ok := <-eventChan:
+		case _, ok := <-sub.Events():
 			if !ok {
-				continue
-			}
-			if event.err != nil {
-				return errwrap.Wrapf(event.err, "error receiving uevent")
+				return sub.Err()
 			}
 			if obj.init.Debug {
-				obj.init.Logf("received uevent SEQNUM: %s", event.uevent.Data["SEQNUM"])
-			}
-			if !isCPUEvent(event.uevent) {
-				continue
+				obj.init.Logf("received cpu uevent")
 			}
 
 		case <-ctx.Done():
@@ -236,10 +192,3 @@ func isCPUEvent(event *socketset.UEvent) bool {
 	}
 	return false
 }
-
-// nlChanEvent defines the channel used to send netlink messages and errors to
-// the event processing loop in Stream.
-type nlChanEvent struct {
-	uevent *socketset.UEvent
-	err    error
-}
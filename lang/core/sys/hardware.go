@@ -0,0 +1,192 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/purpleidea/mgmt/lang/funcs/simple"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	cpuinfoPath = "/proc/cpuinfo"
+	dmiPath     = "/sys/class/dmi/id/"
+	bootIDPath  = "/proc/sys/kernel/random/boot_id"
+)
+
+// dmiFields maps the struct fields that we return to the names of the files in
+// the dmi sysfs directory.
+var dmiFields = map[string]string{
+	"vendor":       "sys_vendor",
+	"product":      "product_name",
+	"version":      "product_version",
+	"serial":       "product_serial",
+	"uuid":         "product_uuid",
+	"board_vendor": "board_vendor",
+	"board_name":   "board_name",
+	"bios_vendor":  "bios_vendor",
+	"bios_version": "bios_version",
+}
+
+func init() {
+	// None of these change until we reboot, so we only need to run them
+	// once, and they don't need to stream.
+	simple.ModuleRegister(ModuleName, "cpu_info", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: false,
+			Memo: false,
+			Fast: true,
+			Spec: false,
+		},
+		T: types.NewType("func() struct{model str; vendor str; flags []str}"),
+		F: CPUInfo,
+	})
+	simple.ModuleRegister(ModuleName, "dmi", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: false,
+			Memo: false,
+			Fast: true,
+			Spec: false,
+		},
+		T: types.NewType("func() struct{vendor str; product str; version str; serial str; uuid str; board_vendor str; board_name str; bios_vendor str; bios_version str}"),
+		F: DMI,
+	})
+	simple.ModuleRegister(ModuleName, "boot_id", &simple.Scaffold{
+		I: &simple.Info{
+			Pure: false,
+			Memo: false,
+			Fast: true,
+			Spec: false,
+		},
+		T: types.NewType("func() str"),
+		F: BootID,
+	})
+}
+
+// CPUInfo returns the model name, the vendor, and the sorted list of feature
+// flags of the first CPU. Any values which the kernel doesn't provide for this
+// architecture are empty.
+func CPUInfo(ctx context.Context, input []types.Value) (types.Value, error) {
+	f, err := os.Open(cpuinfoPath)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not read cpu info")
+	}
+	defer f.Close()
+	model, vendor, flags, err := parseCPUInfo(f)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse cpu info")
+	}
+
+	l := &types.ListValue{
+		T: types.NewType("[]str"),
+	}
+	for _, x := range flags {
+		l.V = append(l.V, &types.StrValue{V: x})
+	}
+	st := types.NewStruct(types.NewType("struct{model str; vendor str; flags []str}"))
+	fields := map[string]types.Value{
+		"model":  &types.StrValue{V: model},
+		"vendor": &types.StrValue{V: vendor},
+		"flags":  l,
+	}
+	for k, v := range fields {
+		if err := st.Set(k, v); err != nil {
+			return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+		}
+	}
+	return st, nil
+}
+
+// DMI returns the hardware identity that the firmware provides, such as the
+// system vendor, product name and serial number. Some of these, such as the
+// serial and uuid, can only be read by root, and so they're empty otherwise.
+// They're all empty on machines without DMI, such as most ARM boards.
+func DMI(ctx context.Context, input []types.Value) (types.Value, error) {
+	st := types.NewStruct(types.NewType("struct{vendor str; product str; version str; serial str; uuid str; board_vendor str; board_name str; bios_vendor str; bios_version str}"))
+	for k, name := range dmiFields {
+		v := &types.StrValue{V: readSysfs(path.Join(dmiPath, name))}
+		if err := st.Set(k, v); err != nil {
+			return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+		}
+	}
+	return st, nil
+}
+
+// BootID returns the random id that the kernel generates on each boot. You can
+// compare it to a stored value to tell if the machine has rebooted.
+func BootID(ctx context.Context, input []types.Value) (types.Value, error) {
+	b, err := os.ReadFile(bootIDPath)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not read boot id")
+	}
+	return &types.StrValue{
+		V: strings.TrimSpace(string(b)),
+	}, nil
+}
+
+// parseCPUInfo parses the first processor section of /proc/cpuinfo. The keys
+// differ between architectures, so we look for each of the known ones.
+func parseCPUInfo(r io.Reader) (model, vendor string, flags []string, err error) {
+	flags = []string{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && model != "" {
+			break // end of the first processor
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch key {
+		case "model name", "Model", "cpu": // x86, arm, ppc
+			if model == "" {
+				model = value
+			}
+		case "vendor_id", "vendor": // x86, riscv
+			vendor = value
+		case "flags", "Features": // x86, arm
+			flags = strings.Fields(value)
+		}
+	}
+	sort.Strings(flags)
+	return model, vendor, flags, scanner.Err()
+}
@@ -0,0 +1,103 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseCPUInfo(t *testing.T) {
+	var tests = []struct {
+		desc   string
+		data   string
+		model  string
+		vendor string
+		flags  []string
+	}{
+		{
+			desc: "x86",
+			data: `processor	: 0
+vendor_id	: GenuineIntel
+model		: 207
+model name	: Intel(R) Xeon(R) Processor
+flags		: sse fpu avx
+
+processor	: 1
+vendor_id	: GenuineIntel
+model name	: Some Other Processor
+flags		: fpu
+`,
+			model:  "Intel(R) Xeon(R) Processor",
+			vendor: "GenuineIntel",
+			flags:  []string{"avx", "fpu", "sse"},
+		},
+		{
+			desc: "arm",
+			data: `processor	: 0
+BogoMIPS	: 108.00
+Features	: fp asimd evtstrm crc32 cpuid
+
+Hardware	: BCM2835
+Model		: Raspberry Pi 4 Model B Rev 1.4
+`,
+			model:  "Raspberry Pi 4 Model B Rev 1.4",
+			vendor: "",
+			flags:  []string{"asimd", "cpuid", "crc32", "evtstrm", "fp"},
+		},
+		{
+			desc:  "empty",
+			data:  "",
+			flags: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.desc, func(t *testing.T) {
+			model, vendor, flags, err := parseCPUInfo(strings.NewReader(tt.data))
+			if err != nil {
+				t.Errorf("could not parseCPUInfo: %+v", err)
+				return
+			}
+			if model != tt.model {
+				t.Errorf("expected model %q, got %q", tt.model, model)
+			}
+			if vendor != tt.vendor {
+				t.Errorf("expected vendor %q, got %q", tt.vendor, vendor)
+			}
+			if !reflect.DeepEqual(flags, tt.flags) {
+				t.Errorf("expected flags %v, got %v", tt.flags, flags)
+			}
+		})
+	}
+}
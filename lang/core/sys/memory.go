@@ -0,0 +1,185 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// MemoryFuncName is the name this func is registered as.
+	MemoryFuncName = "memory"
+
+	memorySignature = "struct{total int; available int; free int; swap_total int; swap_free int}"
+
+	meminfoPath = "/proc/meminfo"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, MemoryFuncName, func() interfaces.Func { return &Memory{} })
+}
+
+// Memory is a func which returns the current memory usage of your system. All
+// of the values are in bytes. The available field is the kernel's estimate of
+// how much memory can be used by new programs without swapping.
+type Memory struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this func. This is needed so this struct can
+// satisfy the pgraph.Vertex interface.
+func (obj *Memory) String() string {
+	return MemoryFuncName
+}
+
+// Validate makes sure we've built our struct properly.
+func (obj *Memory) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *Memory) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // non-constant funcs can't be pure!
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func() %s", memorySignature)),
+	}
+}
+
+// Init runs some startup code for this func.
+func (obj *Memory) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream starts a mainloop and runs Event when it's time to Call() again. There
+// is no way to get notified of memory changes, so we poll.
+func (obj *Memory) Stream(ctx context.Context) error {
+	// TODO: should the interval be configurable?
+	ticker := time.NewTicker(time.Duration(5) * time.Second)
+	defer ticker.Stop()
+
+	// streams must generate an initial event on startup
+	// even though ticker will send one, we want to be faster to first event
+	startChan := make(chan struct{}) // start signal
+	close(startChan)                 // kick it off!
+
+	for {
+		select {
+		case <-startChan:
+			startChan = nil // disable
+
+		case <-ticker.C: // received the timer event
+			// pass
+
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Call this func and return the value if it is possible to do so at this time.
+func (obj *Memory) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	f, err := os.Open(meminfoPath)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not read memory info")
+	}
+	defer f.Close()
+	info, err := parseMeminfo(f)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse memory info")
+	}
+
+	// the kernel uses these names
+	fields := map[string]string{
+		"total":      "MemTotal",
+		"available":  "MemAvailable",
+		"free":       "MemFree",
+		"swap_total": "SwapTotal",
+		"swap_free":  "SwapFree",
+	}
+	st := types.NewStruct(types.NewType(memorySignature))
+	for k, name := range fields {
+		if err := st.Set(k, &types.IntValue{V: info[name]}); err != nil {
+			return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+		}
+	}
+
+	return st, nil
+}
+
+// parseMeminfo parses the contents of /proc/meminfo into a map of the values in
+// bytes. Lines look like: `MemTotal:       16318412 kB`, and a few of them have
+// no unit, in which case they are a count and not a size.
+func parseMeminfo(r io.Reader) (map[string]int64, error) {
+	result := make(map[string]int64)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), ":")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		i, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "invalid value for `%s`", key)
+		}
+		if len(fields) > 1 && fields[1] == "kB" {
+			i *= 1024
+		}
+		result[key] = i
+	}
+	return result, scanner.Err()
+}
@@ -0,0 +1,70 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMeminfo(t *testing.T) {
+	data := `MemTotal:       16318412 kB
+MemFree:         1220432 kB
+MemAvailable:    9876544 kB
+SwapTotal:             0 kB
+HugePages_Total:       4
+`
+	m, err := parseMeminfo(strings.NewReader(data))
+	if err != nil {
+		t.Errorf("could not parseMeminfo: %+v", err)
+		return
+	}
+	expected := map[string]int64{
+		"MemTotal":        16318412 * 1024,
+		"MemFree":         1220432 * 1024,
+		"MemAvailable":    9876544 * 1024,
+		"SwapTotal":       0,
+		"HugePages_Total": 4, // a count, not a size
+	}
+	if len(m) != len(expected) {
+		t.Errorf("expected %d values, got %d", len(expected), len(m))
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("key %s: expected %d, got %d", k, v, m[k])
+		}
+	}
+
+	if _, err := parseMeminfo(strings.NewReader("MemTotal: lots kB\n")); err == nil {
+		t.Errorf("expected an error for an invalid value")
+	}
+}
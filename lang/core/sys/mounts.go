@@ -0,0 +1,299 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	// MountsFuncName is the name this func is registered as.
+	MountsFuncName = "mounts"
+
+	mountSignature = "struct{device str; path str; fstype str; options str; size int; used int; available int}"
+
+	mountsPath = "/proc/self/mounts"
+)
+
+func init() {
+	funcs.ModuleRegister(ModuleName, MountsFuncName, func() interfaces.Func { return &Mounts{} })
+}
+
+// Mounts is a func which returns the list of mounted filesystems, in the order
+// that the kernel lists them. The size, used and available fields are the usage
+// of each filesystem in bytes, and they are zero if it can't be read. The
+// available field is what an unprivileged user could still use. This changes
+// when something is mounted or unmounted, and the usage is polled as well.
+type Mounts struct {
+	interfaces.Textarea
+
+	init *interfaces.Init
+}
+
+// String returns a simple name for this func. This is needed so this struct can
+// satisfy the pgraph.Vertex interface.
+func (obj *Mounts) String() string {
+	return MountsFuncName
+}
+
+// Validate makes sure we've built our struct properly.
+func (obj *Mounts) Validate() error {
+	return nil
+}
+
+// Info returns some static info about itself.
+func (obj *Mounts) Info() *interfaces.Info {
+	return &interfaces.Info{
+		Pure: false, // non-constant funcs can't be pure!
+		Memo: false,
+		Fast: false,
+		Spec: false,
+		Sig:  types.NewType(fmt.Sprintf("func() []%s", mountSignature)),
+	}
+}
+
+// Init runs some startup code for this func.
+func (obj *Mounts) Init(init *interfaces.Init) error {
+	obj.init = init
+	return nil
+}
+
+// Stream starts a mainloop and runs Event when it's time to Call() again. The
+// kernel tells us when the mount table changes by marking the mounts file as
+// having an exceptional condition when we poll it, but there is no way to get
+// notified of usage changes, so we poll for those on a slower schedule too.
+func (obj *Mounts) Stream(ctx context.Context) error {
+	f, err := os.Open(mountsPath)
+	if err != nil {
+		return errwrap.Wrapf(err, "could not open mounts")
+	}
+	defer f.Close()
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan error)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(events)
+		fds := []unix.PollFd{{
+			Fd:     int32(f.Fd()), //nolint:gosec // G115: a file descriptor is a small int
+			Events: unix.POLLPRI,
+		}}
+		for {
+			// wake up every second so that we notice a shutdown
+			n, err := unix.Poll(fds, 1000)
+			if err == unix.EINTR {
+				n, err = 0, nil
+			}
+			if err == nil && (n == 0 || fds[0].Revents&(unix.POLLPRI|unix.POLLERR) == 0) {
+				select {
+				case <-ctx.Done():
+					return
+				default:
+				}
+				continue
+			}
+
+			select {
+			case events <- err:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	// TODO: should the interval be configurable?
+	ticker := time.NewTicker(time.Duration(30) * time.Second)
+	defer ticker.Stop()
+
+	// streams must generate an initial event on startup
+	startChan := make(chan struct{}) // start signal
+	close(startChan)                 // kick it off!
+
+	for {
+		select {
+		case <-startChan:
+			startChan = nil // disable
+
+		case err, ok := <-events:
+			if !ok {
+				return nil // shutdown
+			}
+			if err != nil {
+				return errwrap.Wrapf(err, "error polling mounts")
+			}
+			if obj.init.Debug {
+				obj.init.Logf("mount table changed")
+			}
+
+		case <-ticker.C: // received the timer event
+			// pass
+
+		case <-ctx.Done():
+			return nil
+		}
+
+		if err := obj.init.Event(ctx); err != nil {
+			return err
+		}
+	}
+}
+
+// Call this func and return the value if it is possible to do so at this time.
+func (obj *Mounts) Call(ctx context.Context, args []types.Value) (types.Value, error) {
+	f, err := os.Open(mountsPath)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not read mounts")
+	}
+	defer f.Close()
+	mounts, err := parseMounts(f)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse mounts")
+	}
+
+	typ := types.NewType(mountSignature)
+	values := []types.Value{}
+	for _, m := range mounts {
+		var size, used, available int64
+		var stat unix.Statfs_t
+		// TODO: this can block on a hung network filesystem
+		if err := unix.Statfs(m.path, &stat); err == nil {
+			bsize := uint64(stat.Bsize) //nolint:gosec // G115: a block size is always positive
+			//nolint:gosec // G115: a filesystem size in bytes fits in an int64
+			size, used, available = int64(stat.Blocks*bsize), int64((stat.Blocks-stat.Bfree)*bsize), int64(stat.Bavail*bsize)
+		}
+
+		st := types.NewStruct(typ)
+		fields := map[string]types.Value{
+			"device":    &types.StrValue{V: m.device},
+			"path":      &types.StrValue{V: m.path},
+			"fstype":    &types.StrValue{V: m.fstype},
+			"options":   &types.StrValue{V: m.options},
+			"size":      &types.IntValue{V: size},
+			"used":      &types.IntValue{V: used},
+			"available": &types.IntValue{V: available},
+		}
+		for k, v := range fields {
+			if err := st.Set(k, v); err != nil {
+				return nil, errwrap.Wrapf(err, "struct could not set key: `%s`", k)
+			}
+		}
+		values = append(values, st)
+	}
+
+	return &types.ListValue{
+		T: types.NewType(fmt.Sprintf("[]%s", mountSignature)),
+		V: values,
+	}, nil
+}
+
+// mount is a single entry from the mounts file.
+type mount struct {
+	device  string
+	path    string
+	fstype  string
+	options string
+}
+
+// parseMounts parses the contents of a mounts file, which has the same format
+// as fstab. Spaces and other special chars in the fields are octal escaped.
+func parseMounts(r io.Reader) ([]*mount, error) {
+	result := []*mount{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("invalid mount line: %s", scanner.Text())
+		}
+		for i := 0; i < 4; i++ {
+			s, err := unescapeMountField(fields[i])
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = s
+		}
+		result = append(result, &mount{
+			device:  fields[0],
+			path:    fields[1],
+			fstype:  fields[2],
+			options: fields[3],
+		})
+	}
+	return result, scanner.Err()
+}
+
+// unescapeMountField decodes the octal escapes, such as \040 for a space, that
+// the kernel uses in the fields of the mounts file.
+func unescapeMountField(s string) (string, error) {
+	if !strings.Contains(s, `\`) {
+		return s, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+4 > len(s) {
+			b.WriteByte(s[i])
+			continue
+		}
+		c, err := strconv.ParseUint(s[i+1:i+4], 8, 8)
+		if err != nil {
+			return "", errwrap.Wrapf(err, "invalid escape in: %s", s)
+		}
+		b.WriteByte(byte(c))
+		i += 3
+	}
+	return b.String(), nil
+}
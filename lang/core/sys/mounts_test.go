@@ -0,0 +1,97 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMounts(t *testing.T) {
+	data := `proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sda1 /mnt/my\040disk ext4 rw,relatime 0 0
+
+tmpfs /tmp tmpfs rw 0 0
+`
+	mounts, err := parseMounts(strings.NewReader(data))
+	if err != nil {
+		t.Errorf("could not parseMounts: %+v", err)
+		return
+	}
+	expected := []*mount{
+		{device: "proc", path: "/proc", fstype: "proc", options: "rw,nosuid,nodev,noexec,relatime"},
+		{device: "/dev/sda1", path: "/mnt/my disk", fstype: "ext4", options: "rw,relatime"},
+		{device: "tmpfs", path: "/tmp", fstype: "tmpfs", options: "rw"},
+	}
+	if len(mounts) != len(expected) {
+		t.Errorf("expected %d mounts, got %d", len(expected), len(mounts))
+		return
+	}
+	for i, m := range mounts {
+		if *m != *expected[i] {
+			t.Errorf("mount %d: expected %+v, got %+v", i, expected[i], m)
+		}
+	}
+}
+
+func TestUnescapeMountField(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+		err bool
+	}{
+		{in: "/plain", out: "/plain"},
+		{in: `/a\040b`, out: "/a b"},
+		{in: `/tab\011x\134y`, out: "/tab\tx\\y"},
+		{in: `/end\`, out: `/end\`}, // too short to be an escape
+		{in: `/bad\09x`, err: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			out, err := unescapeMountField(tt.in)
+			if tt.err {
+				if err == nil {
+					t.Errorf("expected error, got: %s", out)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("could not unescape: %+v", err)
+				return
+			}
+			if out != tt.out {
+				t.Errorf("expected %q, got %q", tt.out, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,188 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !darwin
+
+package coresys
+
+import (
+	"sync"
+
+	"github.com/purpleidea/mgmt/util/errwrap"
+	"github.com/purpleidea/mgmt/util/socketset"
+
+	"golang.org/x/sys/unix"
+)
+
+// uevents is the shared broker which all of the funcs in this module use to get
+// kernel uevents. Only one netlink socket can be bound per process, so we can't
+// have each func open its own.
+var uevents = &ueventBroker{}
+
+// ueventSubscription is what a subscriber gets back from the broker. The events
+// channel receives a value each time a matching uevent arrives. It's buffered,
+// and events get coalesced, since the subscribers only need to know that they
+// should look again. If the socket fails, then the channel gets closed, and Err
+// returns the reason.
+type ueventSubscription struct {
+	broker *ueventBroker
+	filter func(*socketset.UEvent) bool
+	events chan struct{}
+	err    error
+}
+
+// Events returns the channel of events for this subscription.
+func (obj *ueventSubscription) Events() <-chan struct{} {
+	return obj.events
+}
+
+// Err returns the error that closed the events channel, if any.
+func (obj *ueventSubscription) Err() error {
+	obj.broker.mutex.Lock()
+	defer obj.broker.mutex.Unlock()
+	return obj.err
+}
+
+// Close removes this subscription. When the last one is removed, the socket is
+// closed too.
+func (obj *ueventSubscription) Close() error {
+	return obj.broker.unsubscribe(obj)
+}
+
+// ueventBroker owns the uevent socket and fans out the events to each of the
+// subscribers. The socket is opened with the first subscriber and is closed
+// after the last one leaves.
+type ueventBroker struct {
+	mutex sync.Mutex
+	subs  map[*ueventSubscription]struct{}
+
+	ss   *socketset.SocketSet
+	wg   *sync.WaitGroup
+	done chan struct{}
+	err  error // set if the socket failed
+}
+
+// subscribe returns a new subscription for the uevents which match the filter.
+func (obj *ueventBroker) subscribe(filter func(*socketset.UEvent) bool) (*ueventSubscription, error) {
+	obj.mutex.Lock()
+	defer obj.mutex.Unlock()
+
+	if obj.ss == nil {
+		ss, err := socketset.NewSocketSet(rtmGrps, socketFile, unix.NETLINK_KOBJECT_UEVENT)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "error creating socket set")
+		}
+		obj.ss = ss
+		obj.subs = make(map[*ueventSubscription]struct{})
+		obj.wg = &sync.WaitGroup{}
+		obj.done = make(chan struct{})
+		obj.err = nil
+
+		obj.wg.Add(1)
+		go obj.run(ss, obj.done)
+	}
+	if obj.err != nil { // the old subscribers must all leave first
+		return nil, obj.err
+	}
+
+	sub := &ueventSubscription{
+		broker: obj,
+		filter: filter,
+		events: make(chan struct{}, 1),
+	}
+	obj.subs[sub] = struct{}{}
+	return sub, nil
+}
+
+// unsubscribe removes the subscription, and shuts down the socket if it was the
+// last one.
+func (obj *ueventBroker) unsubscribe(sub *ueventSubscription) error {
+	obj.mutex.Lock()
+	if _, exists := obj.subs[sub]; !exists {
+		obj.mutex.Unlock()
+		return nil // already removed
+	}
+	delete(obj.subs, sub)
+	if len(obj.subs) > 0 {
+		obj.mutex.Unlock()
+		return nil
+	}
+	ss, wg := obj.ss, obj.wg
+	close(obj.done)
+	obj.ss = nil
+	obj.subs = nil
+	obj.mutex.Unlock()
+
+	// We must wait for the Shutdown() AND the select inside of SocketSet to
+	// complete before we Close, since the unblocking in SocketSet is not a
+	// synchronous operation.
+	err := ss.Shutdown() // close the netlink socket and unblock receive
+	wg.Wait()
+	if e := ss.Close(); err == nil {
+		err = e
+	}
+	return err
+}
+
+// run receives the uevents and sends them to the matching subscribers, until
+// the done channel is closed.
+func (obj *ueventBroker) run(ss *socketset.SocketSet, done chan struct{}) {
+	defer obj.wg.Done()
+	for {
+		uevent, err := ss.ReceiveUEvent() // calling Shutdown will stop this from blocking
+		select {
+		case <-done:
+			return
+		default:
+		}
+		obj.mutex.Lock()
+		if err != nil {
+			obj.err = errwrap.Wrapf(err, "error receiving uevent")
+		}
+		for sub := range obj.subs {
+			if obj.err != nil {
+				sub.err = obj.err
+				close(sub.events)
+				continue
+			}
+			if !sub.filter(uevent) {
+				continue
+			}
+			select {
+			case sub.events <- struct{}{}:
+			default: // an event is already pending
+			}
+		}
+		obj.mutex.Unlock()
+
+		if err != nil {
+			return // the last subscriber will close the socket
+		}
+	}
+}
@@ -0,0 +1,304 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+// Package docgen generates the documentation of mcl modules. It collects the
+// doc comments which are directly above each top-level function, class, and
+// variable, along with their signatures and their inferred types.
+package docgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	docsUtil "github.com/purpleidea/mgmt/docs/util"
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/lang"
+	"github.com/purpleidea/mgmt/lang/ast"
+	"github.com/purpleidea/mgmt/lang/format/astfmt"
+	"github.com/purpleidea/mgmt/lang/inputs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/interpolate"
+	"github.com/purpleidea/mgmt/lang/parser"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+// Docgen generates the documentation of mcl modules.
+type Docgen struct {
+	// ModulePath is the absolute path to the modules directory which is
+	// used to resolve the imports of each module. It can be empty.
+	ModulePath string
+
+	// Debug represents if we're running in debug mode or not.
+	Debug bool
+
+	// Logf is a logger which should be used.
+	Logf func(format string, v ...interface{})
+}
+
+// Module documents the module with the metadata file at this path in the fs.
+// The name is what is used to refer to the module. If the module doesn't type
+// check, for example because some of its imports aren't available, then it is
+// still documented, but without any of the inferred types.
+func (obj *Docgen) Module(ctx context.Context, name string, fs engine.Fs, path string) (*docsUtil.ModuleInfo, error) {
+	output, err := inputs.ParseInput(path, fs)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not activate an input parser")
+	}
+	file := &interfaces.SourceFile{
+		FS:   output.FS,
+		Path: output.Base + output.Metadata.Main,
+	}
+
+	// The signatures are printed from this AST, since the formatter needs
+	// the one that comes right out of the parser.
+	xast, comments, err := parser.LexParseWithComments(bytes.NewReader(output.Main))
+	if err != nil {
+		err = interfaces.HighlightParseError(err, file, obj.Logf)
+		return nil, errwrap.Wrapf(err, "could not generate AST")
+	}
+	prog, ok := xast.(*ast.StmtProg)
+	if !ok {
+		// programming error
+		return nil, fmt.Errorf("unexpected AST")
+	}
+
+	typs, err := obj.infer(ctx, output)
+	if err != nil {
+		obj.Logf("%s: no inferred types: %v", name, err)
+	}
+
+	lines := strings.Split(string(output.Main), "\n")
+	docs := Docs(comments, lines)
+
+	info := &docsUtil.ModuleInfo{
+		Name:      name,
+		File:      file.Filename(),
+		Functions: []*docsUtil.ModuleEntryInfo{},
+		Classes:   []*docsUtil.ModuleEntryInfo{},
+		Variables: []*docsUtil.ModuleEntryInfo{},
+	}
+	for i, stmt := range prog.Body {
+		row := -1
+		if x, ok := stmt.(interfaces.PositionableNode); ok && x.IsSet() {
+			row, _ = x.Pos()
+		}
+
+		var entries *[]*docsUtil.ModuleEntryInfo
+		var ident string
+		switch x := stmt.(type) {
+		case *ast.StmtImport:
+			if i == 0 { // the doc comment of the whole module
+				info.Desc = docs[row]
+			}
+			continue
+		case *ast.StmtFunc:
+			entries, ident = &info.Functions, x.Name
+		case *ast.StmtClass:
+			entries, ident = &info.Classes, x.Name
+		case *ast.StmtBind:
+			entries, ident = &info.Variables, x.Ident
+		default:
+			continue
+		}
+
+		signature, err := astfmt.Signature(ctx, stmt)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not print the signature of: %s", ident)
+		}
+		entry := &docsUtil.ModuleEntryInfo{
+			Name:      ident,
+			Signature: signature,
+			File:      file.Filename(),
+			Line:      row + 1, // one-based for display
+			Desc:      docs[row],
+		}
+		if s, exists := typs[row]; exists {
+			entry.Type = &s
+		}
+		*entries = append(*entries, entry)
+	}
+
+	return info, nil
+}
+
+// infer runs the compiler on the module up to type unification, and returns
+// the type of each top-level function and variable, keyed by the zero-based
+// row that it starts on. Polymorphic functions which are never used have no
+// single type, so those aren't included.
+func (obj *Docgen) infer(ctx context.Context, output *inputs.ParsedInput) (map[int]string, error) {
+	logf := func(format string, v ...interface{}) {
+		if !obj.Debug {
+			return
+		}
+		obj.Logf(format, v...)
+	}
+
+	xast, err := parser.LexParse(bytes.NewReader(output.Main))
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not generate AST")
+	}
+
+	importVertex, err := lang.NewImports()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &interfaces.Data{
+		Fs:       output.FS,
+		FsURI:    output.FS.URI(),
+		Base:     output.Base, // base dir (absolute path) that this is rooted in
+		Files:    output.Files,
+		Imports:  importVertex,
+		Metadata: output.Metadata,
+		Modules:  obj.ModulePath,
+
+		LexParser:       parser.LexParse,
+		StrInterpolater: interpolate.StrInterpolate,
+
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("ast: "+format, v...)
+		},
+	}
+	scope, err := lang.NewScope("") // empty b/c not used
+	if err != nil {
+		return nil, err
+	}
+	iast, err := lang.Compile(xast, data, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := lang.Unify(ctx, iast, nil, obj.Debug, logf); err != nil {
+		return nil, err
+	}
+
+	prog, ok := iast.(*ast.StmtProg)
+	if !ok {
+		// programming error
+		return nil, fmt.Errorf("unexpected AST")
+	}
+	named := prog.Types() // unification loses the names of types
+	typs := make(map[int]string)
+	for _, stmt := range prog.Body {
+		var expr interfaces.Expr
+		switch x := stmt.(type) {
+		case *ast.StmtFunc:
+			expr = x.Func
+		case *ast.StmtBind:
+			expr = x.Value
+		default:
+			continue
+		}
+		typ, err := expr.Type()
+		if err != nil || typ == nil || typ.HasUni() {
+			continue // not known statically
+		}
+		s, err := astfmt.TypeString(typ.Rename(named))
+		if err != nil {
+			continue
+		}
+		row, _ := stmt.(interfaces.PositionableNode).Pos()
+		typs[row] = s
+	}
+	return typs, nil
+}
+
+// Docs returns the text of each doc comment, keyed by the zero-based row of the
+// statement that it documents. A doc comment is a block of whole line comments
+// which is directly above that row. The lines are joined into paragraphs, and
+// any lines which are notes for the developers, such as a TODO, are removed.
+// The lines of the source are needed to tell the whole line comments apart.
+func Docs(comments []*interfaces.Comment, lines []string) map[int]string {
+	full := make(map[int]string) // whole line comments keyed by row
+	for _, c := range comments {
+		if c.Row >= len(lines) || c.Col > len(lines[c.Row]) {
+			continue
+		}
+		if strings.TrimSpace(lines[c.Row][:c.Col]) != "" {
+			continue // a trailing comment
+		}
+		full[c.Row] = c.Value
+	}
+
+	docs := make(map[int]string)
+	for row := range lines {
+		if _, exists := full[row]; exists {
+			continue // a comment doesn't have a doc comment
+		}
+		if strings.TrimSpace(lines[row]) == "" {
+			continue // the block is not directly above anything
+		}
+		if _, exists := full[row-1]; !exists {
+			continue
+		}
+		start := row
+		for {
+			if _, exists := full[start-1]; !exists {
+				break
+			}
+			start--
+		}
+		block := []string{}
+		for r := start; r < row; r++ {
+			block = append(block, full[r])
+		}
+		if s := clean(block); s != "" {
+			docs[row] = s
+		}
+	}
+	return docs
+}
+
+// clean turns the lines of a doc comment into clean text. A single newline is
+// used between paragraphs, and the other lines are joined with a space. This is
+// the same format that the documentation of the golang code uses.
+func clean(block []string) string {
+	paragraphs := []string{}
+	paragraph := []string{}
+	for _, line := range block {
+		line = strings.TrimSpace(line)
+		if docsUtil.IsDevComment(line) {
+			continue
+		}
+		if line == "" {
+			if len(paragraph) > 0 {
+				paragraphs = append(paragraphs, strings.Join(paragraph, " "))
+			}
+			paragraph = []string{}
+			continue
+		}
+		paragraph = append(paragraph, line)
+	}
+	if len(paragraph) > 0 {
+		paragraphs = append(paragraphs, strings.Join(paragraph, " "))
+	}
+	return strings.Join(paragraphs, "\n")
+}
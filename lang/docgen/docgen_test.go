@@ -0,0 +1,123 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package docgen
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	docsUtil "github.com/purpleidea/mgmt/docs/util"
+	_ "github.com/purpleidea/mgmt/lang/core" // import so the funcs register
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/util"
+)
+
+func TestDocs0(t *testing.T) {
+	lines := []string{
+		"# header",        // 0
+		"",                // 1
+		"# first line",    // 2
+		"# XXX: for devs", // 3
+		"#",               // 4
+		"# second para",   // 5
+		"$x = 42 # trailing",
+		"$y = 13",
+		"",
+	}
+	comments := []*interfaces.Comment{
+		{Value: " header", Row: 0, Col: 0},
+		{Value: " first line", Row: 2, Col: 0},
+		{Value: " XXX: for devs", Row: 3, Col: 0},
+		{Value: "", Row: 4, Col: 0},
+		{Value: " second para", Row: 5, Col: 0},
+		{Value: " trailing", Row: 6, Col: 8},
+	}
+	docs := Docs(comments, lines)
+	if s := docs[6]; s != "first line\nsecond para" {
+		t.Errorf("unexpected doc: %q", s)
+	}
+	if s, exists := docs[7]; exists {
+		t.Errorf("unexpected doc from a trailing comment: %q", s)
+	}
+	if s, exists := docs[1]; exists {
+		t.Errorf("unexpected doc for a blank line: %q", s)
+	}
+	if len(docs) != 1 {
+		t.Errorf("unexpected docs: %+v", docs)
+	}
+}
+
+func TestModule0(t *testing.T) {
+	dir, err := filepath.Abs("testdata/simple/")
+	if err != nil {
+		t.Fatalf("could not get path: %+v", err)
+	}
+	obj := &Docgen{
+		Logf: func(format string, v ...interface{}) {
+			t.Logf("docgen: "+format, v...)
+		},
+	}
+	info, err := obj.Module(context.TODO(), "simple", util.NewReadOnlyOsFs(), dir+"/"+interfaces.MetadataFilename)
+	if err != nil {
+		t.Fatalf("could not document: %+v", err)
+	}
+	expected := &docsUtil.ModuleInfo{}
+	golden, err := os.ReadFile("testdata/simple.json")
+	if err != nil {
+		t.Fatalf("could not read golden file: %+v", err)
+	}
+	if err := json.Unmarshal(golden, expected); err != nil {
+		t.Fatalf("could not parse golden file: %+v", err)
+	}
+	// the golden file has paths which are relative to the test dir
+	info.File = filepath.Base(info.File)
+	for _, entries := range [][]*docsUtil.ModuleEntryInfo{info.Functions, info.Classes, info.Variables} {
+		for _, entry := range entries {
+			entry.File = filepath.Base(entry.File)
+		}
+	}
+	a, err := json.MarshalIndent(info, "", "\t")
+	if err != nil {
+		t.Fatalf("could not marshal: %+v", err)
+	}
+	e, err := json.MarshalIndent(expected, "", "\t")
+	if err != nil {
+		t.Fatalf("could not marshal: %+v", err)
+	}
+	if string(a) != string(e) {
+		t.Errorf("unexpected docs:\n%s", a)
+		t.Errorf("expected docs:\n%s", e)
+	}
+}
@@ -31,16 +31,25 @@
 package download
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
 	"fmt"
+	"io"
+	iofs "io/fs"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
+	"github.com/purpleidea/mgmt/engine"
 	"github.com/purpleidea/mgmt/lang/interfaces"
 	"github.com/purpleidea/mgmt/util/errwrap"
 
 	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/spf13/afero"
 )
 
 // Downloader implements the Downloader interface. It provides a mechanism to
@@ -58,11 +67,46 @@ type Downloader struct {
 	Retry int
 
 	// TODO: add a retry backoff parameter
+
+	// lock is the lockfile that we read in Init, or nil if there is none.
+	lock *interfaces.Lock
+
+	// resolved holds an entry for every module that we've downloaded, and
+	// is what gets written out by WriteLock.
+	resolved *interfaces.Lock
+
+	// seen stores the qualifier of each module dir that we've downloaded,
+	// since the same module is often imported from many places.
+	seen map[string]string
+
+	// paths stores the relative import path of each module dir that we've
+	// downloaded. This is where Vendor puts it.
+	paths map[string]string
 }
 
 // Init initializes the downloader with some core structures we'll need.
 func (obj *Downloader) Init(info *interfaces.DownloadInfo) error {
 	obj.info = info
+	obj.resolved = &interfaces.Lock{}
+	obj.seen = make(map[string]string)
+	obj.paths = make(map[string]string)
+
+	if obj.info.LockPath == "" || obj.info.UpdateLock {
+		return nil // nothing is pinned
+	}
+	f, err := obj.info.Fs.Open(obj.info.LockPath)
+	if os.IsNotExist(err) {
+		return nil // nothing is pinned
+	}
+	if err != nil {
+		return errwrap.Wrapf(err, "could not open lockfile `%s`", obj.info.LockPath)
+	}
+	defer f.Close()
+	lock, err := interfaces.ParseLock(f)
+	if err != nil {
+		return errwrap.Wrapf(err, "could not read lockfile `%s`", obj.info.LockPath)
+	}
+	obj.lock = lock
 	return nil
 }
 
@@ -101,9 +145,29 @@ func (obj *Downloader) Get(info *interfaces.ImportData, modulesPath string) erro
 
 	pull := false
 	dir := modulesPath + info.Path // TODO: is this dir unique?
+	qualifier := info.Qualifier()
+	if q, exists := obj.seen[dir]; exists {
+		if q != qualifier {
+			return fmt.Errorf("module `%s` is imported with different versions: `%s` and `%s`", info.URL, q, qualifier)
+		}
+		return nil // already done
+	}
+	obj.seen[dir] = qualifier
+	obj.paths[dir] = info.Path
+
+	var entry *interfaces.LockEntry
+	if obj.lock != nil {
+		if entry = obj.lock.Lookup(info.URL); entry == nil {
+			return fmt.Errorf("module `%s` is missing from the lockfile, run `mgmt check lang --update-lock`", info.URL)
+		}
+		if entry.Qualifier != qualifier {
+			return fmt.Errorf("module `%s` is locked for `%s` but imported with `%s`, run `mgmt check lang --update-lock`", info.URL, entry.Qualifier, qualifier)
+		}
+	}
 	isBare := false
 	options := &git.CloneOptions{
-		URL: info.URL,
+		URL:  info.URL,
+		Tags: git.AllTags, // tags are needed to resolve qualifiers
 		// TODO: do we want to add an option for infinite recursion here?
 		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
 		Progress:          os.Stdout,
@@ -128,6 +192,7 @@ func (obj *Downloader) Get(info *interfaces.ImportData, modulesPath string) erro
 	// TODO: repo, err := git.Clone(??? storage.Storer, billyFs, options)
 	gitDir := path.Clean(dir)
 	obj.info.Logf("cloning...")
+	fetched := true // a fresh clone is up-to-date
 	repo, err := git.PlainCloneContext(context.TODO(), gitDir, isBare, options)
 	if err == git.ErrRepositoryAlreadyExists {
 		repo, err = git.PlainOpen(gitDir)
@@ -135,6 +200,7 @@ func (obj *Downloader) Get(info *interfaces.ImportData, modulesPath string) erro
 			return errwrap.Wrapf(err, "can't open existing repo at: `%s`", dir)
 		}
 		obj.info.Logf("repo already exists!")
+		fetched = false
 
 		if obj.info.Update {
 			pull = true // make sure to pull latest...
@@ -152,8 +218,45 @@ func (obj *Downloader) Get(info *interfaces.ImportData, modulesPath string) erro
 		return errwrap.Wrapf(err, "can't work with nil work tree for: `%s`", dir)
 	}
 
+	// A pinned module is checked out at the exact commit from the lock. A
+	// module with a qualifier, or one we're locking, is resolved and then
+	// checked out. Anything else follows the default branch as before.
+	pinned := entry != nil || qualifier != "" || obj.info.UpdateLock
+	if entry != nil {
+		hash := plumbing.NewHash(entry.Commit)
+		if _, err := repo.CommitObject(hash); err != nil && !fetched {
+			if err := obj.fetch(repo); err != nil {
+				return errwrap.Wrapf(err, "can't fetch from: `%s`", info.URL)
+			}
+		}
+		if err := obj.checkout(repo, worktree, hash); err != nil {
+			return errwrap.Wrapf(err, "can't checkout locked commit `%s` of: `%s`", entry.Commit, info.URL)
+		}
+
+	} else if pinned {
+		if !fetched && (obj.info.Update || obj.info.UpdateLock) {
+			if err := obj.fetch(repo); err != nil {
+				return errwrap.Wrapf(err, "can't fetch from: `%s`", info.URL)
+			}
+			fetched = true
+		}
+		hash, err := obj.resolve(repo, info)
+		if err != nil && !fetched { // maybe it's new?
+			if err := obj.fetch(repo); err != nil {
+				return errwrap.Wrapf(err, "can't fetch from: `%s`", info.URL)
+			}
+			hash, err = obj.resolve(repo, info)
+		}
+		if err != nil {
+			return errwrap.Wrapf(err, "can't resolve version `%s` of: `%s`", qualifier, info.URL)
+		}
+		if err := obj.checkout(repo, worktree, hash); err != nil {
+			return errwrap.Wrapf(err, "can't checkout `%s` of: `%s`", hash, info.URL)
+		}
+	}
+
 	// TODO: do we need to checkout master first, before pulling?
-	if pull {
+	if pull && !pinned {
 		options := &git.PullOptions{
 			// TODO: do we want to add an option for infinite recursion here?
 			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
@@ -169,13 +272,254 @@ func (obj *Downloader) Get(info *interfaces.ImportData, modulesPath string) erro
 		}
 	}
 
-	// TODO: checkout requested sha1/tag if one was specified...
-	// if err := worktree.Checkout(opts *CheckoutOptions)
-
 	// does the repo have a metadata file present? (we'll validate it later)
 	if _, err := obj.info.Fs.Stat(dir + interfaces.MetadataFilename); err != nil {
 		return errwrap.Wrapf(err, "could not read repo metadata file `%s` in its root", interfaces.MetadataFilename)
 	}
 
+	if !pinned {
+		return nil
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return errwrap.Wrapf(err, "can't read the head of: `%s`", dir)
+	}
+	checksum, err := Checksum(gitDir)
+	if err != nil {
+		return errwrap.Wrapf(err, "can't checksum: `%s`", dir)
+	}
+	if entry != nil && entry.Checksum != checksum {
+		return fmt.Errorf("checksum mismatch for module `%s` at `%s`: the lockfile has `%s` but we got `%s`", info.URL, entry.Commit, entry.Checksum, checksum)
+	}
+	obj.resolved.Add(&interfaces.LockEntry{
+		URL:       info.URL,
+		Qualifier: qualifier,
+		Commit:    head.Hash().String(),
+		Checksum:  checksum,
+	})
+
 	return nil
 }
+
+// WriteLock writes out the lockfile with an entry for every module that we've
+// downloaded. This is used after all the imports have been followed when the
+// UpdateLock option is set.
+func (obj *Downloader) WriteLock() error {
+	msg := fmt.Sprintf("writing lockfile with %d module(s) to: `%s`", len(obj.resolved.Modules), obj.info.LockPath)
+	if obj.info.Noop {
+		msg = "(noop) " + msg // add prefix
+	}
+	obj.info.Logf(msg)
+	if obj.info.Noop {
+		return nil
+	}
+
+	b, err := obj.resolved.ToBytes()
+	if err != nil {
+		return errwrap.Wrapf(err, "can't encode lockfile")
+	}
+	f, err := obj.info.Fs.Create(obj.info.LockPath)
+	if err != nil {
+		return errwrap.Wrapf(err, "can't create lockfile")
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close() // ignore error
+		return errwrap.Wrapf(err, "can't write lockfile")
+	}
+	return f.Close()
+}
+
+// Dirs returns the sorted list of module dirs that we've downloaded. Each one
+// is an absolute path with a trailing slash.
+func (obj *Downloader) Dirs() []string {
+	dirs := []string{}
+	for dir := range obj.paths {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// Vendor copies every module that we've downloaded into the modules dir of the
+// fs, so that the code can run on hosts which can't download anything. Each one
+// is copied whole, except for its git metadata, to the same relative path that
+// it's imported from, which is where the interpreter looks for it.
+func (obj *Downloader) Vendor(fs engine.Fs, modulesPath string) error {
+	for _, dir := range obj.Dirs() {
+		dst := modulesPath + obj.paths[dir]
+		msg := fmt.Sprintf("vendoring `%s` to: `%s`", dir, dst)
+		if obj.info.Noop {
+			msg = "(noop) " + msg // add prefix
+		}
+		obj.info.Logf(msg)
+		if obj.info.Noop {
+			continue
+		}
+		if err := vendorDir(fs, dir, dst); err != nil {
+			return errwrap.Wrapf(err, "can't vendor `%s`", dir)
+		}
+	}
+	return nil
+}
+
+// vendorDir copies the contents of the src dir on the local disk into the dst
+// dir on the fs. It skips any git metadata.
+func vendorDir(dstFs engine.Fs, src, dst string) error {
+	fn := func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		target := path.Join(dst, filepath.ToSlash(rel))
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return dstFs.MkdirAll(target, info.Mode().Perm())
+		}
+		if !info.Mode().IsRegular() {
+			return nil // symlinks can't be stored in every fs
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return afero.WriteFile(dstFs, target, b, info.Mode().Perm())
+	}
+	return filepath.WalkDir(src, fn)
+}
+
+// fetch downloads any new commits and tags into an existing repo.
+func (obj *Downloader) fetch(repo *git.Repository) error {
+	options := &git.FetchOptions{
+		Tags:     git.AllTags,
+		Force:    true, // tags and branches can move upstream
+		Progress: os.Stdout,
+	}
+	obj.info.Logf("fetching...")
+	err := repo.FetchContext(context.TODO(), options)
+	if err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	return err
+}
+
+// resolve returns the commit that the qualifier of an import points to. If
+// there is no qualifier, then this is the tip of the remote default branch.
+func (obj *Downloader) resolve(repo *git.Repository, info *interfaces.ImportData) (plumbing.Hash, error) {
+	if info.Commit != "" {
+		hash := plumbing.NewHash(info.Commit)
+		if _, err := repo.CommitObject(hash); err != nil {
+			return plumbing.ZeroHash, err
+		}
+		return hash, nil
+	}
+
+	rev := ""
+	if info.Tag != "" {
+		rev = plumbing.NewTagReferenceName(info.Tag).String()
+	}
+	if info.Branch != "" {
+		rev = plumbing.NewRemoteReferenceName(git.DefaultRemoteName, info.Branch).String()
+	}
+	if rev == "" { // no qualifier, so ask the remote for its default
+		remote, err := repo.Remote(git.DefaultRemoteName)
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		refs, err := remote.ListContext(context.TODO(), &git.ListOptions{})
+		if err != nil {
+			return plumbing.ZeroHash, err
+		}
+		for _, ref := range refs {
+			if ref.Name() != plumbing.HEAD || ref.Type() != plumbing.SymbolicReference {
+				continue
+			}
+			branch := ref.Target().Short()
+			rev = plumbing.NewRemoteReferenceName(git.DefaultRemoteName, branch).String()
+		}
+		if rev == "" {
+			return plumbing.ZeroHash, fmt.Errorf("can't find the default branch")
+		}
+	}
+
+	hash, err := repo.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return plumbing.ZeroHash, err
+	}
+	return *hash, nil
+}
+
+// checkout moves the worktree to the commit if it's not already there. This
+// fails instead of overwriting any local changes.
+func (obj *Downloader) checkout(repo *git.Repository, worktree *git.Worktree, hash plumbing.Hash) error {
+	if head, err := repo.Head(); err == nil && head.Hash() == hash {
+		return nil // already there
+	}
+	obj.info.Logf("checking out `%s`...", hash)
+	return worktree.Checkout(&git.CheckoutOptions{
+		Hash: hash,
+	})
+}
+
+// Checksum returns a checksum of the contents of a module directory. It skips
+// any git metadata, so it only changes when the files in the module change. It
+// is the sha256 of a sorted listing of the sha256 and the path of every file,
+// which is similar to the output of the `sha256sum` command.
+func Checksum(dir string) (string, error) {
+	summary := &bytes.Buffer{}
+	fn := func(p string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" { // a dir, or a file for submodules
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+
+		h := sha256.New()
+		if d.Type()&iofs.ModeSymlink != 0 {
+			target, err := os.Readlink(p)
+			if err != nil {
+				return err
+			}
+			h.Write([]byte(target))
+		} else {
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(h, f)
+			f.Close() // ignore error
+			if err != nil {
+				return err
+			}
+		}
+		fmt.Fprintf(summary, "%x  %s\n", h.Sum(nil), filepath.ToSlash(rel))
+		return nil
+	}
+	// WalkDir visits everything in lexical order, so this is stable.
+	if err := filepath.WalkDir(dir, fn); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%x", interfaces.ChecksumPrefix, sha256.Sum256(summary.Bytes())), nil
+}
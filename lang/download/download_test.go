@@ -0,0 +1,266 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package download
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	langUtil "github.com/purpleidea/mgmt/lang/util"
+	"github.com/purpleidea/mgmt/util"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// commit writes the files into the repo and commits them.
+func commit(t *testing.T, repo *git.Repository, dir string, files map[string]string) plumbing.Hash {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("err: %+v", err)
+		}
+		if _, err := worktree.Add(name); err != nil {
+			t.Fatalf("err: %+v", err)
+		}
+	}
+	hash, err := worktree.Commit("test", &git.CommitOptions{
+		Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	return hash
+}
+
+// downloader returns an initialized downloader which writes into a local fs.
+func downloader(t *testing.T, lockPath string, updateLock bool) *Downloader {
+	obj := &Downloader{}
+	info := &interfaces.DownloadInfo{
+		Fs:         util.NewOsFs(),
+		LockPath:   lockPath,
+		UpdateLock: updateLock,
+		Logf: func(format string, v ...interface{}) {
+			t.Logf("download: "+format, v...)
+		},
+	}
+	if err := obj.Init(info); err != nil {
+		t.Fatalf("init failed: %+v", err)
+	}
+	return obj
+}
+
+// get parses the import name and downloads it into the modules dir.
+func get(obj *Downloader, name, modules string) error {
+	info, err := langUtil.ParseImportName(name)
+	if err != nil {
+		return err
+	}
+	return obj.Get(info, modules)
+}
+
+func TestDownload0(t *testing.T) {
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "mgmt-example1")
+	repo, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	v1 := commit(t, repo, src, map[string]string{
+		interfaces.MetadataFilename: "main: main.mcl\n",
+		"main.mcl":                  "$version = 1\n",
+	})
+	if _, err := repo.CreateTag("v1", v1, nil); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	v2 := commit(t, repo, src, map[string]string{
+		"main.mcl": "$version = 2\n",
+	})
+
+	name := "file://" + src + "/"
+	lockPath := filepath.Join(tmpdir, interfaces.LockFilename)
+	modules := filepath.Join(tmpdir, "modules") + "/"
+	if err := os.Mkdir(modules, 0755); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	checkout := modules + strings.TrimPrefix(src, "/") + "/"
+	version := func() string {
+		b, err := os.ReadFile(checkout + "main.mcl")
+		if err != nil {
+			t.Fatalf("err: %+v", err)
+		}
+		return string(b)
+	}
+
+	// pin the tag and write the lockfile
+	obj := downloader(t, lockPath, true)
+	if err := get(obj, name+"?tag=v1", modules); err != nil {
+		t.Fatalf("get failed: %+v", err)
+	}
+	if err := get(obj, name+"?tag=v2", modules); err == nil {
+		t.Errorf("expected an error for a conflicting version")
+	}
+	if s := version(); s != "$version = 1\n" {
+		t.Errorf("unexpected checkout: %s", s)
+	}
+	if err := obj.WriteLock(); err != nil {
+		t.Fatalf("write failed: %+v", err)
+	}
+	f, err := os.Open(lockPath)
+	if err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	lock, err := interfaces.ParseLock(f)
+	f.Close()
+	if err != nil {
+		t.Fatalf("parse failed: %+v", err)
+	}
+	entry := lock.Lookup(strings.TrimSuffix(name, "/") + "/")
+	if entry == nil || len(lock.Modules) != 1 {
+		t.Fatalf("unexpected lock: %+v", lock)
+	}
+	if entry.Qualifier != "tag=v1" || entry.Commit != v1.String() {
+		t.Errorf("unexpected entry: %+v", entry)
+	}
+
+	// the lockfile is honoured
+	obj = downloader(t, lockPath, false)
+	if err := get(obj, name, modules); err == nil || !strings.Contains(err.Error(), "locked for") {
+		t.Errorf("expected a qualifier mismatch, got: %+v", err)
+	}
+	obj = downloader(t, lockPath, false)
+	if err := get(obj, name+"?tag=v1", modules); err != nil {
+		t.Errorf("get failed: %+v", err)
+	}
+
+	// local changes don't match the checksum
+	if err := os.WriteFile(checkout+"main.mcl", []byte("$version = 3\n"), 0644); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	obj = downloader(t, lockPath, false)
+	if err := get(obj, name+"?tag=v1", modules); err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("expected a checksum mismatch, got: %+v", err)
+	}
+
+	// without a qualifier we lock the tip of the default branch
+	modules2 := filepath.Join(tmpdir, "modules2") + "/"
+	if err := os.Mkdir(modules2, 0755); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	obj = downloader(t, lockPath, true)
+	if err := get(obj, name, modules2); err != nil {
+		t.Fatalf("get failed: %+v", err)
+	}
+	if len(obj.resolved.Modules) != 1 || obj.resolved.Modules[0].Commit != v2.String() {
+		t.Errorf("unexpected resolved: %+v", obj.resolved.Modules[0])
+	}
+}
+
+func TestChecksum0(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.mcl"), []byte("$x = 42\n"), 0644); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, ".git", "objects"), 0755); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	sum1, err := Checksum(dir)
+	if err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	if !strings.HasPrefix(sum1, interfaces.ChecksumPrefix) {
+		t.Errorf("unexpected checksum: %s", sum1)
+	}
+
+	// git metadata is not part of the checksum
+	if err := os.WriteFile(filepath.Join(dir, ".git", "HEAD"), []byte("ref: refs/heads/main\n"), 0644); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	if sum2, err := Checksum(dir); err != nil || sum2 != sum1 {
+		t.Errorf("checksum changed: %s != %s (%+v)", sum2, sum1, err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.mcl"), []byte("$x = 13\n"), 0644); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	if sum3, err := Checksum(dir); err != nil || sum3 == sum1 {
+		t.Errorf("checksum didn't change: %s (%+v)", sum3, err)
+	}
+}
+
+func TestVendor0(t *testing.T) {
+	tmpdir := t.TempDir()
+	src := filepath.Join(tmpdir, "mgmt-example2")
+	repo, err := git.PlainInit(src, false)
+	if err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	if err := os.Mkdir(filepath.Join(src, "templates"), 0755); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	commit(t, repo, src, map[string]string{
+		interfaces.MetadataFilename: "main: main.mcl\n",
+		"main.mcl":                  "$x = 42\n",
+		"templates/motd.tmpl":       "hello\n",
+	})
+
+	modules := filepath.Join(tmpdir, "modules") + "/"
+	if err := os.Mkdir(modules, 0755); err != nil {
+		t.Fatalf("err: %+v", err)
+	}
+	obj := downloader(t, "", false)
+	if err := get(obj, "file://"+src+"/", modules); err != nil {
+		t.Fatalf("get failed: %+v", err)
+	}
+
+	fs := util.NewMemFs()
+	if err := obj.Vendor(fs, "/modules/"); err != nil {
+		t.Fatalf("vendor failed: %+v", err)
+	}
+	dst := "/modules/" + strings.TrimPrefix(src, "/") + "/"
+	for _, name := range []string{interfaces.MetadataFilename, "main.mcl", "templates/motd.tmpl"} {
+		if _, err := fs.Stat(dst + name); err != nil {
+			t.Errorf("missing vendored file `%s`: %+v", name, err)
+		}
+	}
+	if _, err := fs.Stat(dst + ".git"); err == nil {
+		t.Errorf("the git metadata was vendored")
+	}
+}
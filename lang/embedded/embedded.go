@@ -35,6 +35,7 @@ import (
 	"fmt"
 	"io/fs"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/purpleidea/mgmt/engine"
@@ -80,6 +81,17 @@ func Lookup(module string) (engine.Fs, error) {
 	return engineFS, nil
 }
 
+// Modules returns the sorted names of all of the embedded modules. They can each
+// be looked up with the Lookup function.
+func Modules() []string {
+	names := []string{}
+	for name := range registeredEmbeds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // MergeFS merges multiple filesystems and returns an fs.FS. It is provided as a
 // helper function to abstract away the underlying implementation in case we
 // ever wish to replace it with something more performant or ergonomic.
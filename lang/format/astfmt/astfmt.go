@@ -116,6 +116,58 @@ func Format(ctx context.Context, stmt interfaces.Stmt, comments []*interfaces.Co
 	return printer.buf.Bytes(), nil
 }
 
+// Signature returns the declaration of a function, class or variable statement
+// without its body or value, eg: `func add($a int, $b int = 42) int`. This is
+// used by the documentation generator, so it prints the args and the types the
+// way they were written, including the names of any named types.
+func Signature(ctx context.Context, stmt interfaces.Stmt) (string, error) {
+	printer := &printer{
+		lastRow: -1,
+	}
+
+	switch x := stmt.(type) {
+	case *ast.StmtBind:
+		printer.buf.WriteString("$" + x.Ident)
+		if x.Type != nil {
+			s, err := TypeString(x.Type)
+			if err != nil {
+				return "", err
+			}
+			printer.buf.WriteString(" " + s)
+		}
+
+	case *ast.StmtFunc:
+		fn, ok := x.Func.(*ast.ExprFunc)
+		if !ok {
+			return "", fmt.Errorf("unsupported func statement contents type: %T", x.Func)
+		}
+		printer.buf.WriteString("func " + x.Name)
+		if err := printer.defArgs(ctx, fn.Args, -1, -1, 0); err != nil {
+			return "", err
+		}
+		if fn.Return != nil {
+			s, err := TypeString(fn.Return)
+			if err != nil {
+				return "", err
+			}
+			printer.buf.WriteString(" " + s)
+		}
+
+	case *ast.StmtClass:
+		printer.buf.WriteString("class " + x.Name)
+		if x.Args != nil {
+			if err := printer.defArgs(ctx, x.Args, -1, -1, 0); err != nil {
+				return "", err
+			}
+		}
+
+	default:
+		return "", fmt.Errorf("unsupported statement type: %T", stmt)
+	}
+
+	return printer.buf.String(), nil
+}
+
 // startRow returns the zero-based source row on which this node starts, or -1
 // if no position information is available. It prefers the node's own recorded
 // position and falls back to the smallest position in the whole subtree.
@@ -315,7 +367,7 @@ func (obj *printer) stmt(ctx context.Context, stmt interfaces.Stmt, depth int) e
 		obj.buf.WriteByte('$')
 		obj.buf.WriteString(x.Ident)
 		if x.Type != nil {
-			s, err := typeString(x.Type)
+			s, err := TypeString(x.Type)
 			if err != nil {
 				return err
 			}
@@ -408,7 +460,7 @@ func (obj *printer) stmt(ctx context.Context, stmt interfaces.Stmt, depth int) e
 			if prog, ok := x.Body.(*ast.StmtProg); ok && prog.IsSet() {
 				closeParenRow, _ = prog.Pos()
 			}
-			if err := obj.defArgs(x.Args, openParenRow, closeParenRow, depth); err != nil {
+			if err := obj.defArgs(ctx, x.Args, openParenRow, closeParenRow, depth); err != nil {
 				return err
 			}
 		}
@@ -423,7 +475,7 @@ func (obj *printer) stmt(ctx context.Context, stmt interfaces.Stmt, depth int) e
 		obj.buf.WriteString("include ")
 		obj.buf.WriteString(x.Name)
 		if x.Args != nil {
-			if err := obj.callArgs(ctx, x.Args, startRow(x), endRow(x), depth); err != nil {
+			if err := obj.callArgs(ctx, x.Args, x.ArgNames, startRow(x), endRow(x), depth); err != nil {
 				return err
 			}
 		}
@@ -446,6 +498,19 @@ func (obj *printer) stmt(ctx context.Context, stmt interfaces.Stmt, depth int) e
 		obj.endLine(endRow(x))
 		return nil
 
+	case *ast.StmtType:
+		t, err := TypeString(x.Type)
+		if err != nil {
+			return err
+		}
+		obj.indent(depth)
+		obj.buf.WriteString("type ")
+		obj.buf.WriteString(x.Name)
+		obj.buf.WriteString(" = ")
+		obj.buf.WriteString(t)
+		obj.endLine(endRow(x))
+		return nil
+
 	case *ast.StmtComment:
 		// These are not produced by the parser, but handle them anyway.
 		obj.indent(depth)
@@ -597,7 +662,7 @@ func (obj *printer) stmtIf(ctx context.Context, x *ast.StmtIf, depth int) error
 	if call, ok := panicCall(x); ok {
 		obj.indent(depth)
 		obj.buf.WriteString(funcs.PanicFuncName)
-		if err := obj.callArgs(ctx, call.Args, startRow(call), endRow(call), depth); err != nil {
+		if err := obj.callArgs(ctx, call.Args, nil, startRow(call), endRow(call), depth); err != nil {
 			return err
 		}
 		obj.endLine(endRow(call))
@@ -605,6 +670,17 @@ func (obj *printer) stmtIf(ctx context.Context, x *ast.StmtIf, depth int) error
 	}
 
 	obj.indent(depth)
+	if err := obj.stmtIfChain(ctx, x, depth); err != nil {
+		return err
+	}
+	obj.endLine(endRow(x))
+	return nil
+}
+
+// stmtIfChain prints an if statement starting at the current buffer position,
+// without the final newline. An else branch which is itself an if statement is
+// printed as an `else if` chain, since that's how the parser builds those.
+func (obj *printer) stmtIfChain(ctx context.Context, x *ast.StmtIf, depth int) error {
 	obj.buf.WriteString("if ")
 	if err := obj.expr(ctx, x.Condition, depth); err != nil {
 		return err
@@ -618,6 +694,10 @@ func (obj *printer) stmtIf(ctx context.Context, x *ast.StmtIf, depth int) error
 	if err := obj.progBlock(ctx, x.ThenBranch, endRow(x.Condition), closeRow, depth); err != nil {
 		return err
 	}
+	if elseIf, ok := x.ElseBranch.(*ast.StmtIf); ok {
+		obj.buf.WriteString(" else ")
+		return obj.stmtIfChain(ctx, elseIf, depth)
+	}
 	if x.ElseBranch != nil {
 		obj.buf.WriteString(" else")
 		elseRow := obj.lastRow // the row of the closing then brace
@@ -625,7 +705,6 @@ func (obj *printer) stmtIf(ctx context.Context, x *ast.StmtIf, depth int) error
 			return err
 		}
 	}
-	obj.endLine(closeRow)
 	return nil
 }
 
@@ -689,6 +768,9 @@ func (obj *printer) expr(ctx context.Context, expr interfaces.Expr, depth int) e
 	case *ast.ExprIf:
 		return obj.exprIf(ctx, x, depth)
 
+	case *ast.ExprMatch:
+		return obj.exprMatch(ctx, x, depth)
+
 	case *ast.ExprExcept:
 		if err := obj.expr(ctx, x.Expr, depth); err != nil {
 			return err
@@ -901,11 +983,11 @@ func (obj *printer) funcSignatureBody(ctx context.Context, x *ast.ExprFunc, head
 		}
 	}
 
-	if err := obj.defArgs(x.Args, headRow, openBraceRow, depth); err != nil {
+	if err := obj.defArgs(ctx, x.Args, headRow, openBraceRow, depth); err != nil {
 		return err
 	}
 	if x.Return != nil {
-		s, err := typeString(x.Return)
+		s, err := TypeString(x.Return)
 		if err != nil {
 			return err
 		}
@@ -1065,12 +1147,20 @@ func (obj *printer) exprCall(ctx context.Context, x *ast.ExprCall, depth int) er
 	if x.Anon != nil {
 		openRow = endRow(x.Anon)
 	}
-	return obj.callArgs(ctx, x.Args, openRow, endRow(x), depth)
+	return obj.callArgs(ctx, x.Args, x.ArgNames, openRow, endRow(x), depth)
 }
 
 // callArgs prints a parenthesized function call arg list in single or multi
-// line form. The openRow is the row that the open parenthesis is on.
-func (obj *printer) callArgs(ctx context.Context, args []interfaces.Expr, openRow, closeRow, depth int) error {
+// line form. The openRow is the row that the open parenthesis is on. The names
+// are either nil, or the name of each arg if it was passed by name.
+func (obj *printer) callArgs(ctx context.Context, args []interfaces.Expr, names []string, openRow, closeRow, depth int) error {
+	name := func(i int) {
+		if i < len(names) && names[i] != "" {
+			obj.buf.WriteString(names[i])
+			obj.buf.WriteString(" => ")
+		}
+	}
+
 	multi := false
 	if len(args) > 0 && openRow >= 0 && startRow(args[0]) > openRow {
 		multi = true
@@ -1082,6 +1172,7 @@ func (obj *printer) callArgs(ctx context.Context, args []interfaces.Expr, openRo
 			if i > 0 {
 				obj.buf.WriteString(", ")
 			}
+			name(i)
 			if err := obj.expr(ctx, arg, depth); err != nil {
 				return err
 			}
@@ -1092,11 +1183,12 @@ func (obj *printer) callArgs(ctx context.Context, args []interfaces.Expr, openRo
 
 	obj.buf.WriteByte('(')
 	obj.endLine(openRow)
-	for _, arg := range args {
+	for i, arg := range args {
 		start := startRow(arg)
 		obj.flushComments(start, depth+1)
 		obj.gap(start)
 		obj.indent(depth + 1)
+		name(i)
 		if err := obj.expr(ctx, arg, depth+1); err != nil {
 			return err
 		}
@@ -1147,11 +1239,17 @@ func (obj *printer) exprIf(ctx context.Context, x *ast.ExprIf, depth int) error
 		multi = true
 	}
 
+	elseIf, isElseIf := x.ElseBranch.(*ast.ExprIf)
+
 	if !multi {
 		obj.buf.WriteString(" { ")
 		if err := obj.expr(ctx, thenInner, depth); err != nil {
 			return err
 		}
+		if isElseIf {
+			obj.buf.WriteString(" } else ")
+			return obj.exprIf(ctx, elseIf, depth)
+		}
 		obj.buf.WriteString(" } else { ")
 		if err := obj.expr(ctx, elseInner, depth); err != nil {
 			return err
@@ -1174,6 +1272,13 @@ func (obj *printer) exprIf(ctx context.Context, x *ast.ExprIf, depth int) error
 	obj.flushComments(elseRow, depth+1)
 	obj.gap(elseRow)
 	obj.indent(depth)
+	if isElseIf {
+		obj.buf.WriteString("} else ")
+		if elseRow >= 0 {
+			obj.lastRow = elseRow
+		}
+		return obj.exprIf(ctx, elseIf, depth)
+	}
 	obj.buf.WriteString("} else {")
 	obj.endLine(elseRow)
 
@@ -1190,10 +1295,112 @@ func (obj *printer) exprIf(ctx context.Context, x *ast.ExprIf, depth int) error
 	return nil
 }
 
+// exprMatch prints a match expression in single or multi line form. The multi
+// line form puts each arm on its own line with a trailing comma, while the
+// single line form has no trailing comma.
+func (obj *printer) exprMatch(ctx context.Context, x *ast.ExprMatch, depth int) error {
+	obj.buf.WriteString("match ")
+	if err := obj.expr(ctx, x.Expr, depth); err != nil {
+		return err
+	}
+
+	// The grammar guarantees that the open curly brace is on the same line
+	// as the end of the expression that we're matching on.
+	openRow := endRow(x.Expr)
+	closeRow := endRow(x)
+	multi := obj.hasCommentBefore(closeRow)
+	if len(x.Arms) > 0 && openRow >= 0 && startRow(x.Arms[0]) > openRow {
+		multi = true
+	}
+
+	if !multi {
+		obj.buf.WriteString(" { ")
+		for i, arm := range x.Arms {
+			if i > 0 {
+				obj.buf.WriteString(", ")
+			}
+			if err := obj.matchArm(ctx, arm, depth); err != nil {
+				return err
+			}
+		}
+		obj.buf.WriteString(" }")
+		obj.lastRow = max(obj.lastRow, closeRow)
+		return nil
+	}
+
+	obj.buf.WriteString(" {")
+	obj.endLine(openRow)
+	for _, arm := range x.Arms {
+		start := startRow(arm)
+		obj.flushComments(start, depth+1)
+		obj.gap(start)
+		obj.indent(depth + 1)
+		if err := obj.matchArm(ctx, arm, depth+1); err != nil {
+			return err
+		}
+		obj.buf.WriteByte(',')
+		obj.endLine(endRow(arm))
+	}
+	obj.closeBlock(closeRow, depth)
+	return nil
+}
+
+// matchArm prints one `pattern => expr` arm of a match expression.
+func (obj *printer) matchArm(ctx context.Context, arm *ast.ExprMatchArm, depth int) error {
+	if err := obj.matchPattern(ctx, arm.Pattern, depth); err != nil {
+		return err
+	}
+	obj.buf.WriteString(" => ")
+	return obj.expr(ctx, arm.Body, depth)
+}
+
+// matchPattern prints a match expression pattern. The grammar only allows these
+// on a single line, so there is no multi line form.
+func (obj *printer) matchPattern(ctx context.Context, x *ast.MatchPattern, depth int) error {
+	switch x.Kind {
+	case ast.MatchPatternWildcard:
+		obj.buf.WriteByte('_')
+		return nil
+
+	case ast.MatchPatternValue:
+		return obj.expr(ctx, x.Value, depth)
+
+	case ast.MatchPatternList:
+		obj.buf.WriteByte('[')
+		for i, element := range x.List {
+			if i > 0 {
+				obj.buf.WriteString(", ")
+			}
+			if err := obj.matchPattern(ctx, element, depth); err != nil {
+				return err
+			}
+		}
+		obj.buf.WriteByte(']')
+		return nil
+
+	case ast.MatchPatternStruct:
+		obj.buf.WriteString("struct{")
+		for i, field := range x.Fields {
+			if i > 0 {
+				obj.buf.WriteString(", ")
+			}
+			obj.buf.WriteString(field.Name)
+			obj.buf.WriteString(" => ")
+			if err := obj.matchPattern(ctx, field.Pattern, depth); err != nil {
+				return err
+			}
+		}
+		obj.buf.WriteByte('}')
+		return nil
+	}
+
+	return fmt.Errorf("unsupported match pattern kind: %d", x.Kind)
+}
+
 // defArgs prints the parenthesized definition arg list of a function or class
 // in single or multi line form, eg: `($a, $b str)`. The openRow and closeRow
 // are the rows that the two parenthesis are on.
-func (obj *printer) defArgs(args []*interfaces.Arg, openRow, closeRow, depth int) error {
+func (obj *printer) defArgs(ctx context.Context, args []*interfaces.Arg, openRow, closeRow, depth int) error {
 	multi := obj.hasCommentBefore(closeRow)
 	if len(args) > 0 && openRow >= 0 && args[0].IsSet() {
 		if row, _ := args[0].Pos(); row > openRow {
@@ -1207,11 +1414,9 @@ func (obj *printer) defArgs(args []*interfaces.Arg, openRow, closeRow, depth int
 			if i > 0 {
 				obj.buf.WriteString(", ")
 			}
-			s, err := argString(arg)
-			if err != nil {
+			if err := obj.defArg(ctx, arg, depth); err != nil {
 				return err
 			}
-			obj.buf.WriteString(s)
 		}
 		obj.buf.WriteByte(')')
 		return nil
@@ -1225,14 +1430,15 @@ func (obj *printer) defArgs(args []*interfaces.Arg, openRow, closeRow, depth int
 			start, _ = arg.Pos()
 			end, _ = arg.End()
 		}
+		if arg.Default != nil {
+			end = endRow(arg.Default)
+		}
 		obj.flushComments(start, depth+1)
 		obj.gap(start)
 		obj.indent(depth + 1)
-		s, err := argString(arg)
-		if err != nil {
+		if err := obj.defArg(ctx, arg, depth+1); err != nil {
 			return err
 		}
-		obj.buf.WriteString(s)
 		obj.buf.WriteByte(',')
 		obj.endLine(end)
 	}
@@ -1246,26 +1452,33 @@ func (obj *printer) defArgs(args []*interfaces.Arg, openRow, closeRow, depth int
 	return nil
 }
 
-// argString returns a single definition arg, eg: `$a` or `$b str`.
-func argString(arg *interfaces.Arg) (string, error) {
-	s := "$" + arg.Name
+// defArg prints a single definition arg, eg: `$a`, `$b str` or `$c int = 42`.
+func (obj *printer) defArg(ctx context.Context, arg *interfaces.Arg, depth int) error {
+	obj.buf.WriteString("$" + arg.Name)
 	if arg.Type != nil {
-		t, err := typeString(arg.Type)
+		t, err := TypeString(arg.Type)
 		if err != nil {
-			return "", err
+			return err
 		}
-		s += " " + t
+		obj.buf.WriteString(" " + t)
 	}
-	return s, nil
+	if arg.Default != nil {
+		obj.buf.WriteString(" = ")
+		return obj.expr(ctx, arg.Default, depth)
+	}
+	return nil
 }
 
-// typeString returns the mcl source representation of a type. This differs from
+// TypeString returns the mcl source representation of a type. This differs from
 // the String method on the type, because function arg names must be printed
 // with a dollar sign prefix to be parseable as mcl.
-func typeString(typ *types.Type) (string, error) {
+func TypeString(typ *types.Type) (string, error) {
 	if typ == nil {
 		return "", fmt.Errorf("nil type")
 	}
+	if typ.Name != "" { // it was named by a type statement
+		return typ.Name, nil
+	}
 
 	switch typ.Kind {
 	case types.KindBool:
@@ -1281,18 +1494,18 @@ func typeString(typ *types.Type) (string, error) {
 		return "float", nil
 
 	case types.KindList:
-		s, err := typeString(typ.Val)
+		s, err := TypeString(typ.Val)
 		if err != nil {
 			return "", err
 		}
 		return "[]" + s, nil
 
 	case types.KindMap:
-		key, err := typeString(typ.Key)
+		key, err := TypeString(typ.Key)
 		if err != nil {
 			return "", err
 		}
-		val, err := typeString(typ.Val)
+		val, err := TypeString(typ.Val)
 		if err != nil {
 			return "", err
 		}
@@ -1305,7 +1518,7 @@ func typeString(typ *types.Type) (string, error) {
 			if !ok {
 				return "", fmt.Errorf("malformed struct type field: %s", name)
 			}
-			s, err := typeString(t)
+			s, err := TypeString(t)
 			if err != nil {
 				return "", err
 			}
@@ -1320,7 +1533,7 @@ func typeString(typ *types.Type) (string, error) {
 			if !ok {
 				return "", fmt.Errorf("malformed func type arg: %s", name)
 			}
-			s, err := typeString(t)
+			s, err := TypeString(t)
 			if err != nil {
 				return "", err
 			}
@@ -1338,7 +1551,7 @@ func typeString(typ *types.Type) (string, error) {
 		}
 		out := ""
 		if typ.Out != nil {
-			s, err := typeString(typ.Out)
+			s, err := TypeString(typ.Out)
 			if err != nil {
 				return "", err
 			}
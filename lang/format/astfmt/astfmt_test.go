@@ -117,6 +117,81 @@ func TestFormatUnsupportedStmt(t *testing.T) {
 	}
 }
 
+func TestSignature(t *testing.T) {
+	endpoint := types.NewType("struct{host str; port int}")
+	endpoint.Name = "lib.endpoint"
+
+	tests := []struct {
+		name string
+		stmt interfaces.Stmt
+		want string
+	}{
+		{
+			name: "bind",
+			stmt: &ast.StmtBind{
+				Ident: "x",
+				Value: &ast.ExprInt{V: 42},
+			},
+			want: "$x",
+		},
+		{
+			name: "bind with named type",
+			stmt: &ast.StmtBind{
+				Ident: "x",
+				Value: &ast.ExprInt{V: 42},
+				Type:  endpoint,
+			},
+			want: "$x lib.endpoint",
+		},
+		{
+			name: "func",
+			stmt: &ast.StmtFunc{
+				Name: "add",
+				Func: &ast.ExprFunc{
+					Args: []*interfaces.Arg{
+						{Name: "a", Type: types.TypeInt},
+						{Name: "b", Default: &ast.ExprInt{V: 42}},
+					},
+					Return: types.TypeInt,
+					Body:   &ast.ExprVar{Name: "a"},
+				},
+			},
+			want: "func add($a int, $b = 42) int",
+		},
+		{
+			name: "class",
+			stmt: &ast.StmtClass{
+				Name: "server",
+				Args: []*interfaces.Arg{
+					{Name: "e", Type: endpoint},
+				},
+				Body: &ast.StmtProg{},
+			},
+			want: "class server($e lib.endpoint)",
+		},
+		{
+			name: "class without args",
+			stmt: &ast.StmtClass{
+				Name: "base",
+				Body: &ast.StmtProg{},
+			},
+			want: "class base",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := Signature(context.TODO(), tt.stmt)
+			if err != nil {
+				t.Fatalf("func Signature failed: %+v", err)
+			}
+			if out != tt.want {
+				t.Fatalf("unexpected signature: got %s, expected %s", out, tt.want)
+			}
+		})
+	}
+}
+
 func TestTypeString(t *testing.T) {
 	tests := []struct {
 		name string
@@ -143,9 +218,9 @@ func TestTypeString(t *testing.T) {
 			if typ == nil {
 				t.Fatalf("could not build type: %s", tt.typ)
 			}
-			out, err := typeString(typ)
+			out, err := TypeString(typ)
 			if err != nil {
-				t.Fatalf("func typeString failed: %+v", err)
+				t.Fatalf("func TypeString failed: %+v", err)
 			}
 			if out != tt.want {
 				t.Fatalf("unexpected type: got %s, expected %s", out, tt.want)
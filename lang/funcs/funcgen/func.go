@@ -48,6 +48,9 @@ type function struct {
 	InternalName string `yaml:"internalName"`
 	// Help is the docstring of the function, including // and new lines.
 	Help string `yaml:"help"`
+	// Deprecated is the deprecation notice from the docstring of the golang
+	// function, or empty if it isn't deprecated.
+	Deprecated string `yaml:"deprecated"`
 	// GolangPackage is the representation of the package.
 	GolangPackage *golangPackage `yaml:"golangPackage"`
 	// GolangFunc is the name of the function in golang.
@@ -159,6 +159,7 @@ func (obj *golangPackage) parsefuncs() (functions, error) {
 			MclName:       strcase.ToSnake(name),
 			InternalName:  internalName,
 			Help:          help,
+			Deprecated:    deprecation(funcDocs[name]),
 			GolangPackage: obj,
 			GolangFunc:    name,
 			Errorful:      errorFul,
@@ -335,6 +336,19 @@ func collectFuncDocs(p *packages.Package) map[string]string {
 	return docs
 }
 
+// deprecation returns the text of the "Deprecated:" paragraph of a golang doc
+// comment joined onto a single line, or the empty string if there isn't one.
+func deprecation(doc string) string {
+	for _, p := range strings.Split(doc, "\n\n") {
+		p = strings.TrimSpace(p)
+		if !strings.HasPrefix(p, "Deprecated: ") {
+			continue
+		}
+		return strings.Join(strings.Fields(strings.TrimPrefix(p, "Deprecated: ")), " ")
+	}
+	return ""
+}
+
 // buildHelp builds a help block: autogenerated header + signature + doc text.
 func buildHelp(internalName, publicName string, sig *types.Signature, doc string) string {
 	var b strings.Builder
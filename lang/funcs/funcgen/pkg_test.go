@@ -154,3 +154,17 @@ func sortNorms(ns []normalizedFunction) {
 		return ns[i].InternalName < ns[j].InternalName
 	})
 }
+
+func TestDeprecation(t *testing.T) {
+	tests := map[string]string{
+		"":                      "",
+		"Title returns a copy.": "",
+		"Title returns a copy.\n\nDeprecated: Use\ncases instead.\n": "Use cases instead.",
+		"Foo.\n\nDeprecated: Nope.\n\nMore text here.":               "Nope.",
+	}
+	for doc, expected := range tests {
+		if out := deprecation(doc); out != expected {
+			t.Errorf("doc %q: expected %q, got %q", doc, expected, out)
+		}
+	}
+}
@@ -49,6 +49,9 @@ func init() {
 		},
 		T: types.NewType("{{$func.Signature}}"),
 		F: {{$func.InternalName}},
+{{- if $func.Deprecated }}
+		Deprecated: {{ printf "%q" $func.Deprecated }},
+{{- end }}
 	})
 {{ end }}
 }
@@ -75,6 +75,10 @@ const (
 	// ContainsFuncName is the name the contains function is registered as.
 	ContainsFuncName = "contains"
 
+	// LenFuncName is the name the len function is registered as. It is
+	// listed here because the match expression desugaring needs it.
+	LenFuncName = "len"
+
 	// LookupFuncName is the name this function is registered as. This
 	// starts with an underscore so that it cannot be used from the lexer.
 	LookupFuncName = "_lookup"
@@ -186,6 +190,27 @@ func ModuleRegister(module, name string, fn func() interfaces.Func) {
 	Register(module+ModuleSep+name, fn)
 }
 
+// registeredDeprecations maps the name of each deprecated function to a notice
+// which says why, and what to use instead. It is used by the linter.
+var registeredDeprecations = make(map[string]string) // must initialize
+
+// Deprecate marks the registered function with this name as deprecated. The
+// notice should say what to use instead. It is usually called in the init()
+// method right after the function is registered.
+func Deprecate(name, notice string) {
+	if _, exists := registeredFuncs[name]; !exists {
+		panic(fmt.Sprintf("can't deprecate the unknown func %s", name))
+	}
+	registeredDeprecations[name] = notice
+}
+
+// LookupDeprecation returns the deprecation notice of the registered function
+// with this name, and whether it is deprecated at all.
+func LookupDeprecation(name string) (string, bool) {
+	notice, exists := registeredDeprecations[name]
+	return notice, exists
+}
+
 // Lookup returns a pointer to the function's struct. It may be convertible to a
 // BuildableFunc or InferableFunc if the particular function implements those
 // additional methods.
@@ -89,6 +89,10 @@ type Scaffold struct {
 	// struct or function for the doc string instead of the F field if this
 	// is specified.
 	D interface{}
+
+	// Deprecated is a notice which marks this function as deprecated. It
+	// should say what to use instead. It is usually left empty.
+	Deprecated string
 }
 
 // Register registers a simple, static, pure, polymorphic function. It is easier
@@ -164,6 +168,10 @@ func Register(name string, scaffold *Scaffold) {
 			Func:  scaffold.F,
 		}
 	})
+
+	if scaffold.Deprecated != "" {
+		funcs.Deprecate(name, scaffold.Deprecated)
+	}
 }
 
 // ModuleRegister is exactly like Register, except that it registers within a
@@ -34,6 +34,8 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"io"
+	iofs "io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -41,19 +43,23 @@ import (
 	"time"
 
 	cliUtil "github.com/purpleidea/mgmt/cli/util"
+	docsUtil "github.com/purpleidea/mgmt/docs/util"
 	"github.com/purpleidea/mgmt/engine"
 	"github.com/purpleidea/mgmt/gapi"
 	"github.com/purpleidea/mgmt/lang"
 	"github.com/purpleidea/mgmt/lang/ast"
+	"github.com/purpleidea/mgmt/lang/docgen"
 	"github.com/purpleidea/mgmt/lang/download"
+	"github.com/purpleidea/mgmt/lang/embedded"
 	"github.com/purpleidea/mgmt/lang/format"
 	"github.com/purpleidea/mgmt/lang/format/astfmt"
-	"github.com/purpleidea/mgmt/lang/funcs/vars"
 	"github.com/purpleidea/mgmt/lang/inputs"
 	"github.com/purpleidea/mgmt/lang/interfaces"
 	"github.com/purpleidea/mgmt/lang/interpolate"
+	"github.com/purpleidea/mgmt/lang/lsp"
 	"github.com/purpleidea/mgmt/lang/parser"
-	"github.com/purpleidea/mgmt/lang/types"
+	"github.com/purpleidea/mgmt/lang/repl"
+	"github.com/purpleidea/mgmt/lang/tester"
 	"github.com/purpleidea/mgmt/lang/unification"
 	"github.com/purpleidea/mgmt/pgraph"
 	"github.com/purpleidea/mgmt/util"
@@ -100,6 +106,129 @@ func (obj *GAPI) Formatter() *format.Formatter {
 	}
 }
 
+// Test runs the mcl unit tests which are selected by the args. The cli finds
+// this method through the gapi registry, for the same reason as the Formatter.
+func (obj *GAPI) Test(ctx context.Context, args *cliUtil.TestArgs, debug bool, logf func(format string, v ...interface{})) (bool, error) {
+	modules, err := modulePath(args.ModulePath)
+	if err != nil {
+		return false, err
+	}
+
+	t := &tester.Tester{
+		Run:          args.Run,
+		UpdateGolden: args.UpdateGolden,
+		ModulePath:   modules,
+		Timeout:      time.Duration(args.Timeout) * time.Second,
+		Verbose:      args.Verbose,
+		Debug:        debug,
+		Logf:         logf,
+	}
+	if err := t.Init(); err != nil {
+		return false, err
+	}
+	return t.TestPath(ctx, args.Input)
+}
+
+// Lsp runs the mcl language server. The cli finds this method through the gapi
+// registry, for the same reason as the Formatter.
+func (obj *GAPI) Lsp(ctx context.Context, args *cliUtil.LspArgs, r io.Reader, w io.Writer, debug bool, logf func(format string, v ...interface{})) error {
+	modules, err := modulePath(args.ModulePath)
+	if err != nil {
+		return err
+	}
+
+	server := &lsp.Server{
+		ModulePath: modules,
+		Debug:      debug,
+		Logf:       logf,
+	}
+	if err := server.Init(); err != nil {
+		return err
+	}
+	return server.Run(ctx, r, w)
+}
+
+// Repl runs the interactive mcl interpreter. The cli finds this method through
+// the gapi registry, for the same reason as the Formatter.
+func (obj *GAPI) Repl(ctx context.Context, args *cliUtil.ReplArgs, r io.Reader, w io.Writer, debug bool, logf func(format string, v ...interface{})) error {
+	modules, err := modulePath(args.ModulePath)
+	if err != nil {
+		return err
+	}
+
+	interpreter := &repl.Repl{
+		ModulePath: modules,
+		Debug:      debug,
+		Logf:       logf,
+	}
+	if err := interpreter.Init(); err != nil {
+		return err
+	}
+	return interpreter.Run(ctx, r, w)
+}
+
+// Docs documents the embedded mcl modules and the ones in the modules dir. The
+// cli finds this method through the gapi registry, for the same reason as the
+// Formatter.
+func (obj *GAPI) Docs(ctx context.Context, args *cliUtil.DocsArgs, debug bool, logf func(format string, v ...interface{})) (map[string]*docsUtil.ModuleInfo, error) {
+	modules, err := modulePath(args.ModulePath)
+	if err != nil {
+		return nil, err
+	}
+
+	generator := &docgen.Docgen{
+		ModulePath: modules,
+		Debug:      debug,
+		Logf:       logf,
+	}
+	result := make(map[string]*docsUtil.ModuleInfo)
+
+	for _, name := range embedded.Modules() {
+		fs, err := embedded.Lookup(name)
+		if err != nil {
+			return nil, err
+		}
+		info, err := generator.Module(ctx, name, fs, "/"+interfaces.MetadataFilename)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not document module: %s", name)
+		}
+		result[name] = info
+	}
+
+	if args.ModulesDir == "" {
+		return result, nil
+	}
+	localFs := util.NewReadOnlyOsFs() // always the local fs
+	paths := []string{}
+	err = filepath.WalkDir(args.ModulesDir, func(path string, d iofs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && d.Name() == interfaces.MetadataFilename {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not find modules in: %s", args.ModulesDir)
+	}
+	for _, path := range paths { // sorted by the walk
+		dir := filepath.Dir(path)
+		rel, err := filepath.Rel(filepath.Dir(filepath.Clean(args.ModulesDir)), dir)
+		if err != nil {
+			return nil, err
+		}
+		name := rel + "/" // eg: modules/cups/
+		info, err := generator.Module(ctx, name, localFs, path)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not document module: %s", name)
+		}
+		result[name] = info
+	}
+
+	return result, nil
+}
+
 // Cli takes an *Info struct, and returns our deploy if activated, and if there
 // are any validation problems, you should return an error. If there is no
 // deploy, then you should return a nil deploy and a nil error. This is passed
@@ -128,16 +257,9 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 	}
 
 	// empty by default (don't set for deploy, only download)
-	modules := args.ModulePath
-	if modules != "" && !strings.HasSuffix(modules, "/") {
-		return nil, fmt.Errorf("module path does not end with a slash")
-	}
-	if modules != "" && !strings.HasPrefix(modules, "/") {
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, err
-		}
-		modules = filepath.Join(wd, modules) + "/"
+	modules, err := modulePath(args.ModulePath)
+	if err != nil {
+		return nil, err
 	}
 
 	// TODO: while reading through trees of metadata files, we could also
@@ -171,7 +293,8 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 	// This runs the necessary downloads. It passes a downloader in, which
 	// can be used to pull down or update any missing imports.
 	var downloader interfaces.Downloader
-	if args.Download {
+	var locker *download.Downloader   // writes the lockfile
+	if args.Download || args.Vendor { // vendoring needs the downloads
 		downloadInfo := &interfaces.DownloadInfo{
 			Fs: downloadFs, // the local fs!
 
@@ -180,6 +303,10 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 			Sema:   info.Flags.Sema,
 			Update: args.Update,
 
+			// the lockfile lives next to the top-level metadata file
+			LockPath:   output.Base + interfaces.LockFilename,
+			UpdateLock: args.UpdateLock,
+
 			Debug: debug,
 			Logf: func(format string, v ...interface{}) {
 				// TODO: is this a sane prefix to use here?
@@ -187,24 +314,20 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 			},
 		}
 		// this fulfills the interfaces.Downloader interface
-		downloader = &download.Downloader{
+		locker = &download.Downloader{
 			Depth: args.Depth, // default of infinite is -1
 			Retry: args.Retry, // infinite is -1
 		}
-		if err := downloader.Init(downloadInfo); err != nil {
+		if err := locker.Init(downloadInfo); err != nil {
 			return nil, errwrap.Wrapf(err, "could not initialize downloader")
 		}
+		downloader = locker
 	}
 
-	importGraph, err := pgraph.NewGraph("importGraph")
+	importVertex, err := lang.NewImports()
 	if err != nil {
 		return nil, err
 	}
-	importVertex := &pgraph.SelfVertex{
-		Name:  "",          // first node is the empty string
-		Graph: importGraph, // store a reference to ourself
-	}
-	importGraph.AddVertex(importVertex)
 
 	//logf("init...")
 	logf("import: %s", output.Base)
@@ -232,54 +355,31 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 			logf("ast: "+format, v...)
 		},
 	}
-	// some of this might happen *after* interpolate in SetScope or Unify...
-	if err := xast.Init(data); err != nil {
-		return nil, errwrap.Wrapf(err, "could not init and validate AST")
-	}
-
-	if debug {
-		logf("interpolating...")
-	}
-	// interpolate strings and other expansionable nodes in AST
-	iast, err := xast.Interpolate()
-	if err != nil {
-		return nil, errwrap.Wrapf(err, "could not interpolate AST")
-	}
 
 	hostname := ""
 	if h := info.Flags.Hostname; h != nil {
 		hostname = *h // it's optional, since this value is not used...
 	}
-	variables := map[string]interfaces.Expr{
-		"purpleidea": &ast.ExprStr{V: "hello world!"}, // james says hi
-		// TODO: change to a func when we can change hostname dynamically!
-		"hostname": &ast.ExprStr{V: hostname}, // NOTE: can be empty b/c not used
-	}
-	consts := ast.VarPrefixToVariablesScope(vars.ConstNamespace) // strips prefix!
-	addback := vars.ConstNamespace + interfaces.ModuleSep        // add it back...
-	variables, err = ast.MergeExprMaps(variables, consts, addback)
+	scope, err := lang.NewScope(hostname) // NOTE: can be empty b/c not used
 	if err != nil {
-		return nil, errwrap.Wrapf(err, "couldn't merge in consts")
-	}
-
-	// top-level, built-in, initial global scope
-	scope := &interfaces.Scope{
-		Variables: variables,
-		// all the built-in top-level, core functions enter here...
-		Functions: ast.FuncPrefixToFunctionsScope(""), // runs funcs.LookupPrefix
+		return nil, err
 	}
 
-	if debug {
-		logf("scope building...")
-	}
-	// propagate the scope down through the AST...
 	// We use SetScope because it follows all of the imports through. I did
 	// not think we needed to pass in an initial scope because the download
 	// operation should not depend on any initial scope values, since those
 	// would all be runtime changes, and we do not support dynamic imports,
 	// however, we need to since we're doing type unification to err early!
-	if err := iast.SetScope(scope); err != nil { // empty initial scope!
-		return nil, errwrap.Wrapf(err, "could not set scope")
+	iast, err := lang.Compile(xast, data, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	// All of the imports have been downloaded now, so we can pin them.
+	if locker != nil && args.UpdateLock {
+		if err := locker.WriteLock(); err != nil {
+			return nil, errwrap.Wrapf(err, "could not write lockfile")
+		}
 	}
 
 	// Previously the `get` command would stop here.
@@ -300,25 +400,10 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 
 	if args.CheckUnify || !args.CheckOnly {
 		// apply type unification
-		unificationLogf := func(format string, v ...interface{}) {
-			logf("unification: "+format, v...)
-		}
 		logf("running type unification...")
 
-		solver, err := unification.LookupDefault()
-		if err != nil {
-			return nil, errwrap.Wrapf(err, "could not get default solver")
-		}
-		unifier := &unification.Unifier{
-			AST:          iast,
-			Solver:       solver,
-			Strategy:     unificationStrategy,
-			UnifiedState: types.NewUnifiedState(),
-			Debug:        debug,
-			Logf:         unificationLogf,
-		}
 		startTime := time.Now()
-		unifyErr := unifier.Unify(context.TODO())
+		unifyErr := lang.Unify(context.TODO(), iast, unificationStrategy, debug, logf)
 		delta := time.Since(startTime)
 		formatted := delta.String()
 		if delta.Milliseconds() > 1000 { // 1 second
@@ -327,9 +412,9 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 		if unifyErr != nil {
 			if args.CheckOnly {
 				logf("type unification failed after %s", formatted)
-				checkErr = errwrap.Append(checkErr, errwrap.Wrapf(unifyErr, "could not unify types"))
+				checkErr = errwrap.Append(checkErr, unifyErr)
 			} else {
-				return nil, errwrap.Wrapf(unifyErr, "could not unify types")
+				return nil, unifyErr
 			}
 		} else if args.CheckOnly {
 			logf("type unification succeeded in %s", formatted)
@@ -371,6 +456,31 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 			}
 		}
 	}
+	if args.CheckLint {
+		logf("running lint...")
+		issues, err := ast.Lint(iast)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not lint")
+		}
+		count := 0
+		for _, issue := range issues {
+			// Only report on our own code, and not on the code of
+			// our imports, since we can't change those files here.
+			if issue.File.Filename() != issue.File.Path || !strings.HasPrefix(issue.File.Path, output.Base) {
+				continue
+			}
+			logf("lint: %s", issue)
+			count++
+		}
+		if count > 0 {
+			err := fmt.Errorf("found %d lint issue(s)", count)
+			if args.CheckOnly {
+				checkErr = errwrap.Append(checkErr, err)
+			} else {
+				return nil, err
+			}
+		}
+	}
 	if args.CheckOnly {
 		return nil, checkErr
 	}
@@ -404,6 +514,23 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 	// There are duplicates if in our dag we use the same import twice.
 	files = util.StrRemoveDuplicatesInList(files)
 
+	// Vendored modules are copied whole further below, so skip their files
+	// here. They might not be under the modules dir which we rebase from.
+	if args.Vendor {
+		vendored := locker.Dirs()
+		filtered := []string{}
+	Loop:
+		for _, src := range files {
+			for _, dir := range vendored {
+				if util.HasPathPrefix(src, dir) {
+					continue Loop
+				}
+			}
+			filtered = append(filtered, src)
+		}
+		files = filtered
+	}
+
 	// Add any missing dirs, so that we don't need to use `MkdirAll`...
 	// FIXME: It's possible that the dirs get generated upstream, but it's
 	// not exactly clear where they'd need to get added into the list. If we
@@ -522,6 +649,23 @@ func (obj *GAPI) Cli(info *gapi.Info) (*gapi.Deploy, error) {
 		}
 	}
 
+	// Copy all the downloaded modules into the deploy, so that the hosts
+	// never need network access to find them. The interpreter on each host
+	// always looks for them in this dir of the deploy fs.
+	if args.Vendor {
+		logf("vendoring modules...")
+		if err := locker.Vendor(fs, "/"+interfaces.ModuleDirectory); err != nil {
+			return nil, errwrap.Wrapf(err, "could not vendor modules")
+		}
+		// include the lockfile so the vendored versions can be seen
+		lockPath := output.Base + interfaces.LockFilename
+		if _, err := localFs.Stat(lockPath); err == nil {
+			if err := gapi.CopyFileToFs(writeableFS, lockPath, "/"+interfaces.LockFilename); err != nil {
+				return nil, errwrap.Wrapf(err, "can't copy lockfile")
+			}
+		}
+	}
+
 	// display the deploy fs tree
 	if debug { // this should only be shown on debug, or `entry` looks messy!
 		logf("input: %s", args.Input)
@@ -684,3 +828,18 @@ func (obj *GAPI) errAppend(err error) {
 	obj.err = errwrap.Append(obj.err, err)
 	obj.errMutex.Unlock()
 }
+
+// modulePath validates the module path arg, and makes it absolute if needed.
+func modulePath(modules string) (string, error) {
+	if modules != "" && !strings.HasSuffix(modules, "/") {
+		return "", fmt.Errorf("module path does not end with a slash")
+	}
+	if modules != "" && !strings.HasPrefix(modules, "/") {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		modules = filepath.Join(wd, modules) + "/"
+	}
+	return modules, nil
+}
@@ -298,6 +298,10 @@ type Scope struct {
 	// Classes map the name of the class to the class.
 	Classes map[string]Stmt
 
+	// Types maps the name of a type from a `type` statement to the resolved
+	// type that it stands for.
+	Types map[string]*types.Type
+
 	// Iterated is a flag that is true if this scope is inside of a for
 	// loop.
 	Iterated bool
@@ -312,6 +316,7 @@ func EmptyScope() *Scope {
 		Variables: make(map[string]Expr),
 		Functions: make(map[string]Expr),
 		Classes:   make(map[string]Stmt),
+		Types:     make(map[string]*types.Type),
 		Iterated:  false,
 		Chain:     []Node{},
 	}
@@ -329,6 +334,7 @@ func (obj *Scope) Copy() *Scope {
 	variables := make(map[string]Expr)
 	functions := make(map[string]Expr)
 	classes := make(map[string]Stmt)
+	typs := make(map[string]*types.Type)
 	iterated := obj.Iterated
 	chain := []Node{}
 
@@ -341,6 +347,9 @@ func (obj *Scope) Copy() *Scope {
 	for k, v := range obj.Classes { // copy
 		classes[k] = v // we don't copy the StmtClass!
 	}
+	for k, v := range obj.Types { // copy
+		typs[k] = v // types are never modified in place
+	}
 	for _, x := range obj.Chain { // copy
 		chain = append(chain, x) // we don't copy the Stmt pointer!
 	}
@@ -349,6 +358,7 @@ func (obj *Scope) Copy() *Scope {
 		Variables: variables,
 		Functions: functions,
 		Classes:   classes,
+		Types:     typs,
 		Iterated:  iterated,
 		Chain:     chain,
 	}
@@ -366,6 +376,7 @@ func (obj *Scope) Merge(scope *Scope) error {
 	namedVariables := []string{}
 	namedFunctions := []string{}
 	namedClasses := []string{}
+	namedTypes := []string{}
 	for name := range scope.Variables {
 		namedVariables = append(namedVariables, name)
 	}
@@ -377,7 +388,11 @@ func (obj *Scope) Merge(scope *Scope) error {
 	}
 	sort.Strings(namedVariables)
 	sort.Strings(namedFunctions)
+	for name := range scope.Types {
+		namedTypes = append(namedTypes, name)
+	}
 	sort.Strings(namedClasses)
+	sort.Strings(namedTypes)
 
 	for _, name := range namedVariables {
 		if _, exists := obj.Variables[name]; exists {
@@ -400,6 +415,16 @@ func (obj *Scope) Merge(scope *Scope) error {
 		}
 		obj.Classes[name] = scope.Classes[name]
 	}
+	for _, name := range namedTypes {
+		if _, exists := obj.Types[name]; exists {
+			e := fmt.Errorf("type `%s` was overwritten", name)
+			err = errwrap.Append(err, e)
+		}
+		if obj.Types == nil { // for scopes that were built by hand
+			obj.Types = make(map[string]*types.Type)
+		}
+		obj.Types[name] = scope.Types[name]
+	}
 
 	if scope.Iterated { // XXX: how should we merge this?
 		obj.Iterated = scope.Iterated
@@ -423,6 +448,9 @@ func (obj *Scope) IsEmpty() bool {
 	if len(obj.Classes) > 0 {
 		return false
 	}
+	if len(obj.Types) > 0 {
+		return false
+	}
 	return true
 }
 
@@ -550,14 +578,18 @@ func (obj *ValueEnv) Copy() *ValueEnv {
 }
 
 // Arg represents a name identifier for a func or class argument declaration and
-// is sometimes accompanied by a type. This does not satisfy the Expr interface.
-// It embeds Textarea so that the parser can store the source code position,
-// which tools such as the code formatter use.
+// is sometimes accompanied by a type and a default value. This does not satisfy
+// the Expr interface. It embeds Textarea so that the parser can store the source
+// code position, which tools such as the code formatter use.
 type Arg struct {
 	Textarea
 
 	Name string
 	Type *types.Type // nil if unspecified (needs to be solved for)
+
+	// Default is the expression used when the caller omits this arg. It
+	// is evaluated in the scope of the definition and not of the caller.
+	Default Expr // nil if the arg is required
 }
 
 // String returns a short representation of this arg.
@@ -566,6 +598,9 @@ func (obj *Arg) String() string {
 	if obj.Type != nil {
 		s += fmt.Sprintf(" %s", obj.Type.String())
 	}
+	if obj.Default != nil {
+		s += fmt.Sprintf(" = %s", obj.Default.String())
+	}
 	return s
 }
 
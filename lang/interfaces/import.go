@@ -67,6 +67,35 @@ type ImportData struct {
 	// URL is the path that a `git clone` operation should use as the URL.
 	// If it is a local import, then this is the empty value.
 	URL string
+
+	// Tag is the git tag that a remote import is pinned to. It is set with
+	// a `?tag=` qualifier at the end of the import name. At most one of the
+	// Tag, Branch and Commit fields can be set.
+	Tag string
+
+	// Branch is the git branch that a remote import follows. It is set with
+	// a `?branch=` qualifier at the end of the import name.
+	Branch string
+
+	// Commit is the full git commit hash that a remote import is pinned to.
+	// It is set with a `?commit=` qualifier at the end of the import name.
+	Commit string
+}
+
+// Qualifier returns the version qualifier of this import in the same form that
+// it is written in the import name, eg: `tag=v1.0`. It returns the empty string
+// if the import follows the default branch.
+func (obj *ImportData) Qualifier() string {
+	if obj.Tag != "" {
+		return "tag=" + obj.Tag
+	}
+	if obj.Branch != "" {
+		return "branch=" + obj.Branch
+	}
+	if obj.Commit != "" {
+		return "commit=" + obj.Commit
+	}
+	return ""
 }
 
 // DownloadInfo is the set of input values passed into the Init method of the
@@ -87,6 +116,16 @@ type DownloadInfo struct {
 	// artifacts.
 	Update bool
 
+	// LockPath is the absolute path to the lockfile which pins the versions
+	// of the downloaded modules. If it is empty, or if that file does not
+	// exist, then nothing is pinned.
+	LockPath string
+
+	// UpdateLock specifies that we should ignore any existing pins, resolve
+	// every module again, and record the results so that the lockfile can
+	// be written out afterwards.
+	UpdateLock bool
+
 	// Debug represents if we're running in debug mode or not.
 	Debug bool
 
@@ -0,0 +1,143 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package interfaces
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/purpleidea/mgmt/util/errwrap"
+
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// LockHeader is the comment at the top of every generated lockfile.
+	LockHeader = "# This file is generated by `mgmt check lang --update-lock`. Do not edit.\n"
+
+	// ChecksumPrefix is the prefix of every module checksum. It names the
+	// hash algorithm, so that it can be changed in the future.
+	ChecksumPrefix = "sha256:"
+)
+
+// Lock is a data structure representing the lockfile. It records the exact
+// commit and the content checksum of every remote import, so that downloads
+// are reproducible.
+type Lock struct {
+	// Modules is the list of pinned modules. It is kept sorted by URL.
+	Modules []*LockEntry `yaml:"modules"`
+}
+
+// LockEntry is a single pinned module in the lockfile.
+type LockEntry struct {
+	// URL is the git URL of the module, without any version qualifier.
+	URL string `yaml:"url"`
+
+	// Qualifier is the version qualifier that the import asked for when
+	// this entry was resolved, eg: `tag=v1.0`. It is empty if the import
+	// follows the default branch.
+	Qualifier string `yaml:"qualifier,omitempty"`
+
+	// Commit is the full git commit hash that the module is pinned to.
+	Commit string `yaml:"commit"`
+
+	// Checksum is the checksum of the module contents at that commit. It
+	// starts with the ChecksumPrefix.
+	Checksum string `yaml:"checksum"`
+}
+
+// Lookup returns the entry for the given URL, or nil if there isn't one.
+func (obj *Lock) Lookup(url string) *LockEntry {
+	for _, x := range obj.Modules {
+		if x.URL == url {
+			return x
+		}
+	}
+	return nil
+}
+
+// Add adds an entry to the lockfile, replacing any existing entry for the same
+// URL.
+func (obj *Lock) Add(entry *LockEntry) {
+	modules := []*LockEntry{}
+	for _, x := range obj.Modules {
+		if x.URL != entry.URL {
+			modules = append(modules, x)
+		}
+	}
+	modules = append(modules, entry)
+	sort.Slice(modules, func(i, j int) bool {
+		return modules[i].URL < modules[j].URL
+	})
+	obj.Modules = modules
+}
+
+// ToBytes marshals the struct into a byte array and returns it.
+func (obj *Lock) ToBytes() ([]byte, error) {
+	b, err := yaml.Marshal(obj)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(LockHeader), b...), nil
+}
+
+// ParseLock reads from some input and returns a *Lock struct after validating
+// each of the entries.
+func ParseLock(reader io.Reader) (*Lock, error) {
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "can't read lockfile")
+	}
+	lock := &Lock{}
+	if err := yaml.UnmarshalStrict(b, lock); err != nil {
+		return nil, errwrap.Wrapf(err, "can't parse lockfile")
+	}
+
+	urls := make(map[string]struct{})
+	for _, x := range lock.Modules {
+		if x == nil || x.URL == "" {
+			return nil, fmt.Errorf("lockfile entry is missing a url")
+		}
+		if _, exists := urls[x.URL]; exists {
+			return nil, fmt.Errorf("lockfile contains a duplicate entry for: `%s`", x.URL)
+		}
+		urls[x.URL] = struct{}{}
+		if x.Commit == "" {
+			return nil, fmt.Errorf("lockfile entry for `%s` is missing a commit", x.URL)
+		}
+		if !strings.HasPrefix(x.Checksum, ChecksumPrefix) {
+			return nil, fmt.Errorf("lockfile entry for `%s` has an invalid checksum", x.URL)
+		}
+	}
+
+	return lock, nil
+}
@@ -44,6 +44,11 @@ const (
 	// the ideal entry point for any running code.
 	MetadataFilename = "metadata.yaml"
 
+	// LockFilename is the filename of the lockfile which pins the versions
+	// of all the remote imports. It lives next to the top-level metadata
+	// file.
+	LockFilename = "metadata.lock"
+
 	// FileNameExtension is the filename extension used for languages files.
 	FileNameExtension = "mcl" // alternate suggestions welcome!
 
@@ -247,9 +247,47 @@ func HighlightHelper(node interface{}, logf func(format string, v ...interface{}
 		logf("%s: %s", err.Error(), highlight)
 	}
 	//return errwrap.Wrapf(err, "%s", displayer.Byline()) // alternate
-	return fmt.Errorf("%s: %s", err.Error(), displayer.Byline())
+	result := &HighlightedError{
+		Err:    err,
+		Byline: displayer.Byline(),
+	}
+	if positionable, ok := node.(PositionableNode); ok {
+		result.StartLine, result.StartColumn = positionable.Pos()
+		result.EndLine, result.EndColumn = positionable.End()
+	}
+	if sourced, ok := node.(interface{ SourceFile() *SourceFile }); ok {
+		result.File = sourced.SourceFile()
+	}
+	return result
 }
 
+// HighlightedError is the error returned by HighlightHelper. It prints the same
+// as the error it wraps with the byline added, but it also keeps the position
+// of the node that the error is about, so that tools such as the language
+// server can use it without having to parse it back out of the error message.
+type HighlightedError struct {
+	// Err is the error we are wrapping.
+	Err error
+
+	// Byline is the short description of the error location.
+	Byline string
+
+	// File is the source file of the node, if it is known.
+	File *SourceFile
+
+	// StartLine, StartColumn, EndLine and EndColumn are the zero-based
+	// position of the node.
+	StartLine, StartColumn, EndLine, EndColumn int
+}
+
+// Error implements the error interface for this special error type.
+func (obj *HighlightedError) Error() string {
+	return fmt.Sprintf("%s: %s", obj.Err.Error(), obj.Byline)
+}
+
+// Unwrap lets the standard errors package look inside of this error type.
+func (obj *HighlightedError) Unwrap() error { return obj.Err }
+
 // PositionedError is implemented by errors that know the source position where
 // they occurred, such as lex/parse errors. It is used by HighlightParseError to
 // annotate them with a source position byline (and caret) without the error's
@@ -40,10 +40,8 @@ import (
 
 	"github.com/purpleidea/mgmt/engine"
 	"github.com/purpleidea/mgmt/engine/local"
-	"github.com/purpleidea/mgmt/lang/ast"
 	_ "github.com/purpleidea/mgmt/lang/core" // import so the funcs register
 	"github.com/purpleidea/mgmt/lang/funcs/dage"
-	"github.com/purpleidea/mgmt/lang/funcs/vars"
 	"github.com/purpleidea/mgmt/lang/inputs"
 	"github.com/purpleidea/mgmt/lang/interfaces"
 	"github.com/purpleidea/mgmt/lang/interpolate"
@@ -170,15 +168,10 @@ func (obj *Lang) Init(ctx context.Context) error {
 		obj.Logf("behold, the AST: %+v", xast)
 	}
 
-	importGraph, err := pgraph.NewGraph("importGraph")
+	importVertex, err := NewImports()
 	if err != nil {
 		return err
 	}
-	importVertex := &pgraph.SelfVertex{
-		Name:  "",          // first node is the empty string
-		Graph: importGraph, // store a reference to ourself
-	}
-	importGraph.AddVertex(importVertex)
 
 	//obj.Logf("init...")
 	obj.Logf("import: %s", output.Base)
@@ -194,7 +187,7 @@ func (obj *Lang) Init(ctx context.Context) error {
 		Modules:  "/" + interfaces.ModuleDirectory, // do not set from env for a deploy!
 
 		LexParser:       parser.LexParse,
-		Downloader:      nil, // XXX: is this used here?
+		Downloader:      nil, // hosts never download, see: --vendor
 		StrInterpolater: interpolate.StrInterpolate,
 		//Local: obj.Local, // TODO: do we need this?
 		//World: obj.World, // TODO: do we need this?
@@ -223,24 +216,10 @@ func (obj *Lang) Init(ctx context.Context) error {
 	obj.Logf("interpolating took: %s", time.Since(timing))
 	obj.ast = iast
 
-	variables := map[string]interfaces.Expr{
-		"purpleidea": &ast.ExprStr{V: "hello world!"}, // james says hi
-		// TODO: change to a func when we can change hostname dynamically!
-		"hostname": &ast.ExprStr{V: obj.Hostname},
-	}
-	// TODO: pass `data` into ast.VarPrefixToVariablesScope ?
-	consts := ast.VarPrefixToVariablesScope(vars.ConstNamespace) // strips prefix!
-	addback := vars.ConstNamespace + interfaces.ModuleSep        // add it back...
-	variables, err = ast.MergeExprMaps(variables, consts, addback)
-	if err != nil {
-		return errwrap.Wrapf(err, "couldn't merge in consts")
-	}
-
 	// top-level, built-in, initial global scope
-	scope := &interfaces.Scope{
-		Variables: variables,
-		// all the built-in top-level, core functions enter here...
-		Functions: ast.FuncPrefixToFunctionsScope(""), // runs funcs.LookupPrefix
+	scope, err := NewScope(obj.Hostname)
+	if err != nil {
+		return err
 	}
 
 	if obj.Debug {
@@ -0,0 +1,402 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package lsp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/purpleidea/mgmt/engine"
+	engineUtil "github.com/purpleidea/mgmt/engine/util"
+	"github.com/purpleidea/mgmt/lang"
+	"github.com/purpleidea/mgmt/lang/ast"
+	_ "github.com/purpleidea/mgmt/lang/core" // import so the funcs register
+	"github.com/purpleidea/mgmt/lang/format/astfmt"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/interpolate"
+	"github.com/purpleidea/mgmt/lang/parser"
+	_ "github.com/purpleidea/mgmt/lang/unification/solvers" // import so the solvers register
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+var (
+	// kindRegexp matches the line which opens a resource block, and the
+	// first submatch is the kind.
+	kindRegexp = regexp.MustCompile(`^\s*([a-z][a-z0-9_]*(?::[a-z][a-z0-9_]*)*)\s+.*\{\s*$`)
+
+	// wordRegexp matches the line up to the cursor, when the cursor is at
+	// the end of the first word on the line, which might be a partial kind
+	// or field name.
+	wordRegexp = regexp.MustCompile(`^\s*[a-z0-9_:]*$`)
+)
+
+// analyze runs the lexer, parser, scope checker and type unification over the
+// document, and returns the diagnostics of the first stage which fails. Since
+// the compiler stops at the first error, there is at most one of them. The AST
+// is kept for hover and go to definition.
+func (obj *Server) analyze(ctx context.Context, doc *document) []*Diagnostic {
+	doc.ast = nil
+	diagnostics := []*Diagnostic{}
+
+	logf := func(format string, v ...interface{}) {
+		if !obj.Debug {
+			return
+		}
+		obj.Logf("analyze: "+format, v...)
+	}
+
+	xast, err := parser.LexParse(strings.NewReader(doc.text))
+	if err != nil {
+		return append(diagnostics, doc.diagnostic(err))
+	}
+
+	importVertex, err := lang.NewImports()
+	if err != nil {
+		return append(diagnostics, doc.diagnostic(err))
+	}
+
+	// Imports are always read from disk, but the document itself comes
+	// from the editor, since it might not have been saved yet.
+	fs := util.NewReadOnlyOsFs()
+	data := &interfaces.Data{
+		Fs:    fs,
+		FsURI: fs.URI(),
+		Base:  filepath.Dir(doc.path) + "/", // base dir with trailing slash
+		Files: []string{doc.path},
+		Metadata: &interfaces.Metadata{
+			Main: filepath.Base(doc.path), // use the name of the input
+		},
+		Imports: importVertex,
+		Modules: obj.ModulePath,
+
+		LexParser:       parser.LexParse,
+		StrInterpolater: interpolate.StrInterpolate,
+
+		Debug: obj.Debug,
+		Logf:  logf,
+	}
+	scope, err := lang.NewScope("") // empty b/c not used
+	if err != nil {
+		return append(diagnostics, doc.diagnostic(err))
+	}
+	iast, err := lang.Compile(xast, data, scope)
+	if err != nil {
+		return append(diagnostics, doc.diagnostic(err))
+	}
+	doc.ast = iast // good enough for go to definition
+
+	if err := lang.Unify(ctx, iast, nil, obj.Debug, logf); err != nil {
+		return append(diagnostics, doc.diagnostic(err))
+	}
+
+	return diagnostics
+}
+
+// diagnostic returns the diagnostic for an error from one of the compiler
+// stages. If the error has a position in this document, then it's used, and
+// otherwise the diagnostic is shown at the start of the document, which is the
+// case for errors in imported files, since the message includes their byline.
+func (obj *document) diagnostic(err error) *Diagnostic {
+	r := Range{}
+	var highlighted *interfaces.HighlightedError
+	var positioned interfaces.PositionedError
+	if errors.As(err, &highlighted) && highlighted.File != nil && highlighted.File.Path == obj.path {
+		r = Range{
+			Start: Position{Line: highlighted.StartLine, Character: highlighted.StartColumn},
+			End:   Position{Line: highlighted.EndLine, Character: highlighted.EndColumn},
+		}
+	} else if errors.As(err, &positioned) { // a lex or parse error
+		row, col := positioned.ErrorPos()
+		r = Range{
+			Start: Position{Line: row, Character: col},
+			End:   Position{Line: row, Character: col + 1},
+		}
+	}
+	return &Diagnostic{
+		Range:    r,
+		Severity: diagnosticSeverityError,
+		Source:   "mgmt",
+		Message:  err.Error(),
+	}
+}
+
+// nodes returns the positioned nodes of this document which contain the given
+// position, ordered from the innermost one to the outermost one. The nodes of
+// imported files are skipped.
+func (obj *document) nodes(pos Position) []interfaces.Node {
+	if obj.ast == nil {
+		return nil
+	}
+	type pathPositionable interface {
+		interfaces.PositionableNode
+		Path() string
+	}
+	nodes := []interfaces.Node{}
+	ranges := make(map[interfaces.Node]Range)
+	obj.ast.Apply(func(node interfaces.Node) error {
+		x, ok := node.(pathPositionable)
+		if !ok || !x.IsSet() || x.Path() != obj.path {
+			return nil
+		}
+		r := nodeRange(x)
+		if !contains(r, pos) {
+			return nil
+		}
+		if _, exists := ranges[node]; !exists {
+			nodes = append(nodes, node)
+		}
+		ranges[node] = r
+		return nil
+	})
+	// Nested ranges which contain the same position are innermost when
+	// they start last, or when they start together, when they end first.
+	sort.SliceStable(nodes, func(i, j int) bool {
+		a, b := ranges[nodes[i]], ranges[nodes[j]]
+		if a.Start != b.Start {
+			return before(b.Start, a.Start)
+		}
+		return before(a.End, b.End)
+	})
+	return nodes
+}
+
+// Hover returns the inferred type of the innermost expression at the position,
+// or nil if there's none, or if it has no known type.
+func (obj *document) Hover(pos Position) *Hover {
+	for _, node := range obj.nodes(pos) {
+		expr, ok := node.(interfaces.Expr)
+		if !ok {
+			continue
+		}
+		typ, err := expr.Type()
+		if err != nil || typ == nil {
+			continue
+		}
+		s := typ.String()
+		switch x := expr.(type) {
+		case *ast.ExprVar:
+			s = fmt.Sprintf("%s%s %s", interfaces.VarPrefix, x.Name, s)
+		case *ast.ExprCall:
+			if x.Name != "" {
+				s = fmt.Sprintf("%s() %s", x.Name, s)
+			}
+		}
+		r := nodeRange(node.(interfaces.PositionableNode))
+		return &Hover{
+			Contents: MarkupContent{
+				Kind:  "markdown",
+				Value: "```mcl\n" + s + "\n```",
+			},
+			Range: &r,
+		}
+	}
+	return nil
+}
+
+// Definition returns the location of the definition of the variable, function
+// or class which is named at the position, or nil if there's none. Builtins and
+// the definitions in embedded modules have no location on disk.
+func (obj *document) Definition(pos Position) *Location {
+	var def interfaces.Node
+	for _, node := range obj.nodes(pos) {
+		if def = ast.Definition(node); def != nil {
+			break
+		}
+	}
+	if def == nil {
+		return nil
+	}
+
+	// The scope holds the value of a bind and the function of a func
+	// statement, so we look for the statement which defines them, since
+	// it's the one that's positioned and contains the name.
+	obj.ast.Apply(func(node interfaces.Node) error {
+		switch x := node.(type) {
+		case *ast.StmtBind:
+			if x.Value == def {
+				def = x
+			}
+		case *ast.StmtFunc:
+			if x.Func == def {
+				def = x
+			}
+		}
+		return nil
+	})
+
+	x, ok := def.(interface {
+		interfaces.PositionableNode
+		SourceFile() *interfaces.SourceFile
+	})
+	if !ok || !x.IsSet() {
+		return nil
+	}
+	file := x.SourceFile()
+	if file.Path == "" || file.FS == nil || strings.HasPrefix(file.FS.URI(), interfaces.EmbeddedScheme+"://") {
+		return nil
+	}
+	return &Location{
+		URI:   pathToURI(file.Path),
+		Range: nodeRange(x),
+	}
+}
+
+// Completion returns the field names of the resource when the position is the
+// start of a line inside of a resource block, and otherwise it returns the
+// resource kinds when the position is the start of a line. This is done from
+// the text, since the code being typed usually doesn't parse.
+func (obj *document) Completion(pos Position) *CompletionList {
+	result := &CompletionList{
+		Items: []*CompletionItem{},
+	}
+	lines := strings.Split(obj.text, "\n")
+	if pos.Line >= len(lines) {
+		return result
+	}
+	line := lines[pos.Line]
+	if pos.Character < len(line) {
+		line = line[:pos.Character]
+	}
+	if !wordRegexp.MatchString(line) {
+		return result
+	}
+
+	// Find the block that we're in, by looking back for the first unclosed
+	// curly brace. This doesn't know about strings or comments, but they
+	// rarely contain unbalanced braces.
+	kind := ""
+	depth := 0
+	for i := pos.Line - 1; i >= 0; i-- {
+		s := lines[i]
+		depth += strings.Count(s, "}") - strings.Count(s, "{")
+		if depth >= 0 {
+			continue
+		}
+		if m := kindRegexp.FindStringSubmatch(s); m != nil && engine.IsKind(m[1]) {
+			kind = m[1]
+		}
+		break
+	}
+
+	if kind == "" {
+		for _, name := range engine.RegisteredResourcesNames() {
+			result.Items = append(result.Items, &CompletionItem{
+				Label: name,
+				Kind:  completionItemKindClass,
+			})
+		}
+		return result
+	}
+
+	fields, err := engineUtil.LangFieldNameToStructType(kind)
+	if err != nil {
+		return result
+	}
+	names := []string{}
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.Items = append(result.Items, &CompletionItem{
+			Label:      name,
+			Kind:       completionItemKindField,
+			Detail:     fields[name].String(),
+			InsertText: name + " => ",
+		})
+	}
+	return result
+}
+
+// Format returns the edits which format the document, and no edits if it's
+// already formatted.
+func (obj *document) Format(ctx context.Context) ([]*TextEdit, error) {
+	xast, comments, err := parser.LexParseWithComments(strings.NewReader(obj.text))
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse")
+	}
+	b, err := astfmt.Format(ctx, xast, comments)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not format")
+	}
+	edits := []*TextEdit{}
+	if s := string(b); s != obj.text {
+		lines := strings.Split(obj.text, "\n")
+		edits = append(edits, &TextEdit{ // replace everything
+			Range: Range{
+				End: Position{
+					Line:      len(lines) - 1,
+					Character: len(lines[len(lines)-1]),
+				},
+			},
+			NewText: s,
+		})
+	}
+	return edits, nil
+}
+
+// nodeRange returns the range of a positioned node.
+func nodeRange(node interfaces.PositionableNode) Range {
+	line, col := node.Pos()
+	endLine, endCol := node.End()
+	return Range{
+		Start: Position{Line: line, Character: col},
+		End:   Position{Line: endLine, Character: endCol},
+	}
+}
+
+// before returns true if position a is before position b.
+func before(a, b Position) bool {
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Character < b.Character
+}
+
+// contains returns true if the position is inside of the range, including at
+// either end, so that the cursor can be just after a name.
+func contains(r Range, pos Position) bool {
+	if pos.Line < r.Start.Line || pos.Line > r.End.Line {
+		return false
+	}
+	if pos.Line == r.Start.Line && pos.Character < r.Start.Character {
+		return false
+	}
+	if pos.Line == r.End.Line && pos.Character > r.End.Character {
+		return false
+	}
+	return true
+}
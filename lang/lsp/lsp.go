@@ -0,0 +1,372 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+// Package lsp implements a language server for mcl. It speaks the language
+// server protocol over a pair of streams, which are usually stdin and stdout,
+// so that any editor with a language server client can use it. It provides the
+// errors of the lexer, parser, scope checker and type unification as
+// diagnostics, the inferred types on hover, go to definition, including into
+// imported modules, completion of resource kinds and fields, and formatting.
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+
+	"github.com/purpleidea/mgmt/lang/interfaces"
+)
+
+// Server is a language server for mcl. It handles one client.
+type Server struct {
+	// ModulePath is the absolute path of the modules directory with a
+	// trailing slash. It can be empty if there's none.
+	ModulePath string
+
+	Debug bool
+	Logf  func(format string, v ...interface{})
+
+	docs map[string]*document // open documents, keyed by uri
+	w    io.Writer
+}
+
+// document is an open document, and the result of its last analysis.
+type document struct {
+	uri     string
+	path    string // absolute path of the file on disk
+	version int
+	text    string
+
+	// ast is the AST after scope checking, or nil if it didn't get that
+	// far. If unification also passed, then the expressions have types.
+	ast interfaces.Stmt
+}
+
+// Init must be called before Run.
+func (obj *Server) Init() error {
+	if obj.Logf == nil {
+		return fmt.Errorf("the Logf function must be specified")
+	}
+	obj.docs = make(map[string]*document)
+	return nil
+}
+
+// Run reads requests from the reader and writes responses to the writer, until
+// the client sends the exit notification, the reader closes, or the context is
+// cancelled.
+func (obj *Server) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	obj.w = w
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// We don't wait for this goroutine to exit, since it's usually blocked
+	// reading from stdin, which can't be interrupted. It exits when it gets
+	// the next message, or when the reader is closed.
+	messages := make(chan *message)
+	errch := make(chan error, 1)
+	go func() {
+		defer close(messages)
+		reader := bufio.NewReader(r)
+		for {
+			msg, err := readMessage(reader)
+			if err != nil {
+				errch <- err
+				return
+			}
+			select {
+			case messages <- msg:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				err := <-errch
+				if err == io.EOF {
+					return nil // the client went away
+				}
+				return err
+			}
+			if msg.Method == "exit" {
+				return nil
+			}
+			if err := obj.handle(ctx, msg); err != nil {
+				return err
+			}
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// handle runs a single request or notification. It only errors if we can't
+// write to the client, since that's the end of the session.
+func (obj *Server) handle(ctx context.Context, msg *message) error {
+	if obj.Debug {
+		obj.Logf("method: %s", msg.Method)
+	}
+	result, err := obj.dispatch(ctx, msg)
+	if msg.ID == nil { // it's a notification, so no response is sent
+		if err != nil {
+			obj.Logf("%s: %+v", msg.Method, err)
+		}
+		return nil
+	}
+
+	response := &message{
+		ID:     msg.ID,
+		Result: result,
+	}
+	if err != nil {
+		response.Result = nil
+		response.Error = err
+	} else if result == nil {
+		response.Result = json.RawMessage("null") // a result is required
+	}
+	return writeMessage(obj.w, response)
+}
+
+// notify sends a notification to the client.
+func (obj *Server) notify(method string, params interface{}) error {
+	b, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+	return writeMessage(obj.w, &message{
+		Method: method,
+		Params: b,
+	})
+}
+
+// dispatch runs the handler for the method of the message.
+func (obj *Server) dispatch(ctx context.Context, msg *message) (interface{}, *responseError) {
+	switch msg.Method {
+	case "initialize":
+		return map[string]interface{}{
+			"capabilities": map[string]interface{}{
+				"textDocumentSync": map[string]interface{}{
+					"openClose": true,
+					"change":    textDocumentSyncKindFull,
+					"save":      true,
+				},
+				"hoverProvider":      true,
+				"definitionProvider": true,
+				"completionProvider": map[string]interface{}{
+					"triggerCharacters": []string{":"},
+				},
+				"documentFormattingProvider": true,
+			},
+			"serverInfo": map[string]interface{}{
+				"name": "mgmt",
+			},
+		}, nil
+
+	case "shutdown":
+		return nil, nil
+
+	case "textDocument/didOpen":
+		params := &didOpenTextDocumentParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+		path, err := uriToPath(params.TextDocument.URI)
+		if err != nil {
+			return nil, invalidParams(err)
+		}
+		doc := &document{
+			uri:     params.TextDocument.URI,
+			path:    path,
+			version: params.TextDocument.Version,
+			text:    params.TextDocument.Text,
+		}
+		obj.docs[doc.uri] = doc
+		return nil, obj.publish(ctx, doc)
+
+	case "textDocument/didChange":
+		params := &didChangeTextDocumentParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, exists := obj.docs[params.TextDocument.URI]
+		if !exists || len(params.ContentChanges) == 0 {
+			return nil, nil
+		}
+		doc.version = params.TextDocument.Version
+		doc.text = params.ContentChanges[len(params.ContentChanges)-1].Text
+		return nil, obj.publish(ctx, doc)
+
+	case "textDocument/didSave":
+		// Another file, such as an import, might have changed on disk.
+		params := &textDocumentParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, exists := obj.docs[params.TextDocument.URI]
+		if !exists {
+			return nil, nil
+		}
+		return nil, obj.publish(ctx, doc)
+
+	case "textDocument/didClose":
+		params := &textDocumentParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+		delete(obj.docs, params.TextDocument.URI)
+		err := obj.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+			URI:         params.TextDocument.URI,
+			Diagnostics: []*Diagnostic{}, // clear them
+		})
+		return nil, requestFailed(err)
+
+	case "textDocument/hover":
+		doc, pos, rerr := obj.position(msg)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if hover := doc.Hover(pos); hover != nil {
+			return hover, nil
+		}
+		return nil, nil
+
+	case "textDocument/definition":
+		doc, pos, rerr := obj.position(msg)
+		if rerr != nil {
+			return nil, rerr
+		}
+		if location := doc.Definition(pos); location != nil {
+			return location, nil
+		}
+		return nil, nil
+
+	case "textDocument/completion":
+		doc, pos, rerr := obj.position(msg)
+		if rerr != nil {
+			return nil, rerr
+		}
+		return doc.Completion(pos), nil
+
+	case "textDocument/formatting":
+		params := &textDocumentParams{}
+		if err := json.Unmarshal(msg.Params, params); err != nil {
+			return nil, invalidParams(err)
+		}
+		doc, exists := obj.docs[params.TextDocument.URI]
+		if !exists {
+			return nil, invalidParams(fmt.Errorf("document `%s` is not open", params.TextDocument.URI))
+		}
+		edits, err := doc.Format(ctx)
+		if err != nil {
+			return nil, requestFailed(err)
+		}
+		return edits, nil
+	}
+
+	if msg.ID == nil {
+		return nil, nil // ignore unknown notifications, eg: initialized
+	}
+	return nil, &responseError{
+		Code:    errMethodNotFound,
+		Message: fmt.Sprintf("method `%s` is not supported", msg.Method),
+	}
+}
+
+// position decodes the params of a request for a position in an open document.
+func (obj *Server) position(msg *message) (*document, Position, *responseError) {
+	params := &textDocumentPositionParams{}
+	if err := json.Unmarshal(msg.Params, params); err != nil {
+		return nil, Position{}, invalidParams(err)
+	}
+	doc, exists := obj.docs[params.TextDocument.URI]
+	if !exists {
+		return nil, Position{}, invalidParams(fmt.Errorf("document `%s` is not open", params.TextDocument.URI))
+	}
+	return doc, params.Position, nil
+}
+
+// publish analyzes the document and sends its diagnostics to the client.
+func (obj *Server) publish(ctx context.Context, doc *document) *responseError {
+	diagnostics := obj.analyze(ctx, doc)
+	err := obj.notify("textDocument/publishDiagnostics", &publishDiagnosticsParams{
+		URI:         doc.uri,
+		Version:     doc.version,
+		Diagnostics: diagnostics,
+	})
+	return requestFailed(err)
+}
+
+// invalidParams returns the response error for params that can't be decoded.
+func invalidParams(err error) *responseError {
+	return &responseError{
+		Code:    errInvalidParams,
+		Message: err.Error(),
+	}
+}
+
+// requestFailed returns the response error for a request which failed, or nil
+// if the error is nil.
+func requestFailed(err error) *responseError {
+	if err == nil {
+		return nil
+	}
+	return &responseError{
+		Code:    errRequestFailed,
+		Message: err.Error(),
+	}
+}
+
+// uriToPath returns the path of a file uri.
+func uriToPath(uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "file" {
+		return "", fmt.Errorf("uri `%s` is not a file", uri)
+	}
+	return u.Path, nil
+}
+
+// pathToURI returns the file uri of a path.
+func pathToURI(path string) string {
+	u := &url.URL{
+		Scheme: "file",
+		Path:   path,
+	}
+	return u.String()
+}
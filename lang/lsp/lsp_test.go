@@ -0,0 +1,271 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// client is a minimal language server client for the tests.
+type client struct {
+	t      *testing.T
+	w      io.Writer
+	r      *bufio.Reader
+	nextID int
+}
+
+// notify sends a notification.
+func (obj *client) notify(method string, params interface{}) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		obj.t.Fatalf("could not marshal: %+v", err)
+	}
+	if err := writeMessage(obj.w, &message{Method: method, Params: b}); err != nil {
+		obj.t.Fatalf("could not write: %+v", err)
+	}
+}
+
+// request sends a request and decodes the result of its response into result.
+func (obj *client) request(method string, params, result interface{}) {
+	b, err := json.Marshal(params)
+	if err != nil {
+		obj.t.Fatalf("could not marshal: %+v", err)
+	}
+	obj.nextID++
+	id := json.RawMessage(fmt.Sprintf("%d", obj.nextID))
+	if err := writeMessage(obj.w, &message{ID: &id, Method: method, Params: b}); err != nil {
+		obj.t.Fatalf("could not write: %+v", err)
+	}
+	for {
+		raw := obj.read()
+		if raw.ID == nil { // skip notifications
+			continue
+		}
+		if raw.Error != nil {
+			obj.t.Fatalf("request %s failed: %+v", method, raw.Error)
+		}
+		b, err := json.Marshal(raw.Result)
+		if err != nil {
+			obj.t.Fatalf("could not marshal: %+v", err)
+		}
+		if err := json.Unmarshal(b, result); err != nil {
+			obj.t.Fatalf("could not unmarshal: %+v", err)
+		}
+		return
+	}
+}
+
+// diagnostics reads the next diagnostics that the server publishes.
+func (obj *client) diagnostics() []*Diagnostic {
+	for {
+		raw := obj.read()
+		if raw.Method != "textDocument/publishDiagnostics" {
+			continue
+		}
+		params := &publishDiagnosticsParams{}
+		if err := json.Unmarshal(raw.Params, params); err != nil {
+			obj.t.Fatalf("could not unmarshal: %+v", err)
+		}
+		return params.Diagnostics
+	}
+}
+
+// read reads the next message from the server, with the result left as json.
+func (obj *client) read() *message {
+	msg, err := readMessage(obj.r)
+	if err != nil {
+		obj.t.Fatalf("could not read: %+v", err)
+	}
+	return msg
+}
+
+func TestServer0(t *testing.T) {
+	dir, err := filepath.Abs("testdata/")
+	if err != nil {
+		t.Fatalf("could not get path: %+v", err)
+	}
+	uri := pathToURI(filepath.Join(dir, "main.mcl")) // doesn't exist on disk
+	code := strings.Join([]string{
+		`import "fmt"`,
+		`import "lib.mcl"`,
+		``,
+		`$x = lib.double(21)`,
+		`$s = fmt.printf("%d", $x)`,
+		``,
+		`file "/tmp/mgmt/lsp" {`,
+		`	content => $s,`,
+		`	`,
+		`}`,
+		``,
+	}, "\n")
+
+	sr, cw := io.Pipe() // client to server
+	cr, sw := io.Pipe() // server to client
+	server := &Server{
+		Logf: t.Logf,
+	}
+	if err := server.Init(); err != nil {
+		t.Fatalf("could not init: %+v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errch := make(chan error)
+	go func() {
+		errch <- server.Run(ctx, sr, sw)
+		sw.Close()
+	}()
+	c := &client{t: t, w: cw, r: bufio.NewReader(cr)}
+
+	initialized := map[string]map[string]interface{}{}
+	c.request("initialize", map[string]interface{}{}, &initialized)
+	if initialized["capabilities"]["hoverProvider"] != true {
+		t.Errorf("unexpected capabilities: %+v", initialized)
+	}
+	c.notify("initialized", map[string]interface{}{})
+
+	open := &didOpenTextDocumentParams{}
+	open.TextDocument.URI = uri
+	open.TextDocument.Text = code
+	c.notify("textDocument/didOpen", open)
+	if diagnostics := c.diagnostics(); len(diagnostics) != 0 {
+		t.Errorf("unexpected diagnostics: %+v", diagnostics[0])
+	}
+
+	position := func(line, character int) *textDocumentPositionParams {
+		return &textDocumentPositionParams{
+			TextDocument: textDocumentIdentifier{URI: uri},
+			Position:     Position{Line: line, Character: character},
+		}
+	}
+
+	t.Run("hover", func(t *testing.T) {
+		hover := &Hover{}
+		c.request("textDocument/hover", position(7, 13), hover)
+		if s := hover.Contents.Value; !strings.Contains(s, "$s str") {
+			t.Errorf("unexpected hover: %s", s)
+		}
+		c.request("textDocument/hover", position(3, 8), hover)
+		if s := hover.Contents.Value; !strings.Contains(s, "lib.double() int") {
+			t.Errorf("unexpected hover: %s", s)
+		}
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		location := &Location{}
+		c.request("textDocument/definition", position(7, 13), location)
+		if location.URI != uri || location.Range.Start.Line != 4 {
+			t.Errorf("unexpected location: %+v", location)
+		}
+		c.request("textDocument/definition", position(3, 8), location)
+		if location.URI != pathToURI(filepath.Join(dir, "lib.mcl")) || location.Range.Start.Line != 0 {
+			t.Errorf("unexpected location: %+v", location)
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		list := &CompletionList{}
+		c.request("textDocument/completion", position(8, 1), list)
+		found := false
+		for _, item := range list.Items {
+			found = found || item.Label == "content" && item.InsertText == "content => "
+		}
+		if !found {
+			t.Errorf("missing field completion in: %+v", list.Items)
+		}
+		c.request("textDocument/completion", position(5, 0), list)
+		found = false
+		for _, item := range list.Items {
+			found = found || item.Label == "file"
+		}
+		if !found {
+			t.Errorf("missing kind completion in: %+v", list.Items)
+		}
+	})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		change := &didChangeTextDocumentParams{}
+		change.TextDocument.URI = uri
+		change.ContentChanges = []struct {
+			Text string `json:"text"`
+		}{{Text: strings.Replace(code, "content => $s", "content => $nope", 1)}}
+		c.notify("textDocument/didChange", change)
+		diagnostics := c.diagnostics()
+		if len(diagnostics) != 1 {
+			t.Fatalf("expected one diagnostic, got: %d", len(diagnostics))
+		}
+		if r := diagnostics[0].Range; r.Start.Line != 7 || r.Start.Character != 12 || !strings.Contains(diagnostics[0].Message, "$nope") {
+			t.Errorf("unexpected diagnostic: %+v", diagnostics[0])
+		}
+
+		change.ContentChanges[0].Text = strings.Replace(code, `"%d", $x`, `"%s", $x`, 1)
+		c.notify("textDocument/didChange", change)
+		diagnostics = c.diagnostics()
+		if len(diagnostics) != 1 || diagnostics[0].Range.Start.Line != 4 || !strings.Contains(diagnostics[0].Message, "int != str") {
+			t.Errorf("unexpected diagnostics: %+v", diagnostics)
+		}
+
+		change.ContentChanges[0].Text = strings.Replace(code, "$x = lib", "$x = = lib", 1)
+		c.notify("textDocument/didChange", change)
+		diagnostics = c.diagnostics()
+		if len(diagnostics) != 1 || diagnostics[0].Range.Start.Line != 3 {
+			t.Errorf("unexpected diagnostics: %+v", diagnostics)
+		}
+	})
+
+	t.Run("formatting", func(t *testing.T) {
+		change := &didChangeTextDocumentParams{}
+		change.TextDocument.URI = uri
+		change.ContentChanges = []struct {
+			Text string `json:"text"`
+		}{{Text: "$x   =   42\n"}}
+		c.notify("textDocument/didChange", change)
+		edits := []*TextEdit{}
+		c.request("textDocument/formatting", &textDocumentParams{TextDocument: textDocumentIdentifier{URI: uri}}, &edits)
+		if len(edits) != 1 || edits[0].NewText != "$x = 42\n" {
+			t.Errorf("unexpected edits: %+v", edits)
+		}
+	})
+
+	var result interface{}
+	c.request("shutdown", nil, &result)
+	c.notify("exit", nil)
+	if err := <-errch; err != nil {
+		t.Errorf("server failed: %+v", err)
+	}
+}
@@ -0,0 +1,236 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package lsp
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// This file contains the small subset of the language server protocol and of
+// json-rpc that we implement. Field names and constants are taken from the
+// specification, which is at:
+// https://microsoft.github.io/language-server-protocol/specifications/lsp/3.17/specification/
+
+const (
+	// jsonrpcVersion is the only version of json-rpc that is supported.
+	jsonrpcVersion = "2.0"
+
+	// errMethodNotFound is the json-rpc error code for an unknown method.
+	errMethodNotFound = -32601
+
+	// errInvalidParams is the json-rpc error code for bad method params.
+	errInvalidParams = -32602
+
+	// errRequestFailed is the lsp error code for a valid request that we
+	// could not complete, such as formatting code which doesn't parse.
+	errRequestFailed = -32803
+
+	// textDocumentSyncKindFull means the client always sends the whole
+	// document when it changes.
+	textDocumentSyncKindFull = 1
+
+	// diagnosticSeverityError is the severity of every diagnostic we send.
+	diagnosticSeverityError = 1
+
+	// completionItemKindField is used for resource fields.
+	completionItemKindField = 5
+
+	// completionItemKindClass is used for resource kinds.
+	completionItemKindClass = 7
+)
+
+// message is a json-rpc request, response or notification. Notifications have
+// no id, and responses have no method.
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  interface{}      `json:"result,omitempty"`
+	Error   *responseError   `json:"error,omitempty"`
+}
+
+// responseError is the error of a failed json-rpc request.
+type responseError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// readMessage reads one message, which is a set of headers followed by a json
+// body, as used by the base protocol.
+func readMessage(r *bufio.Reader) (*message, error) {
+	header, err := textproto.NewReader(r).ReadMIMEHeader()
+	if err != nil {
+		return nil, err
+	}
+	s := header.Get("Content-Length")
+	if s == "" {
+		return nil, fmt.Errorf("missing content length header")
+	}
+	length, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("invalid content length: %s", s)
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	msg := &message{}
+	if err := json.Unmarshal(body, msg); err != nil {
+		return nil, fmt.Errorf("invalid json-rpc message: %v", err)
+	}
+	return msg, nil
+}
+
+// writeMessage writes one message with the header that the base protocol needs.
+func writeMessage(w io.Writer, msg *message) error {
+	msg.JSONRPC = jsonrpcVersion
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = w.Write(body)
+	return err
+}
+
+// Position is a zero-based line and character offset in a document.
+// TODO: The protocol counts characters in utf-16 code units, and we use the
+// column of the lexer, so the two only agree on lines that are all ascii.
+type Position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+// Range is a span of a document. The end position is exclusive.
+type Range struct {
+	Start Position `json:"start"`
+	End   Position `json:"end"`
+}
+
+// Location is a range in a particular document.
+type Location struct {
+	URI   string `json:"uri"`
+	Range Range  `json:"range"`
+}
+
+// Diagnostic is an error which is shown in the editor.
+type Diagnostic struct {
+	Range    Range  `json:"range"`
+	Severity int    `json:"severity"`
+	Source   string `json:"source"`
+	Message  string `json:"message"`
+}
+
+// TextEdit is a change to a document.
+type TextEdit struct {
+	Range   Range  `json:"range"`
+	NewText string `json:"newText"`
+}
+
+// MarkupContent is some formatted text, such as the contents of a hover.
+type MarkupContent struct {
+	Kind  string `json:"kind"`
+	Value string `json:"value"`
+}
+
+// Hover is the result of a hover request.
+type Hover struct {
+	Contents MarkupContent `json:"contents"`
+	Range    *Range        `json:"range,omitempty"`
+}
+
+// CompletionItem is a single completion suggestion.
+type CompletionItem struct {
+	Label      string `json:"label"`
+	Kind       int    `json:"kind"`
+	Detail     string `json:"detail,omitempty"`
+	InsertText string `json:"insertText,omitempty"`
+}
+
+// CompletionList is the result of a completion request.
+type CompletionList struct {
+	IsIncomplete bool              `json:"isIncomplete"`
+	Items        []*CompletionItem `json:"items"`
+}
+
+// textDocumentIdentifier names a document.
+type textDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+// textDocumentPositionParams are the params of the hover, definition and
+// completion requests.
+type textDocumentPositionParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+	Position     Position               `json:"position"`
+}
+
+// didOpenTextDocumentParams are the params of the didOpen notification.
+type didOpenTextDocumentParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+		Text    string `json:"text"`
+	} `json:"textDocument"`
+}
+
+// didChangeTextDocumentParams are the params of the didChange notification.
+// Since we ask for full syncs, the last change holds the whole document.
+type didChangeTextDocumentParams struct {
+	TextDocument struct {
+		URI     string `json:"uri"`
+		Version int    `json:"version"`
+	} `json:"textDocument"`
+	ContentChanges []struct {
+		Text string `json:"text"`
+	} `json:"contentChanges"`
+}
+
+// textDocumentParams are the params of the requests and notifications which
+// only name a document, such as didSave, didClose and formatting.
+type textDocumentParams struct {
+	TextDocument textDocumentIdentifier `json:"textDocument"`
+}
+
+// publishDiagnosticsParams are the params of the diagnostics notification.
+type publishDiagnosticsParams struct {
+	URI         string        `json:"uri"`
+	Version     int           `json:"version,omitempty"`
+	Diagnostics []*Diagnostic `json:"diagnostics"`
+}
@@ -1367,6 +1367,68 @@ func TestLexParse0(t *testing.T) {
 			exp:  exp,
 		})
 	}
+	{
+		exp := &ast.StmtProg{
+			Body: []interfaces.Stmt{
+				&ast.StmtClass{
+					Name: "c1",
+					Args: []*interfaces.Arg{
+						{
+							Name: "a",
+							Type: types.TypeStr,
+						},
+						{
+							Name: "b",
+							Type: types.TypeInt,
+							Default: &ast.ExprInt{
+								V: 42,
+							},
+						},
+						{
+							Name: "c",
+							Default: &ast.ExprBool{
+								V: true,
+							},
+						},
+					},
+					Body: &ast.StmtProg{
+						Body: []interfaces.Stmt{},
+					},
+				},
+				&ast.StmtInclude{
+					Name: "c1",
+					Args: []interfaces.Expr{
+						&ast.ExprStr{
+							V: "hello",
+						},
+						&ast.ExprBool{
+							V: false,
+						},
+					},
+					ArgNames: []string{"", "c"},
+				},
+			},
+		}
+		testCases = append(testCases, test{
+			name: "class with default and named args",
+			code: `
+			class c1($a str, $b int = 42, $c = true) {
+			}
+			include c1("hello", c => false)
+			`,
+			fail: false,
+			exp:  exp,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "named arg must be an identifier",
+			code: `
+			$x = foo("a" => 42)
+			`,
+			fail: true,
+		})
+	}
 	{
 		testCases = append(testCases, test{
 			name: "simple dotted invalid class 1",
@@ -2193,6 +2255,285 @@ func TestLexParse0(t *testing.T) {
 		})
 	}
 
+	{
+		exp := &ast.StmtProg{
+			Body: []interfaces.Stmt{
+				&ast.StmtIf{
+					Condition: &ast.ExprBool{
+						V: false,
+					},
+					ThenBranch: &ast.StmtProg{
+						Body: []interfaces.Stmt{},
+					},
+					ElseBranch: &ast.StmtIf{
+						Condition: &ast.ExprBool{
+							V: true,
+						},
+						ThenBranch: &ast.StmtProg{
+							Body: []interfaces.Stmt{},
+						},
+						ElseBranch: &ast.StmtProg{
+							Body: []interfaces.Stmt{},
+						},
+					},
+				},
+			},
+		}
+		testCases = append(testCases, test{
+			name: "else if statement",
+			code: `
+			if false {
+			} else if true {
+			} else {
+			}
+			`,
+			fail: false,
+			exp:  exp,
+		})
+	}
+	{
+		exp := &ast.StmtProg{
+			Body: []interfaces.Stmt{
+				&ast.StmtBind{
+					Ident: "x",
+					Value: &ast.ExprIf{
+						Condition: &ast.ExprBool{
+							V: false,
+						},
+						ThenBranch: &ast.ExprBlock{
+							Inner: &ast.ExprInt{
+								V: 1,
+							},
+						},
+						ElseBranch: &ast.ExprIf{
+							Condition: &ast.ExprBool{
+								V: true,
+							},
+							ThenBranch: &ast.ExprBlock{
+								Inner: &ast.ExprInt{
+									V: 2,
+								},
+							},
+							ElseBranch: &ast.ExprBlock{
+								Inner: &ast.ExprInt{
+									V: 3,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		testCases = append(testCases, test{
+			name: "else if expression",
+			code: `$x = if false { 1 } else if true { 2 } else { 3 }`,
+			fail: false,
+			exp:  exp,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "else if expression without else",
+			code: `$x = if false { 1 } else if true { 2 }`,
+			fail: true, // an if expression must always have a value
+		})
+	}
+	{
+		exp := &ast.StmtProg{
+			Body: []interfaces.Stmt{
+				&ast.StmtBind{
+					Ident: "x",
+					Value: &ast.ExprMatch{
+						Expr: &ast.ExprVar{
+							Name: "y",
+						},
+						Arms: []*ast.ExprMatchArm{
+							{
+								Pattern: &ast.MatchPattern{
+									Kind: ast.MatchPatternValue,
+									Value: &ast.ExprStr{
+										V: "a",
+									},
+								},
+								Body: &ast.ExprInt{
+									V: 1,
+								},
+							},
+							{
+								Pattern: &ast.MatchPattern{
+									Kind: ast.MatchPatternList,
+									List: []*ast.MatchPattern{
+										{
+											Kind: ast.MatchPatternWildcard,
+										},
+										{
+											Kind: ast.MatchPatternValue,
+											Value: &ast.ExprBool{
+												V: true,
+											},
+										},
+									},
+								},
+								Body: &ast.ExprInt{
+									V: 2,
+								},
+							},
+							{
+								Pattern: &ast.MatchPattern{
+									Kind: ast.MatchPatternStruct,
+									Fields: []*ast.MatchPatternField{
+										{
+											Name: "z",
+											Pattern: &ast.MatchPattern{
+												Kind: ast.MatchPatternValue,
+												Value: &ast.ExprFloat{
+													V: 4.2,
+												},
+											},
+										},
+									},
+								},
+								Body: &ast.ExprInt{
+									V: 3,
+								},
+							},
+							{
+								Pattern: &ast.MatchPattern{
+									Kind: ast.MatchPatternWildcard,
+								},
+								Body: &ast.ExprInt{
+									V: 4,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+		testCases = append(testCases, test{
+			name: "match expression",
+			code: `
+			$x = match $y {
+				"a" => 1,
+				[_, true] => 2,
+				struct{z => 4.2} => 3,
+				_ => 4,
+			}
+			`,
+			fail: false,
+			exp:  exp,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "match expression single line",
+			code: `$x = match $y { 1 => "a", _ => "b" }`,
+			fail: false,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "match expression without arms",
+			code: `$x = match $y {}`,
+			fail: true,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "match expression with expr pattern",
+			code: `$x = match $y { $z => 1, _ => 2 }`,
+			fail: true, // patterns are only literals
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "match as a name",
+			code: `
+			import "regexp"
+			$match = regexp.match("^a", "abc")
+			test "t1" {
+				boolptr => $match,
+			}
+			`,
+			fail: false,
+		})
+	}
+	{
+		exp := &ast.StmtProg{
+			Body: []interfaces.Stmt{
+				&ast.StmtType{
+					Name: "endpoint",
+					Type: types.NewType("struct{name str; port int}"),
+				},
+				&ast.StmtBind{
+					Ident: "x",
+					Value: &ast.ExprStruct{
+						Fields: []*ast.ExprStructField{
+							{
+								Name: "name",
+								Value: &ast.ExprStr{
+									V: "web",
+								},
+							},
+							{
+								Name: "port",
+								Value: &ast.ExprInt{
+									V: 80,
+								},
+							},
+						},
+					},
+					Type: types.NewNamed("endpoint"),
+				},
+			},
+		}
+		testCases = append(testCases, test{
+			name: "type statement",
+			code: `
+			type endpoint = struct{name str; port int}
+			$x endpoint = struct{name => "web", port => 80}
+			`,
+			fail: false,
+			exp:  exp,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "named types in signatures",
+			code: `
+			import "pkg"
+			type endpoints = []pkg.endpoint
+			func first($eps endpoints, $f func(pkg.endpoint) str) map{str: pkg.endpoint} {
+				$f($eps[0])
+			}
+			class server($eps endpoints) {
+			}
+			`,
+			fail: false,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "type as a name",
+			code: `
+			$type = struct{type => "x"}->type
+			test "t1" {
+				type => $type,
+			}
+			`,
+			fail: false,
+		})
+	}
+	{
+		testCases = append(testCases, test{
+			name: "type statement without a name",
+			code: `
+			type = int
+			`,
+			fail: true,
+		})
+	}
+
 	if testing.Short() {
 		t.Logf("available tests:")
 	}
@@ -2510,6 +2851,7 @@ func TestImportParsing0(t *testing.T) {
 		isFile   bool
 		path     string
 		url      string
+		qual     string
 	}
 	testCases := []test{}
 	testCases = append(testCases, test{ // index: 0
@@ -2723,6 +3065,43 @@ func TestImportParsing0(t *testing.T) {
 		name: "git:////home/james/code/mgmt-example1/",
 		fail: true, // don't allow double root slash
 	})
+	testCases = append(testCases, test{
+		name:  "git://example.com/purpleidea/mgmt-example1/?tag=v1.0",
+		alias: "example1",
+		path:  "example.com/purpleidea/mgmt-example1/",
+		url:   "git://example.com/purpleidea/mgmt-example1/",
+		qual:  "tag=v1.0",
+	})
+	testCases = append(testCases, test{
+		name:  "git://example.com/purpleidea/mgmt-example1/?branch=stable",
+		alias: "example1",
+		path:  "example.com/purpleidea/mgmt-example1/",
+		url:   "git://example.com/purpleidea/mgmt-example1/",
+		qual:  "branch=stable",
+	})
+	testCases = append(testCases, test{
+		name:  "git://example.com/purpleidea/mgmt-example1/?commit=0123456789abcdef0123456789abcdef01234567",
+		alias: "example1",
+		path:  "example.com/purpleidea/mgmt-example1/",
+		url:   "git://example.com/purpleidea/mgmt-example1/",
+		qual:  "commit=0123456789abcdef0123456789abcdef01234567",
+	})
+	testCases = append(testCases, test{
+		name: "git://example.com/purpleidea/mgmt-example1/?commit=0123456",
+		fail: true, // short hashes are ambiguous
+	})
+	testCases = append(testCases, test{
+		name: "git://example.com/purpleidea/mgmt-example1/?tag=v1.0&branch=stable",
+		fail: true, // only one qualifier
+	})
+	testCases = append(testCases, test{
+		name: "git://example.com/purpleidea/mgmt-example1/?tag=",
+		fail: true, // empty qualifier
+	})
+	testCases = append(testCases, test{
+		name: "foo/bar/?tag=v1.0",
+		fail: true, // local imports can't be pinned
+	})
 
 	t.Logf("ModuleMagicPrefix: %s", langUtil.ModuleMagicPrefix)
 	names := []string{}
@@ -2733,7 +3112,7 @@ func TestImportParsing0(t *testing.T) {
 		}
 		names = append(names, tc.name)
 		t.Run(fmt.Sprintf("test #%d (%s)", index, tc.name), func(t *testing.T) {
-			name, fail, alias, isSystem, isLocal, isFile, path, url := tc.name, tc.fail, tc.alias, tc.isSystem, tc.isLocal, tc.isFile, tc.path, tc.url
+			name, fail, alias, isSystem, isLocal, isFile, path, url, qual := tc.name, tc.fail, tc.alias, tc.isSystem, tc.isLocal, tc.isFile, tc.path, tc.url, tc.qual
 
 			output, err := langUtil.ParseImportName(name)
 			if !fail && err != nil {
@@ -2793,6 +3172,12 @@ func TestImportParsing0(t *testing.T) {
 				t.Logf("test #%d:    url: %s", index, url)
 				return
 			}
+			if qual != output.Qualifier() {
+				t.Errorf("test #%d: unexpected value for: `Qualifier`", index)
+				t.Logf("test #%d: output: %+v", index, output)
+				t.Logf("test #%d:   qual: %s", index, qual)
+				return
+			}
 
 			// add some additional sanity checking:
 			if strings.HasPrefix(path, "/") {
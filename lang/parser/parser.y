@@ -64,6 +64,7 @@ func init() {
 
 	bool  bool
 	str   string
+	strs  []string
 	int   int64 // this is the .int as seen in lexer.nex
 	float float64
 
@@ -91,6 +92,13 @@ func init() {
 
 	edgeHalfList []*ast.StmtEdgeHalf
 	edgeHalf     *ast.StmtEdgeHalf
+
+	matchArms          []*ast.ExprMatchArm
+	matchArm           *ast.ExprMatchArm
+	matchPatterns      []*ast.MatchPattern
+	matchPattern       *ast.MatchPattern
+	matchPatternFields []*ast.MatchPatternField
+	matchPatternField  *ast.MatchPatternField
 }
 
 %token NEWLINE
@@ -111,6 +119,8 @@ func init() {
 %token COMMENT ERROR
 %token COLLECT_IDENTIFIER
 %token PANIC_IDENTIFIER
+%token MATCH_IDENTIFIER UNDERSCORE
+%token TYPE_IDENTIFIER
 
 // precedence table
 // "Operator precedence is determined by the line ordering of the declarations;
@@ -252,25 +262,18 @@ stmt:
 		$$.stmt = $1.stmt
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
 	}
-|	IF expr OPEN_CURLY prog CLOSE_CURLY
+|	stmt_if
 	{
-		$$.stmt = &ast.StmtIf{
-			Condition:  $2.expr,
-			ThenBranch: $4.stmt,
-			//ElseBranch: nil,
-		}
-		relocate($3, $5, $4.stmt) // the block spans the braces
+		$$.stmt = $1.stmt
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
 	}
-|	IF expr OPEN_CURLY prog CLOSE_CURLY ELSE OPEN_CURLY prog CLOSE_CURLY
+	// `type endpoint = struct{name str; port int}`
+|	TYPE_IDENTIFIER IDENTIFIER EQUALS type
 	{
-		$$.stmt = &ast.StmtIf{
-			Condition:  $2.expr,
-			ThenBranch: $4.stmt,
-			ElseBranch: $8.stmt,
+		$$.stmt = &ast.StmtType{
+			Name: $2.str,
+			Type: $4.typ,
 		}
-		relocate($3, $5, $4.stmt) // the blocks span the braces
-		relocate($7, $9, $8.stmt)
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
 	}
 	// iterate over lists
@@ -362,9 +365,12 @@ stmt:
 				Out:  $6.typ,
 			}
 			// XXX: We might still need to do this for now...
-			if err := fn.SetType(typ); err != nil {
-				// this will ultimately cause a parser error to occur...
-				yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
+			// Named types are set in SetScope once they're resolved.
+			if !typ.HasNamedRef() {
+				if err := fn.SetType(typ); err != nil {
+					// this will ultimately cause a parser error to occur...
+					yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
+				}
 			}
 		}
 		$$.stmt = &ast.StmtFunc{
@@ -409,8 +415,9 @@ stmt:
 |	INCLUDE_IDENTIFIER dotted_identifier OPEN_PAREN callargs CLOSE_PAREN
 	{
 		$$.stmt = &ast.StmtInclude{
-			Name: $2.str,
-			Args: $4.exprs,
+			Name:     $2.str,
+			Args:     $4.exprs,
+			ArgNames: argNames($4.strs),
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
 	}
@@ -429,9 +436,10 @@ stmt:
 |	INCLUDE_IDENTIFIER dotted_identifier OPEN_PAREN callargs CLOSE_PAREN AS_IDENTIFIER IDENTIFIER
 	{
 		$$.stmt = &ast.StmtInclude{
-			Name:  $2.str,
-			Args:  $4.exprs,
-			Alias: $7.str,
+			Name:     $2.str,
+			Args:     $4.exprs,
+			ArgNames: argNames($4.strs),
+			Alias:    $7.str,
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
 	}
@@ -471,6 +479,43 @@ stmt:
 	}
 */
 ;
+stmt_if:
+	IF expr OPEN_CURLY prog CLOSE_CURLY
+	{
+		$$.stmt = &ast.StmtIf{
+			Condition:  $2.expr,
+			ThenBranch: $4.stmt,
+			//ElseBranch: nil,
+		}
+		relocate($3, $5, $4.stmt) // the block spans the braces
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
+	}
+|	IF expr OPEN_CURLY prog CLOSE_CURLY ELSE OPEN_CURLY prog CLOSE_CURLY
+	{
+		$$.stmt = &ast.StmtIf{
+			Condition:  $2.expr,
+			ThenBranch: $4.stmt,
+			ElseBranch: $8.stmt,
+		}
+		relocate($3, $5, $4.stmt) // the blocks span the braces
+		relocate($7, $9, $8.stmt)
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.stmt)
+	}
+	// `if ... { ... } else if ... { ... }`
+|	IF expr OPEN_CURLY prog CLOSE_CURLY ELSE stmt_if
+	{
+		// The else if chain is a nested if statement, which is exactly
+		// what it would be if it was written inside an else block.
+		$$.stmt = &ast.StmtIf{
+			Condition:  $2.expr,
+			ThenBranch: $4.stmt,
+			ElseBranch: $7.stmt,
+		}
+		relocate($3, $5, $4.stmt) // the block spans the braces
+		posLast(yylex, yyDollar) // our pos
+		locateThrough($1, $7.stmt, $$.stmt)
+	}
+;
 expr:
 	BOOL
 	{
@@ -536,7 +581,32 @@ expr:
 		$$.expr = $1.expr
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
 	}
-|	IF expr OPEN_CURLY opt_newlines expr opt_newlines CLOSE_CURLY ELSE OPEN_CURLY opt_newlines expr opt_newlines CLOSE_CURLY
+|	expr_if
+	{
+		$$.expr = $1.expr
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
+	}
+|	match
+	{
+		$$.expr = $1.expr
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
+	}
+	// parenthesis wrap an expression for precedence
+|	OPEN_PAREN expr CLOSE_PAREN
+	{
+		// We wrap it in ExprParen, which is a transient AST node that
+		// records where the explicit parenthesis were in the source
+		// code, so that tools like the code formatter can print them
+		// back out. It gets removed during the Interpolate step, since
+		// the parser already used it for expression precedence here.
+		$$.expr = &ast.ExprParen{
+			Inner: $2.expr,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
+	}
+;
+expr_if:
+	IF expr OPEN_CURLY opt_newlines expr opt_newlines CLOSE_CURLY ELSE OPEN_CURLY opt_newlines expr opt_newlines CLOSE_CURLY
 	{
 		thenBranch := &ast.ExprBlock{
 			Inner: $5.expr,
@@ -553,20 +623,196 @@ expr:
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
 	}
-	// parenthesis wrap an expression for precedence
-|	OPEN_PAREN expr CLOSE_PAREN
+	// `if ... { ... } else if ... { ... } else { ... }`
+|	IF expr OPEN_CURLY opt_newlines expr opt_newlines CLOSE_CURLY ELSE expr_if
 	{
-		// We wrap it in ExprParen, which is a transient AST node that
-		// records where the explicit parenthesis were in the source
-		// code, so that tools like the code formatter can print them
-		// back out. It gets removed during the Interpolate step, since
-		// the parser already used it for expression precedence here.
-		$$.expr = &ast.ExprParen{
-			Inner: $2.expr,
+		thenBranch := &ast.ExprBlock{
+			Inner: $5.expr,
+		}
+		relocate($3, $7, thenBranch) // the block spans the braces
+		// The else if chain is a nested if expression, which is exactly
+		// what it would be if it was written inside an else block.
+		$$.expr = &ast.ExprIf{
+			Condition:  $2.expr,
+			ThenBranch: thenBranch,
+			ElseBranch: $9.expr,
+		}
+		posLast(yylex, yyDollar) // our pos
+		locateThrough($1, $9.expr, $$.expr)
+	}
+;
+match:
+	// `match $x { "a" => 1, [_, true] => 2, struct{y => 3} => 3, _ => 4, }`
+	MATCH_IDENTIFIER expr OPEN_CURLY opt_newlines match_arms opt_newlines CLOSE_CURLY
+	{
+		$$.expr = &ast.ExprMatch{
+			Expr: $2.expr,
+			Arms: $5.matchArms,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
+	}
+|	MATCH_IDENTIFIER expr OPEN_CURLY opt_newlines match_arms COMMA opt_newlines CLOSE_CURLY
+	{
+		$$.expr = &ast.ExprMatch{
+			Expr: $2.expr,
+			Arms: $5.matchArms,
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
 	}
 ;
+match_arms:
+	match_arm
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.matchArms = []*ast.ExprMatchArm{$1.matchArm}
+	}
+|	match_arms COMMA opt_newlines match_arm
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.matchArms = append($1.matchArms, $4.matchArm)
+	}
+;
+match_arm:
+	// `pattern => expr`
+	match_pattern ROCKET expr
+	{
+		$$.matchArm = &ast.ExprMatchArm{
+			Pattern: $1.matchPattern,
+			Body:    $3.expr,
+		}
+		posLast(yylex, yyDollar) // our pos
+		locateThrough($1, $3.expr, $$.matchArm)
+	}
+;
+match_pattern:
+	// `_` matches anything
+	UNDERSCORE
+	{
+		$$.matchPattern = &ast.MatchPattern{
+			Kind: ast.MatchPatternWildcard,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+|	BOOL
+	{
+		value := &ast.ExprBool{
+			V: $1.bool,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], value)
+		$$.matchPattern = &ast.MatchPattern{
+			Kind:  ast.MatchPatternValue,
+			Value: value,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+|	STRING
+	{
+		value := &ast.ExprStr{
+			V: $1.str,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], value)
+		$$.matchPattern = &ast.MatchPattern{
+			Kind:  ast.MatchPatternValue,
+			Value: value,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+|	INTEGER
+	{
+		value := &ast.ExprInt{
+			V: $1.int,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], value)
+		$$.matchPattern = &ast.MatchPattern{
+			Kind:  ast.MatchPatternValue,
+			Value: value,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+|	FLOAT
+	{
+		value := &ast.ExprFloat{
+			V: $1.float,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], value)
+		$$.matchPattern = &ast.MatchPattern{
+			Kind:  ast.MatchPatternValue,
+			Value: value,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+	// `[]` matches an empty list
+|	OPEN_BRACK CLOSE_BRACK
+	{
+		$$.matchPattern = &ast.MatchPattern{
+			Kind: ast.MatchPatternList,
+			List: []*ast.MatchPattern{},
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+	// `[_, 42]` matches a list of exactly two elements
+|	OPEN_BRACK match_patterns CLOSE_BRACK
+	{
+		$$.matchPattern = &ast.MatchPattern{
+			Kind: ast.MatchPatternList,
+			List: $2.matchPatterns,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+	// `struct{}` matches any struct
+|	STRUCT_IDENTIFIER OPEN_CURLY CLOSE_CURLY
+	{
+		$$.matchPattern = &ast.MatchPattern{
+			Kind:   ast.MatchPatternStruct,
+			Fields: []*ast.MatchPatternField{},
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+	// `struct{x => 42, y => _}` only looks at the named fields
+|	STRUCT_IDENTIFIER OPEN_CURLY match_pattern_fields CLOSE_CURLY
+	{
+		$$.matchPattern = &ast.MatchPattern{
+			Kind:   ast.MatchPatternStruct,
+			Fields: $3.matchPatternFields,
+		}
+		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.matchPattern)
+	}
+;
+match_patterns:
+	match_pattern
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.matchPatterns = []*ast.MatchPattern{$1.matchPattern}
+	}
+|	match_patterns COMMA match_pattern
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.matchPatterns = append($1.matchPatterns, $3.matchPattern)
+	}
+;
+match_pattern_fields:
+	match_pattern_field
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.matchPatternFields = []*ast.MatchPatternField{$1.matchPatternField}
+	}
+|	match_pattern_fields COMMA match_pattern_field
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.matchPatternFields = append($1.matchPatternFields, $3.matchPatternField)
+	}
+;
+match_pattern_field:
+	field_identifier ROCKET match_pattern
+	{
+		$$.matchPatternField = &ast.MatchPatternField{
+			Name:    $1.str,
+			Pattern: $3.matchPattern,
+		}
+		posLast(yylex, yyDollar) // our pos
+		locateThrough($1, $3.matchPattern, $$.matchPatternField)
+	}
+;
 list:
 	list_single
 	{
@@ -793,7 +1039,7 @@ struct_single_fields:
 	}
 ;
 struct_single_field:
-	IDENTIFIER ROCKET expr
+	field_identifier ROCKET expr
 	{
 		$$.structField = &ast.ExprStructField{
 			Name:  $1.str,
@@ -835,7 +1081,7 @@ struct_multi_fields:
 	}
 ;
 struct_multi_field:
-	IDENTIFIER ROCKET expr COMMA NEWLINE
+	field_identifier ROCKET expr COMMA NEWLINE
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.structField = &ast.ExprStructField{
@@ -855,8 +1101,9 @@ call:
 	dotted_identifier OPEN_PAREN callargs CLOSE_PAREN
 	{
 		$$.expr = &ast.ExprCall{
-			Name: $1.str,
-			Args: $3.exprs,
+			Name:     $1.str,
+			Args:     $3.exprs,
+			ArgNames: argNames($3.strs),
 			//Var: false, // default
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
@@ -866,8 +1113,9 @@ call:
 |	dotted_var_identifier OPEN_PAREN callargs CLOSE_PAREN
 	{
 		$$.expr = &ast.ExprCall{
-			Name: $1.str,
-			Args: $3.exprs,
+			Name:     $1.str,
+			Args:     $3.exprs,
+			ArgNames: argNames($3.strs),
 			// Instead of `Var: true`, we could have added a `$`
 			// prefix to the Name, but I felt this was more elegant.
 			Var: true, // lambda
@@ -878,9 +1126,10 @@ call:
 |	func OPEN_PAREN callargs CLOSE_PAREN
 	{
 		$$.expr = &ast.ExprCall{
-			Name: "", // anonymous!
-			Args: $3.exprs,
-			Anon: $1.expr,
+			Name:     "", // anonymous!
+			Args:     $3.exprs,
+			ArgNames: argNames($3.strs),
+			Anon:     $1.expr,
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
 	}
@@ -1083,7 +1332,7 @@ call:
 	// lookup a field in a struct
 	// _struct_lookup($foo, "field")
 	// `$foo->field`
-|	expr ARROW IDENTIFIER %prec STRUCT_LOOKUP
+|	expr ARROW field_identifier %prec STRUCT_LOOKUP
 	{
 		$$.expr = &ast.ExprCall{
 			Name: funcs.StructLookupFuncName,
@@ -1102,7 +1351,7 @@ call:
 	// NOTE: This is different from the generic except operator below, since
 	// whether the field is present or not is determined statically from the
 	// struct type at compile time, it is not a runtime error to catch.
-|	expr ARROW IDENTIFIER EXCEPT expr
+|	expr ARROW field_identifier EXCEPT expr
 	{
 		$$.expr = &ast.ExprCall{
 			Name: funcs.StructLookupOptionalFuncName,
@@ -1146,16 +1395,19 @@ callargs:
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = []interfaces.Expr{}
+		$$.strs = []string{}
 	}
 |	callargs_single
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = $1.exprs
+		$$.strs = $1.strs
 	}
 |	callargs_multi
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = $1.exprs
+		$$.strs = $1.strs
 	}
 ;
 callargs_single:
@@ -1164,6 +1416,7 @@ callargs_single:
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = $1.exprs
+		$$.strs = $1.strs
 	}
 ;
 callargs_single_args:
@@ -1172,18 +1425,21 @@ callargs_single_args:
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = append($1.exprs, $3.expr)
+		$$.strs = append($1.strs, $3.str)
 	}
 |	callargs_single_arg
 	{
 		posLast(yylex, yyDollar) // our pos
-		$$.exprs = append($$.exprs, $1.expr)
+		$$.exprs = append([]interfaces.Expr{}, $1.expr)
+		$$.strs = append([]string{}, $1.str)
 	}
 ;
 callargs_single_arg:
-	expr
+	callarg
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.expr = $1.expr
+		$$.str = $1.str
 	}
 ;
 callargs_multi:
@@ -1194,6 +1450,7 @@ callargs_multi:
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = $2.exprs
+		$$.strs = $2.strs
 	}
 ;
 callargs_multi_args:
@@ -1201,24 +1458,44 @@ callargs_multi_args:
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = []interfaces.Expr{}
+		$$.strs = []string{}
 	}
 |	callargs_multi_args callargs_multi_arg
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = append($1.exprs, $2.expr)
+		$$.strs = append($1.strs, $2.str)
 	}
 	// Skip over blank lines between args.
 |	callargs_multi_args NEWLINE
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.exprs = $1.exprs
+		$$.strs = $1.strs
 	}
 ;
 callargs_multi_arg:
-	expr COMMA NEWLINE
+	callarg COMMA NEWLINE
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.expr = $1.expr
+		$$.str = $1.str
+	}
+;
+callarg:
+	// `42`
+	expr
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.expr = $1.expr
+		$$.str = "" // positional
+	}
+	// `port => 42`
+|	IDENTIFIER ROCKET expr
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.expr = $3.expr
+		$$.str = $1.str // named
 	}
 ;
 var:
@@ -1279,9 +1556,12 @@ func:
 				Ord:  ord,
 				Out:  $5.typ,
 			}
-			if err := $$.expr.SetType(typ); err != nil {
-				// this will ultimately cause a parser error to occur...
-				yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
+			// Named types are set in SetScope once they're resolved.
+			if !typ.HasNamedRef() {
+				if err := $$.expr.SetType(typ); err != nil {
+					// this will ultimately cause a parser error to occur...
+					yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
+				}
 			}
 		}
 		locate(yylex, $1, yyDollar[len(yyDollar)-1], $$.expr)
@@ -1386,6 +1666,25 @@ arg:
 		}
 		locateOnly($1, yyDollar[len(yyDollar)-1], $$.arg)
 	}
+	// `$x = <expr>`
+|	var_identifier EQUALS expr
+	{
+		$$.arg = &interfaces.Arg{
+			Name:    $1.str,
+			Default: $3.expr,
+		}
+		locateOnly($1, yyDollar[len(yyDollar)-1], $$.arg)
+	}
+	// `$x <type> = <expr>`
+|	var_identifier type EQUALS expr
+	{
+		$$.arg = &interfaces.Arg{
+			Name:    $1.str,
+			Type:    $2.typ,
+			Default: $4.expr,
+		}
+		locateOnly($1, yyDollar[len(yyDollar)-1], $$.arg)
+	}
 ;
 bind:
 	// `$s = "hey"`
@@ -1403,9 +1702,12 @@ bind:
 	{
 		var expr interfaces.Expr = $4.expr
 		// XXX: We still need to do this for now it seems...
-		if err := expr.SetType($2.typ); err != nil {
-			// this will ultimately cause a parser error to occur...
-			yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
+		// Named types are set in SetScope once they're resolved.
+		if !$2.typ.HasNamedRef() {
+			if err := expr.SetType($2.typ); err != nil {
+				// this will ultimately cause a parser error to occur...
+				yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
+			}
 		}
 		$$.stmt = &ast.StmtBind{
 			Ident: $1.str,
@@ -1572,7 +1874,7 @@ resource_body:
 	}
 ;
 resource_field:
-	IDENTIFIER ROCKET expr COMMA
+	field_identifier ROCKET expr COMMA
 	{
 		$$.resField = &ast.StmtResField{
 			Field: $1.str,
@@ -1583,7 +1885,7 @@ resource_field:
 ;
 conditional_resource_field:
 	// content => $present ?: "hello",
-	IDENTIFIER ROCKET expr ELVIS expr COMMA
+	field_identifier ROCKET expr ELVIS expr COMMA
 	{
 		$$.resField = &ast.StmtResField{
 			Field:     $1.str,
@@ -1769,47 +2071,64 @@ type:
 	// list: []int or [][]str (with recursion)
 	{
 		posLast(yylex, yyDollar) // our pos
-		$$.typ = types.NewType("[]" + $3.typ.String())
+		endAt(&$$, yyDollar)
+		// build it directly so that any named types are preserved
+		$$.typ = &types.Type{
+			Kind: types.KindList,
+			Val:  $3.typ,
+		}
 	}
 |	MAP_IDENTIFIER OPEN_CURLY type COLON type CLOSE_CURLY
 	// map: map{str: int} or map{str: []int}
 	{
 		posLast(yylex, yyDollar) // our pos
-		$$.typ = types.NewType(fmt.Sprintf("map{%s: %s}", $3.typ.String(), $5.typ.String()))
+		endAt(&$$, yyDollar)
+		$$.typ = &types.Type{
+			Kind: types.KindMap,
+			Key:  $3.typ,
+			Val:  $5.typ,
+		}
 	}
 |	STRUCT_IDENTIFIER OPEN_CURLY CLOSE_CURLY
 	// struct: struct{}
 	{
 		posLast(yylex, yyDollar) // our pos
+		endAt(&$$, yyDollar)
 		$$.typ = types.NewType(fmt.Sprintf("%s{}", $1.str))
 	}
 |	STRUCT_IDENTIFIER OPEN_CURLY type_struct_fields CLOSE_CURLY
 	// struct: struct{a bool} or struct{a bool; bb int}
 	{
 		posLast(yylex, yyDollar) // our pos
+		endAt(&$$, yyDollar)
 
-		names := make(map[string]struct{})
-		strs := []string{}
+		m := make(map[string]*types.Type)
+		ord := []string{}
 		for _, arg := range $3.args {
-			s := fmt.Sprintf("%s %s", arg.Name, arg.Type.String())
-			if _, exists := names[arg.Name]; exists {
+			if _, exists := m[arg.Name]; exists {
 				// duplicate field name used
+				s := fmt.Sprintf("%s %s", arg.Name, arg.Type.String())
 				err := fmt.Errorf("duplicate struct field of `%s`", s)
 				// this will ultimately cause a parser error to occur...
 				yylex.Error(fmt.Sprintf("%s: %+v", ErrParseSetType, err))
 				break // we must skip, because code continues!
 			}
-			names[arg.Name] = struct{}{}
-			strs = append(strs, s)
+			m[arg.Name] = arg.Type
+			ord = append(ord, arg.Name)
 		}
 
-		$$.typ = types.NewType(fmt.Sprintf("%s{%s}", $1.str, strings.Join(strs, "; ")))
+		$$.typ = &types.Type{
+			Kind: types.KindStruct,
+			Map:  m,
+			Ord:  ord,
+		}
 	}
 |	FUNC_IDENTIFIER OPEN_PAREN type_func_args CLOSE_PAREN type
 	// XXX: should we allow named args in the type signature?
 	// func: func() float or func(bool) str or func(a bool, bb int) float
 	{
 		posLast(yylex, yyDollar) // our pos
+		endAt(&$$, yyDollar)
 
 		m := make(map[string]*types.Type)
 		ord := []string{}
@@ -1855,6 +2174,26 @@ type:
 		posLast(yylex, yyDollar) // our pos
 		$$.typ = types.NewType($1.str) // "variant"
 	}
+	// a type which was named with a type statement, eg: `endpoint`
+	// or one that came in from an import, eg: `pkg.endpoint`
+|	type_identifier
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.typ = types.NewNamed($1.str) // resolved in SetScope
+	}
+;
+type_identifier:
+	IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $1.str
+	}
+|	type_identifier DOT IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		endAt(&$$, yyDollar)
+		$$.str = $1.str + interfaces.ModuleSep + $3.str
+	}
 ;
 type_struct_fields:
 	type_struct_fields SEMICOLON type_struct_field
@@ -1869,7 +2208,7 @@ type_struct_fields:
 	}
 ;
 type_struct_field:
-	IDENTIFIER type
+	field_identifier type
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.arg = &interfaces.Arg{ // reuse the Arg struct
@@ -1980,6 +2319,12 @@ type_func_arg:
 ;
 undotted_identifier:
 	IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $1.str
+	}
+	// a variable could be named $type
+|	TYPE_IDENTIFIER
 	{
 		posLast(yylex, yyDollar) // our pos
 		$$.str = $1.str
@@ -1997,6 +2342,20 @@ undotted_identifier:
 		$$.str = $1.str
 	}
 ;
+// field_identifier is the name of a resource field or of a struct field. These
+// can also be named with some of the keywords, eg: `type => "foo",`.
+field_identifier:
+	IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $1.str
+	}
+|	TYPE_IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $1.str
+	}
+;
 var_identifier:
 	// eg: $ foo (dollar prefix + identifier)
 	DOLLAR undotted_identifier
@@ -2006,6 +2365,14 @@ var_identifier:
 		$$.endRow = $2.endRow // propagate end position from identifier
 		$$.endCol = $2.endCol
 	}
+	// eg: $ match (match is a keyword, but it's still a valid variable name)
+|	DOLLAR MATCH_IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $2.str // don't include the leading $
+		$$.endRow = $2.endRow // propagate end position from identifier
+		$$.endCol = $2.endCol
+	}
 ;
 colon_identifier:
 	// eg: `foo`
@@ -2032,6 +2399,12 @@ dotted_identifier:
 		posLast(yylex, yyDollar) // our pos
 		$$.str = $1.str + interfaces.ModuleSep + $3.str
 	}
+	// a module function could be named match(), eg: regexp.match()
+|	dotted_identifier DOT MATCH_IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $1.str + interfaces.ModuleSep + $3.str
+	}
 ;
 // there are different ways the lexer/parser might choose to represent this...
 dotted_var_identifier:
@@ -2043,6 +2416,14 @@ dotted_var_identifier:
 		$$.endRow = $2.endRow // propagate end position from identifier
 		$$.endCol = $2.endCol
 	}
+	// eg: $ match (match is a keyword, but it's still a valid variable name)
+|	DOLLAR MATCH_IDENTIFIER
+	{
+		posLast(yylex, yyDollar) // our pos
+		$$.str = $2.str // don't include the leading $
+		$$.endRow = $2.endRow // propagate end position from identifier
+		$$.endCol = $2.endCol
+	}
 ;
 capitalized_res_identifier:
 	CAPITALIZED_IDENTIFIER
@@ -2135,6 +2516,39 @@ func locateEdge(edge *ast.StmtEdge) {
 	edge.Locate(startLine, startCol, endLine, endCol)
 }
 
+// locateThrough is like locate, but for rules whose trailing symbol is an
+// already located non-terminal, such as an `else if` chain. The parser symbol
+// of a non-terminal only carries the end of its first token, so we end at the
+// end of the trailing node instead.
+func locateThrough(first yySymType, last interface{}, node interface{}) {
+	pn, ok := node.(interfaces.PositionableNode)
+	if !ok || pn.IsSet() {
+		return
+	}
+	endRow, endCol := last.(interfaces.PositionableNode).End() // must be set
+	pn.Locate(first.row, first.col, endRow, endCol)
+}
+
+// argNames returns the names of the args of a call or of an include, or nil if
+// they're all positional, which is the common case.
+func argNames(names []string) []string {
+	for _, x := range names {
+		if x != "" {
+			return names
+		}
+	}
+	return nil
+}
+
+// endAt stores the end position of the last symbol of a rule in the result of
+// that rule. The parser symbol of a non-terminal would otherwise only carry the
+// end of its first token, which is not enough for types that span many tokens.
+func endAt(val *yySymType, dollars []yySymType) {
+	last := dollars[len(dollars)-1]
+	val.endRow = last.endRow
+	val.endCol = last.endCol
+}
+
 // cast is used to pull out the parser run-specific struct we store our AST in.
 // this is usually called in the parser.
 func cast(y yyLexer) *lexParseAST {
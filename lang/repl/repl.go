@@ -0,0 +1,676 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+// Package repl implements an interactive read-eval-print loop for mcl. Each
+// expression which is entered is evaluated live by the function engine, and
+// streaming values keep updating until the user presses enter. Each statement
+// which is entered is added to the program, and the changes that it makes to
+// the resource graph are shown. Nothing is ever applied.
+package repl
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/graph/autoedge"
+	"github.com/purpleidea/mgmt/engine/local"
+	"github.com/purpleidea/mgmt/etcd"
+	etcdClient "github.com/purpleidea/mgmt/etcd/client"
+	"github.com/purpleidea/mgmt/lang"
+	"github.com/purpleidea/mgmt/lang/ast"
+	_ "github.com/purpleidea/mgmt/lang/core" // import so the funcs register
+	"github.com/purpleidea/mgmt/lang/funcs/dage"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/interpolate"
+	"github.com/purpleidea/mgmt/lang/interpret"
+	"github.com/purpleidea/mgmt/lang/parser"
+	"github.com/purpleidea/mgmt/lang/tester"
+	_ "github.com/purpleidea/mgmt/lang/unification/solvers" // import so the solvers register
+	"github.com/purpleidea/mgmt/pgraph"
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// Prompt is printed when we're waiting for new input.
+	Prompt = "mcl> "
+
+	// ContinuePrompt is printed when the input so far is incomplete, such
+	// as when a curly brace hasn't been closed yet.
+	ContinuePrompt = "...> "
+
+	// ResultName is the name of the variable which an expression is bound
+	// to, so that it can be type checked along with the program.
+	ResultName = "repl_result"
+
+	// DefaultTimeout is the default amount of time that we wait for the
+	// function engine to produce the first value.
+	DefaultTimeout = 60 * time.Second
+
+	// MainFilename is the name that the program is known by in errors.
+	MainFilename = "repl.mcl"
+
+	// help is printed by the :help command.
+	help = `Enter an mcl expression to evaluate it, or a statement to add it to the
+program. Streaming values keep updating until you press enter.
+
+  :type <expr>  print the type of an expression
+  :graph        print the resource graph of the program
+  :list         print the program
+  :reset        remove all the statements from the program
+  :help         print this help
+  :quit         exit
+`
+)
+
+// Repl is an interactive mcl interpreter. It's the engine behind `mgmt repl`.
+type Repl struct {
+	// ModulePath is the absolute path of the modules directory with a
+	// trailing slash. It can be empty if there's none.
+	ModulePath string
+
+	// Timeout is how long we wait for the first value of an expression,
+	// or for the resource graph. If it's zero, DefaultTimeout is used.
+	Timeout time.Duration
+
+	Debug bool
+	Logf  func(format string, v ...interface{})
+
+	stmts []string // the code of each statement in the program
+	graph string   // the last resource graph that was shown
+
+	w        io.Writer
+	terminal bool        // can we update values in place?
+	lines    chan string // lines of input
+	pending  string      // a line of input that stopped a streaming value
+}
+
+// Init must be called before Run.
+func (obj *Repl) Init() error {
+	if obj.Logf == nil {
+		return fmt.Errorf("the Logf function must be specified")
+	}
+	if obj.Timeout == 0 {
+		obj.Timeout = DefaultTimeout
+	}
+	obj.stmts = []string{}
+	return nil
+}
+
+// Run reads input from the reader and writes the results to the writer, until
+// the input ends, the user quits, or the context is cancelled.
+func (obj *Repl) Run(ctx context.Context, r io.Reader, w io.Writer) error {
+	obj.w = w
+	if f, ok := w.(*os.File); ok {
+		if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			obj.terminal = true
+		}
+	}
+
+	// We don't wait for this goroutine to exit, since it's usually blocked
+	// reading from stdin, which can't be interrupted.
+	obj.lines = make(chan string)
+	go func() {
+		defer close(obj.lines)
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			select {
+			case obj.lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintf(obj.w, "Type :help for help.\n")
+	for {
+		input, ok, err := obj.read(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok { // end of input
+			fmt.Fprintln(obj.w)
+			return nil
+		}
+		quit, err := obj.Eval(ctx, input)
+		if err != nil {
+			fmt.Fprintf(obj.w, "error: %s\n", err)
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// read returns the next input, which might span many lines when there are some
+// unclosed brackets. It returns false when the input ends.
+func (obj *Repl) read(ctx context.Context) (string, bool, error) {
+	input := ""
+	prompt := Prompt
+	for {
+		line, ok := obj.pending, true
+		obj.pending = ""
+		if line == "" {
+			fmt.Fprint(obj.w, prompt)
+			select {
+			case line, ok = <-obj.lines:
+			case <-ctx.Done():
+				return "", false, ctx.Err()
+			}
+		}
+		if !ok {
+			return "", false, nil
+		}
+		input += line + "\n"
+		if !incomplete(input) {
+			return strings.TrimSpace(input), true, nil
+		}
+		prompt = ContinuePrompt
+	}
+}
+
+// Eval runs a single input, which is a command, an expression or a statement.
+// It returns true if the user asked to quit. An error is for the user, and it
+// doesn't end the session.
+func (obj *Repl) Eval(ctx context.Context, input string) (bool, error) {
+	command, arg, _ := strings.Cut(input, " ")
+	arg = strings.TrimSpace(arg)
+	switch command {
+	case "":
+		return false, nil
+
+	case ":quit", ":q", ":exit":
+		return true, nil
+
+	case ":help":
+		fmt.Fprint(obj.w, help)
+		return false, nil
+
+	case ":reset":
+		obj.stmts = []string{}
+		obj.graph = ""
+		return false, nil
+
+	case ":list":
+		for _, x := range obj.stmts {
+			fmt.Fprintln(obj.w, x)
+		}
+		return false, nil
+
+	case ":graph":
+		iast, err := obj.compile(ctx, obj.program())
+		if err != nil {
+			return false, err
+		}
+		s, err := obj.resources(ctx, iast)
+		if err != nil {
+			return false, err
+		}
+		obj.graph = s
+		if s == "" {
+			fmt.Fprintln(obj.w, "the resource graph is empty")
+		}
+		fmt.Fprint(obj.w, s)
+		return false, nil
+
+	case ":type":
+		if _, err := parser.LexParse(strings.NewReader(bind(arg))); err != nil {
+			return false, fmt.Errorf("not an expression")
+		}
+		expr, err := obj.expr(ctx, arg)
+		if err != nil {
+			return false, err
+		}
+		typ, err := expr.Type()
+		if err != nil {
+			return false, err
+		}
+		fmt.Fprintln(obj.w, typ)
+		return false, nil
+	}
+	if strings.HasPrefix(command, ":") {
+		return false, fmt.Errorf("unknown command `%s`, try :help", command)
+	}
+
+	// An expression can always be bound to a variable, but a statement
+	// can't, so that's how we tell them apart.
+	if _, err := parser.LexParse(strings.NewReader(bind(input))); err == nil {
+		return false, obj.evalExpr(ctx, input)
+	}
+	if _, err := parser.LexParse(strings.NewReader(input + "\n")); err != nil {
+		return false, err
+	}
+	return false, obj.evalStmt(ctx, input)
+}
+
+// evalExpr evaluates an expression with the function engine, and prints its
+// value. If the value can change, then we keep printing it until the user
+// enters something.
+func (obj *Repl) evalExpr(ctx context.Context, input string) error {
+	expr, err := obj.expr(ctx, input)
+	if err != nil {
+		return err
+	}
+	fgraph, fn, err := expr.Graph(interfaces.EmptyEnv())
+	if err != nil {
+		return errwrap.Wrapf(err, "could not generate function graph")
+	}
+	streaming := streams(expr, make(map[interfaces.Node]struct{}))
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, cleanup, err := obj.engine(ctx, fgraph)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	last := ""
+	timeout := time.After(obj.Timeout)
+	var lines chan string // nil until we're waiting for the user to stop
+	for {
+		select {
+		case table, ok := <-stream:
+			if !ok {
+				return cleanup()
+			}
+			value, exists := table[fn]
+			if !exists {
+				continue
+			}
+			timeout = nil // we got the first value
+			s := value.String()
+			if !streaming {
+				fmt.Fprintln(obj.w, s)
+				return nil
+			}
+			lines = obj.lines
+			if s == last {
+				continue
+			}
+			last = s
+			if obj.terminal {
+				fmt.Fprintf(obj.w, "\r\033[K%s", s) // update in place
+				continue
+			}
+			fmt.Fprintln(obj.w, s)
+
+		case line, ok := <-lines:
+			// Any input stops the value. If it's more than a
+			// simple enter key, then we run it next.
+			if obj.terminal && last != "" {
+				fmt.Fprintln(obj.w)
+			}
+			if ok { // otherwise read sees the end of the input
+				obj.pending = line
+			}
+			return nil
+
+		case <-timeout:
+			return fmt.Errorf("no value was produced after %s", obj.Timeout)
+
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// evalStmt adds a statement to the program, if the program still compiles and
+// runs, and prints the changes to the resource graph that it made.
+func (obj *Repl) evalStmt(ctx context.Context, input string) error {
+	code := obj.program() + input + "\n"
+	iast, err := obj.compile(ctx, code)
+	if err != nil {
+		return err
+	}
+	s, err := obj.resources(ctx, iast)
+	if err != nil {
+		return err
+	}
+	obj.stmts = append(obj.stmts, input)
+	if diff := tester.Diff(obj.graph, s); diff != "" {
+		fmt.Fprintln(obj.w, diff)
+	}
+	obj.graph = s
+	return nil
+}
+
+// expr compiles the program with the expression bound to a variable at the
+// end, and returns that expression, with its type. A bind is only type checked
+// where it's used, so we also add an empty loop over it which doesn't do
+// anything, but which accepts any type.
+func (obj *Repl) expr(ctx context.Context, input string) (interfaces.Expr, error) {
+	use := fmt.Sprintf("for $i, $x in [%s%s] {}\n", interfaces.VarPrefix, ResultName)
+	iast, err := obj.compile(ctx, obj.program()+bind(input)+use)
+	if err != nil {
+		return nil, err
+	}
+	prog, ok := iast.(*ast.StmtProg)
+	if !ok || len(prog.Body) < 2 {
+		// programming error
+		return nil, fmt.Errorf("unexpected AST")
+	}
+	stmt, ok := prog.Body[len(prog.Body)-2].(*ast.StmtBind)
+	if !ok || stmt.Ident != ResultName {
+		// programming error
+		return nil, fmt.Errorf("unexpected AST")
+	}
+	return stmt.Value, nil
+}
+
+// program returns the code of all the statements so far.
+func (obj *Repl) program() string {
+	s := ""
+	for _, x := range obj.stmts {
+		s += x + "\n"
+	}
+	return s
+}
+
+// compile runs the code through the lexer, parser, scope checker and the type
+// unification, and returns the AST.
+func (obj *Repl) compile(ctx context.Context, code string) (interfaces.Stmt, error) {
+	logf := func(format string, v ...interface{}) {
+		if !obj.Debug {
+			return
+		}
+		obj.Logf(format, v...)
+	}
+
+	xast, err := parser.LexParse(strings.NewReader(code))
+	if err != nil {
+		return nil, err
+	}
+
+	importVertex, err := lang.NewImports()
+	if err != nil {
+		return nil, err
+	}
+
+	// Local imports are relative to the working directory.
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	fs := util.NewReadOnlyOsFs()
+	data := &interfaces.Data{
+		Fs:    fs,
+		FsURI: fs.URI(),
+		Base:  strings.TrimSuffix(wd, "/") + "/", // with trailing slash
+		Files: []string{},
+		Metadata: &interfaces.Metadata{
+			Main: MainFilename,
+		},
+		Imports: importVertex,
+		Modules: obj.ModulePath,
+
+		LexParser:       parser.LexParse,
+		StrInterpolater: interpolate.StrInterpolate,
+
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("ast: "+format, v...)
+		},
+	}
+	scope, err := lang.NewScope("") // empty b/c not used
+	if err != nil {
+		return nil, err
+	}
+	iast, err := lang.Compile(xast, data, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := lang.Unify(ctx, iast, nil, obj.Debug, logf); err != nil {
+		return nil, err
+	}
+	return iast, nil
+}
+
+// resources runs the program until the function engine produces the first set
+// of values, and returns the text of the resulting resource graph.
+func (obj *Repl) resources(ctx context.Context, iast interfaces.Stmt) (string, error) {
+	fgraph, err := iast.Graph(interfaces.EmptyEnv())
+	if err != nil {
+		return "", errwrap.Wrapf(err, "could not generate function graph")
+	}
+
+	table := interfaces.Table{}
+	if fgraph.NumVertices() > 0 { // no funcs to load!
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		stream, cleanup, err := obj.engine(ctx, fgraph)
+		if err != nil {
+			return "", err
+		}
+		defer cleanup()
+
+		select {
+		case t, ok := <-stream:
+			if !ok {
+				return "", cleanup()
+			}
+			table = t
+
+		case <-time.After(obj.Timeout):
+			return "", fmt.Errorf("no values were produced after %s", obj.Timeout)
+
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+
+	interpreter := &interpret.Interpreter{
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			if obj.Debug {
+				obj.Logf("interpret: "+format, v...)
+			}
+		},
+	}
+	ograph, err := interpreter.Interpret(iast, table)
+	if err != nil {
+		return "", errwrap.Wrapf(err, "could not interpret")
+	}
+	logf := func(format string, v ...interface{}) {
+		if obj.Debug {
+			obj.Logf("autoedge: "+format, v...)
+		}
+	}
+	if err := autoedge.AutoEdge(ctx, ograph, obj.Debug, logf); err != nil {
+		return "", errwrap.Wrapf(err, "could not add automatic edges")
+	}
+	return tester.GraphString(ograph)
+}
+
+// engine starts a function engine with the function graph, and returns the
+// stream of values. The cleanup function must be called when done, after the
+// context is cancelled. It returns the error of the engine, if there was one.
+func (obj *Repl) engine(ctx context.Context, fgraph *pgraph.Graph) (<-chan interfaces.Table, func() error, error) {
+	logf := func(format string, v ...interface{}) {
+		if obj.Debug {
+			obj.Logf(format, v...)
+		}
+	}
+	cleanups := []func(){}
+	cleanup := func() {
+		for i := len(cleanups) - 1; i >= 0; i-- { // in reverse
+			cleanups[i]()
+		}
+		cleanups = nil
+	}
+
+	tmpdir, err := os.MkdirTemp("", "mgmt-repl-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanups = append(cleanups, func() { os.RemoveAll(tmpdir) })
+
+	localAPI := (&local.API{
+		Prefix: tmpdir + "/",
+		Debug:  obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("local: api: "+format, v...)
+		},
+	}).Init()
+
+	var world engine.World
+	world = &etcd.World{
+		Client:       etcdClient.NewClientFromClient(nil), // stub
+		StandaloneFs: util.NewMemFs(),                     // used for static deploys
+	}
+	worldInit := &engine.WorldInit{
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("world: etcd: "+format, v...)
+		},
+	}
+	if err := world.Connect(ctx, worldInit); err != nil {
+		cleanup()
+		return nil, nil, errwrap.Wrapf(err, "world Connect failed")
+	}
+	cleanups = append(cleanups, func() { world.Cleanup() })
+
+	funcs := &dage.Engine{
+		Name:     "repl",
+		Hostname: "", // NOTE: empty b/c not used
+		Local:    localAPI,
+		World:    world,
+		Debug:    obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("funcs: "+format, v...)
+		},
+	}
+	if err := funcs.Setup(); err != nil {
+		cleanup()
+		return nil, nil, errwrap.Wrapf(err, "could not setup the function engine")
+	}
+
+	txn := funcs.Txn()
+	defer txn.Free() // remember to call Free()
+	txn.AddGraph(fgraph)
+	if err := txn.Commit(); err != nil {
+		cleanup()
+		return nil, nil, errwrap.Wrapf(err, "could not commit the function graph")
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		funcs.Run(ctx) // the error is checked with funcs.Err()
+	}()
+	cleanups = append(cleanups, func() {
+		cancel()
+		wg.Wait()
+	})
+
+	once := &sync.Once{}
+	var reterr error
+	return funcs.Stream(), func() error {
+		once.Do(func() {
+			cleanup()
+			if err := errwrap.WithoutContext(funcs.Err()); err != nil && err != context.Canceled {
+				reterr = err
+			}
+		})
+		return reterr
+	}, nil
+}
+
+// streams returns true if the node might call a builtin function which streams
+// values. This follows the variables and the functions that it refers to. The
+// function calls only get built into the function graph while it runs, so we
+// can't look at that graph to find out.
+func streams(node interfaces.Node, seen map[interfaces.Node]struct{}) bool {
+	result := false
+	node.Apply(func(n interfaces.Node) error {
+		if _, exists := seen[n]; exists || result {
+			return nil
+		}
+		seen[n] = struct{}{}
+
+		def := ast.Definition(n)
+		if def == nil {
+			return nil
+		}
+		if fn, ok := def.(*ast.ExprFunc); ok && fn.Function != nil {
+			_, result = fn.Function().(interfaces.StreamableFunc)
+			return nil
+		}
+		result = streams(def, seen)
+		return nil
+	})
+	return result
+}
+
+// bind returns the code which binds the expression to the result variable.
+func bind(expr string) string {
+	return fmt.Sprintf("%s%s = %s\n", interfaces.VarPrefix, ResultName, expr)
+}
+
+// incomplete returns true if the code has some unclosed brackets, which means
+// that it continues on the next line. Brackets in strings and comments don't
+// count.
+func incomplete(code string) bool {
+	depth := 0
+	inString := false
+	inComment := false
+	escaped := false
+	for _, c := range code {
+		switch {
+		case inComment:
+			inComment = c != '\n'
+		case inString:
+			if escaped {
+				escaped = false
+			} else if c == '\\' {
+				escaped = true
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '#':
+			inComment = true
+		case c == '"':
+			inString = true
+		case c == '{' || c == '(' || c == '[':
+			depth++
+		case c == '}' || c == ')' || c == ']':
+			depth--
+		}
+	}
+	return depth > 0 || inString
+}
@@ -0,0 +1,152 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package repl
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIncomplete0(t *testing.T) {
+	tests := map[string]bool{
+		"42\n":                  false,
+		"file \"/tmp/x\" {\n":   true,
+		"$x = [1, 2,\n":         true,
+		"$s = \"{\"\n":          false,
+		"$s = 42 # {\n":         false,
+		"$s = \"hello\n":        true,
+		"func f() {\n\t42\n}\n": false,
+		"$s = \"\\\"{\"\n":      false,
+	}
+	for code, expected := range tests {
+		if incomplete(code) != expected {
+			t.Errorf("expected incomplete(%q) to be %t", code, expected)
+		}
+	}
+}
+
+func TestRepl0(t *testing.T) {
+	input := strings.Join([]string{
+		`40 + 2`,
+		`:type "hello"`,
+		`import "fmt"`,
+		`$name = "world"`,
+		`fmt.printf("hello, %s!", $name)`,
+		`$nope + 1`,
+		`test "t1" {`,
+		`	stringptr => "${name}",`,
+		`}`,
+		`:list`,
+		`:graph`,
+		`:reset`,
+		`:graph`,
+		`:bogus`,
+		`:quit`,
+		`"unreached"`,
+	}, "\n")
+	w := &bytes.Buffer{}
+	repl := &Repl{
+		Logf: t.Logf,
+	}
+	if err := repl.Init(); err != nil {
+		t.Fatalf("could not init: %+v", err)
+	}
+	if err := repl.Run(context.Background(), strings.NewReader(input), w); err != nil {
+		t.Fatalf("could not run: %+v", err)
+	}
+	output := w.String()
+	t.Logf("output:\n%s", output)
+
+	for _, s := range []string{
+		"mcl> 42\n",
+		"mcl> str\n",
+		`mcl> "hello, world!"` + "\n",
+		"error: could not set scope: var `$nope` does not exist in this scope",
+		"+ Vertex: test[t1]\n",
+		`Field: test[t1].StringPtr = "world"`,
+		"mcl> import \"fmt\"\n$name = \"world\"\ntest \"t1\" {\n",
+		"the resource graph is empty",
+		"error: unknown command `:bogus`",
+	} {
+		if !strings.Contains(output, s) {
+			t.Errorf("missing output: %q", s)
+		}
+	}
+	if strings.Contains(output, "unreached") {
+		t.Errorf("expected to quit")
+	}
+}
+
+func TestRepl1(t *testing.T) {
+	// A streaming value keeps going until the next line of input.
+	r, w := io.Pipe()
+	output := &bytes.Buffer{}
+	repl := &Repl{
+		Logf: t.Logf,
+	}
+	if err := repl.Init(); err != nil {
+		t.Fatalf("could not init: %+v", err)
+	}
+	errch := make(chan error)
+	go func() {
+		errch <- repl.Run(context.Background(), r, output)
+	}()
+	io.WriteString(w, "import \"datetime\"\n")
+	io.WriteString(w, "datetime.now()\n")
+	time.Sleep(2500 * time.Millisecond) // let a few values arrive
+	io.WriteString(w, "\n")             // stop it
+	io.WriteString(w, "\"done\"\n")
+	w.Close()
+	if err := <-errch; err != nil {
+		t.Fatalf("could not run: %+v", err)
+	}
+	t.Logf("output:\n%s", output)
+
+	values := 0
+	for _, line := range strings.Split(output.String(), "\n") {
+		line = strings.TrimPrefix(line, Prompt)
+		if _, err := strconv.Atoi(line); err == nil {
+			values++
+		}
+	}
+	if values < 2 {
+		t.Errorf("expected the value to update")
+	}
+	if !strings.Contains(output.String(), `"done"`) {
+		t.Errorf("expected the input to continue")
+	}
+}
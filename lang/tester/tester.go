@@ -0,0 +1,633 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+// Package tester runs the unit tests of mcl code. Tests live in files named
+// with a `_test.mcl` suffix. Each top-level class named with a `test_` prefix
+// is a test which is included on its own, and whose resulting resource graph
+// can be compared to a golden file. Each top-level function named with a
+// `test_` prefix is a test which must return true. Nothing is ever applied.
+package tester
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/purpleidea/mgmt/engine"
+	"github.com/purpleidea/mgmt/engine/graph/autoedge"
+	"github.com/purpleidea/mgmt/engine/local"
+	engineUtil "github.com/purpleidea/mgmt/engine/util"
+	"github.com/purpleidea/mgmt/etcd"
+	etcdClient "github.com/purpleidea/mgmt/etcd/client"
+	"github.com/purpleidea/mgmt/lang"
+	"github.com/purpleidea/mgmt/lang/ast"
+	_ "github.com/purpleidea/mgmt/lang/core" // import so the funcs register
+	"github.com/purpleidea/mgmt/lang/funcs"
+	"github.com/purpleidea/mgmt/lang/funcs/dage"
+	"github.com/purpleidea/mgmt/lang/funcs/operators"
+	"github.com/purpleidea/mgmt/lang/inputs"
+	"github.com/purpleidea/mgmt/lang/interfaces"
+	"github.com/purpleidea/mgmt/lang/interpolate"
+	"github.com/purpleidea/mgmt/lang/interpret"
+	"github.com/purpleidea/mgmt/lang/parser"
+	_ "github.com/purpleidea/mgmt/lang/unification/solvers" // import so the solvers register
+	"github.com/purpleidea/mgmt/pgraph"
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// FileSuffix is the suffix of the files that contain mcl tests.
+	FileSuffix = "_test" + interfaces.DotFileNameExtension
+
+	// NamePrefix is the prefix of the classes and functions which are tests.
+	NamePrefix = "test_"
+
+	// GoldenDirectory is the directory next to the test files which holds
+	// the expected resource graph of each class test.
+	GoldenDirectory = "testdata/"
+
+	// GoldenExtension is the file extension of the golden files.
+	GoldenExtension = ".golden"
+
+	// DefaultTimeout is the default amount of time that we wait for the
+	// function engine to produce the first values of a test.
+	DefaultTimeout = 60 * time.Second
+)
+
+// Case is a single test found in a test file.
+type Case struct {
+	// File is the absolute path of the test file.
+	File string
+
+	// Name is the name of the class or function.
+	Name string
+
+	// Class is true if this test is a class, and false if it's a function.
+	Class bool
+}
+
+// String returns the name of the test with the file it's in.
+func (obj *Case) String() string {
+	return obj.File + ": " + obj.Name
+}
+
+// Golden returns the path of the golden file for this test. Each test file has
+// a directory of them, so that tests in different files can share a name.
+func (obj *Case) Golden() string {
+	dir, base := filepath.Split(obj.File)
+	stem := strings.TrimSuffix(base, FileSuffix)
+	return filepath.Join(dir, GoldenDirectory, stem, obj.Name+GoldenExtension)
+}
+
+// Tester finds and runs the mcl tests. It's the engine behind `mgmt test`.
+type Tester struct {
+	// Run is an optional regular expression. If it's set, only the tests
+	// whose name matches are run.
+	Run string
+
+	// UpdateGolden writes the resource graph of each class test to its
+	// golden file instead of comparing them.
+	UpdateGolden bool
+
+	// ModulePath is the absolute path of the modules directory with a
+	// trailing slash. It can be empty if there's none.
+	ModulePath string
+
+	// Timeout is how long we wait for the first values of each test. If
+	// it's zero, then the DefaultTimeout is used.
+	Timeout time.Duration
+
+	// Verbose prints the name of every test, and not only the failures.
+	Verbose bool
+
+	Debug bool
+	Logf  func(format string, v ...interface{})
+
+	run *regexp.Regexp
+}
+
+// Init must be called before any of the other methods.
+func (obj *Tester) Init() error {
+	if obj.Logf == nil {
+		return fmt.Errorf("the Logf function must be specified")
+	}
+	if obj.Run != "" {
+		run, err := regexp.Compile(obj.Run)
+		if err != nil {
+			return errwrap.Wrapf(err, "invalid run pattern")
+		}
+		obj.run = run
+	}
+	if obj.Timeout == 0 {
+		obj.Timeout = DefaultTimeout
+	}
+	return nil
+}
+
+// TestPath finds all the test files in the input path, and runs all of their
+// tests. The input can be a single test file, or a directory which is searched
+// recursively. It returns true if every test passed. An error is only returned
+// if something prevented the tests from running at all.
+func (obj *Tester) TestPath(ctx context.Context, input string) (bool, error) {
+	files, err := Find(input)
+	if err != nil {
+		return false, err
+	}
+	if len(files) == 0 {
+		obj.Logf("no test files found in: %s", input)
+		return true, nil
+	}
+
+	passed, failed := 0, 0
+	for _, file := range files {
+		cases, err := obj.Cases(file)
+		if err != nil {
+			return false, err
+		}
+		for _, c := range cases {
+			if obj.run != nil && !obj.run.MatchString(c.Name) {
+				continue
+			}
+			if err := ctx.Err(); err != nil {
+				return false, err
+			}
+
+			if obj.Verbose {
+				obj.Logf("=== RUN   %s", c)
+			}
+			start := time.Now()
+			err := obj.Test(ctx, c)
+			delta := time.Since(start).Truncate(time.Millisecond)
+			if err != nil {
+				failed++
+				obj.Logf("--- FAIL: %s (%s)", c, delta)
+				for _, line := range strings.Split(err.Error(), "\n") {
+					obj.Logf("    %s", line)
+				}
+				continue
+			}
+			passed++
+			if obj.Verbose {
+				obj.Logf("--- PASS: %s (%s)", c, delta)
+			}
+		}
+	}
+
+	obj.Logf("%d passed, %d failed", passed, failed)
+	return failed == 0, nil
+}
+
+// Find returns the sorted list of test files in the input path. If the input is
+// a file, then it must be a test file. Hidden directories are skipped.
+func Find(input string) ([]string, error) {
+	input, err := filepath.Abs(input)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := os.Stat(input)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		if !strings.HasSuffix(input, FileSuffix) {
+			return nil, fmt.Errorf("file `%s` is not a test file", input)
+		}
+		return []string{input}, nil
+	}
+
+	files := []string{}
+	walkFn := func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if path != input && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), FileSuffix) {
+			files = append(files, path)
+		}
+		return nil
+	}
+	if err := filepath.WalkDir(input, walkFn); err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// Cases parses a test file and returns the tests that it contains, in the order
+// that they were defined in.
+func (obj *Tester) Cases(file string) ([]*Case, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	xast, err := parser.LexParse(bytes.NewReader(b))
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not parse `%s`", file)
+	}
+	prog, ok := xast.(*ast.StmtProg)
+	if !ok {
+		// programming error
+		return nil, fmt.Errorf("unexpected AST in `%s`", file)
+	}
+
+	cases := []*Case{}
+	for _, x := range prog.Body {
+		switch stmt := x.(type) {
+		case *ast.StmtClass:
+			if !strings.HasPrefix(stmt.Name, NamePrefix) {
+				continue
+			}
+			for _, arg := range stmt.Args {
+				if arg.Default == nil {
+					return nil, fmt.Errorf("test class `%s` in `%s` has arg `$%s` without a default", stmt.Name, file, arg.Name)
+				}
+			}
+			cases = append(cases, &Case{
+				File:  file,
+				Name:  stmt.Name,
+				Class: true,
+			})
+
+		case *ast.StmtFunc:
+			if !strings.HasPrefix(stmt.Name, NamePrefix) {
+				continue
+			}
+			cases = append(cases, &Case{
+				File: file,
+				Name: stmt.Name,
+			})
+		}
+	}
+	return cases, nil
+}
+
+// Test runs a single test. It returns an error if the test failed.
+func (obj *Tester) Test(ctx context.Context, c *Case) error {
+	g, err := obj.Graph(ctx, c)
+	if err != nil {
+		return err
+	}
+	if !c.Class { // a function test already passed if it got this far
+		return nil
+	}
+
+	actual, err := GraphString(g)
+	if err != nil {
+		return err
+	}
+	golden := c.Golden()
+
+	if obj.UpdateGolden {
+		if err := os.MkdirAll(filepath.Dir(golden), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(golden, []byte(actual), 0644); err != nil {
+			return err
+		}
+		obj.Logf("wrote: %s", golden)
+		return nil
+	}
+
+	expected, err := os.ReadFile(golden)
+	if os.IsNotExist(err) {
+		return nil // nothing to compare against, but it did run
+	} else if err != nil {
+		return err
+	}
+	if diff := Diff(string(expected), actual); diff != "" {
+		return fmt.Errorf("resource graph differs from `%s`:\n%s", golden, diff)
+	}
+	return nil
+}
+
+// Graph runs the test through the interpreter and returns the resource graph.
+// A class test is included, and a function test is wrapped in a panic which
+// fires if the function doesn't return true. Nothing is ever applied.
+func (obj *Tester) Graph(ctx context.Context, c *Case) (*pgraph.Graph, error) {
+	logf := func(format string, v ...interface{}) {
+		if !obj.Debug {
+			return
+		}
+		obj.Logf(c.Name+": "+format, v...)
+	}
+
+	localFs := util.NewReadOnlyOsFs() // always the local fs
+	output, err := inputs.ParseInput(c.File, localFs)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not activate an input parser")
+	}
+
+	xast, err := parser.LexParse(bytes.NewReader(output.Main))
+	if err != nil {
+		file := &interfaces.SourceFile{FS: output.FS, Path: output.Base + output.Metadata.Main}
+		err = interfaces.HighlightParseError(err, file, obj.Logf)
+		return nil, errwrap.Wrapf(err, "could not generate AST")
+	}
+	prog, ok := xast.(*ast.StmtProg)
+	if !ok {
+		// programming error
+		return nil, fmt.Errorf("unexpected AST")
+	}
+	prog.Body = append(prog.Body, runStmt(c))
+
+	importVertex, err := lang.NewImports()
+	if err != nil {
+		return nil, err
+	}
+
+	data := &interfaces.Data{
+		Fs:       output.FS,
+		FsURI:    output.FS.URI(),
+		Base:     output.Base, // base dir (absolute path) that this is rooted in
+		Files:    output.Files,
+		Imports:  importVertex,
+		Metadata: output.Metadata,
+		Modules:  obj.ModulePath,
+
+		LexParser:       parser.LexParse,
+		StrInterpolater: interpolate.StrInterpolate,
+
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			if !obj.Verbose && !obj.Debug {
+				return
+			}
+			obj.Logf("ast: "+format, v...) // errors get highlighted here
+		},
+	}
+	scope, err := lang.NewScope("") // empty b/c not used
+	if err != nil {
+		return nil, err
+	}
+	iast, err := lang.Compile(prog, data, scope)
+	if err != nil {
+		return nil, err
+	}
+	if err := lang.Unify(ctx, iast, nil, obj.Debug, logf); err != nil {
+		return nil, err
+	}
+
+	fgraph, err := iast.Graph(interfaces.EmptyEnv())
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not generate function graph")
+	}
+
+	table, err := obj.stream(ctx, fgraph, logf)
+	if err != nil {
+		return nil, err
+	}
+
+	interpreter := &interpret.Interpreter{
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("interpret: "+format, v...)
+		},
+	}
+	ograph, err := interpreter.Interpret(iast, table)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "could not interpret")
+	}
+
+	// add automatic edges, since they'd be in the real graph too
+	if err := autoedge.AutoEdge(ctx, ograph, obj.Debug, logf); err != nil {
+		return nil, errwrap.Wrapf(err, "could not add automatic edges")
+	}
+
+	return ograph, nil
+}
+
+// stream runs the function engine with the function graph until it produces
+// the first table of values, and then shuts it down. None of the resources get
+// any stubs, so the functions which need the World only see an empty one.
+func (obj *Tester) stream(ctx context.Context, fgraph *pgraph.Graph, logf func(format string, v ...interface{})) (interfaces.Table, error) {
+	tmpdir, err := os.MkdirTemp("", "mgmt-test-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpdir) // clean up
+
+	localAPI := (&local.API{
+		Prefix: tmpdir + "/",
+		Debug:  obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("local: api: "+format, v...)
+		},
+	}).Init()
+
+	var world engine.World
+	world = &etcd.World{
+		Client:       etcdClient.NewClientFromClient(nil), // stub
+		StandaloneFs: util.NewMemFs(),                     // used for static deploys
+	}
+	worldInit := &engine.WorldInit{
+		Debug: obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("world: etcd: "+format, v...)
+		},
+	}
+	if err := world.Connect(ctx, worldInit); err != nil {
+		return nil, errwrap.Wrapf(err, "world Connect failed")
+	}
+	defer world.Cleanup()
+
+	engine := &dage.Engine{
+		Name:     "test",
+		Hostname: "", // NOTE: empty b/c not used
+		Local:    localAPI,
+		World:    world,
+		Debug:    obj.Debug,
+		Logf: func(format string, v ...interface{}) {
+			logf("funcs: "+format, v...)
+		},
+	}
+	if err := engine.Setup(); err != nil {
+		return nil, errwrap.Wrapf(err, "could not setup the function engine")
+	}
+
+	txn := engine.Txn()
+	defer txn.Free() // remember to call Free()
+	txn.AddGraph(fgraph)
+	if err := txn.Commit(); err != nil {
+		return nil, errwrap.Wrapf(err, "could not commit the function graph")
+	}
+
+	wg := &sync.WaitGroup{}
+	defer wg.Wait()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		engine.Run(ctx) // the error is checked with engine.Err()
+	}()
+
+	if fgraph.NumVertices() == 0 { // no funcs to load!
+		return interfaces.Table{}, nil
+	}
+
+	select {
+	case table, ok := <-engine.Stream():
+		if ok {
+			return table, nil
+		}
+		cancel()
+		wg.Wait() // so that the error is available
+		if err := errwrap.WithoutContext(engine.Err()); err != nil && err != context.Canceled {
+			return nil, err
+		}
+		return nil, fmt.Errorf("the function engine stopped")
+
+	case <-time.After(obj.Timeout):
+		return nil, fmt.Errorf("no values were produced after %s", obj.Timeout)
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// runStmt returns the statement that runs a test when it's added to the end of
+// the test file. Neither one has a position, since they're not in the source.
+func runStmt(c *Case) interfaces.Stmt {
+	if c.Class {
+		// `include test_foo`
+		return &ast.StmtInclude{
+			Name: c.Name,
+		}
+	}
+
+	// `panic(not test_foo(), "...")`
+	call := &ast.ExprCall{
+		Name: funcs.PanicDebugFuncName,
+		Args: []interfaces.Expr{
+			&ast.ExprCall{
+				Name: operators.OperatorFuncName,
+				Args: []interfaces.Expr{
+					&ast.ExprStr{ // operator first
+						V: "not",
+					},
+					&ast.ExprCall{
+						Name: c.Name,
+						Args: []interfaces.Expr{},
+					},
+				},
+			},
+			&ast.ExprStr{
+				V: fmt.Sprintf("test `%s` returned false", c.Name),
+			},
+		},
+	}
+	return &ast.StmtIf{
+		Condition: call,
+		ThenBranch: &ast.StmtRes{
+			Kind: interfaces.PanicResKind,
+			Name: &ast.ExprStr{
+				V: funcs.PanicFuncName, // any constant, non-empty name
+			},
+			Contents: []ast.StmtResContents{},
+		},
+	}
+}
+
+// GraphString returns the text format of a resource graph that's stored in the
+// golden files. It has one line for each vertex, edge and resource param, which
+// are sorted, so that the files are deterministic and easy to diff.
+func GraphString(g *pgraph.Graph) (string, error) {
+	lines := []string{}
+	for _, line := range strings.Split(g.Sprint(), "\n") {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	for _, v := range g.Vertices() {
+		res, ok := v.(engine.Res)
+		if !ok {
+			return "", fmt.Errorf("vertex %s is not a resource", v)
+		}
+		m, err := engineUtil.ResToParamValues(res)
+		if err != nil {
+			return "", errwrap.Wrapf(err, "can't read resource %s", res)
+		}
+		for field, value := range m {
+			lines = append(lines, fmt.Sprintf("Field: %s[%s].%s = %s", res.Kind(), res.Name(), field, value))
+		}
+	}
+	sort.Strings(lines)
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// Diff returns the lines which are only in one of the two graph strings. Lines
+// which are only expected are prefixed with a minus sign, and lines which are
+// only in the actual graph are prefixed with a plus sign. Since both of them
+// are sorted, order doesn't matter. It returns an empty string if they match.
+func Diff(expected, actual string) string {
+	count := make(map[string]int)
+	for _, line := range strings.Split(expected, "\n") {
+		if line != "" {
+			count[line]++
+		}
+	}
+	for _, line := range strings.Split(actual, "\n") {
+		if line != "" {
+			count[line]--
+		}
+	}
+
+	lines := []string{}
+	for line, n := range count {
+		for ; n > 0; n-- {
+			lines = append(lines, "- "+line)
+		}
+		for ; n < 0; n++ {
+			lines = append(lines, "+ "+line)
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool { // sort by line, then sign
+		if a, b := lines[i][2:], lines[j][2:]; a != b {
+			return a < b
+		}
+		return lines[i] < lines[j]
+	})
+	return strings.Join(lines, "\n")
+}
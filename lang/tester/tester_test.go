@@ -0,0 +1,130 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package tester
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFind0(t *testing.T) {
+	files, err := Find("testdata/")
+	if err != nil {
+		t.Fatalf("could not find: %+v", err)
+	}
+	if len(files) != 1 || !strings.HasSuffix(files[0], "/testdata/simple/main_test.mcl") {
+		t.Errorf("unexpected files: %+v", files)
+	}
+
+	if _, err := Find("testdata/simple/motd.mcl"); err == nil {
+		t.Errorf("expected an error for a file which isn't a test")
+	}
+}
+
+func TestDiff0(t *testing.T) {
+	expected := "a\nb\nc\n"
+	if diff := Diff(expected, expected); diff != "" {
+		t.Errorf("expected no diff, got: %s", diff)
+	}
+	diff := Diff(expected, "a\nc\nd\n")
+	if s := "- b\n+ d"; diff != s {
+		t.Errorf("expected diff: %q, got: %q", s, diff)
+	}
+}
+
+func TestTestPath0(t *testing.T) {
+	tester := &Tester{
+		Verbose: testing.Verbose(),
+		Logf:    t.Logf,
+	}
+	if err := tester.Init(); err != nil {
+		t.Fatalf("could not init: %+v", err)
+	}
+	passed, err := tester.TestPath(context.Background(), "testdata/simple/")
+	if err != nil {
+		t.Fatalf("could not test: %+v", err)
+	}
+	if !passed {
+		t.Errorf("expected the tests to pass")
+	}
+}
+
+func TestTestPath1(t *testing.T) {
+	// copy the tests so that we can break the golden file and a func
+	dir := t.TempDir()
+	for _, name := range []string{"motd.mcl", "main_test.mcl", "testdata/main/test_motd.golden"} {
+		b, err := os.ReadFile(filepath.Join("testdata/simple", name))
+		if err != nil {
+			t.Fatalf("could not read: %+v", err)
+		}
+		b = []byte(strings.Replace(string(b), "hello, world!", "hello, there!", 1))
+		b = []byte(strings.Replace(string(b), "== 42", "== 41", 1))
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatalf("could not mkdir: %+v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), b, 0644); err != nil {
+			t.Fatalf("could not write: %+v", err)
+		}
+	}
+
+	tester := &Tester{
+		Logf: t.Logf,
+	}
+	if err := tester.Init(); err != nil {
+		t.Fatalf("could not init: %+v", err)
+	}
+	passed, err := tester.TestPath(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("could not test: %+v", err)
+	}
+	if passed {
+		t.Errorf("expected the tests to fail")
+	}
+
+	cases, err := tester.Cases(filepath.Join(dir, "main_test.mcl"))
+	if err != nil {
+		t.Fatalf("could not get cases: %+v", err)
+	}
+	if len(cases) != 2 {
+		t.Fatalf("expected two cases, got: %d", len(cases))
+	}
+	if err := tester.Test(context.Background(), cases[0]); err == nil || !strings.Contains(err.Error(), "test `test_double` returned false") {
+		t.Errorf("unexpected func test error: %+v", err)
+	}
+	err = tester.Test(context.Background(), cases[1])
+	if err == nil || !strings.Contains(err.Error(), `- Field: file[/etc/motd].Content = "hello, there!\n"`) || !strings.Contains(err.Error(), `+ Field: file[/etc/motd].Content = "hello, world!\n"`) {
+		t.Errorf("unexpected class test error: %+v", err)
+	}
+}
@@ -32,6 +32,7 @@ package json
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/purpleidea/mgmt/lang/types"
@@ -68,6 +69,122 @@ func FlexibleValueOfJSON(data string, typ *types.Type) (types.Value, error) {
 	return convertJSON(v, typ, true)
 }
 
+// ValueOfNative takes some already parsed data, and an expected type, and if
+// the data matches that type, returns the equivalent types.Value matching it.
+// The data must be of the shape that encoding/json produces when decoding into
+// an interface{} with UseNumber set, so numbers must be json.Number. This is
+// useful for reusing the type-directed conversion with other markup languages.
+// If you specify flexible, then it allows missing struct fields in the data.
+func ValueOfNative(val interface{}, typ *types.Type, flexible bool) (types.Value, error) {
+	return convertJSON(val, typ, flexible)
+}
+
+// NativeOfValue is the inverse of ValueOfNative. It takes a types.Value and
+// returns the equivalent data of the shape that encoding/json and most other
+// markup encoders can consume. Structs and maps become map[string]interface{},
+// which most encoders will print with their keys sorted, lists become
+// []interface{}, and the scalars become their golang equivalents. Since most
+// formats only support string keys, maps must have keys of kind str.
+func NativeOfValue(v types.Value) (interface{}, error) {
+	if v == nil {
+		return nil, fmt.Errorf("value is nil")
+	}
+	typ := v.Type()
+	if typ == nil {
+		return nil, fmt.Errorf("value has nil type")
+	}
+
+	switch typ.Kind {
+	case types.KindBool:
+		return v.Bool(), nil
+
+	case types.KindStr:
+		return v.Str(), nil
+
+	case types.KindInt:
+		return v.Int(), nil
+
+	case types.KindFloat:
+		return v.Float(), nil
+
+	case types.KindList:
+		l := []interface{}{}
+		for _, x := range v.List() {
+			xx, err := NativeOfValue(x) // recurse
+			if err != nil {
+				return nil, err
+			}
+			l = append(l, xx)
+		}
+		return l, nil
+
+	case types.KindMap:
+		if typ.Key == nil || typ.Key.Kind != types.KindStr {
+			return nil, fmt.Errorf("map keys must be of kind str")
+		}
+		m := make(map[string]interface{})
+		for k, x := range v.Map() {
+			xx, err := NativeOfValue(x) // recurse
+			if err != nil {
+				return nil, err
+			}
+			m[k.Str()] = xx
+		}
+		return m, nil
+
+	case types.KindStruct:
+		m := make(map[string]interface{})
+		for k, x := range v.Struct() {
+			xx, err := NativeOfValue(x) // recurse
+			if err != nil {
+				return nil, err
+			}
+			m[k] = xx
+		}
+		return m, nil
+	}
+
+	return nil, fmt.Errorf("can't convert value of kind %s", typ.Kind)
+}
+
+// NativeKinds checks that the type only contains kinds which NativeOfValue can
+// convert. This lets us catch most problems at type unification time, instead
+// of when the function runs.
+func NativeKinds(typ *types.Type) error {
+	if typ == nil {
+		return fmt.Errorf("type is nil")
+	}
+
+	switch typ.Kind {
+	case types.KindBool, types.KindStr, types.KindInt, types.KindFloat:
+		return nil
+
+	case types.KindList:
+		return NativeKinds(typ.Val) // recurse
+
+	case types.KindMap:
+		if typ.Key == nil || typ.Key.Kind != types.KindStr {
+			return fmt.Errorf("map keys must be of kind str")
+		}
+		return NativeKinds(typ.Val) // recurse
+
+	case types.KindStruct:
+		keys := []string{}
+		for k := range typ.Map {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys) // deterministic errors
+		for _, k := range keys {
+			if err := NativeKinds(typ.Map[k]); err != nil { // recurse
+				return fmt.Errorf("field %s: %w", k, err)
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("can't convert kind %s", typ.Kind)
+}
+
 // convertJSON is the recursive helper that takes the parsed json data and the
 // expected type. If you specify flexible, then it allows missing fields in the
 // data. This API may change if we add more modifiers in the future.
@@ -32,6 +32,7 @@
 package json
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -274,3 +275,69 @@ func TestValueOfJSON1(t *testing.T) {
 		})
 	}
 }
+
+func TestNativeOfValue0(t *testing.T) {
+	testCases := []struct {
+		str string
+		typ string
+		exp string // sorted keys
+	}{
+		{`true`, "bool", `true`},
+		{`"hello"`, "str", `"hello"`},
+		{`42`, "int", `42`},
+		{`2.5`, "float", `2.5`},
+		{`[1, 2, 3]`, "[]int", `[1,2,3]`},
+		{`{"b": 2, "a": 1}`, "map{str: int}", `{"a":1,"b":2}`},
+		{`{"zz": "x", "aa": [true]}`, "struct{zz str; aa []bool}", `{"aa":[true],"zz":"x"}`},
+	}
+
+	for index, tc := range testCases {
+		name := fmt.Sprintf("test NativeOfValue0 #%d_", index)
+
+		t.Run(name, func(t *testing.T) {
+			typ := types.NewType(tc.typ)
+			if err := NativeKinds(typ); err != nil {
+				t.Errorf("type `%s` is not native: %v", tc.typ, err)
+				return
+			}
+			v, err := ValueOfJSON(tc.str, typ)
+			if err != nil {
+				t.Errorf("json of `%s` errored: `%v`", tc.str, err)
+				return
+			}
+			n, err := NativeOfValue(v)
+			if err != nil {
+				t.Errorf("native of `%s` errored: `%v`", v, err)
+				return
+			}
+			b, err := json.Marshal(n)
+			if err != nil {
+				t.Errorf("marshal errored: `%v`", err)
+				return
+			}
+			if s := string(b); s != tc.exp {
+				t.Errorf("expected: %s", tc.exp)
+				t.Errorf("got: %s", s)
+				return
+			}
+			// and back again
+			v2, err := ValueOfJSON(string(b), typ)
+			if err != nil {
+				t.Errorf("json of `%s` errored: `%v`", string(b), err)
+				return
+			}
+			if err := v.Cmp(v2); err != nil {
+				t.Errorf("round trip of `%s` failed: %v", tc.str, err)
+				return
+			}
+		})
+	}
+}
+
+func TestNativeKinds0(t *testing.T) {
+	for _, s := range []string{"map{int: str}", "func() str", "struct{a []map{bool: str}}"} {
+		if err := NativeKinds(types.NewType(s)); err == nil {
+			t.Errorf("type `%s` should not be native", s)
+		}
+	}
+}
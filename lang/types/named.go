@@ -0,0 +1,231 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package types
+
+import (
+	"fmt"
+	"sort"
+)
+
+// NewNamed returns a reference to the type which was named by an mcl `type`
+// statement. It has no structure until it gets resolved, which happens when the
+// scope of the code using it is known. Until then, it has a Kind of KindNil.
+func NewNamed(name string) *Type {
+	return &Type{
+		Kind: KindNil,
+		Name: name,
+	}
+}
+
+// IsNamedRef returns true if this type is an unresolved reference to a named
+// type. It does not look inside of any container types.
+func (obj *Type) IsNamedRef() bool {
+	return obj != nil && obj.Kind == KindNil && obj.Name != ""
+}
+
+// HasNamedRef returns true if this type contains any unresolved references to a
+// named type. These must be resolved before the type can be used.
+func (obj *Type) HasNamedRef() bool {
+	if obj == nil {
+		return false
+	}
+	if obj.IsNamedRef() {
+		return true
+	}
+
+	switch obj.Kind {
+	case KindList:
+		return obj.Val.HasNamedRef()
+
+	case KindMap:
+		return obj.Key.HasNamedRef() || obj.Val.HasNamedRef()
+
+	case KindStruct, KindFunc:
+		for _, k := range obj.Ord {
+			if obj.Map[k].HasNamedRef() {
+				return true
+			}
+		}
+		return obj.Out.HasNamedRef() // nil for structs
+
+	case KindVariant:
+		return obj.Var.HasNamedRef()
+	}
+
+	return false
+}
+
+// Resolve returns a copy of this type where every unresolved reference to a
+// named type has been replaced by the type that the lookup function returns for
+// that name. The returned types keep their names, but since types are compared
+// structurally, the result is equivalent to having written them out in full.
+// The parts of the type which don't contain any references are not copied.
+func (obj *Type) Resolve(lookup func(name string) (*Type, error)) (*Type, error) {
+	if obj == nil {
+		return nil, nil
+	}
+	if obj.IsNamedRef() {
+		typ, err := lookup(obj.Name)
+		if err != nil {
+			return nil, err
+		}
+		if typ == nil || typ.HasNamedRef() {
+			return nil, fmt.Errorf("named type `%s` did not resolve", obj.Name)
+		}
+		return typ, nil
+	}
+	if !obj.HasNamedRef() {
+		return obj, nil // nothing to do
+	}
+
+	switch obj.Kind {
+	case KindList:
+		val, err := obj.Val.Resolve(lookup)
+		if err != nil {
+			return nil, err
+		}
+		return &Type{
+			Kind: KindList,
+			Val:  val,
+			Name: obj.Name,
+		}, nil
+
+	case KindMap:
+		key, err := obj.Key.Resolve(lookup)
+		if err != nil {
+			return nil, err
+		}
+		val, err := obj.Val.Resolve(lookup)
+		if err != nil {
+			return nil, err
+		}
+		return &Type{
+			Kind: KindMap,
+			Key:  key,
+			Val:  val,
+			Name: obj.Name,
+		}, nil
+
+	case KindStruct, KindFunc:
+		m := make(map[string]*Type)
+		ord := []string{}
+		for _, k := range obj.Ord {
+			t, err := obj.Map[k].Resolve(lookup)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = t
+			ord = append(ord, k)
+		}
+		out, err := obj.Out.Resolve(lookup) // nil for structs
+		if err != nil {
+			return nil, err
+		}
+		return &Type{
+			Kind: obj.Kind,
+			Map:  m,
+			Ord:  ord,
+			Out:  out,
+			Name: obj.Name,
+		}, nil
+
+	case KindVariant:
+		v, err := obj.Var.Resolve(lookup)
+		if err != nil {
+			return nil, err
+		}
+		return &Type{
+			Kind: KindVariant,
+			Var:  v,
+			Name: obj.Name,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("can't resolve kind: %s", obj.Kind)
+}
+
+// Rename returns a copy of this type where each part which is identical to one
+// of the named types is replaced by that named type, so that it prints with its
+// name. Unification builds new types which don't have any names, so this is how
+// tools such as the docs generator get them back. Named types of a basic kind
+// such as int are skipped, since otherwise every int would be renamed. If more
+// than one name matches, then the first one in sorted order is used.
+func (obj *Type) Rename(named map[string]*Type) *Type {
+	if obj == nil || obj.Name != "" {
+		return obj
+	}
+
+	switch obj.Kind {
+	case KindList, KindMap, KindStruct, KindFunc:
+		names := []string{}
+		for name := range named {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if obj.Cmp(named[name]) == nil {
+				typ := *named[name] // shallow copy so that we can name it
+				typ.Name = name
+				return &typ
+			}
+		}
+	}
+
+	switch obj.Kind {
+	case KindList:
+		return &Type{
+			Kind: KindList,
+			Val:  obj.Val.Rename(named),
+		}
+
+	case KindMap:
+		return &Type{
+			Kind: KindMap,
+			Key:  obj.Key.Rename(named),
+			Val:  obj.Val.Rename(named),
+		}
+
+	case KindStruct, KindFunc:
+		m := make(map[string]*Type)
+		ord := []string{}
+		for _, k := range obj.Ord {
+			m[k] = obj.Map[k].Rename(named)
+			ord = append(ord, k)
+		}
+		return &Type{
+			Kind: obj.Kind,
+			Map:  m,
+			Ord:  ord,
+			Out:  obj.Out.Rename(named), // nil for structs
+		}
+	}
+
+	return obj
+}
@@ -0,0 +1,138 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package types
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolve(t *testing.T) {
+	named := map[string]*Type{
+		"endpoint": NewType("struct{name str; port int}"),
+		"pkg.id":   NewType("int"),
+	}
+	lookup := func(name string) (*Type, error) {
+		typ, exists := named[name]
+		if !exists {
+			return nil, fmt.Errorf("type `%s` does not exist", name)
+		}
+		return typ, nil
+	}
+
+	testCases := []struct {
+		typ *Type
+		exp string
+	}{
+		{
+			typ: NewType("str"),
+			exp: "str",
+		},
+		{
+			typ: NewNamed("endpoint"),
+			exp: "struct{name str; port int}",
+		},
+		{
+			typ: &Type{
+				Kind: KindList,
+				Val:  NewNamed("endpoint"),
+			},
+			exp: "[]struct{name str; port int}",
+		},
+		{
+			typ: &Type{
+				Kind: KindMap,
+				Key:  NewType("str"),
+				Val:  NewNamed("pkg.id"),
+			},
+			exp: "map{str: int}",
+		},
+		{
+			typ: &Type{
+				Kind: KindFunc,
+				Map: map[string]*Type{
+					"a": NewNamed("endpoint"),
+					"b": NewType("bool"),
+				},
+				Ord: []string{"a", "b"},
+				Out: NewNamed("pkg.id"),
+			},
+			exp: "func(a struct{name str; port int}, b bool) int",
+		},
+	}
+
+	for i, tc := range testCases {
+		typ, err := tc.typ.Resolve(lookup)
+		if err != nil {
+			t.Errorf("test #%d: unexpected error: %+v", i, err)
+			continue
+		}
+		if typ.HasNamedRef() {
+			t.Errorf("test #%d: type still has a named reference", i)
+		}
+		if s := typ.String(); s != tc.exp {
+			t.Errorf("test #%d: expected: %s, got: %s", i, tc.exp, s)
+		}
+		if err := typ.Cmp(NewType(tc.exp)); err != nil {
+			t.Errorf("test #%d: types differ: %+v", i, err)
+		}
+	}
+
+	if _, err := NewNamed("nope").Resolve(lookup); err == nil {
+		t.Errorf("expected an error for a missing named type")
+	}
+}
+
+func TestRename(t *testing.T) {
+	named := map[string]*Type{
+		"endpoint": NewType("struct{name str; port int}"),
+		"port":     NewType("int"), // basic kinds are never renamed
+	}
+
+	typ := NewType("func(a []struct{name str; port int}, b int) map{str: struct{name str; port int}}").Rename(named)
+	if err := typ.Cmp(NewType("func(a []struct{name str; port int}, b int) map{str: struct{name str; port int}}")); err != nil {
+		t.Errorf("renamed type differs: %+v", err)
+	}
+	if name := typ.Map["a"].Val.Name; name != "endpoint" {
+		t.Errorf("expected list val to be named, got: %s", name)
+	}
+	if name := typ.Out.Val.Name; name != "endpoint" {
+		t.Errorf("expected map val to be named, got: %s", name)
+	}
+	if name := typ.Map["b"].Name; name != "" {
+		t.Errorf("expected int to not be named, got: %s", name)
+	}
+
+	if typ := NewType("struct{name str; port str}").Rename(named); typ.Name != "" {
+		t.Errorf("expected a different struct to not be named, got: %s", typ.Name)
+	}
+}
@@ -95,6 +95,14 @@ type Type struct {
 
 	// unification variable (question mark, eg ?1, ?2)
 	Uni *Elem // if Kind == Unification (optional) use Uni only
+
+	// Name is the name this type was given by an mcl `type` statement. It
+	// is only informational, since types are compared structurally. If the
+	// Kind is KindNil, then this is a reference to a named type which has
+	// not been resolved yet. See NewNamed and Resolve for more information.
+	// The String method only prints the name for unresolved references,
+	// since its output gets parsed by NewType. The mcl formatter prints it.
+	Name string
 }
 
 // Elem is the type used for the unification variable in the Uni field of Type.
@@ -730,6 +738,9 @@ func (obj *Type) String() string {
 func (obj *Type) string(table map[*Elem]uint) string {
 	switch obj.Kind {
 	case KindNil:
+		if obj.Name != "" { // unresolved named type
+			return obj.Name
+		}
 		return "nil"
 	case KindBool:
 		return "bool"
@@ -1310,6 +1321,39 @@ func (obj *Type) HasUni() bool {
 	panic("malformed type")
 }
 
+// HasFunc tells us if the type is or contains any function types. Values of
+// these types can't be compared or sorted, so functions which do that should
+// reject them.
+func (obj *Type) HasFunc() bool {
+	if obj == nil {
+		return false
+	}
+
+	switch obj.Kind {
+	case KindList:
+		return obj.Val.HasFunc()
+
+	case KindMap:
+		return obj.Key.HasFunc() || obj.Val.HasFunc()
+
+	case KindStruct:
+		for _, k := range obj.Ord {
+			if obj.Map[k].HasFunc() {
+				return true
+			}
+		}
+		return false
+
+	case KindFunc:
+		return true // found it!
+
+	case KindVariant:
+		return obj.Var.HasFunc()
+	}
+
+	return false
+}
+
 // ComplexCmp tells us if the input type is compatible with the concrete one. It
 // can match against types containing variants, or against partial types. If the
 // two types are equivalent, it will return nil. If the input type is identical,
@@ -1499,6 +1499,24 @@ func TestTypeCopy0(t *testing.T) {
 	}
 }
 
+func TestHasFunc0(t *testing.T) {
+	tests := map[string]bool{
+		"int":                           false,
+		"[]str":                         false,
+		"map{str: [][]int}":             false,
+		"struct{a str; b []bool}":       false,
+		"func() str":                    true,
+		"[]func(a int) str":             true,
+		"map{str: func() str}":          true,
+		"struct{a str; b []func() str}": true,
+	}
+	for s, expected := range tests {
+		if b := NewType(s).HasFunc(); b != expected {
+			t.Errorf("type: %s, expected: %t, got: %t", s, expected, b)
+		}
+	}
+}
+
 func TestUni0(t *testing.T) {
 	// good type strings
 	if NewType("?1") == nil {
@@ -134,8 +134,7 @@ func (obj *FastInvariantSolver) Solve(ctx context.Context, data *unification.Dat
 		if err := unificationUtil.Unify(x.Expect, x.Actual); err != nil {
 			// Storing the Expr with this invariant is so that we
 			// can generate this more helpful error message here.
-			displayer, ok := x.Node.(interfaces.TextDisplayer)
-			if !ok {
+			if _, ok := x.Node.(interfaces.TextDisplayer); !ok {
 				obj.Logf("not displayable: %v\n", x.Node)
 				return nil, errwrap.Wrapf(err, "unify error with: %s", x.Expr)
 			}
@@ -143,14 +142,9 @@ func (obj *FastInvariantSolver) Solve(ctx context.Context, data *unification.Dat
 				obj.Logf("not set: %v\n", x.Node)
 				return nil, errwrap.Wrapf(err, "unify error with: %s", x.Expr)
 			}
-			if highlight := displayer.HighlightText(); highlight != "" {
-				obj.Logf("%s: %s", err.Error(), highlight)
-			}
-			return nil, fmt.Errorf("%s: %s", err.Error(), displayer.Byline())
-
 			// XXX: when we have fully populated all the position
-			// information, we could replace the above code with:
-			//return nil, interfaces.HighlightHelper(x.Node, obj.Logf, err)
+			// information, we could remove the above checks.
+			return nil, interfaces.HighlightHelper(x.Node, obj.Logf, err)
 		}
 		if obj.Debug {
 			e1, e2 := unificationUtil.Extract(x.Expect), unificationUtil.Extract(x.Actual)
@@ -51,6 +51,10 @@ const (
 	ModuleMagicPrefix = "mgmt-"
 )
 
+// commitRegexp matches a full git commit hash, which is what the commit import
+// qualifier requires, since a short hash could become ambiguous later.
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
 // HasDuplicateTypes returns an error if the list of types is not unique.
 func HasDuplicateTypes(typs []*types.Type) error {
 	// FIXME: do this comparison in < O(n^2) ?
@@ -242,10 +246,46 @@ func ParseImportName(name string) (*interfaces.ImportData, error) {
 	// TODO: consider adding some logic that is similar to the logic in:
 	// https://github.com/golang/go/blob/054640b54df68789d9df0e50575d21d9dbffe99f/src/cmd/go/internal/get/vcs.go#L972
 	// so that we can more correctly figure out the correct url to clone...
+	// a remote import can pick a version with a single qualifier, eg:
+	// git://example.com/purpleidea/mgmt-example1/?tag=v1.0
+	// any other query parameters are ignored, as they have always been
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "invalid query string")
+	}
+	tag, branch, commit := "", "", ""
+	count := 0
+	for _, key := range []string{"tag", "branch", "commit"} {
+		values, exists := query[key]
+		if !exists {
+			continue
+		}
+		count++
+		if len(values) != 1 || values[0] == "" {
+			return nil, fmt.Errorf("expected exactly one value for the `%s` qualifier", key)
+		}
+		switch key {
+		case "tag":
+			tag = values[0]
+		case "branch":
+			branch = values[0]
+		case "commit":
+			commit = values[0]
+		}
+	}
+	if count > 1 {
+		return nil, fmt.Errorf("expected at most one version qualifier")
+	}
+	if count > 0 && isLocal {
+		return nil, fmt.Errorf("only remote imports can have a version qualifier")
+	}
+	if commit != "" && !commitRegexp.MatchString(commit) {
+		return nil, fmt.Errorf("the commit qualifier must be a full hash: `%s`", commit)
+	}
+
 	xurl := ""
 	if !isLocal {
 		u.Fragment = ""
-		// TODO: maybe look for ?sha1=... or ?tag=... to pick a real ref
 		u.RawQuery = ""
 		u.ForceQuery = false
 		xurl = u.String()
@@ -265,5 +305,8 @@ func ParseImportName(name string) (*interfaces.ImportData, error) {
 		IsFile:   isFile,
 		Path:     xpath,
 		URL:      xurl,
+		Tag:      tag,
+		Branch:   branch,
+		Commit:   commit,
 	}, nil
 }
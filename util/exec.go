@@ -32,6 +32,7 @@ package util
 import (
 	"bytes"
 	"context"
+	"io"
 	"os/exec"
 	"strings"
 	"syscall"
@@ -49,6 +50,10 @@ type SimpleCmdOpts struct {
 
 	// LogOutput is the path to where we can append the stdout and stderr.
 	LogOutput string
+
+	// Stdin is an optional reader which is connected to the command's
+	// standard input.
+	Stdin io.Reader
 }
 
 // SimpleCmd is a simple wrapper for us to run commands how we usually want to.
@@ -79,6 +84,9 @@ func SimpleCmdOut(ctx context.Context, name string, args []string, opts *SimpleC
 	var b bytes.Buffer
 	cmd.Stdout = &b
 	cmd.Stderr = &b
+	if opts != nil && opts.Stdin != nil {
+		cmd.Stdin = opts.Stdin
+	}
 
 	logf("running: %s", strings.Join(cmd.Args, " "))
 	if err := cmd.Start(); err != nil {
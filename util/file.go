@@ -31,6 +31,7 @@ package util
 
 import (
 	"os"
+	"path/filepath"
 )
 
 // AppendFile writes data to the named file, creating it if necessary. If it
@@ -51,3 +52,49 @@ func AppendFile(name string, data []byte, perm os.FileMode) error {
 	}
 	return err
 }
+
+// AtomicWriteFile writes data to the named file by first writing it to a
+// temporary file in the same directory, and then renaming it over the original.
+// This means that readers will either see the old or the new contents, but
+// never a partially written file. The temporary file starts with a period, so
+// that tools which read all the files in a directory will usually ignore it. The
+// new file gets the permissions perm and is owned by the caller.
+func AtomicWriteFile(name string, data []byte, perm os.FileMode) (reterr error) {
+	f, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer func() {
+		if reterr != nil {
+			os.Remove(tmp) // clean up, ignore any error
+		}
+	}()
+
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		return err
+	}
+
+	// sync the directory so that the rename is durable
+	dir, err := os.Open(filepath.Dir(name))
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
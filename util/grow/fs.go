@@ -0,0 +1,282 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package grow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+// BlkidInfo is the interesting subset of the `blkid --output export` fields.
+type BlkidInfo struct {
+	// Type is the signature type, eg: ext4, xfs or swap. It is empty if
+	// there was nothing found on the device.
+	Type string
+
+	// Label is the filesystem (or swap) label if one is set.
+	Label string
+
+	// UUID is the filesystem (or swap) uuid if one is set.
+	UUID string
+
+	// PTType is the partition table type, eg: gpt or dos. It is empty if
+	// there is no partition table on the device. A whole disk can have one
+	// of these without having any filesystem Type.
+	PTType string
+}
+
+// Empty returns true if no signature of any kind was found on the device. Any
+// device which isn't empty should be considered to contain existing data.
+func (obj *BlkidInfo) Empty() bool {
+	return obj.Type == "" && obj.PTType == ""
+}
+
+// String returns a short human readable description of the signatures found.
+func (obj *BlkidInfo) String() string {
+	s := []string{}
+	if obj.Type != "" {
+		s = append(s, obj.Type)
+	}
+	if obj.PTType != "" {
+		s = append(s, obj.PTType+" partition table")
+	}
+	if obj.UUID != "" {
+		s = append(s, fmt.Sprintf("(%s)", obj.UUID))
+	}
+	if len(s) == 0 {
+		return "nothing"
+	}
+	return strings.Join(s, " ")
+}
+
+// Blkid probes the device with the linux util `blkid` command. It bypasses the
+// blkid cache so that the result is always current. If no signature is found,
+// then an empty struct is returned without error.
+func (obj *Grow) Blkid(ctx context.Context, dev string) (*BlkidInfo, error) {
+	if dev == "" {
+		return nil, fmt.Errorf("empty dev")
+	}
+
+	cmd, err := exec.LookPath("blkid")
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs := []string{"--probe", "--output", "export", dev}
+	if obj.Debug {
+		obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	}
+	b, err := exec.CommandContext(ctx, cmd, cmdArgs...).Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 2 {
+		return &BlkidInfo{}, nil // nothing was found
+	}
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "blkid failed on: %s", dev)
+	}
+
+	return parseBlkid(b)
+}
+
+// parseBlkid parses the `KEY=value` lines of the blkid export output format.
+func parseBlkid(b []byte) (*BlkidInfo, error) {
+	info := &BlkidInfo{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("unexpected blkid line: %s", line)
+		}
+		switch key {
+		case "TYPE":
+			info.Type = value
+		case "LABEL":
+			info.Label = value
+		case "UUID":
+			info.UUID = value
+		case "PTTYPE":
+			info.PTType = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// IsValidMkfsType are the types of filesystems we currently know how to make.
+func (obj *Grow) IsValidMkfsType(fsType string) error {
+	switch fsType {
+	case "ext2", "ext3", "ext4", "xfs", "btrfs", "vfat":
+		return nil
+	}
+	return fmt.Errorf("can't make fstype: %s", fsType)
+}
+
+// MkfsArgs returns the command and arguments needed to make a new filesystem.
+// The label, uuid and extra args are all optional. The force flag is passed to
+// the tool for types which would otherwise refuse to overwrite a signature.
+func (obj *Grow) MkfsArgs(dev, fsType, label, uuid string, args []string, force bool) (string, []string, error) {
+	if dev == "" {
+		return "", nil, fmt.Errorf("empty dev")
+	}
+	if err := obj.IsValidMkfsType(fsType); err != nil {
+		return "", nil, err
+	}
+
+	cmdArgs := []string{}
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		if force {
+			cmdArgs = append(cmdArgs, "-F")
+		}
+		if label != "" {
+			cmdArgs = append(cmdArgs, "-L", label)
+		}
+		if uuid != "" {
+			cmdArgs = append(cmdArgs, "-U", uuid)
+		}
+
+	case "xfs":
+		if force {
+			cmdArgs = append(cmdArgs, "-f")
+		}
+		if label != "" {
+			cmdArgs = append(cmdArgs, "-L", label)
+		}
+		if uuid != "" {
+			cmdArgs = append(cmdArgs, "-m", "uuid="+uuid)
+		}
+
+	case "btrfs":
+		if force {
+			cmdArgs = append(cmdArgs, "-f")
+		}
+		if label != "" {
+			cmdArgs = append(cmdArgs, "-L", label)
+		}
+		if uuid != "" {
+			cmdArgs = append(cmdArgs, "-U", uuid)
+		}
+
+	case "vfat":
+		if label != "" {
+			cmdArgs = append(cmdArgs, "-n", label)
+		}
+		if uuid != "" { // the volume id looks like: ABCD-1234
+			cmdArgs = append(cmdArgs, "-i", strings.ReplaceAll(uuid, "-", ""))
+		}
+	}
+	cmdArgs = append(cmdArgs, args...)
+	cmdArgs = append(cmdArgs, dev)
+
+	return "mkfs." + fsType, cmdArgs, nil
+}
+
+// Mkfs makes a new filesystem on the device. This destroys any existing data!
+func (obj *Grow) Mkfs(ctx context.Context, dev, fsType, label, uuid string, args []string, force bool) error {
+	name, cmdArgs, err := obj.MkfsArgs(dev, fsType, label, uuid, args, force)
+	if err != nil {
+		return err
+	}
+	cmd, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
+
+// Wipefs erases all of the filesystem, raid and partition table signatures from
+// the device so that the tools which run after it don't find any leftovers. This
+// destroys any existing data!
+func (obj *Grow) Wipefs(ctx context.Context, dev string) error {
+	if dev == "" {
+		return fmt.Errorf("empty dev")
+	}
+	cmd, err := exec.LookPath("wipefs")
+	if err != nil {
+		return err
+	}
+	cmdArgs := []string{"--all", dev}
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
+
+// Relabel changes the label of an existing filesystem (or swap) signature. This
+// does not touch any of the data. Some filesystems such as xfs can only be
+// relabelled when they're not mounted.
+func (obj *Grow) Relabel(ctx context.Context, dev, fsType, label string) error {
+	if dev == "" {
+		return fmt.Errorf("empty dev")
+	}
+
+	var name string
+	var cmdArgs []string
+	switch fsType {
+	case "ext2", "ext3", "ext4":
+		name, cmdArgs = "e2label", []string{dev, label}
+	case "xfs":
+		name, cmdArgs = "xfs_admin", []string{"-L", label, dev}
+	case "btrfs":
+		name, cmdArgs = "btrfs", []string{"filesystem", "label", dev, label}
+	case "vfat":
+		name, cmdArgs = "fatlabel", []string{dev, label}
+	case "swap":
+		name, cmdArgs = "swaplabel", []string{"--label", label, dev}
+	default:
+		return fmt.Errorf("can't relabel fstype: %s", fsType)
+	}
+
+	cmd, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
@@ -27,7 +27,9 @@
 // additional permission if he deems it necessary to achieve the goals of this
 // additional permission.
 
-// Package grow is a utility for growing storage.
+// Package grow is a utility for growing storage. It also contains the helpers
+// for making partitions, filesystems, swap and lvm volumes which the storage
+// resources use.
 package grow
 
 import (
@@ -50,10 +52,11 @@ const (
 
 // Grow is a utility that grows the underlying partition, luks device (if
 // encrypted) and then finally the partition. It makes many assumptions about
-// the luks device being encrypted with an empty password, and that nobody uses
-// lvm anymore. This utility is useful when provisioning new machines which
-// don't get their maximum disk utilization by default. (All the Fedora machines
-// whether physical or virtual seem to have this problem.)
+// the luks device being encrypted with an empty password, and that there's no
+// lvm in the stack. (The lvm helpers are only used by the lvm resources.) This
+// utility is useful when provisioning new machines which don't get their
+// maximum disk utilization by default. (All the Fedora machines whether
+// physical or virtual seem to have this problem.)
 //
 // This whole utility should only be run by the Run entrypoint if you want to
 // receive the benefit of the various options, such as Noop and Done. If you
@@ -321,8 +324,9 @@ func (obj *Grow) GrowPartArgs(dev string) (string, string, error) {
 	base := dev[:i+1]
 	part := dev[i+1:]
 
-	// fancy parsing for /dev/nvme0n1p3 which has the "p".
-	if strings.HasPrefix(dev, DevDir+"nvme") && dev[i] == 'p' {
+	// fancy parsing for /dev/nvme0n1p3 which has the "p". This is also the
+	// case for mmcblk0p1 and loop0p1 or anything else ending in a number.
+	if dev[i] == 'p' && i > 0 && dev[i-1] >= '0' && dev[i-1] <= '9' {
 		base = dev[:i]
 	}
 	if base == "" || part == "" {
@@ -0,0 +1,334 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package grow
+
+import (
+	"context"
+	"encoding/binary"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGrowPartArgsPartDev(t *testing.T) {
+	tests := []struct {
+		dev  string
+		base string
+		part string
+		num  int
+	}{
+		{"/dev/sda3", "/dev/sda", "3", 3},
+		{"/dev/vdb12", "/dev/vdb", "12", 12},
+		{"/dev/nvme0n1p3", "/dev/nvme0n1", "3", 3},
+		{"/dev/loop0p1", "/dev/loop0", "1", 1},
+		{"/dev/mmcblk0p2", "/dev/mmcblk0", "2", 2},
+	}
+
+	obj := &Grow{}
+	for i, test := range tests {
+		base, part, err := obj.GrowPartArgs(test.dev)
+		if err != nil {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+			continue
+		}
+		if base != test.base || part != test.part {
+			t.Errorf("index: %d, expected: %s %s, actual: %s %s", i, test.base, test.part, base, part)
+		}
+		if dev := PartDev(test.base, test.num); dev != test.dev {
+			t.Errorf("index: %d, expected: %s, actual: %s", i, test.dev, dev)
+		}
+	}
+}
+
+func TestParseBlkid(t *testing.T) {
+	b := []byte("DEVNAME=/dev/vdb1\nUUID=0b1e6d7a-4ec1-4a0e-b1fb-2f3e1c8f3a11\nBLOCK_SIZE=4096\nTYPE=ext4\nLABEL=data\n")
+	info, err := parseBlkid(b)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	expected := &BlkidInfo{
+		Type:  "ext4",
+		Label: "data",
+		UUID:  "0b1e6d7a-4ec1-4a0e-b1fb-2f3e1c8f3a11",
+	}
+	if !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, info)
+	}
+
+	if info.Empty() {
+		t.Errorf("expected a signature")
+	}
+
+	// a whole disk with a partition table but no filesystem
+	b = []byte("DEVNAME=/dev/vdb\nPTUUID=5d2a6c5e-7a1f-4f0e-9a52-6a3c1f1e0b2d\nPTTYPE=gpt\n")
+	if info, err = parseBlkid(b); err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if expected := (&BlkidInfo{PTType: "gpt"}); !reflect.DeepEqual(info, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, info)
+	}
+	if info.Empty() {
+		t.Errorf("expected a partition table to not be empty")
+	}
+
+	if info, err = parseBlkid([]byte("")); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !info.Empty() {
+		t.Errorf("expected empty")
+	}
+
+	if _, err := parseBlkid([]byte("garbage\n")); err == nil {
+		t.Errorf("expected error on garbage")
+	}
+}
+
+func TestBlkidPartitioned(t *testing.T) {
+	if _, err := exec.LookPath("blkid"); err != nil {
+		t.Skipf("blkid is missing")
+	}
+
+	// make a small image with a dos partition table and no filesystem
+	b := make([]byte, 1024*1024)
+	entry := b[446 : 446+16]
+	entry[4] = 0x83                                // linux
+	binary.LittleEndian.PutUint32(entry[8:], 2048) // first sector
+	binary.LittleEndian.PutUint32(entry[12:], 1024)
+	b[510], b[511] = 0x55, 0xaa // boot signature
+	img := filepath.Join(t.TempDir(), "disk.img")
+	if err := os.WriteFile(img, b, 0600); err != nil {
+		t.Errorf("could not write image: %v", err)
+		return
+	}
+
+	obj := &Grow{Logf: t.Logf}
+	info, err := obj.Blkid(context.Background(), img)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if info.Type != "" || info.PTType != "dos" {
+		t.Errorf("unexpected signature: %+v", info)
+	}
+	if info.Empty() {
+		t.Errorf("expected a partitioned image to not be empty")
+	}
+
+	// the same image without the partition table
+	if err := os.WriteFile(img, make([]byte, len(b)), 0600); err != nil {
+		t.Errorf("could not write image: %v", err)
+		return
+	}
+	if info, err = obj.Blkid(context.Background(), img); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if !info.Empty() {
+		t.Errorf("expected an empty image, got: %+v", info)
+	}
+}
+
+func TestParseSwaps(t *testing.T) {
+	b := []byte(`Filename				Type		Size		Used		Priority
+/dev/vda2                               partition	2097148		0		-2
+/var/swap\040file                       file		1048572		512		10
+`)
+	swaps, err := parseSwaps(b)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	expected := []*SwapInfo{
+		{Filename: "/dev/vda2", Type: "partition", Size: 2097148, Used: 0, Priority: -2},
+		{Filename: "/var/swap file", Type: "file", Size: 1048572, Used: 512, Priority: 10},
+	}
+	if !reflect.DeepEqual(swaps, expected) {
+		t.Errorf("expected: %+v, actual: %+v", expected, swaps)
+	}
+}
+
+func TestParseSfdisk(t *testing.T) {
+	b := []byte(`{
+   "partitiontable": {
+      "label": "gpt",
+      "id": "6B1C5E0A-2E5B-4B45-9D5F-2B9A5F9C0E11",
+      "device": "/dev/vdb",
+      "unit": "sectors",
+      "firstlba": 2048,
+      "lastlba": 20971486,
+      "sectorsize": 512,
+      "partitions": [
+         {
+            "node": "/dev/vdb1",
+            "start": 2048,
+            "size": 1048576,
+            "type": "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F",
+            "uuid": "1A2B3C4D-0000-4000-8000-000000000001",
+            "name": "swap"
+         }
+      ]
+   }
+}`)
+	table, err := parseSfdisk(b)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if table.Label != "gpt" || table.SectorSize != 512 || len(table.Partitions) != 1 {
+		t.Errorf("unexpected table: %+v", table)
+		return
+	}
+	p := table.Partitions[0]
+	if p.Node != "/dev/vdb1" || p.Size != 1048576 || p.Name != "swap" {
+		t.Errorf("unexpected partition: %+v", p)
+	}
+	if typ := PartType(table.Label, "SWAP"); typ != p.Type {
+		t.Errorf("unexpected type: %s", typ)
+	}
+}
+
+func TestMkfsArgs(t *testing.T) {
+	obj := &Grow{}
+	name, args, err := obj.MkfsArgs("/dev/vdb1", "xfs", "data", "", []string{"-K"}, true)
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if name != "mkfs.xfs" {
+		t.Errorf("unexpected name: %s", name)
+	}
+	if expected := []string{"-f", "-L", "data", "-K", "/dev/vdb1"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("expected: %v, actual: %v", expected, args)
+	}
+
+	if _, _, err := obj.MkfsArgs("/dev/vdb1", "ntfs", "", "", nil, false); err == nil {
+		t.Errorf("expected error on unknown fstype")
+	}
+}
+
+func TestParseLVMReport(t *testing.T) {
+	b := []byte(`  {
+      "report": [
+          {
+              "lv": [
+                  {"lv_name":"root", "vg_name":"vg0", "lv_size":"21474836480", "origin":""},
+                  {"lv_name":"root-snap", "vg_name":"vg0", "lv_size":"1073741824", "origin":"root"}
+              ]
+          }
+      ]
+  }
+`)
+	rows, err := parseLVMReport(b, "lv")
+	if err != nil {
+		t.Errorf("unexpected error: %v", err)
+		return
+	}
+	if len(rows) != 2 {
+		t.Errorf("expected two rows, got: %d", len(rows))
+		return
+	}
+	if rows[1]["origin"] != "root" {
+		t.Errorf("unexpected origin: %s", rows[1]["origin"])
+	}
+	if size, err := lvmInt(rows[0], "lv_size"); err != nil || size != 20<<30 {
+		t.Errorf("unexpected size: %d", size)
+	}
+
+	if _, err := parseLVMReport(b, "vg"); err == nil {
+		t.Errorf("expected error on missing report")
+	}
+}
+
+func TestParseLVMSize(t *testing.T) {
+	tests := []struct {
+		size     string
+		expected int64
+		fail     bool
+	}{
+		{"512", 512 << 20, false}, // megabytes is the default
+		{"10G", 10 << 30, false},
+		{"10g", 10 << 30, false},
+		{"1.5t", 3 << 39, false},
+		{"4096b", 4096, false},
+		{"8s", 4096, false},
+		{"", 0, true},
+		{"0", 0, true},
+		{"-1G", 0, true},
+		{"10GiB", 0, true},
+		{"100%FREE", 0, true},
+	}
+	for i, test := range tests {
+		size, err := ParseLVMSize(test.size)
+		if err != nil && !test.fail {
+			t.Errorf("index: %d, unexpected error: %v", i, err)
+		} else if err == nil && test.fail {
+			t.Errorf("index: %d, expected error", i)
+		} else if size != test.expected {
+			t.Errorf("index: %d, expected: %d, actual: %d", i, test.expected, size)
+		}
+	}
+
+	if !IsLVMPercent("100%FREE") || !IsLVMPercent("50%VG") || IsLVMPercent("50%") {
+		t.Errorf("unexpected percent result")
+	}
+	if s := RoundExtents(5<<20, 4<<20); s != 8<<20 {
+		t.Errorf("unexpected rounding: %d", s)
+	}
+}
+
+func TestParseLVPath(t *testing.T) {
+	tests := []struct {
+		path string
+		vg   string
+		lv   string
+		ok   bool
+	}{
+		{"/dev/vg0/root", "vg0", "root", true},
+		{"/dev/mapper/vg0-root", "vg0", "root", true},
+		{"/dev/mapper/my--vg-my--lv", "my-vg", "my-lv", true},
+		{"/dev/vda1", "", "", false},
+		{"/dev/disk/by-uuid/1234", "", "", false},
+		{"/dev/mapper/luks", "", "", false},
+		{"/var/lib/libvirt/images/vm.qcow2", "", "", false},
+	}
+	for i, test := range tests {
+		vg, lv, ok := ParseLVPath(test.path)
+		if vg != test.vg || lv != test.lv || ok != test.ok {
+			t.Errorf("index: %d, expected: %s %s %t, actual: %s %s %t", i, test.vg, test.lv, test.ok, vg, lv, ok)
+		}
+		if ok && !strings.HasPrefix(test.path, "/dev/mapper/") && LVPath(vg, lv) != test.path {
+			t.Errorf("index: %d, unexpected path: %s", i, LVPath(vg, lv))
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package grow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// LVMMember is the blkid signature type of an lvm physical volume.
+	LVMMember = "LVM2_member"
+
+	// LVMNameMaxLen is the longest name of a volume group or logical
+	// volume that lvm accepts.
+	LVMNameMaxLen = 127
+)
+
+var (
+	// lvmNameRegexp matches the characters that lvm allows in the names.
+	lvmNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9+_.][a-zA-Z0-9+_.-]*$`)
+
+	// lvmPercentRegexp matches the relative sizes which are given to the
+	// lvcreate --extents flag.
+	lvmPercentRegexp = regexp.MustCompile(`^[0-9]+%(VG|FREE|PVS)$`)
+
+	// lvmSizeRegexp matches the absolute sizes in the lvm format.
+	lvmSizeRegexp = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?)([bBsSkKmMgGtTpPeE]?)$`)
+)
+
+// PhysicalVolume is the interesting subset of the `pvs` fields.
+type PhysicalVolume struct {
+	// Name is the device path of the physical volume.
+	Name string
+
+	// VG is the volume group that it belongs to, if any.
+	VG string
+}
+
+// VolumeGroup is the interesting subset of the `vgs` fields.
+type VolumeGroup struct {
+	// Name is the name of the volume group.
+	Name string
+
+	// Size is the total size in bytes.
+	Size int64
+
+	// Free is the unallocated size in bytes.
+	Free int64
+
+	// ExtentSize is the size of each physical extent in bytes. Logical
+	// volumes are always a multiple of this size.
+	ExtentSize int64
+}
+
+// LogicalVolume is the interesting subset of the `lvs` fields.
+type LogicalVolume struct {
+	// Name is the name of the logical volume.
+	Name string
+
+	// VG is the volume group that it is in.
+	VG string
+
+	// Size is the size in bytes.
+	Size int64
+
+	// Origin is the name of the origin volume if this is a snapshot.
+	Origin string
+}
+
+// IsValidLVMName checks that the name can be used for a volume group or a
+// logical volume.
+func IsValidLVMName(name string) error {
+	if name == "" {
+		return fmt.Errorf("empty name")
+	}
+	if len(name) > LVMNameMaxLen {
+		return fmt.Errorf("the name is longer than %d characters", LVMNameMaxLen)
+	}
+	if name == "." || name == ".." {
+		return fmt.Errorf("invalid name: %s", name)
+	}
+	if !lvmNameRegexp.MatchString(name) {
+		return fmt.Errorf("invalid characters in name: %s", name)
+	}
+	// these are used by lvm for its internal volumes
+	if strings.HasPrefix(name, "snapshot") || strings.HasPrefix(name, "pvmove") {
+		return fmt.Errorf("reserved name prefix: %s", name)
+	}
+	return nil
+}
+
+// IsLVMPercent returns true if the size is relative to the size of the volume
+// group, eg: 100%FREE or 50%VG.
+func IsLVMPercent(size string) bool {
+	return lvmPercentRegexp.MatchString(size)
+}
+
+// ParseLVMSize parses a size in the format that lvm uses, eg: 10G or 512m, and
+// returns the number of bytes. Just like lvm, the suffixes are powers of 1024
+// regardless of the case, `s` is for 512 byte sectors, and a number without
+// any suffix is in megabytes.
+func ParseLVMSize(size string) (int64, error) {
+	m := lvmSizeRegexp.FindStringSubmatch(size)
+	if m == nil {
+		return 0, fmt.Errorf("invalid size: %s", size)
+	}
+	f, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	units := map[string]float64{
+		"b": 1,
+		"s": 512,
+		"k": 1 << 10,
+		"":  1 << 20, // the lvm default
+		"m": 1 << 20,
+		"g": 1 << 30,
+		"t": 1 << 40,
+		"p": 1 << 50,
+		"e": 1 << 60,
+	}
+	f *= units[strings.ToLower(m[3])]
+	if f >= math.MaxInt64 {
+		return 0, fmt.Errorf("size is too large: %s", size)
+	}
+	if f <= 0 {
+		return 0, fmt.Errorf("size must be positive: %s", size)
+	}
+	return int64(f), nil
+}
+
+// RoundExtents rounds the size up to a multiple of the extent size. This is
+// what lvm does to every requested size.
+func RoundExtents(size, extent int64) int64 {
+	if extent <= 0 {
+		return size
+	}
+	return (size + extent - 1) / extent * extent
+}
+
+// LVPath returns the device path of a logical volume.
+func LVPath(vg, lv string) string {
+	return DevDir + vg + "/" + lv
+}
+
+// ParseLVPath returns the volume group and logical volume names from a device
+// path. It understands both the /dev/<vg>/<lv> and the device mapper style of
+// /dev/mapper/<vg>-<lv> paths, in which any dash in the names is doubled. It
+// only looks at the path, so there's no guarantee that the volume exists.
+func ParseLVPath(p string) (string, string, bool) {
+	if !strings.HasPrefix(p, DevDir) {
+		return "", "", false
+	}
+	s := strings.TrimPrefix(p, DevDir)
+
+	if name, ok := strings.CutPrefix(s, "mapper/"); ok {
+		for i := 0; i < len(name); i++ {
+			if name[i] != '-' {
+				continue
+			}
+			if i+1 < len(name) && name[i+1] == '-' { // escaped
+				i++
+				continue
+			}
+			vg := strings.ReplaceAll(name[:i], "--", "-")
+			lv := strings.ReplaceAll(name[i+1:], "--", "-")
+			if IsValidLVMName(vg) != nil || IsValidLVMName(lv) != nil {
+				return "", "", false
+			}
+			return vg, lv, true
+		}
+		return "", "", false
+	}
+
+	vg, lv, ok := strings.Cut(s, "/")
+	if !ok || IsValidLVMName(vg) != nil || IsValidLVMName(lv) != nil {
+		return "", "", false
+	}
+	return vg, lv, true
+}
+
+// PVs returns the list of physical volumes with the linux util `pvs` command.
+func (obj *Grow) PVs(ctx context.Context) ([]*PhysicalVolume, error) {
+	rows, err := obj.lvmReport(ctx, "pvs", "pv", "pv_name,vg_name")
+	if err != nil {
+		return nil, err
+	}
+	result := []*PhysicalVolume{}
+	for _, row := range rows {
+		result = append(result, &PhysicalVolume{
+			Name: row["pv_name"],
+			VG:   row["vg_name"],
+		})
+	}
+	return result, nil
+}
+
+// VG returns the volume group with the linux util `vgs` command. If it doesn't
+// exist, then this returns nil without error.
+func (obj *Grow) VG(ctx context.Context, name string) (*VolumeGroup, error) {
+	rows, err := obj.lvmReport(ctx, "vgs", "vg", "vg_name,vg_size,vg_free,vg_extent_size")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row["vg_name"] != name {
+			continue
+		}
+		vg := &VolumeGroup{
+			Name: name,
+		}
+		if vg.Size, err = lvmInt(row, "vg_size"); err != nil {
+			return nil, err
+		}
+		if vg.Free, err = lvmInt(row, "vg_free"); err != nil {
+			return nil, err
+		}
+		if vg.ExtentSize, err = lvmInt(row, "vg_extent_size"); err != nil {
+			return nil, err
+		}
+		return vg, nil
+	}
+	return nil, nil
+}
+
+// LV returns the logical volume with the linux util `lvs` command. If it
+// doesn't exist, then this returns nil without error.
+func (obj *Grow) LV(ctx context.Context, vg, name string) (*LogicalVolume, error) {
+	rows, err := obj.lvmReport(ctx, "lvs", "lv", "lv_name,vg_name,lv_size,origin")
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		if row["vg_name"] != vg || row["lv_name"] != name {
+			continue
+		}
+		lv := &LogicalVolume{
+			Name:   name,
+			VG:     vg,
+			Origin: row["origin"],
+		}
+		if lv.Size, err = lvmInt(row, "lv_size"); err != nil {
+			return nil, err
+		}
+		return lv, nil
+	}
+	return nil, nil
+}
+
+// PVCreate initializes the device as a physical volume. Any existing signature
+// on the device is wiped, so check it's empty first!
+func (obj *Grow) PVCreate(ctx context.Context, dev string) error {
+	if dev == "" {
+		return fmt.Errorf("empty dev")
+	}
+	return obj.lvm(ctx, "pvcreate", []string{"--yes", dev})
+}
+
+// VGCreate creates the volume group on the physical volumes.
+func (obj *Grow) VGCreate(ctx context.Context, name string, devs []string) error {
+	if len(devs) == 0 {
+		return fmt.Errorf("no devices")
+	}
+	return obj.lvm(ctx, "vgcreate", append([]string{name}, devs...))
+}
+
+// VGExtend adds the physical volumes to the volume group.
+func (obj *Grow) VGExtend(ctx context.Context, name string, devs []string) error {
+	if len(devs) == 0 {
+		return fmt.Errorf("no devices")
+	}
+	return obj.lvm(ctx, "vgextend", append([]string{name}, devs...))
+}
+
+// VGReduce removes the unused physical volumes from the volume group. This
+// fails if any of them contain data.
+func (obj *Grow) VGReduce(ctx context.Context, name string, devs []string) error {
+	if len(devs) == 0 {
+		return fmt.Errorf("no devices")
+	}
+	return obj.lvm(ctx, "vgreduce", append([]string{name}, devs...))
+}
+
+// VGRemove removes the volume group. If force is true, then any logical volumes
+// in it are removed too, otherwise this fails if there are some.
+func (obj *Grow) VGRemove(ctx context.Context, name string, force bool) error {
+	cmdArgs := []string{name}
+	if force {
+		cmdArgs = []string{"--force", "--yes", name}
+	}
+	return obj.lvm(ctx, "vgremove", cmdArgs)
+}
+
+// LVCreate creates the logical volume. The size is either a number of bytes or
+// a relative size such as 100%FREE. If origin is not empty, then this is a
+// snapshot of that logical volume in the same volume group instead.
+func (obj *Grow) LVCreate(ctx context.Context, vg, name, size, origin string) error {
+	cmdArgs := []string{"--yes", "--name", name}
+	if IsLVMPercent(size) {
+		cmdArgs = append(cmdArgs, "--extents", size)
+	} else {
+		cmdArgs = append(cmdArgs, "--size", size)
+	}
+	if origin != "" {
+		cmdArgs = append(cmdArgs, "--snapshot", vg+"/"+origin)
+	} else {
+		cmdArgs = append(cmdArgs, vg)
+	}
+	return obj.lvm(ctx, "lvcreate", cmdArgs)
+}
+
+// LVResize resizes the logical volume to the number of bytes. If resizeFs is
+// true, then the filesystem on it is resized too. Shrinking a volume which has
+// no filesystem to resize along with it destroys data!
+func (obj *Grow) LVResize(ctx context.Context, vg, name string, size int64, resizeFs bool) error {
+	cmdArgs := []string{"--force", "--size", fmt.Sprintf("%db", size)}
+	if resizeFs {
+		cmdArgs = append(cmdArgs, "--resizefs")
+	}
+	cmdArgs = append(cmdArgs, vg+"/"+name)
+	return obj.lvm(ctx, "lvresize", cmdArgs)
+}
+
+// LVRemove removes the logical volume. This destroys data!
+func (obj *Grow) LVRemove(ctx context.Context, vg, name string) error {
+	return obj.lvm(ctx, "lvremove", []string{"--force", vg + "/" + name})
+}
+
+// lvmReport runs one of the lvm reporting commands and returns the rows of the
+// report. The sizes are all in bytes.
+func (obj *Grow) lvmReport(ctx context.Context, name, key, fields string) ([]map[string]string, error) {
+	cmd, err := exec.LookPath(name)
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs := []string{"--reportformat", "json", "--units", "b", "--nosuffix", "--options", fields}
+	b, err := util.SimpleCmdOut(ctx, cmd, cmdArgs, obj.cmdOpts())
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "%s failed", name)
+	}
+	return parseLVMReport(b, key)
+}
+
+// parseLVMReport parses the --reportformat json output of the lvm commands.
+// Every value in this format is a string.
+func parseLVMReport(b []byte, key string) ([]map[string]string, error) {
+	var st struct {
+		Report []map[string][]map[string]string `json:"report"`
+	}
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	if len(st.Report) != 1 {
+		return nil, fmt.Errorf("expected one report, got: %d", len(st.Report))
+	}
+	rows, exists := st.Report[0][key]
+	if !exists {
+		return nil, fmt.Errorf("missing %s report", key)
+	}
+	return rows, nil
+}
+
+// lvmInt returns a field of a report row as an integer.
+func lvmInt(row map[string]string, field string) (int64, error) {
+	i, err := strconv.ParseInt(row[field], 10, 64)
+	if err != nil {
+		return 0, errwrap.Wrapf(err, "invalid %s", field)
+	}
+	return i, nil
+}
+
+// lvm runs one of the lvm commands which change something.
+func (obj *Grow) lvm(ctx context.Context, name string, cmdArgs []string) error {
+	cmd, err := exec.LookPath(name)
+	if err != nil {
+		return err
+	}
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
@@ -0,0 +1,271 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package grow
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/util"
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+// PartTypeAliases maps the common partition type aliases to their canonical
+// values for each partition table label. We use these so that we can compare
+// what the user asked for, with what `sfdisk` reports.
+var PartTypeAliases = map[string]map[string]string{
+	"gpt": {
+		"linux": "0FC63DAF-8483-4772-8E79-3D69D8477DE4",
+		"swap":  "0657FD6D-A4AB-43C4-84E5-0933C84B4F4F",
+		"home":  "933AC7E1-2EB4-4F13-B844-0E14E2AEF915",
+		"uefi":  "C12A7328-F81F-11D2-BA4B-00A0C93EC93B",
+		"lvm":   "E6D6D379-F507-44C2-A23C-238F2A3DF928",
+		"raid":  "A19D880F-05FC-4D3B-A006-743F0F84911E",
+	},
+	"dos": {
+		"linux": "83",
+		"swap":  "82",
+		"uefi":  "ef",
+		"lvm":   "8e",
+		"raid":  "fd",
+	},
+}
+
+// Sfdisk is the --json output of the `sfdisk --dump` command.
+type Sfdisk struct {
+	PartitionTable *PartitionTable `json:"partitiontable"`
+}
+
+// PartitionTable is the partition table as reported by `sfdisk`.
+type PartitionTable struct {
+	Label      string       `json:"label"` // gpt or dos
+	ID         string       `json:"id"`
+	Device     string       `json:"device"`
+	Unit       string       `json:"unit"`
+	SectorSize int64        `json:"sectorsize"`
+	Partitions []*Partition `json:"partitions"`
+}
+
+// Partition is the type of each entry in the PartitionTable Partitions field.
+// The start and size are in units of sectors.
+type Partition struct {
+	Node  string `json:"node"`
+	Start int64  `json:"start"`
+	Size  int64  `json:"size"`
+	Type  string `json:"type"`
+	UUID  string `json:"uuid"`
+	Name  string `json:"name"`
+}
+
+// PartType returns the canonical partition type for the table label. If the
+// type is not a known alias, it is returned unchanged.
+func PartType(label, typ string) string {
+	if aliases, exists := PartTypeAliases[label]; exists {
+		if s, exists := aliases[strings.ToLower(typ)]; exists {
+			return s
+		}
+	}
+	return typ
+}
+
+// PartDev returns the partition device path for the disk and partition number.
+// This is the inverse of the GrowPartArgs function, eg: /dev/sda and 3 return
+// /dev/sda3 and /dev/nvme0n1 and 3 return /dev/nvme0n1p3.
+func PartDev(disk string, num int) string {
+	if disk == "" {
+		return ""
+	}
+	if c := disk[len(disk)-1]; c >= '0' && c <= '9' {
+		return fmt.Sprintf("%sp%d", disk, num)
+	}
+	return fmt.Sprintf("%s%d", disk, num)
+}
+
+// PartTable returns the partition table on the disk with the linux util
+// `sfdisk` command. If the disk doesn't have a partition table, then this
+// returns nil without error.
+func (obj *Grow) PartTable(ctx context.Context, disk string) (*PartitionTable, error) {
+	if disk == "" {
+		return nil, fmt.Errorf("empty disk")
+	}
+
+	cmd, err := exec.LookPath("sfdisk")
+	if err != nil {
+		return nil, err
+	}
+	cmdArgs := []string{"--json", disk}
+	if obj.Debug {
+		obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	}
+	b, err := exec.CommandContext(ctx, cmd, cmdArgs...).CombinedOutput()
+	if err != nil && strings.Contains(string(b), "does not contain a recognized partition table") {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errwrap.Wrapf(err, "sfdisk failed on: %s", disk)
+	}
+
+	return parseSfdisk(b)
+}
+
+// parseSfdisk parses the --json output of the `sfdisk` command.
+func parseSfdisk(b []byte) (*PartitionTable, error) {
+	var st Sfdisk
+	if err := json.Unmarshal(b, &st); err != nil {
+		return nil, err
+	}
+	if st.PartitionTable == nil {
+		return nil, fmt.Errorf("missing partition table")
+	}
+	if st.PartitionTable.SectorSize == 0 {
+		st.PartitionTable.SectorSize = 512 // older sfdisk omits this
+	}
+	return st.PartitionTable, nil
+}
+
+// MkPartTable writes a new empty partition table of the label type (gpt or dos)
+// onto the disk. This destroys any existing partitions!
+func (obj *Grow) MkPartTable(ctx context.Context, disk, label string) error {
+	if disk == "" {
+		return fmt.Errorf("empty disk")
+	}
+	if _, exists := PartTypeAliases[label]; !exists {
+		return fmt.Errorf("unknown partition table label: %s", label)
+	}
+	return obj.sfdisk(ctx, []string{disk}, fmt.Sprintf("label: %s\n", label))
+}
+
+// AddPart adds the partition numbered num to the disk. If size (in sectors) is
+// zero, then it uses the largest available free space. The type and name are
+// optional, although the name is only supported on gpt partition tables.
+func (obj *Grow) AddPart(ctx context.Context, disk string, num int, size int64, typ, name string) error {
+	if disk == "" {
+		return fmt.Errorf("empty disk")
+	}
+	if num <= 0 {
+		return fmt.Errorf("invalid partition number: %d", num)
+	}
+
+	fields := []string{}
+	if size > 0 {
+		fields = append(fields, fmt.Sprintf("size=%d", size))
+	}
+	if typ != "" {
+		fields = append(fields, fmt.Sprintf("type=%s", typ))
+	}
+	if name != "" {
+		fields = append(fields, fmt.Sprintf("name=%s", strconv.Quote(name)))
+	}
+	input := strings.Join(fields, ", ") + "\n"
+	if len(fields) == 0 {
+		input = ",\n" // all the defaults
+	}
+
+	cmdArgs := []string{"--partno", strconv.Itoa(num), disk}
+	return obj.sfdisk(ctx, cmdArgs, input)
+}
+
+// DelPart removes the partition numbered num from the disk. This does not wipe
+// the data, but you should consider it lost.
+func (obj *Grow) DelPart(ctx context.Context, disk string, num int) error {
+	if disk == "" {
+		return fmt.Errorf("empty disk")
+	}
+	return obj.sfdisk(ctx, []string{"--delete", disk, strconv.Itoa(num)}, "")
+}
+
+// SetPartType changes the type of the partition numbered num on the disk.
+func (obj *Grow) SetPartType(ctx context.Context, disk string, num int, typ string) error {
+	if disk == "" {
+		return fmt.Errorf("empty disk")
+	}
+	return obj.sfdisk(ctx, []string{"--part-type", disk, strconv.Itoa(num), typ}, "")
+}
+
+// SetPartName changes the (gpt only) name of the partition numbered num on the
+// disk.
+func (obj *Grow) SetPartName(ctx context.Context, disk string, num int, name string) error {
+	if disk == "" {
+		return fmt.Errorf("empty disk")
+	}
+	return obj.sfdisk(ctx, []string{"--part-label", disk, strconv.Itoa(num), name}, "")
+}
+
+// GrowPartCheck runs the "growpart" command in dry-run mode to determine if the
+// partition could be grown. It returns true if it would grow.
+func (obj *Grow) GrowPartCheck(ctx context.Context, part string) (bool, error) {
+	if part == "" {
+		return false, fmt.Errorf("empty part")
+	}
+
+	base, part, err := obj.GrowPartArgs(part)
+	if err != nil {
+		return false, err
+	}
+
+	cmd, err := exec.LookPath("growpart")
+	if err != nil {
+		return false, err
+	}
+	cmdArgs := []string{"--dry-run", base, part}
+	if obj.Debug {
+		obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	}
+	b, err := exec.CommandContext(ctx, cmd, cmdArgs...).CombinedOutput()
+	if strings.Contains(string(b), "NOCHANGE") { // exit status is also 1
+		return false, nil
+	}
+	if err != nil {
+		return false, errwrap.Wrapf(err, "growpart failed: %s", strings.TrimSpace(string(b)))
+	}
+	return true, nil
+}
+
+// sfdisk runs the `sfdisk` command with the args and passes in the input on
+// stdin if it is not empty.
+func (obj *Grow) sfdisk(ctx context.Context, cmdArgs []string, input string) error {
+	cmd, err := exec.LookPath("sfdisk")
+	if err != nil {
+		return err
+	}
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	opts := obj.cmdOpts()
+	if input != "" {
+		opts.Stdin = strings.NewReader(input)
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, opts)
+}
@@ -0,0 +1,190 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package grow
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"github.com/purpleidea/mgmt/util"
+)
+
+const (
+	// ProcSwaps is the kernel file that lists all the active swap areas.
+	ProcSwaps = "/proc/swaps"
+)
+
+// SwapInfo is the type of each entry in the /proc/swaps file.
+type SwapInfo struct {
+	// Filename is the path to the device or file used for swap.
+	Filename string
+
+	// Type is either "partition" or "file".
+	Type string
+
+	// Size is the size of the swap area in KiB.
+	Size int64
+
+	// Used is the amount of swap that is used in KiB.
+	Used int64
+
+	// Priority is the swap priority. Negative values are kernel chosen.
+	Priority int
+}
+
+// Swaps returns the list of active swap areas.
+func (obj *Grow) Swaps() ([]*SwapInfo, error) {
+	b, err := os.ReadFile(ProcSwaps)
+	if err != nil {
+		return nil, err
+	}
+	return parseSwaps(b)
+}
+
+// parseSwaps parses the contents of the /proc/swaps file. The first line is a
+// header which is skipped.
+func parseSwaps(b []byte) ([]*SwapInfo, error) {
+	swaps := []*SwapInfo{}
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	header := true
+	for scanner.Scan() {
+		if header {
+			header = false
+			continue
+		}
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("unexpected swaps line: %s", scanner.Text())
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		used, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		priority, err := strconv.Atoi(fields[4])
+		if err != nil {
+			return nil, err
+		}
+		swaps = append(swaps, &SwapInfo{
+			// spaces in the path are shown in their octal form
+			Filename: strings.ReplaceAll(fields[0], `\040`, " "),
+			Type:     fields[1],
+			Size:     size,
+			Used:     used,
+			Priority: priority,
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return swaps, nil
+}
+
+// MkSwap sets up a swap area on the device or file. The label and uuid are
+// optional. This destroys any existing data!
+func (obj *Grow) MkSwap(ctx context.Context, dev, label, uuid string, force bool) error {
+	if dev == "" {
+		return fmt.Errorf("empty dev")
+	}
+
+	cmd, err := exec.LookPath("mkswap")
+	if err != nil {
+		return err
+	}
+	cmdArgs := []string{}
+	if force {
+		cmdArgs = append(cmdArgs, "--force")
+	}
+	if label != "" {
+		cmdArgs = append(cmdArgs, "--label", label)
+	}
+	if uuid != "" {
+		cmdArgs = append(cmdArgs, "--uuid", uuid)
+	}
+	cmdArgs = append(cmdArgs, dev)
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
+
+// SwapOn activates the swap area. If the priority is nil, then the kernel will
+// pick one.
+func (obj *Grow) SwapOn(ctx context.Context, dev string, priority *int) error {
+	if dev == "" {
+		return fmt.Errorf("empty dev")
+	}
+
+	cmd, err := exec.LookPath("swapon")
+	if err != nil {
+		return err
+	}
+	cmdArgs := []string{}
+	if priority != nil {
+		cmdArgs = append(cmdArgs, "--priority", strconv.Itoa(*priority))
+	}
+	cmdArgs = append(cmdArgs, dev)
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
+
+// SwapOff deactivates the swap area.
+func (obj *Grow) SwapOff(ctx context.Context, dev string) error {
+	if dev == "" {
+		return fmt.Errorf("empty dev")
+	}
+
+	cmd, err := exec.LookPath("swapoff")
+	if err != nil {
+		return err
+	}
+	cmdArgs := []string{dev}
+	obj.Logf("cmd: %s %s", cmd, strings.Join(cmdArgs, " "))
+	if obj.Noop {
+		return nil
+	}
+	return util.SimpleCmd(ctx, cmd, cmdArgs, obj.cmdOpts())
+}
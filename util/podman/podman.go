@@ -0,0 +1,601 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+// Package podman is a small client for the libpod REST API which is served by
+// `podman system service` on a unix socket. It only contains what the podman
+// resources need. We talk to the libpod API and not the docker compatible one,
+// because it's the only way to manage pods, and because rootless podman is a
+// first class citizen there. It also contains helpers for quadlet unit files.
+package podman
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/purpleidea/mgmt/util/errwrap"
+)
+
+const (
+	// DefaultSocket is the path of the socket that the rootful podman
+	// service listens on.
+	DefaultSocket = "/run/podman/podman.sock"
+
+	// APIPrefix is the prefix of all the libpod API paths. We pin the
+	// version so that the server knows which behaviour we expect.
+	APIPrefix = "/v4.0.0/libpod"
+
+	// LabelHash is the label that we store a hash of the definition in, so
+	// that we can notice when an existing object doesn't match it.
+	LabelHash = "io.github.purpleidea.mgmt.hash"
+)
+
+// Hash returns a stable hash of a spec. We store it in the LabelHash label when
+// we create an object so that we can tell if it has drifted from the spec. The
+// spec must not include the hash label itself.
+func Hash(spec interface{}) (string, error) {
+	b, err := json.Marshal(spec) // maps are sorted by the encoder
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(b)), nil
+}
+
+// UserSocket returns the path of the socket that the rootless podman service
+// of the user with this uid listens on.
+func UserSocket(uid string) string {
+	return "/run/user/" + uid + "/podman/podman.sock"
+}
+
+// Error is returned when the API responds with an error status code.
+type Error struct {
+	// Status is the HTTP status code.
+	Status int
+
+	// Message is the error message that podman sent.
+	Message string
+}
+
+// Error returns the string representation of the API error.
+func (obj *Error) Error() string {
+	return fmt.Sprintf("podman: %d: %s", obj.Status, obj.Message)
+}
+
+// IsNotFound returns true if the error is an API error for a missing object.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && e.Status == http.StatusNotFound
+}
+
+// Client talks to a single podman service socket.
+type Client struct {
+	// Socket is the path to the unix socket of the service.
+	Socket string
+
+	// Debug represents if we're running in debug mode or not.
+	Debug bool
+
+	// Logf is a logger which should be used.
+	Logf func(format string, v ...interface{})
+
+	client *http.Client
+}
+
+// httpClient returns the http client which dials our socket.
+func (obj *Client) httpClient() *http.Client {
+	if obj.client != nil {
+		return obj.client
+	}
+	socket := strings.TrimPrefix(obj.Socket, "unix://")
+	if socket == "" {
+		socket = DefaultSocket
+	}
+	obj.client = &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				d := &net.Dialer{}
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+	return obj.client
+}
+
+// Close releases any idle connections to the service.
+func (obj *Client) Close() {
+	if obj.client != nil {
+		obj.client.CloseIdleConnections()
+	}
+}
+
+// request runs an API request and returns the response if the status code is
+// not an error. The caller must close the body. The path is relative to the
+// APIPrefix. If in is not nil, it is sent as the JSON request body.
+func (obj *Client) request(ctx context.Context, method, path string, query url.Values, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return nil, errwrap.Wrapf(err, "could not encode request")
+		}
+		body = bytes.NewReader(b)
+	}
+
+	u := "http://d" + APIPrefix + path // the host is ignored
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	if obj.Debug && obj.Logf != nil {
+		obj.Logf("%s %s", method, u)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := obj.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 400 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	apiErr := &Error{Status: resp.StatusCode}
+	msg := struct {
+		Message string `json:"message"`
+	}{}
+	if b, err := io.ReadAll(resp.Body); err == nil {
+		if json.Unmarshal(b, &msg) == nil && msg.Message != "" {
+			apiErr.Message = msg.Message
+		} else {
+			apiErr.Message = strings.TrimSpace(string(b))
+		}
+	}
+	return nil, apiErr
+}
+
+// call runs an API request and decodes the JSON response into out, unless it's
+// nil, in which case the response is discarded.
+func (obj *Client) call(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := obj.request(ctx, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err := io.Copy(io.Discard, resp.Body)
+		return err
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return errwrap.Wrapf(err, "could not decode response")
+	}
+	return nil
+}
+
+// Ping returns nil if the service is up.
+func (obj *Client) Ping(ctx context.Context) error {
+	return obj.call(ctx, http.MethodGet, "/_ping", nil, nil, nil)
+}
+
+// inspect gets the object of kind at the name and decodes it into out. It
+// returns false if it doesn't exist.
+func (obj *Client) inspect(ctx context.Context, kind, name string, out interface{}) (bool, error) {
+	err := obj.call(ctx, http.MethodGet, "/"+kind+"/"+url.PathEscape(name)+"/json", nil, nil, out)
+	if IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// remove deletes the object of kind at the name. It's not an error if it's
+// already gone.
+func (obj *Client) remove(ctx context.Context, kind, name string, force bool) error {
+	query := url.Values{}
+	if force {
+		query.Set("force", "true")
+	}
+	err := obj.call(ctx, http.MethodDelete, "/"+kind+"/"+url.PathEscape(name), query, nil, nil)
+	if IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// PortMapping is a port that is published on the host.
+type PortMapping struct {
+	HostIP        string `json:"host_ip,omitempty"`
+	HostPort      uint16 `json:"host_port"`
+	ContainerPort uint16 `json:"container_port"`
+	Protocol      string `json:"protocol,omitempty"`
+}
+
+// NamedVolume is a named volume which is mounted into a container.
+type NamedVolume struct {
+	Name    string   `json:"Name"`
+	Dest    string   `json:"Dest"`
+	Options []string `json:"Options,omitempty"`
+}
+
+// Mount is a bind mount of a host path into a container.
+type Mount struct {
+	Type        string   `json:"type"`
+	Source      string   `json:"source"`
+	Destination string   `json:"destination"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// HealthConfig is the healthcheck of a container. The durations are in
+// nanoseconds, like they are in the API.
+type HealthConfig struct {
+	Test        []string      `json:"Test,omitempty"`
+	Interval    time.Duration `json:"Interval,omitempty"`
+	Timeout     time.Duration `json:"Timeout,omitempty"`
+	StartPeriod time.Duration `json:"StartPeriod,omitempty"`
+	Retries     int           `json:"Retries,omitempty"`
+}
+
+// ContainerSpec is the subset of the libpod SpecGenerator that we use to create
+// containers.
+type ContainerSpec struct {
+	Name         string                       `json:"name"`
+	Image        string                       `json:"image"`
+	Command      []string                     `json:"command,omitempty"`
+	Env          map[string]string            `json:"env,omitempty"`
+	Labels       map[string]string            `json:"labels,omitempty"`
+	PortMappings []PortMapping                `json:"portmappings,omitempty"`
+	Volumes      []NamedVolume                `json:"volumes,omitempty"`
+	Mounts       []Mount                      `json:"mounts,omitempty"`
+	Networks     map[string]map[string]string `json:"Networks,omitempty"`
+	Pod          string                       `json:"pod,omitempty"`
+	HealthConfig *HealthConfig                `json:"healthconfig,omitempty"`
+}
+
+// ContainerInfo is the subset of the container inspect output that we use.
+type ContainerInfo struct {
+	ID        string `json:"Id"`
+	Name      string `json:"Name"`
+	ImageName string `json:"ImageName"`
+	Pod       string `json:"Pod"`
+	State     struct {
+		Status  string `json:"Status"`
+		Running bool   `json:"Running"`
+		Health  *struct {
+			Status string `json:"Status"`
+		} `json:"Health"`
+	} `json:"State"`
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"Config"`
+}
+
+// Health returns the health status of the container, or the empty string if
+// it has no healthcheck.
+func (obj *ContainerInfo) Health() string {
+	if obj.State.Health == nil {
+		return ""
+	}
+	return obj.State.Health.Status
+}
+
+// The health statuses of a container with a healthcheck.
+const (
+	HealthStarting  = "starting"
+	HealthHealthy   = "healthy"
+	HealthUnhealthy = "unhealthy"
+)
+
+// InspectContainer returns information about the named container, or nil if it
+// doesn't exist.
+func (obj *Client) InspectContainer(ctx context.Context, name string) (*ContainerInfo, error) {
+	info := &ContainerInfo{}
+	if exists, err := obj.inspect(ctx, "containers", name, info); err != nil || !exists {
+		return nil, err
+	}
+	return info, nil
+}
+
+// CreateContainer creates a new container.
+func (obj *Client) CreateContainer(ctx context.Context, spec *ContainerSpec) error {
+	return obj.call(ctx, http.MethodPost, "/containers/create", nil, spec, nil)
+}
+
+// StartContainer starts the named container. It's not an error if it's already
+// running.
+func (obj *Client) StartContainer(ctx context.Context, name string) error {
+	return obj.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/start", nil, nil, nil)
+}
+
+// StopContainer stops the named container. It's not an error if it's already
+// stopped. If timeout is not nil, it's the number of seconds to wait before
+// killing it.
+func (obj *Client) StopContainer(ctx context.Context, name string, timeout *int) error {
+	query := url.Values{}
+	if timeout != nil {
+		query.Set("timeout", fmt.Sprintf("%d", *timeout))
+	}
+	return obj.call(ctx, http.MethodPost, "/containers/"+url.PathEscape(name)+"/stop", query, nil, nil)
+}
+
+// RemoveContainer removes the named container, and kills it first if needed.
+func (obj *Client) RemoveContainer(ctx context.Context, name string) error {
+	return obj.remove(ctx, "containers", name, true)
+}
+
+// ImageInfo is the subset of the image inspect output that we use.
+type ImageInfo struct {
+	ID       string   `json:"Id"`
+	RepoTags []string `json:"RepoTags"`
+}
+
+// InspectImage returns information about the image, or nil if it doesn't
+// exist locally.
+func (obj *Client) InspectImage(ctx context.Context, name string) (*ImageInfo, error) {
+	info := &ImageInfo{}
+	if exists, err := obj.inspect(ctx, "images", name, info); err != nil || !exists {
+		return nil, err
+	}
+	return info, nil
+}
+
+// PullImage pulls the image from its registry and waits for it to finish.
+func (obj *Client) PullImage(ctx context.Context, name string) error {
+	query := url.Values{}
+	query.Set("reference", name)
+	query.Set("quiet", "true")
+	resp, err := obj.request(ctx, http.MethodPost, "/images/pull", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The response is a stream of JSON objects. Errors are sent in band.
+	dec := json.NewDecoder(resp.Body)
+	for {
+		report := struct {
+			Error string `json:"error"`
+		}{}
+		if err := dec.Decode(&report); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errwrap.Wrapf(err, "could not decode pull report")
+		}
+		if report.Error != "" {
+			return fmt.Errorf("pull failed: %s", report.Error)
+		}
+	}
+}
+
+// RemoveImage removes the image.
+func (obj *Client) RemoveImage(ctx context.Context, name string) error {
+	return obj.remove(ctx, "images", name, false)
+}
+
+// VolumeSpec is what we use to create a volume.
+type VolumeSpec struct {
+	Name    string            `json:"Name"`
+	Driver  string            `json:"Driver,omitempty"`
+	Labels  map[string]string `json:"Labels,omitempty"`
+	Options map[string]string `json:"Options,omitempty"`
+}
+
+// VolumeInfo is the subset of the volume inspect output that we use.
+type VolumeInfo struct {
+	Name   string            `json:"Name"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// InspectVolume returns information about the volume, or nil if it doesn't
+// exist.
+func (obj *Client) InspectVolume(ctx context.Context, name string) (*VolumeInfo, error) {
+	info := &VolumeInfo{}
+	if exists, err := obj.inspect(ctx, "volumes", name, info); err != nil || !exists {
+		return nil, err
+	}
+	return info, nil
+}
+
+// CreateVolume creates a new volume.
+func (obj *Client) CreateVolume(ctx context.Context, spec *VolumeSpec) error {
+	return obj.call(ctx, http.MethodPost, "/volumes/create", nil, spec, nil)
+}
+
+// RemoveVolume removes the volume. It fails if it's in use, unless forced.
+func (obj *Client) RemoveVolume(ctx context.Context, name string, force bool) error {
+	return obj.remove(ctx, "volumes", name, force)
+}
+
+// Subnet is a network subnet with an optional gateway.
+type Subnet struct {
+	Subnet  string `json:"subnet"`
+	Gateway string `json:"gateway,omitempty"`
+}
+
+// NetworkSpec is what we use to create a network.
+type NetworkSpec struct {
+	Name        string            `json:"name"`
+	Driver      string            `json:"driver,omitempty"`
+	Subnets     []Subnet          `json:"subnets,omitempty"`
+	Internal    bool              `json:"internal"`
+	IPv6Enabled bool              `json:"ipv6_enabled"`
+	DNSEnabled  bool              `json:"dns_enabled"`
+	Labels      map[string]string `json:"labels,omitempty"`
+}
+
+// NetworkInfo is the subset of the network inspect output that we use.
+type NetworkInfo struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels"`
+}
+
+// InspectNetwork returns information about the network, or nil if it doesn't
+// exist.
+func (obj *Client) InspectNetwork(ctx context.Context, name string) (*NetworkInfo, error) {
+	info := &NetworkInfo{}
+	if exists, err := obj.inspect(ctx, "networks", name, info); err != nil || !exists {
+		return nil, err
+	}
+	return info, nil
+}
+
+// CreateNetwork creates a new network.
+func (obj *Client) CreateNetwork(ctx context.Context, spec *NetworkSpec) error {
+	return obj.call(ctx, http.MethodPost, "/networks/create", nil, spec, nil)
+}
+
+// RemoveNetwork removes the network. If force is true, any containers using it
+// are removed too.
+func (obj *Client) RemoveNetwork(ctx context.Context, name string, force bool) error {
+	return obj.remove(ctx, "networks", name, force)
+}
+
+// PodSpec is the subset of the libpod PodSpecGenerator that we use to create
+// pods.
+type PodSpec struct {
+	Name         string                       `json:"name"`
+	Labels       map[string]string            `json:"labels,omitempty"`
+	PortMappings []PortMapping                `json:"portmappings,omitempty"`
+	Networks     map[string]map[string]string `json:"Networks,omitempty"`
+}
+
+// PodInfo is the subset of the pod inspect output that we use.
+type PodInfo struct {
+	ID     string            `json:"Id"`
+	Name   string            `json:"Name"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// The pod states that we care about.
+const (
+	PodRunning = "Running"
+	PodCreated = "Created"
+	PodExited  = "Exited"
+)
+
+// InspectPod returns information about the pod, or nil if it doesn't exist.
+func (obj *Client) InspectPod(ctx context.Context, name string) (*PodInfo, error) {
+	info := &PodInfo{}
+	if exists, err := obj.inspect(ctx, "pods", name, info); err != nil || !exists {
+		return nil, err
+	}
+	return info, nil
+}
+
+// CreatePod creates a new pod.
+func (obj *Client) CreatePod(ctx context.Context, spec *PodSpec) error {
+	return obj.call(ctx, http.MethodPost, "/pods/create", nil, spec, nil)
+}
+
+// StartPod starts all the containers in the pod.
+func (obj *Client) StartPod(ctx context.Context, name string) error {
+	return obj.call(ctx, http.MethodPost, "/pods/"+url.PathEscape(name)+"/start", nil, nil, nil)
+}
+
+// StopPod stops all the containers in the pod.
+func (obj *Client) StopPod(ctx context.Context, name string) error {
+	return obj.call(ctx, http.MethodPost, "/pods/"+url.PathEscape(name)+"/stop", nil, nil, nil)
+}
+
+// RemovePod removes the pod and all of its containers.
+func (obj *Client) RemovePod(ctx context.Context, name string) error {
+	return obj.remove(ctx, "pods", name, true)
+}
+
+// Event is a single event from the event stream.
+type Event struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+}
+
+// Events streams the events which match the filters until the context closes.
+// The filters are the same as those of `podman events --filter`. The events
+// channel is closed when the stream ends, and if that was due to an error, it's
+// sent on the error channel first, which is then closed too.
+func (obj *Client) Events(ctx context.Context, filters map[string][]string) (<-chan *Event, <-chan error, error) {
+	query := url.Values{}
+	query.Set("stream", "true")
+	if len(filters) > 0 {
+		b, err := json.Marshal(filters)
+		if err != nil {
+			return nil, nil, err
+		}
+		query.Set("filters", string(b))
+	}
+
+	resp, err := obj.request(ctx, http.MethodGet, "/events", query, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	events := make(chan *Event)
+	errch := make(chan error, 1) // buffered so we never block on it
+	go func() {
+		defer close(errch)
+		defer close(events)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			event := &Event{}
+			if err := json.Unmarshal(scanner.Bytes(), event); err != nil {
+				errch <- errwrap.Wrapf(err, "could not decode event")
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if err := scanner.Err(); err != nil && ctx.Err() == nil {
+			errch <- err
+		}
+	}()
+	return events, errch, nil
+}
@@ -0,0 +1,233 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+package podman
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// QuadletDir is the directory where rootful quadlet files go. The
+	// quadlet systemd generator turns them into service units.
+	QuadletDir = "/etc/containers/systemd/"
+)
+
+// QuadletUserDir returns the directory where an administrator puts the quadlet
+// files for the rootless user with this uid.
+func QuadletUserDir(uid string) string {
+	return QuadletDir + "users/" + uid + "/"
+}
+
+// Quadlet is a quadlet unit file.
+type Quadlet struct {
+	// Kind is the unit type, which is also the name of the main section and
+	// the file extension. For example: container.
+	Kind string
+
+	// Description is the optional unit description.
+	Description string
+
+	// Entries are the keys and values of the main section in order. A key
+	// may appear more than once.
+	Entries [][2]string
+
+	// Restart is the optional systemd restart policy, eg: always.
+	Restart string
+
+	// WantedBy is the optional target which starts this unit on boot.
+	WantedBy string
+}
+
+// Add appends an entry to the main section.
+func (obj *Quadlet) Add(key, value string) {
+	obj.Entries = append(obj.Entries, [2]string{key, value})
+}
+
+// Filename returns the name of the quadlet file for this unit name.
+func (obj *Quadlet) Filename(name string) string {
+	return name + "." + obj.Kind
+}
+
+// String returns the contents of the unit file.
+func (obj *Quadlet) String() string {
+	s := "# This file is managed by mgmt. Do not edit.\n"
+	if obj.Description != "" {
+		s += "[Unit]\n"
+		s += fmt.Sprintf("Description=%s\n", obj.Description)
+		s += "\n"
+	}
+	s += fmt.Sprintf("[%s]\n", strings.ToUpper(obj.Kind[:1])+obj.Kind[1:])
+	for _, x := range obj.Entries {
+		s += fmt.Sprintf("%s=%s\n", x[0], x[1])
+	}
+	if obj.Restart != "" {
+		s += "\n[Service]\n"
+		s += fmt.Sprintf("Restart=%s\n", obj.Restart)
+	}
+	if obj.WantedBy != "" {
+		s += "\n[Install]\n"
+		s += fmt.Sprintf("WantedBy=%s\n", obj.WantedBy)
+	}
+	return s
+}
+
+// Quote quotes a word for a systemd unit file if it needs it.
+func Quote(s string) string {
+	if s != "" && !strings.ContainsAny(s, " \t\"'\\$%") {
+		return s
+	}
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `$$`, `%`, `%%`)
+	return `"` + r.Replace(s) + `"`
+}
+
+// QuoteArgs quotes and joins a list of words for a systemd unit file.
+func QuoteArgs(args []string) string {
+	l := []string{}
+	for _, x := range args {
+		l = append(l, Quote(x))
+	}
+	return strings.Join(l, " ")
+}
+
+// ContainerQuadlet returns the quadlet which runs a container with this spec.
+// The container keeps its name so that it's easy to find.
+func ContainerQuadlet(spec *ContainerSpec) *Quadlet {
+	q := &Quadlet{
+		Kind:    "container",
+		Restart: "always",
+	}
+	q.Add("ContainerName", spec.Name)
+	q.Add("Image", spec.Image)
+	if len(spec.Command) > 0 {
+		q.Add("Exec", QuoteArgs(spec.Command))
+	}
+	for _, k := range sortedKeys(spec.Env) {
+		q.Add("Environment", Quote(k+"="+spec.Env[k]))
+	}
+	for _, k := range sortedKeys(spec.Labels) {
+		q.Add("Label", Quote(k+"="+spec.Labels[k]))
+	}
+	for _, x := range spec.PortMappings {
+		p := fmt.Sprintf("%d:%d", x.HostPort, x.ContainerPort)
+		if x.HostIP != "" {
+			p = x.HostIP + ":" + p
+		}
+		if x.Protocol != "" {
+			p += "/" + x.Protocol
+		}
+		q.Add("PublishPort", p)
+	}
+	for _, x := range spec.Volumes {
+		q.Add("Volume", Quote(volumeString(x.Name, x.Dest, x.Options)))
+	}
+	for _, x := range spec.Mounts {
+		q.Add("Volume", Quote(volumeString(x.Source, x.Destination, x.Options)))
+	}
+	for _, k := range sortedKeys(spec.Networks) {
+		q.Add("Network", k)
+	}
+	if spec.Pod != "" {
+		// The Pod key expects a quadlet pod, but ours is managed by
+		// the API, so we pass it through instead.
+		q.Add("PodmanArgs", "--pod="+Quote(spec.Pod))
+	}
+	if h := spec.HealthConfig; h != nil {
+		if cmd := HealthCmd(h.Test); cmd != "" {
+			q.Add("HealthCmd", cmd)
+		}
+		if h.Interval > 0 {
+			q.Add("HealthInterval", h.Interval.String())
+		}
+		if h.Timeout > 0 {
+			q.Add("HealthTimeout", h.Timeout.String())
+		}
+		if h.StartPeriod > 0 {
+			q.Add("HealthStartPeriod", h.StartPeriod.String())
+		}
+		if h.Retries > 0 {
+			q.Add("HealthRetries", fmt.Sprintf("%d", h.Retries))
+		}
+	}
+	return q
+}
+
+// HealthTest returns the healthcheck test for a command in the format that the
+// API expects. A single string is run by the shell.
+func HealthTest(cmd []string) []string {
+	if len(cmd) == 0 {
+		return nil
+	}
+	if len(cmd) == 1 {
+		return []string{"CMD-SHELL", cmd[0]}
+	}
+	return append([]string{"CMD"}, cmd...)
+}
+
+// HealthCmd is the reverse of HealthTest, and returns the command in the
+// format that a quadlet file expects.
+func HealthCmd(test []string) string {
+	if len(test) < 2 {
+		return ""
+	}
+	if test[0] == "CMD-SHELL" {
+		return Quote(test[1])
+	}
+	return QuoteArgs(test[1:])
+}
+
+// ParseDuration parses an optional duration. The empty string is zero.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// volumeString returns the volume in the src:dst:opts format.
+func volumeString(src, dst string, opts []string) string {
+	s := src + ":" + dst
+	if len(opts) > 0 {
+		s += ":" + strings.Join(opts, ",")
+	}
+	return s
+}
+
+// sortedKeys returns the sorted keys of a map.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := []string{}
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
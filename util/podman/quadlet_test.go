@@ -0,0 +1,159 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package podman
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"nginx":         "nginx",
+		"":              `""`,
+		"hello world":   `"hello world"`,
+		`say "hi"`:      `"say \"hi\""`,
+		"echo $HOME":    `"echo $$HOME"`,
+		"100%":          `"100%%"`,
+		`C:\dir`:        `"C:\\dir"`,
+		"--pod=app-1.2": "--pod=app-1.2",
+	}
+	for s, expected := range tests {
+		if q := Quote(s); q != expected {
+			t.Errorf("input: %s, expected: %s, got: %s", s, expected, q)
+		}
+	}
+}
+
+func TestHealthCmd(t *testing.T) {
+	tests := []struct {
+		cmd      []string
+		expected string
+	}{
+		{nil, ""},
+		{[]string{"curl -f http://localhost/"}, `"curl -f http://localhost/"`},
+		{[]string{"/bin/check", "--quick"}, "/bin/check --quick"},
+	}
+	for i, test := range tests {
+		if s := HealthCmd(HealthTest(test.cmd)); s != test.expected {
+			t.Errorf("index: %d, expected: %s, got: %s", i, test.expected, s)
+		}
+	}
+}
+
+func TestContainerQuadlet(t *testing.T) {
+	spec := &ContainerSpec{
+		Name:    "web",
+		Image:   "nginx:latest",
+		Command: []string{"nginx", "-g", "daemon off;"},
+		Env:     map[string]string{"B": "2", "A": "1"},
+		Labels:  map[string]string{LabelHash: "abc"},
+		PortMappings: []PortMapping{
+			{HostPort: 8080, ContainerPort: 80, Protocol: "tcp"},
+		},
+		Volumes: []NamedVolume{
+			{Name: "data", Dest: "/data", Options: []string{"Z"}},
+		},
+		Mounts: []Mount{
+			{Type: "bind", Source: "/srv", Destination: "/srv"},
+		},
+		Networks: map[string]map[string]string{"backend": {}},
+		Pod:      "app",
+		HealthConfig: &HealthConfig{
+			Test:     HealthTest([]string{"curl -f localhost"}),
+			Interval: 30 * time.Second,
+			Retries:  3,
+		},
+	}
+	q := ContainerQuadlet(spec)
+	q.Description = "The web container"
+	q.WantedBy = "multi-user.target"
+
+	expected := `# This file is managed by mgmt. Do not edit.
+[Unit]
+Description=The web container
+
+[Container]
+ContainerName=web
+Image=nginx:latest
+Exec=nginx -g "daemon off;"
+Environment=A=1
+Environment=B=2
+Label=io.github.purpleidea.mgmt.hash=abc
+PublishPort=8080:80/tcp
+Volume=data:/data:Z
+Volume=/srv:/srv
+Network=backend
+PodmanArgs=--pod=app
+HealthCmd="curl -f localhost"
+HealthInterval=30s
+HealthRetries=3
+
+[Service]
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`
+	if s := q.String(); s != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, s)
+	}
+	if s := q.Filename("web"); s != "web.container" {
+		t.Errorf("unexpected filename: %s", s)
+	}
+}
+
+func TestHash(t *testing.T) {
+	spec := func() *ContainerSpec {
+		return &ContainerSpec{
+			Name:  "web",
+			Image: "nginx",
+			Env:   map[string]string{"A": "1", "B": "2", "C": "3"},
+		}
+	}
+	h1, err := Hash(spec())
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	h2, err := Hash(spec())
+	if err != nil {
+		t.Fatalf("error: %v", err)
+	}
+	if h1 != h2 {
+		t.Errorf("hash is not stable: %s != %s", h1, h2)
+	}
+	s := spec()
+	s.Image = "httpd"
+	if h3, err := Hash(s); err != nil || h3 == h1 {
+		t.Errorf("hash did not change")
+	}
+}
@@ -0,0 +1,677 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+// Package sudoers contains a syntax checker for sudoers files. It is the moral
+// equivalent of running `visudo -c` but without needing the binary. It supports
+// the subset of the sudoers grammar which is commonly used in drop-in files, and
+// it errors on anything that it doesn't understand, since a broken sudoers file
+// can easily lock you out of a machine.
+package sudoers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// aliasTypes are the keywords which begin an alias definition.
+	aliasTypes = map[string]bool{
+		"User_Alias":  true,
+		"Runas_Alias": true,
+		"Host_Alias":  true,
+		"Cmnd_Alias":  true,
+		"Cmd_Alias":   true,
+	}
+
+	// Tags are the valid command tags which precede a command and a colon.
+	Tags = map[string]bool{
+		"NOPASSWD":     true,
+		"PASSWD":       true,
+		"NOEXEC":       true,
+		"EXEC":         true,
+		"SETENV":       true,
+		"NOSETENV":     true,
+		"LOG_INPUT":    true,
+		"NOLOG_INPUT":  true,
+		"LOG_OUTPUT":   true,
+		"NOLOG_OUTPUT": true,
+		"MAIL":         true,
+		"NOMAIL":       true,
+		"FOLLOW":       true,
+		"NOFOLLOW":     true,
+		"INTERCEPT":    true,
+		"NOINTERCEPT":  true,
+	}
+
+	// options are the valid command options which take a value.
+	options = map[string]bool{
+		"CWD":              true,
+		"CHROOT":           true,
+		"TIMEOUT":          true,
+		"NOTBEFORE":        true,
+		"NOTAFTER":         true,
+		"ROLE":             true,
+		"TYPE":             true,
+		"APPARMOR_PROFILE": true,
+	}
+
+	// digests are the valid digest types which can precede a command.
+	digests = map[string]bool{
+		"sha224": true,
+		"sha256": true,
+		"sha384": true,
+		"sha512": true,
+	}
+
+	aliasNameRegexp   = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+	defaultNameRegexp = regexp.MustCompile(`^[a-z_]+$`)
+	userRegexp        = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.@-]*\$?$`)
+	hostRegexp        = regexp.MustCompile(`^[a-zA-Z0-9*?\[\]_:][a-zA-Z0-9*?\[\]_.:/-]*$`)
+	numberRegexp      = regexp.MustCompile(`^[0-9]+$`)
+	digestRegexp      = regexp.MustCompile(`^[a-zA-Z0-9+/=]+$`)
+)
+
+// Error is the error returned when a sudoers file fails to parse.
+type Error struct {
+	// Line is the line number that the error was found on. It starts at
+	// one. If a logical line was continued with a trailing backslash, then
+	// this is the first physical line of it.
+	Line int
+
+	// Msg is the description of the problem.
+	Msg string
+}
+
+// Error returns the string representation of the parse error.
+func (obj *Error) Error() string {
+	return fmt.Sprintf("sudoers: line %d: %s", obj.Line, obj.Msg)
+}
+
+// Check parses the contents of a sudoers file and returns an error if there is
+// a syntax problem. It also errors if an alias is defined more than once.
+func Check(content string) error {
+	aliases := make(map[string]int) // name -> line
+	for _, line := range logicalLines(content) {
+		p := &parser{
+			s:       line.text,
+			line:    line.num,
+			aliases: aliases,
+		}
+		if err := p.parse(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// logicalLine is a line after the continuations have been joined.
+type logicalLine struct {
+	num  int
+	text string
+}
+
+// logicalLines splits the content into lines, joins the lines which end in a
+// backslash, and removes the comments.
+func logicalLines(content string) []*logicalLine {
+	lines := []*logicalLine{}
+	physical := strings.Split(content, "\n")
+	for i := 0; i < len(physical); i++ {
+		num := i + 1
+		text := physical[i]
+		for strings.HasSuffix(text, `\`) && !strings.HasSuffix(text, `\\`) && i+1 < len(physical) {
+			i++
+			text = strings.TrimSuffix(text, `\`) + " " + physical[i]
+		}
+		text = strings.TrimSpace(stripComment(text))
+		if text == "" {
+			continue
+		}
+		lines = append(lines, &logicalLine{num: num, text: text})
+	}
+	return lines
+}
+
+// stripComment removes a trailing comment from the line. A pound sign begins a
+// comment, unless it is followed by a number (a uid) or it is an include.
+func stripComment(s string) string {
+	if strings.HasPrefix(s, "#include") { // also #includedir
+		return s
+	}
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // skip the escaped char
+		case '"':
+			quoted = !quoted
+		case '#':
+			if quoted {
+				continue
+			}
+			if i+1 < len(s) && s[i+1] >= '0' && s[i+1] <= '9' {
+				continue // a uid
+			}
+			return s[:i]
+		}
+	}
+	return s
+}
+
+// parser is a simple recursive descent parser for a single logical line.
+type parser struct {
+	s       string
+	pos     int
+	line    int
+	aliases map[string]int
+}
+
+// errorf returns a new parse error for the current line.
+func (obj *parser) errorf(format string, v ...interface{}) error {
+	return &Error{
+		Line: obj.line,
+		Msg:  fmt.Sprintf(format, v...),
+	}
+}
+
+// skip moves past any whitespace.
+func (obj *parser) skip() {
+	for obj.pos < len(obj.s) && (obj.s[obj.pos] == ' ' || obj.s[obj.pos] == '\t') {
+		obj.pos++
+	}
+}
+
+// eof returns true if we're at the end of the line, ignoring whitespace.
+func (obj *parser) eof() bool {
+	obj.skip()
+	return obj.pos >= len(obj.s)
+}
+
+// peek returns the next non-whitespace char, or zero at the end of the line.
+func (obj *parser) peek() byte {
+	if obj.eof() {
+		return 0
+	}
+	return obj.s[obj.pos]
+}
+
+// accept consumes the char if it is next and returns true if it did so.
+func (obj *parser) accept(c byte) bool {
+	if obj.peek() != c {
+		return false
+	}
+	obj.pos++
+	return true
+}
+
+// expect consumes the char if it is next, and otherwise errors.
+func (obj *parser) expect(c byte) error {
+	if !obj.accept(c) {
+		if obj.eof() {
+			return obj.errorf("expected '%c' but found the end of the line", c)
+		}
+		return obj.errorf("expected '%c' at column %d", c, obj.pos+1)
+	}
+	return nil
+}
+
+// word reads the next word. It stops at whitespace or any of the special chars
+// unless they are escaped with a backslash. A double quoted string is a word.
+func (obj *parser) word() (string, error) {
+	obj.skip()
+	if obj.pos < len(obj.s) && obj.s[obj.pos] == '"' {
+		end := strings.IndexByte(obj.s[obj.pos+1:], '"')
+		if end < 0 {
+			return "", obj.errorf("unterminated quote")
+		}
+		w := obj.s[obj.pos+1 : obj.pos+1+end]
+		obj.pos += end + 2
+		return w, nil
+	}
+
+	b := &strings.Builder{}
+	for obj.pos < len(obj.s) {
+		c := obj.s[obj.pos]
+		if c == '\\' {
+			if obj.pos+1 >= len(obj.s) {
+				return "", obj.errorf("trailing backslash")
+			}
+			b.WriteByte(obj.s[obj.pos+1])
+			obj.pos += 2
+			continue
+		}
+		if strings.IndexByte(" \t,:=()!", c) >= 0 {
+			break
+		}
+		b.WriteByte(c)
+		obj.pos++
+	}
+	return b.String(), nil
+}
+
+// token reads the next run of chars up to whitespace or a comma, without any
+// special handling. This is used for values which may contain special chars.
+func (obj *parser) token() string {
+	start := obj.pos
+	for obj.pos < len(obj.s) && strings.IndexByte(" \t,", obj.s[obj.pos]) < 0 {
+		obj.pos++
+	}
+	return obj.s[start:obj.pos]
+}
+
+// parse parses the whole line.
+func (obj *parser) parse() error {
+	start := obj.pos
+	w, err := obj.word()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case w == "#include" || w == "@include" || w == "#includedir" || w == "@includedir":
+		p, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if p == "" || !obj.eof() {
+			return obj.errorf("%s expects a single path", w)
+		}
+		return nil
+
+	case aliasTypes[w]:
+		return obj.parseAlias(w)
+
+	case w == "Defaults" || strings.HasPrefix(w, "Defaults@"):
+		// Defaults:user and Defaults!cmnd are split for us, since the
+		// word ends at the binding char.
+		return obj.parseDefaults()
+
+	case strings.HasPrefix(w, "Defaults>"):
+		obj.pos = start + len("Defaults")
+		return obj.parseDefaults()
+
+	case strings.HasPrefix(w, "Defaults"):
+		return obj.errorf("unknown defaults type: %s", w)
+
+	case w == "" && obj.peek() != '!' && obj.peek() != '%' && obj.peek() != '#':
+		return obj.errorf("unexpected character at column %d", obj.pos+1)
+	}
+
+	obj.pos = start // it's a user spec, so parse from the start
+	return obj.parseUserSpec()
+}
+
+// parseAlias parses an alias definition. The keyword is already consumed.
+func (obj *parser) parseAlias(typ string) error {
+	for {
+		name, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if !aliasNameRegexp.MatchString(name) {
+			return obj.errorf("invalid %s name: %s", typ, name)
+		}
+		if name == "ALL" {
+			return obj.errorf("the %s name can't be ALL", typ)
+		}
+		if line, exists := obj.aliases[name]; exists {
+			return obj.errorf("alias %s was already defined on line %d", name, line)
+		}
+		obj.aliases[name] = obj.line
+
+		if err := obj.expect('='); err != nil {
+			return err
+		}
+
+		var f func() error
+		switch typ {
+		case "User_Alias", "Runas_Alias":
+			f = obj.parseUser
+		case "Host_Alias":
+			f = obj.parseHost
+		default:
+			f = func() error { return obj.parseCmnd(true) }
+		}
+		if err := obj.list(f); err != nil {
+			return err
+		}
+
+		if obj.eof() {
+			return nil
+		}
+		if err := obj.expect(':'); err != nil {
+			return err
+		}
+	}
+}
+
+// parseDefaults parses a defaults line. The keyword is already consumed.
+func (obj *parser) parseDefaults() error {
+	// binding, eg: Defaults:user or Defaults>root or Defaults!/bin/ls
+	if obj.pos < len(obj.s) {
+		switch obj.s[obj.pos] {
+		case ':', '>':
+			obj.pos++
+			if err := obj.list(obj.parseUser); err != nil {
+				return err
+			}
+		case '!':
+			// the first whitespace ends the binding, so no args here
+			obj.pos++
+			if err := obj.list(func() error { return obj.parseCmnd(false) }); err != nil {
+				return err
+			}
+		}
+	}
+
+	if obj.eof() {
+		return obj.errorf("missing defaults parameters")
+	}
+
+	return obj.list(func() error {
+		negated := false
+		for obj.accept('!') {
+			negated = !negated
+		}
+		name, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if !defaultNameRegexp.MatchString(name) {
+			return obj.errorf("invalid defaults parameter: %s", name)
+		}
+
+		obj.skip()
+		op := ""
+		for _, x := range []string{"+=", "-=", "="} {
+			if strings.HasPrefix(obj.s[obj.pos:], x) {
+				op = x
+				obj.pos += len(x)
+				break
+			}
+		}
+		if op == "" {
+			return nil // a boolean flag
+		}
+		if negated {
+			return obj.errorf("negated defaults parameter %s can't have a value", name)
+		}
+		value, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if value == "" {
+			return obj.errorf("missing value for defaults parameter: %s", name)
+		}
+		return nil
+	})
+}
+
+// parseUserSpec parses a user specification line.
+func (obj *parser) parseUserSpec() error {
+	if err := obj.list(obj.parseUser); err != nil {
+		return err
+	}
+	for {
+		if err := obj.list(obj.parseHost); err != nil {
+			return err
+		}
+		if err := obj.expect('='); err != nil {
+			return err
+		}
+		if err := obj.list(obj.parseCmndSpec); err != nil {
+			return err
+		}
+		if obj.eof() {
+			return nil
+		}
+		if err := obj.expect(':'); err != nil {
+			return err
+		}
+	}
+}
+
+// list parses a comma separated list of items with the parse function.
+func (obj *parser) list(f func() error) error {
+	for {
+		if obj.eof() {
+			return obj.errorf("expected a list item but found the end of the line")
+		}
+		if err := f(); err != nil {
+			return err
+		}
+		if !obj.accept(',') {
+			return nil
+		}
+	}
+}
+
+// parseUser parses a single user or group in a user list.
+func (obj *parser) parseUser() error {
+	for obj.accept('!') {
+	}
+	if obj.accept('%') {
+		obj.accept(':') // non-unix group
+		if obj.accept('#') {
+			return obj.parseNumber("gid")
+		}
+		g, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if !userRegexp.MatchString(g) {
+			return obj.errorf("invalid group name: %q", g)
+		}
+		return nil
+	}
+	if obj.accept('#') {
+		return obj.parseNumber("uid")
+	}
+	if obj.accept('+') {
+		n, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if !userRegexp.MatchString(n) {
+			return obj.errorf("invalid netgroup name: %q", n)
+		}
+		return nil
+	}
+
+	u, err := obj.word()
+	if err != nil {
+		return err
+	}
+	if u == "ALL" || aliasNameRegexp.MatchString(u) {
+		return nil
+	}
+	if !userRegexp.MatchString(u) {
+		return obj.errorf("invalid user name: %q", u)
+	}
+	return nil
+}
+
+// parseNumber parses a uid or gid.
+func (obj *parser) parseNumber(what string) error {
+	n, err := obj.word()
+	if err != nil {
+		return err
+	}
+	if !numberRegexp.MatchString(n) {
+		return obj.errorf("invalid %s: %q", what, n)
+	}
+	return nil
+}
+
+// parseHost parses a single host in a host list.
+func (obj *parser) parseHost() error {
+	for obj.accept('!') {
+	}
+	obj.accept('+') // netgroup
+
+	obj.skip()
+	// we can't use word here, since ipv6 addresses contain colons
+	start := obj.pos
+	for obj.pos < len(obj.s) && strings.IndexByte(" \t,=()!", obj.s[obj.pos]) < 0 {
+		obj.pos++
+	}
+	h := obj.s[start:obj.pos]
+	if h == "ALL" || aliasNameRegexp.MatchString(h) {
+		return nil
+	}
+	if !hostRegexp.MatchString(h) {
+		return obj.errorf("invalid host: %q", h)
+	}
+	return nil
+}
+
+// parseCmndSpec parses a command with its optional runas, options and tags.
+func (obj *parser) parseCmndSpec() error {
+	if obj.accept('(') {
+		if obj.peek() != ':' && obj.peek() != ')' {
+			if err := obj.list(obj.parseUser); err != nil {
+				return err
+			}
+		}
+		if obj.accept(':') {
+			if err := obj.list(obj.parseUser); err != nil {
+				return err
+			}
+		}
+		if err := obj.expect(')'); err != nil {
+			return err
+		}
+	}
+
+	for { // options and tags
+		obj.skip()
+		start := obj.pos
+		w, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if options[w] && obj.accept('=') {
+			v, err := obj.word()
+			if err != nil {
+				return err
+			}
+			if v == "" {
+				return obj.errorf("missing value for option: %s", w)
+			}
+			continue
+		}
+		if Tags[w] && obj.accept(':') {
+			continue
+		}
+		if digests[w] && obj.accept(':') {
+			obj.skip()
+			d := obj.token()
+			if !digestRegexp.MatchString(d) {
+				return obj.errorf("invalid %s digest", w)
+			}
+			continue
+		}
+		obj.pos = start // it's the command
+		break
+	}
+
+	return obj.parseCmnd(true)
+}
+
+// parseCmnd parses a single command. If args is true, then the command can be
+// followed by arguments which go until an unescaped comma or colon.
+func (obj *parser) parseCmnd(args bool) error {
+	for obj.accept('!') {
+	}
+	c, err := obj.word()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c == "ALL" || aliasNameRegexp.MatchString(c):
+		return nil
+
+	case c == "sudoedit":
+		if !args {
+			return nil
+		}
+		return obj.parseArgs(true)
+
+	case strings.HasPrefix(c, "/"):
+		if strings.HasSuffix(c, "/") { // a directory
+			return nil
+		}
+		if !args {
+			return nil
+		}
+		return obj.parseArgs(false)
+
+	case c == "":
+		return obj.errorf("missing command at column %d", obj.pos+1)
+	}
+
+	return obj.errorf("command must be a fully qualified path: %q", c)
+}
+
+// parseArgs skips over the command arguments. Special chars must be escaped. If
+// the paths flag is true, each argument must be a fully qualified path.
+func (obj *parser) parseArgs(paths bool) error {
+	count := 0
+	for {
+		obj.skip()
+		if obj.pos >= len(obj.s) || obj.s[obj.pos] == ',' || obj.s[obj.pos] == ':' {
+			break
+		}
+		if obj.s[obj.pos] == '=' || obj.s[obj.pos] == '(' || obj.s[obj.pos] == ')' {
+			return obj.errorf("unescaped '%c' in command arguments", obj.s[obj.pos])
+		}
+		if strings.HasPrefix(obj.s[obj.pos:], `""`) { // no args allowed
+			obj.pos += 2
+			count++
+			continue
+		}
+		if obj.s[obj.pos] == '!' { // only special at the start of a cmnd
+			obj.pos++
+			continue
+		}
+		a, err := obj.word()
+		if err != nil {
+			return err
+		}
+		if paths && !strings.HasPrefix(a, "/") {
+			return obj.errorf("sudoedit expects a fully qualified path: %q", a)
+		}
+		count++
+	}
+	if paths && count == 0 {
+		return obj.errorf("sudoedit expects a path")
+	}
+	return nil
+}
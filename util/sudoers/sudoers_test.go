@@ -0,0 +1,124 @@
+// Mgmt
+// Copyright (C) James Shubin and the project contributors
+// Written by James Shubin <james@shubin.ca> and the project contributors
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <https://www.gnu.org/licenses/>.
+//
+// Additional permission under GNU GPL version 3 section 7
+//
+// If you modify this program, or any covered work, by linking or combining it
+// with embedded mcl code and modules (and that the embedded mcl code and
+// modules which link with this program, contain a copy of their source code in
+// the authoritative form) containing parts covered by the terms of any other
+// license, the licensors of this program grant you additional permission to
+// convey the resulting work. Furthermore, the licensors of this program grant
+// the original author, James Shubin, additional permission to update this
+// additional permission if he deems it necessary to achieve the goals of this
+// additional permission.
+
+//go:build !root
+
+package sudoers
+
+import (
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	valid := []string{
+		``,
+		`# just a comment`,
+		`root ALL=(ALL:ALL) ALL`,
+		`%wheel ALL=(ALL) NOPASSWD: ALL`,
+		`%admin ALL=(ALL) ALL # trailing comment`,
+		`#1000 ALL=(ALL) ALL`,
+		`james ALL=(root) NOPASSWD: /usr/bin/systemctl restart nginx, /usr/bin/journalctl`,
+		`james ALL=(:adm) /usr/bin/tail -f /var/log/messages`,
+		`james host1,192.168.1.0/24 = (www-data) NOPASSWD:SETENV: /usr/bin/make`,
+		`james ALL=(ALL) !/usr/bin/su, /usr/bin/`,
+		`james ALL=/usr/bin/ls "", sudoedit /etc/hosts`,
+		`james ALL=/usr/bin/ls : otherhost = /usr/bin/cat`,
+		`james ALL=CWD=/tmp TIMEOUT=30 /usr/bin/make`,
+		`james ALL=sha256:d3Jvbmc= /usr/bin/ls`,
+		`james ALL=/usr/bin/printf a\,b\:c\=d`,
+		"james ALL=(ALL) \\\n\tNOPASSWD: /usr/bin/ls",
+		`Defaults env_reset`,
+		`Defaults !lecture, passwd_tries=3, secure_path="/usr/sbin:/usr/bin"`,
+		`Defaults:james !requiretty`,
+		`Defaults>root !set_logname`,
+		`Defaults!/usr/bin/ls noexec`,
+		`Defaults@host1 log_output`,
+		`Defaults env_keep += "HOME EDITOR"`,
+		`User_Alias ADMINS = james, %wheel`,
+		`Cmnd_Alias SERVICES = /usr/bin/systemctl start, /usr/bin/systemctl stop : LS = /usr/bin/ls`,
+		"Host_Alias SERVERS = 10.0.0.1, ::1\nADMINS2 SERVERS = ALL",
+		`@includedir /etc/sudoers.d`,
+		`#includedir /etc/sudoers.d`,
+	}
+	for index, s := range valid {
+		if err := Check(s); err != nil {
+			t.Errorf("index: %d, unexpected error: %+v", index, err)
+			t.Errorf("index: %d, input: %q", index, s)
+		}
+	}
+
+	invalid := []string{
+		`root`,
+		`root ALL`,
+		`root ALL=`,
+		`root ALL=ls`,
+		`root ALL=(ALL ALL`,
+		`root ALL=(ALL) NOPASSWD ALL`,
+		`root ALL=(ALL) ALL,`,
+		`root ALL=/usr/bin/ls a=b`,
+		`root ALL=sudoedit`,
+		`root ALL=sudoedit hosts`,
+		`root ALL=sha256:!! /usr/bin/ls`,
+		`root ALL=CWD= /usr/bin/ls`,
+		`ro$ot ALL=ALL`,
+		`Defaults`,
+		`Defaults FOO`,
+		`Defaults !foo=bar`,
+		`Defaults foo=`,
+		`Defaultz foo`,
+		`User_Alias admins = james`,
+		`User_Alias ALL = james`,
+		`User_Alias ADMINS james`,
+		"User_Alias ADMINS = james\nUser_Alias ADMINS = root",
+		`@include`,
+		`root ALL="/usr/bin/ls`,
+	}
+	for index, s := range invalid {
+		if err := Check(s); err == nil {
+			t.Errorf("index: %d, expected error for input: %q", index, s)
+		}
+	}
+}
+
+func TestCheckLine(t *testing.T) {
+	s := "# header\n\nroot ALL=(ALL) ALL\njames ALL=\\\n\tls\n"
+	err := Check(s)
+	if err == nil {
+		t.Errorf("expected error")
+		return
+	}
+	e, ok := err.(*Error)
+	if !ok {
+		t.Errorf("unexpected error type: %T", err)
+		return
+	}
+	if e.Line != 4 {
+		t.Errorf("expected line 4, got: %d", e.Line)
+	}
+}